@@ -0,0 +1,135 @@
+package sherlog
+
+import (
+	"math/rand"
+	"sync/atomic"
+)
+
+const (
+	defaultShedAbove    = 0.8
+	defaultRestoreBelow = 0.5
+)
+
+/*
+AdaptiveSamplingPolicy configures an AdaptiveSampler.
+*/
+type AdaptiveSamplingPolicy struct {
+	// Source is what the pressure is read from, such as an HTTPShipper or a PolyLogger. Required.
+	Source Pressurer
+
+	// MinRates maps a level to the fraction (0 to 1) of its entries that are kept when the pressure is 1.
+	// Levels that aren't in MinRates, and entries without a level, are always kept. Defaults to keeping 10% of
+	// INFO and none of DEBUG.
+	MinRates map[Level]float64
+
+	// AlwaysKeep is the least severe level that is never sampled. Defaults to EnumError.
+	AlwaysKeep Level
+
+	// ShedAbove is the pressure that turns sampling on. Defaults to 0.8.
+	ShedAbove float64
+
+	// RestoreBelow is the pressure that turns sampling back off. It is lower than ShedAbove so that pressure
+	// hovering around one value doesn't flip sampling on and off for every entry. Defaults to 0.5.
+	RestoreBelow float64
+}
+
+/*
+AdaptiveSampler is a Middleware that only samples entries while the pipeline is falling behind. Once the pressure of
+Source reaches ShedAbove it starts dropping entries at the levels in MinRates, more of them the closer the pressure
+gets to 1, and it keeps doing so until the pressure falls to RestoreBelow:
+
+	sampler := sherlog.NewAdaptiveSampler(sherlog.AdaptiveSamplingPolicy{Source: shipper})
+	shipper.Use(sampler.Sample)
+
+Starting and stopping are reported to the diagnostics logger (see SetDiagnosticsLogger). When Log is given multiple
+errors, the first one decides whether they get kept. Is thread safe :)
+*/
+type AdaptiveSampler struct {
+	policy   AdaptiveSamplingPolicy
+	shedding int32
+}
+
+/*
+NewAdaptiveSampler returns a new AdaptiveSampler that follows policy. Fills in the defaults of policy.
+*/
+func NewAdaptiveSampler(policy AdaptiveSamplingPolicy) *AdaptiveSampler {
+	if policy.MinRates == nil {
+		policy.MinRates = map[Level]float64{EnumInfo: 0.1, EnumDebug: 0}
+	}
+	if policy.AlwaysKeep == nil {
+		policy.AlwaysKeep = EnumError
+	}
+	if policy.ShedAbove <= 0 {
+		policy.ShedAbove = defaultShedAbove
+	}
+	if policy.RestoreBelow <= 0 || policy.RestoreBelow > policy.ShedAbove {
+		policy.RestoreBelow = defaultRestoreBelow
+		if policy.RestoreBelow > policy.ShedAbove {
+			policy.RestoreBelow = policy.ShedAbove
+		}
+	}
+	return &AdaptiveSampler{policy: policy}
+}
+
+/*
+Sample is the Middleware. Pass it to Use.
+*/
+func (as *AdaptiveSampler) Sample(next LogFunc) LogFunc {
+	return func(values ...interface{}) error {
+		if len(values) > 0 && !as.keeps(values[0]) {
+			return nil
+		}
+		return next(values...)
+	}
+}
+
+/*
+Shedding returns true while entries are being sampled.
+*/
+func (as *AdaptiveSampler) Shedding() bool {
+	return atomic.LoadInt32(&as.shedding) == 1
+}
+
+/*
+keeps updates whether entries are being sampled and then randomly decides whether toLog should be kept.
+*/
+func (as *AdaptiveSampler) keeps(toLog interface{}) bool {
+	err, isErr := toLog.(error)
+	if !isErr {
+		return true
+	}
+	level := LevelOf(err)
+	if level == nil || level.GetLevelId() <= as.policy.AlwaysKeep.GetLevelId() {
+		return true
+	}
+	minRate, hasRate := as.policy.MinRates[level]
+	if !hasRate || minRate >= 1 {
+		return true
+	}
+
+	pressure := as.policy.Source.Pressure()
+	switch {
+	case pressure >= as.policy.ShedAbove && atomic.CompareAndSwapInt32(&as.shedding, 0, 1):
+		diagnose(NewWarning("logging is falling behind, sampling entries until it catches up"))
+	case pressure <= as.policy.RestoreBelow && atomic.CompareAndSwapInt32(&as.shedding, 1, 0):
+		diagnose(NewInfo("logging caught up, stopped sampling entries"))
+	}
+	if !as.Shedding() {
+		return true
+	}
+	return rand.Float64() < as.rateAt(pressure, minRate)
+}
+
+/*
+rateAt returns the fraction of entries to keep at pressure. It falls from 1 at RestoreBelow to minRate at 1.
+*/
+func (as *AdaptiveSampler) rateAt(pressure, minRate float64) float64 {
+	if pressure >= 1 {
+		return minRate
+	}
+	severity := (pressure - as.policy.RestoreBelow) / (1 - as.policy.RestoreBelow)
+	if severity <= 0 {
+		return 1
+	}
+	return 1 - (1-minRate)*severity
+}
@@ -0,0 +1,61 @@
+package sherlog
+
+/*
+Check logs err with level CRITICAL just like logger.Critical if it isn't nil, for errors that should never
+happen. Returns true if err is nil, so the failure can still be handled:
+
+	if !sherlog.Check(logger, json.Unmarshal(defaults, &config)) {
+		return
+	}
+
+Panics with the logged exception after logging it if PanicOnFailedAssertion is on.
+*/
+func Check(logger Logger, err error) bool {
+	if err == nil {
+		return true
+	}
+	failAssertion(logger, GraduateWithSkip(EnumCritical, 0, err))
+	return false
+}
+
+/*
+Must returns value if err is nil. Otherwise, it logs err with level CRITICAL just like logger.Critical and panics
+with the logged exception, no matter what PanicOnFailedAssertion is set to, since there is no value to return.
+Use it for setup that the program can't run without:
+
+	templates := sherlog.Must(logger, template.ParseFiles("index.html")).(*template.Template)
+*/
+func Must(logger Logger, value interface{}, err error) interface{} {
+	if err == nil {
+		return value
+	}
+	exception := GraduateWithSkip(EnumCritical, 0, err)
+	logger.Log(exception)
+	panic(exception)
+}
+
+/*
+Assert logs values with level CRITICAL just like logger.Critical if cond is false, and does nothing if it is
+true. The values are only turned into an exception when cond is false, so it is cheap to call:
+
+	sherlog.Assert(logger, len(batch) <= maxBatchSize, "batch of ", len(batch), " is too big")
+
+Returns cond. Panics with the logged exception after logging it if PanicOnFailedAssertion is on.
+*/
+func Assert(logger Logger, cond bool, values ...interface{}) bool {
+	if cond {
+		return true
+	}
+	failAssertion(logger, GraduateWithSkip(EnumCritical, 0, values...))
+	return false
+}
+
+/*
+failAssertion logs exception with logger and panics with it if PanicOnFailedAssertion is on.
+*/
+func failAssertion(logger Logger, exception error) {
+	logger.Log(exception)
+	if PanicOnFailedAssertion {
+		panic(exception)
+	}
+}
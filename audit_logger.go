@@ -0,0 +1,273 @@
+package sherlog
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"io/ioutil"
+	"os"
+	"regexp"
+	"strconv"
+	"sync"
+)
+
+const auditFilePerms = 0600
+
+/*
+auditTrailerRegex matches the line that ends every audit record.
+*/
+var auditTrailerRegex = regexp.MustCompile(`\naudit #(\d+) sha256:([0-9a-f]{64})\n\n`)
+
+/*
+auditTrailerStart is how a trailer starts, and escapedAuditTrailerStart is what writeRecord replaces it with inside
+a record so that the record can't contain something that looks like a trailer.
+*/
+var (
+	auditTrailerStart        = []byte("\naudit #")
+	escapedAuditTrailerStart = []byte("\n\\audit #")
+)
+
+/*
+AuditLogger writes a tamper evident audit log for compliance. Compared to a FileLogger, it:
+
+  - Only ever appends to its file, which is only readable and writable by the owner (0600).
+    It never rolls or deletes anything, and only truncates it to cut off a record that a crash left half written.
+  - Stamps every record with its own sequence number, so missing records can be detected.
+  - Chains records together with sha256 hashes. Each record's hash covers the record and the hash of the
+    record before it, so changing or deleting a record breaks every hash after it. Use VerifyAuditLog to check.
+  - Rejects LogNoStack, since audit records must be complete.
+
+Every record is followed by a trailer line:
+
+	2018-10-03 07:51:14 - INFO - user 42 changed their password:
+		main.changePassword(main.go:18)
+	audit #1 sha256:9f86d081884c7d659a2feaa0c55ad015a3bf4f1b2b0b822cd15d6c15b0f00a08
+
+Lines of a record that start like a trailer get a backslash in front of them (\audit #...), even if SanitizeText
+is off, so that a message can't forge one. Reopening an existing audit log continues its chain, after cutting off
+any incomplete record at its end so that the next record can't be mistaken for part of it. Is thread safe :)
+*/
+type AuditLogger struct {
+	callerSkipper
+	middlewareChain
+	logFilePath string
+	file        *os.File
+	mutex       *sync.Mutex
+	sequence    uint64
+	lastHash    string
+}
+
+/*
+NewAuditLogger creates a new AuditLogger that appends to logFilePath. If the file already exists, its hash chain
+is verified and continued, and an incomplete record at its end is cut off. Returns an error if the existing chain
+is broken.
+*/
+func NewAuditLogger(logFilePath string) (*AuditLogger, error) {
+	sequence, lastHash, end, err := readAuditChain(logFilePath)
+	if err != nil && !os.IsNotExist(err) {
+		return nil, AsError(err)
+	}
+	file, err := os.OpenFile(logFilePath, os.O_APPEND|os.O_CREATE|os.O_WRONLY, auditFilePerms)
+	if err != nil {
+		return nil, AsError(err)
+	}
+	if err = file.Chmod(auditFilePerms); err != nil {
+		file.Close()
+		return nil, AsError(err)
+	}
+	if err = file.Truncate(int64(end)); err != nil {
+		file.Close()
+		return nil, AsError(err)
+	}
+	return &AuditLogger{
+		logFilePath: logFilePath,
+		file:        file,
+		mutex:       new(sync.Mutex),
+		sequence:    sequence,
+		lastHash:    lastHash,
+	}, nil
+}
+
+/*
+VerifyAuditLog checks the hash chain and sequence numbers of the audit log at logFilePath. Returns nil if no
+record was changed, removed, or reordered, and an error describing the first problem otherwise.
+*/
+func VerifyAuditLog(logFilePath string) error {
+	content, err := ioutil.ReadFile(logFilePath)
+	if err != nil {
+		return AsError(err)
+	}
+	_, _, end, err := walkAuditChain(content)
+	if err != nil {
+		return err
+	}
+	if end != len(content) {
+		return AsError("audit log ends with an incomplete record")
+	}
+	return nil
+}
+
+/*
+readAuditChain returns the sequence number and hash of the last record in logFilePath, and where it ends. An
+incomplete record at the end of the file (from a crash in the middle of a write) is ignored.
+*/
+func readAuditChain(logFilePath string) (uint64, string, int, error) {
+	content, err := ioutil.ReadFile(logFilePath)
+	if err != nil {
+		return 0, "", 0, err
+	}
+	return walkAuditChain(content)
+}
+
+/*
+walkAuditChain checks every complete record in content. Returns the sequence number and hash of the last one,
+and where it ends.
+*/
+func walkAuditChain(content []byte) (sequence uint64, lastHash string, end int, err error) {
+	for _, match := range auditTrailerRegex.FindAllSubmatchIndex(content, -1) {
+		recordSequence, _ := strconv.ParseUint(string(content[match[2]:match[3]]), 10, 64)
+		if recordSequence != sequence+1 {
+			return 0, "", 0, AsError("audit record #" + strconv.FormatUint(recordSequence, 10) + " should be #" + strconv.FormatUint(sequence+1, 10))
+		}
+		hash := auditHash(lastHash, recordSequence, content[end:match[0]])
+		if hash != string(content[match[4]:match[5]]) {
+			return 0, "", 0, AsError("audit record #" + strconv.FormatUint(recordSequence, 10) + " does not match its hash")
+		}
+		sequence, lastHash, end = recordSequence, hash, match[1]
+	}
+	return sequence, lastHash, end, nil
+}
+
+/*
+auditHash returns the hex encoded sha256 hash of a record.
+*/
+func auditHash(previousHash string, sequence uint64, record []byte) string {
+	hash := sha256.New()
+	hash.Write([]byte(previousHash + "\n" + strconv.FormatUint(sequence, 10) + "\n"))
+	hash.Write(record)
+	return hex.EncodeToString(hash.Sum(nil))
+}
+
+/*
+Log writes errorsToLog as a single audit record. Is thread safe :)
+*/
+func (al *AuditLogger) Log(errorsToLog ...interface{}) error {
+	return al.through(al.logValues, errorsToLog)
+}
+
+func (al *AuditLogger) logValues(errorsToLog ...interface{}) error {
+	if len(errorsToLog) < 1 {
+		return AsError("no parameters provided to Log")
+	}
+	var buf bytes.Buffer
+	if err := writeValues(&buf, errorsToLog); err != nil {
+		return err
+	}
+	return al.writeRecord(buf.Bytes())
+}
+
+/*
+LogNoStack always returns an error (unless errToLog is nil), since audit records must be complete. Use Log instead.
+*/
+func (al *AuditLogger) LogNoStack(errToLog error) error {
+	if isNil(errToLog) {
+		return nil
+	}
+	return AsError("AuditLogger does not allow LogNoStack since audit records must be complete")
+}
+
+/*
+LogJson writes errToLog as a json audit record. Stack traces are always included. Is thread safe :)
+*/
+func (al *AuditLogger) LogJson(errToLog error) error {
+	return al.throughWithError(al.logJson, errToLog)
+}
+
+func (al *AuditLogger) logJson(errToLog error) error {
+	if errToLog == nil {
+		return AsError("tried to log nil error")
+	}
+	jsonBytes, err := marshalJsonEntry(NewEntry(errToLog).ToJsonMap(), false)
+	if err != nil {
+		return AsError(err)
+	}
+	return al.writeRecord(jsonBytes)
+}
+
+/*
+writeRecord stamps record with the next sequence number and hash, appends it to the file, and syncs the file.
+*/
+func (al *AuditLogger) writeRecord(record []byte) error {
+	record = bytes.Replace(record, auditTrailerStart, escapedAuditTrailerStart, -1)
+	al.mutex.Lock()
+	defer al.mutex.Unlock()
+	sequence := al.sequence + 1
+	hash := auditHash(al.lastHash, sequence, record)
+
+	var buf bytes.Buffer
+	buf.Write(record)
+	buf.WriteString("\naudit #" + strconv.FormatUint(sequence, 10) + " sha256:" + hash + "\n\n")
+	if _, err := al.file.Write(buf.Bytes()); err != nil {
+		return AsError(err)
+	}
+	if err := al.file.Sync(); err != nil {
+		return AsError(err)
+	}
+	al.sequence, al.lastHash = sequence, hash
+	return nil
+}
+
+/*
+Close closes the file.
+*/
+func (al *AuditLogger) Close() {
+	al.file.Close()
+}
+
+/*
+Critical turns values into a *LeveledException with level CRITICAL and then calls the logger's
+Log function.
+*/
+func (al *AuditLogger) Critical(values ...interface{}) error {
+	return al.Log(al.graduate(EnumCritical, values...))
+}
+
+/*
+Error turns values into a *LeveledException with level ERROR and then calls the logger's
+Log function.
+*/
+func (al *AuditLogger) Error(values ...interface{}) error {
+	return al.Log(al.graduate(EnumError, values...))
+}
+
+/*
+OpsError turns values into a *LeveledException with level OPS_ERROR and then calls the logger's
+Log function.
+*/
+func (al *AuditLogger) OpsError(values ...interface{}) error {
+	return al.Log(al.graduate(EnumOpsError, values...))
+}
+
+/*
+Warn turns values into a *LeveledException with level WARNING and then calls the logger's
+Log function.
+*/
+func (al *AuditLogger) Warn(values ...interface{}) error {
+	return al.Log(al.graduate(EnumWarning, values...))
+}
+
+/*
+Info turns values into a *LeveledException with level INFO and then calls the logger's
+Log function.
+*/
+func (al *AuditLogger) Info(values ...interface{}) error {
+	return al.Log(al.graduate(EnumInfo, values...))
+}
+
+/*
+Debug turns values into a *LeveledException with level DEBUG and then calls the logger's
+Log function.
+*/
+func (al *AuditLogger) Debug(values ...interface{}) error {
+	return al.Log(al.graduate(EnumDebug, values...))
+}
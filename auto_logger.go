@@ -0,0 +1,35 @@
+package sherlog
+
+import (
+	"os"
+	"strings"
+)
+
+/*
+AutoFormatEnvVar is the environment variable that overrides the format NewAutoLogger picks. Set it to "text" for
+the colored human format (colors are still left out if NO_COLOR is set) or "json" for single line json.
+*/
+const AutoFormatEnvVar = "SHERLOG_FORMAT"
+
+/*
+NewAutoLogger returns a logger for stdout that suits where the program is running, so that the same binary does
+the right thing in development and in production. When stdout is a terminal, it returns a ConsoleLogger that
+writes the colored human format. Otherwise (piped, redirected, or running in a container), it returns a
+K8sLogger that writes one json entry per line. Set SHERLOG_FORMAT to "text" or "json" to pick one yourself.
+*/
+func NewAutoLogger() Logger {
+	return newAutoLogger(os.Stdout, os.Stderr)
+}
+
+func newAutoLogger(stdout, stderr *os.File) Logger {
+	switch strings.ToLower(os.Getenv(AutoFormatEnvVar)) {
+	case "text":
+		return newConsoleLogger(stdout, stderr)
+	case "json":
+		return newK8sLogger(stdout)
+	}
+	if isTerminal(stdout) {
+		return newConsoleLogger(stdout, stderr)
+	}
+	return newK8sLogger(stdout)
+}
@@ -0,0 +1,35 @@
+package sherlog
+
+/*
+Pressurer is implemented by loggers that queue entries before writing them. Pressure returns how close the logger
+is to making callers wait, from 0 (nothing is queued) to 1 (the next Log call will block until entries are
+written). It never blocks, so it is cheap enough to check before every DEBUG or INFO entry:
+
+	if sherlog.PressureOf(logger) < 0.8 {
+		logger.Debug("cache miss for ", key)
+	}
+*/
+type Pressurer interface {
+	Pressure() float64
+}
+
+/*
+PressureOf returns logger's Pressure if it is a Pressurer, and 0 otherwise since loggers without a queue never
+fall behind in a way that shedding entries would help with.
+*/
+func PressureOf(logger Logger) float64 {
+	if pressurer, isPressurer := logger.(Pressurer); isPressurer {
+		return pressurer.Pressure()
+	}
+	return 0
+}
+
+/*
+QueueDepthOf returns logger's QueueDepth if it is a QueueDepther, and 0 otherwise.
+*/
+func QueueDepthOf(logger Logger) int {
+	if depther, isDepther := logger.(QueueDepther); isDepther {
+		return depther.QueueDepth()
+	}
+	return 0
+}
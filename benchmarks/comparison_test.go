@@ -0,0 +1,70 @@
+package benchmarks
+
+import (
+	"log"
+	"os"
+	"testing"
+
+	"github.com/Nick-Anderssohn/sherlog"
+	"github.com/rs/zerolog"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+)
+
+func openDevNull(b *testing.B) *os.File {
+	devNull, err := os.OpenFile(os.DevNull, os.O_WRONLY, 0)
+	if err != nil {
+		b.Fatal(err)
+	}
+	return devNull
+}
+
+func BenchmarkSherlog(b *testing.B) {
+	devNull := openDevNull(b)
+	defer devNull.Close()
+	logger := sherlog.NewMultiWriterLogger(devNull)
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if err := logger.LogJson(sherlog.NewError("benchmark message")); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkStdlibLog(b *testing.B) {
+	devNull := openDevNull(b)
+	defer devNull.Close()
+	logger := log.New(devNull, "", log.LstdFlags)
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		logger.Println(sherlog.NewError("benchmark message"))
+	}
+}
+
+func BenchmarkZap(b *testing.B) {
+	devNull := openDevNull(b)
+	defer devNull.Close()
+	logger := zap.New(zapcore.NewCore(
+		zapcore.NewJSONEncoder(zap.NewProductionEncoderConfig()),
+		zapcore.AddSync(devNull),
+		zap.DebugLevel,
+	), zap.AddStacktrace(zap.ErrorLevel))
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		logger.Error("benchmark message")
+	}
+}
+
+func BenchmarkZerolog(b *testing.B) {
+	devNull := openDevNull(b)
+	defer devNull.Close()
+	logger := zerolog.New(devNull).With().Timestamp().Logger()
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		logger.Error().Msg("benchmark message")
+	}
+}
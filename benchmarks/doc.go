@@ -0,0 +1,10 @@
+/*
+Package benchmarks compares sherlog against the standard library's log, zap, and zerolog. It is its own module so
+that sherlog itself doesn't depend on zap or zerolog. Run it from this directory:
+
+	go test -run XXX -bench . -benchmem
+
+Each iteration logs an error level message with a stack trace as json to /dev/null. zerolog can't capture a stack
+trace without github.com/pkg/errors, so it logs without one.
+*/
+package benchmarks
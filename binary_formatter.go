@@ -0,0 +1,152 @@
+package sherlog
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+)
+
+/*
+EntrySeparator can be implemented by a Formatter to control what a logger writes between entries.
+Loggers write a newline after each entry for formatters that don't implement it. Binary formats are
+self-delimiting, so their formatters return nil.
+*/
+type EntrySeparator interface {
+	Separator() []byte
+}
+
+/*
+separatorFor returns the bytes a logger should write after each entry formatted by formatter.
+*/
+func separatorFor(formatter Formatter) []byte {
+	if entrySeparator, ok := formatter.(EntrySeparator); ok {
+		return entrySeparator.Separator()
+	}
+	return []byte("\n")
+}
+
+/*
+binaryEncoder is implemented by the binary encodings. Each function appends the encoded value to buf.
+*/
+type binaryEncoder interface {
+	appendNil(buf []byte) []byte
+	appendBool(buf []byte, val bool) []byte
+	appendInt(buf []byte, val int64) []byte
+	appendUint(buf []byte, val uint64) []byte
+	appendFloat(buf []byte, val float64) []byte
+	appendString(buf []byte, val string) []byte
+	appendBytes(buf []byte, val []byte) []byte
+	appendArrayHeader(buf []byte, length int) []byte
+	appendMapHeader(buf []byte, length int) []byte
+}
+
+/*
+appendBinaryValue encodes val with encoder. Maps are written with their keys sorted so that the output is
+deterministic. Types that the encodings don't have are written as strings using fmt.Sprint.
+*/
+func appendBinaryValue(encoder binaryEncoder, buf []byte, val interface{}) []byte {
+	switch impl := val.(type) {
+	case nil:
+		return encoder.appendNil(buf)
+	case bool:
+		return encoder.appendBool(buf, impl)
+	case int:
+		return encoder.appendInt(buf, int64(impl))
+	case int8:
+		return encoder.appendInt(buf, int64(impl))
+	case int16:
+		return encoder.appendInt(buf, int64(impl))
+	case int32:
+		return encoder.appendInt(buf, int64(impl))
+	case int64:
+		return encoder.appendInt(buf, impl)
+	case uint:
+		return encoder.appendUint(buf, uint64(impl))
+	case uint8:
+		return encoder.appendUint(buf, uint64(impl))
+	case uint16:
+		return encoder.appendUint(buf, uint64(impl))
+	case uint32:
+		return encoder.appendUint(buf, uint64(impl))
+	case uint64:
+		return encoder.appendUint(buf, impl)
+	case float32:
+		return encoder.appendFloat(buf, float64(impl))
+	case float64:
+		return encoder.appendFloat(buf, impl)
+	case string:
+		return encoder.appendString(buf, impl)
+	case json.RawMessage:
+		var decoded interface{} // Sanitized field values that were already marshaled to json
+		if err := json.Unmarshal(impl, &decoded); err != nil {
+			return encoder.appendString(buf, string(impl))
+		}
+		return appendBinaryValue(encoder, buf, decoded)
+	case []byte:
+		return encoder.appendBytes(buf, impl)
+	case []interface{}:
+		buf = encoder.appendArrayHeader(buf, len(impl))
+		for _, elem := range impl {
+			buf = appendBinaryValue(encoder, buf, elem)
+		}
+		return buf
+	case []string:
+		buf = encoder.appendArrayHeader(buf, len(impl))
+		for _, elem := range impl {
+			buf = encoder.appendString(buf, elem)
+		}
+		return buf
+	case []map[string]interface{}:
+		buf = encoder.appendArrayHeader(buf, len(impl))
+		for _, elem := range impl {
+			buf = appendBinaryValue(encoder, buf, elem)
+		}
+		return buf
+	case []*StackTraceEntry:
+		buf = encoder.appendArrayHeader(buf, len(impl))
+		for _, elem := range impl {
+			buf = appendBinaryValue(encoder, buf, elem)
+		}
+		return buf
+	case *StackTraceEntry:
+		return appendBinaryValue(encoder, buf, map[string]interface{}{
+			"FunctionName": impl.FunctionName,
+			"File":         impl.renderedFile(),
+			"Line":         impl.Line,
+		})
+	case map[string]interface{}:
+		keys := make([]string, 0, len(impl))
+		for key := range impl {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+		buf = encoder.appendMapHeader(buf, len(impl))
+		for _, key := range keys {
+			buf = encoder.appendString(buf, key)
+			buf = appendBinaryValue(encoder, buf, impl[key])
+		}
+		return buf
+	}
+	return encoder.appendString(buf, fmt.Sprint(val))
+}
+
+/*
+formatBinary encodes the same map that JsonFormatter would marshal, including the schema envelope.
+*/
+func formatBinary(encoder binaryEncoder, entry *Entry, includeStackString bool, transformers []JsonTransformer) []byte {
+	jsonMap := entry.ToJsonMap()
+	removeStackRepresentations(jsonMap, includeStackString, true)
+	return appendBinaryValue(encoder, nil, toSchemaMap(jsonMap, CurrentJsonSchema, transformers...))
+}
+
+func appendUint16BE(buf []byte, val uint16) []byte {
+	return append(buf, byte(val>>8), byte(val))
+}
+
+func appendUint32BE(buf []byte, val uint32) []byte {
+	return append(buf, byte(val>>24), byte(val>>16), byte(val>>8), byte(val))
+}
+
+func appendUint64BE(buf []byte, val uint64) []byte {
+	return appendUint32BE(appendUint32BE(buf, uint32(val>>32)), uint32(val))
+}
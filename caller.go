@@ -0,0 +1,65 @@
+package sherlog
+
+import "strconv"
+
+/*
+callerSkipper is embedded in loggers to give them an adjustable number of extra stack frames to skip
+when their leveled functions (Critical, Error, etc.) create a new exception.
+*/
+type callerSkipper struct {
+	callerSkip int
+}
+
+/*
+SetCallerSkip sets how many extra stack frames are skipped when the leveled functions (Critical, Error, OpsError,
+Warn, Info, and Debug) create a new exception. Use it when you wrap the logger in your own helper functions so
+that the stack trace starts at the caller of your helper instead of inside of it. For example, if all of your
+logging goes through one helper function, use:
+
+	logger.SetCallerSkip(1)
+
+Defaults to 0.
+*/
+func (cs *callerSkipper) SetCallerSkip(skip int) {
+	cs.callerSkip = skip
+}
+
+/*
+graduate is what the leveled functions of loggers use instead of graduateOrConcatAndCreate so that the
+caller skip is applied. Must be called directly from the leveled function.
+*/
+func (cs *callerSkipper) graduate(level Level, values ...interface{}) error {
+	// Same as graduateOrConcatAndCreate: this function takes the place of the AsFoo function in the stack
+	return graduateOrConcatAndCreateWithPolicy(level, DefaultLevelPolicy, 8+cs.callerSkip, values...)
+}
+
+/*
+GraduateWithSkip is for the leveled functions of Logger implementations outside of this package. It works like
+the AsFoo functions, but the stack trace of a new exception starts skip frames above the caller of the function
+that called GraduateWithSkip, just like the leveled functions of sherlog's own loggers:
+
+	func (ml *MyLogger) Error(values ...interface{}) error {
+		return ml.Log(sherlog.GraduateWithSkip(sherlog.EnumError, ml.callerSkip, values...))
+	}
+
+Must be called directly from the leveled function.
+*/
+func GraduateWithSkip(level Level, skip int, values ...interface{}) error {
+	return graduateOrConcatAndCreateWithPolicy(level, DefaultLevelPolicy, 8+skip, values...)
+}
+
+/*
+callerOf returns the top frame of err's stack trace formatted as file:line.
+Returns an empty string if err does not have a stack trace.
+*/
+func callerOf(err error) string {
+	stackTraceWrapper, ok := err.(StackTraceWrapper)
+	if !ok {
+		return ""
+	}
+	stackTrace := stackTraceWrapper.GetStackTrace()
+	if len(stackTrace) == 0 {
+		return ""
+	}
+	return stackTrace[0].renderedFile() + ":" + strconv.Itoa(stackTrace[0].Line)
+}
@@ -0,0 +1,105 @@
+package sherlog
+
+import "math"
+
+/*
+CBORFormatter is a Formatter that writes entries as CBOR (RFC 7049). The entries hold the same keys as the
+json written by JsonFormatter, but are about 40% smaller. Entries are self-delimiting, so nothing is written
+between them. Use parser.CBORDecoder to read them back.
+*/
+type CBORFormatter struct {
+	IncludeStackString bool
+	Transformers       []JsonTransformer
+}
+
+/*
+NewCBORFormatter returns a new CBORFormatter.
+*/
+func NewCBORFormatter() *CBORFormatter {
+	return &CBORFormatter{}
+}
+
+/*
+Format turns entry into CBOR.
+*/
+func (cf *CBORFormatter) Format(entry *Entry) ([]byte, error) {
+	return formatBinary(cborEncoder{}, entry, cf.IncludeStackString, cf.Transformers), nil
+}
+
+/*
+Separator returns nil since CBOR values are self-delimiting.
+*/
+func (cf *CBORFormatter) Separator() []byte {
+	return nil
+}
+
+// CBOR major types
+const (
+	cborUnsigned byte = 0 << 5
+	cborNegative byte = 1 << 5
+	cborBytes    byte = 2 << 5
+	cborText     byte = 3 << 5
+	cborArray    byte = 4 << 5
+	cborMap      byte = 5 << 5
+)
+
+type cborEncoder struct{}
+
+/*
+appendHead writes the initial byte of a data item (and the following length/value bytes if needed).
+*/
+func (cborEncoder) appendHead(buf []byte, majorType byte, val uint64) []byte {
+	switch {
+	case val < 24:
+		return append(buf, majorType|byte(val))
+	case val <= math.MaxUint8:
+		return append(buf, majorType|24, byte(val))
+	case val <= math.MaxUint16:
+		return appendUint16BE(append(buf, majorType|25), uint16(val))
+	case val <= math.MaxUint32:
+		return appendUint32BE(append(buf, majorType|26), uint32(val))
+	}
+	return appendUint64BE(append(buf, majorType|27), val)
+}
+
+func (cborEncoder) appendNil(buf []byte) []byte {
+	return append(buf, 0xf6)
+}
+
+func (cborEncoder) appendBool(buf []byte, val bool) []byte {
+	if val {
+		return append(buf, 0xf5)
+	}
+	return append(buf, 0xf4)
+}
+
+func (ce cborEncoder) appendInt(buf []byte, val int64) []byte {
+	if val >= 0 {
+		return ce.appendHead(buf, cborUnsigned, uint64(val))
+	}
+	return ce.appendHead(buf, cborNegative, uint64(-1-val))
+}
+
+func (ce cborEncoder) appendUint(buf []byte, val uint64) []byte {
+	return ce.appendHead(buf, cborUnsigned, val)
+}
+
+func (cborEncoder) appendFloat(buf []byte, val float64) []byte {
+	return appendUint64BE(append(buf, 0xfb), math.Float64bits(val))
+}
+
+func (ce cborEncoder) appendString(buf []byte, val string) []byte {
+	return append(ce.appendHead(buf, cborText, uint64(len(val))), val...)
+}
+
+func (ce cborEncoder) appendBytes(buf []byte, val []byte) []byte {
+	return append(ce.appendHead(buf, cborBytes, uint64(len(val))), val...)
+}
+
+func (ce cborEncoder) appendArrayHeader(buf []byte, length int) []byte {
+	return ce.appendHead(buf, cborArray, uint64(length))
+}
+
+func (ce cborEncoder) appendMapHeader(buf []byte, length int) []byte {
+	return ce.appendHead(buf, cborMap, uint64(length))
+}
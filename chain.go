@@ -0,0 +1,147 @@
+package sherlog
+
+import (
+	"fmt"
+	"reflect"
+)
+
+/*
+StackTraceWrapper is something that holds a stack trace.
+*/
+type StackTraceWrapper interface {
+	GetStackTrace() []*StackTraceEntry
+	GetStackTraceAsString() string
+}
+
+/*
+Unwrapper is implemented by errors that wrap another error. It matches the Unwrap convention
+used by the standard library's errors package.
+*/
+type Unwrapper interface {
+	Unwrap() error
+}
+
+/*
+causer is implemented by errors from github.com/pkg/errors, which wrapped other errors before Unwrap existed.
+*/
+type causer interface {
+	Cause() error
+}
+
+/*
+unwrap returns the error that err wraps, or nil if it does not wrap anything. Errors that only have a Cause
+method, like older versions of github.com/pkg/errors, are followed too.
+*/
+func unwrap(err error) error {
+	if unwrapper, ok := err.(Unwrapper); ok {
+		return unwrapper.Unwrap()
+	}
+	if causer, ok := err.(causer); ok {
+		return causer.Cause()
+	}
+	return nil
+}
+
+/*
+walkChain calls visit with err and then every error it wraps, outermost first, until visit returns false. Stops
+after MaxChainDepth errors, or when an error shows up a second time since the chain would go around forever.
+Returns a marker saying why the chain was cut off, or "" if it wasn't.
+*/
+func walkChain(err error, visit func(cur error) bool) (cutOff string) {
+	var seen []error
+	for depth := 0; err != nil; depth++ {
+		if depth >= maxChainDepth() {
+			return fmt.Sprintf("... chain cut off after %d errors", depth)
+		}
+		if reflect.TypeOf(err).Comparable() {
+			for _, seenErr := range seen {
+				if seenErr == err {
+					return fmt.Sprintf("... chain cut off since %T wraps itself", err)
+				}
+			}
+			seen = append(seen, err)
+		}
+		if !visit(err) {
+			return ""
+		}
+		err = unwrap(err)
+	}
+	return ""
+}
+
+/*
+maxChainDepth returns MaxChainDepth, or the default if it isn't positive.
+*/
+func maxChainDepth() int {
+	if MaxChainDepth > 0 {
+		return MaxChainDepth
+	}
+	return defaultMaxChainDepth
+}
+
+/*
+limitMessageChain returns the first MaxChainDepth messages of chain followed by a marker saying how many were left
+out, or chain itself if it isn't that long.
+*/
+func limitMessageChain(chain []string) []string {
+	limit := maxChainDepth()
+	if len(chain) <= limit {
+		return chain
+	}
+	limited := make([]string, limit, limit+1)
+	copy(limited, chain)
+	return append(limited, fmt.Sprintf("... %d more messages", len(chain)-limit))
+}
+
+/*
+RootCause walks the Unwrap chain of err and returns the innermost error.
+Returns err itself if it does not wrap anything, and nil if err is nil.
+*/
+func RootCause(err error) (root error) {
+	walkChain(err, func(cur error) bool {
+		root = cur
+		return true
+	})
+	return
+}
+
+/*
+LevelOf walks the Unwrap chain of err and returns the level of the innermost LevelWrapper.
+Returns nil if there is no LevelWrapper in the chain.
+*/
+func LevelOf(err error) (level Level) {
+	walkChain(err, func(cur error) bool {
+		if levelWrapper, ok := cur.(LevelWrapper); ok {
+			level = levelWrapper.GetLevel()
+		}
+		return true
+	})
+	return
+}
+
+/*
+StackOf walks the Unwrap chain of err and returns the stack trace of the innermost StackTraceWrapper, or of the
+innermost error that carries its stack trace the way github.com/pkg/errors does.
+The innermost one is used because it is the closest to where the problem actually happened.
+Returns nil if there is no stack trace in the chain.
+*/
+func StackOf(err error) (stackTrace []*StackTraceEntry) {
+	walkChain(err, func(cur error) bool {
+		if curStackTrace := stackTraceOf(cur); curStackTrace != nil {
+			stackTrace = curStackTrace
+		}
+		return true
+	})
+	return
+}
+
+/*
+stackTraceOf returns the stack trace that err itself carries (not the errors it wraps), or nil if it doesn't
+carry one.
+*/
+func stackTraceOf(err error) []*StackTraceEntry {
+	if stackTraceWrapper, ok := err.(StackTraceWrapper); ok {
+		return stackTraceWrapper.GetStackTrace()
+	}
+	return stackTraceFromPCs(stackTracerPCs(err), defaultStackTraceDepth)
+}
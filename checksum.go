@@ -0,0 +1,90 @@
+package sherlog
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+/*
+ChecksumSuffix is added to the path of a file to get the path of its checksum sidecar file.
+*/
+const ChecksumSuffix = ".sha256"
+
+/*
+SetWriteChecksums turns on/off writing a checksum sidecar file (see WriteChecksumFile) for every file the logger
+rolls out. The sidecar is written before the function registered with SetOnRoll is called, so it can ship both.
+Sidecars are deleted along with their file by SetMaxFileAge and Compact. Off by default.
+*/
+func (rfl *RollingFileLogger) SetWriteChecksums(write bool) {
+	rfl.mutex.Lock()
+	defer rfl.mutex.Unlock()
+	rfl.writeChecksums = write
+}
+
+/*
+WriteChecksumFile writes the sha256 checksum of the file at filePath to filePath + ".sha256", in the format of
+sha256sum so that it can also be checked with `sha256sum -c`:
+
+	9f86d081884c7d659a2feaa0c55ad015a3bf4f1b2b0b822cd15d6c15b0f00a08  app_2018-10-03.log
+
+Returns the path of the sidecar file.
+*/
+func WriteChecksumFile(filePath string) (string, error) {
+	checksum, err := fileChecksum(filePath)
+	if err != nil {
+		return "", AsError(err)
+	}
+	checksumPath := filePath + ChecksumSuffix
+	tmpPath := checksumPath + ".tmp"
+	if err = ioutil.WriteFile(tmpPath, []byte(checksum+"  "+filepath.Base(filePath)+"\n"), 0644); err != nil {
+		return "", AsError(err)
+	}
+	if err = os.Rename(tmpPath, checksumPath); err != nil {
+		return "", AsError(err)
+	}
+	return checksumPath, nil
+}
+
+/*
+VerifyChecksum checks the file at filePath against its checksum sidecar file. Returns nil if the file is complete
+and unchanged, and an error if it isn't or if the sidecar is missing.
+*/
+func VerifyChecksum(filePath string) error {
+	sidecar, err := ioutil.ReadFile(filePath + ChecksumSuffix)
+	if err != nil {
+		return AsError(err)
+	}
+	fields := strings.Fields(string(sidecar))
+	if len(fields) == 0 {
+		return AsError("checksum file of ", filePath, " is empty")
+	}
+	checksum, err := fileChecksum(filePath)
+	if err != nil {
+		return AsError(err)
+	}
+	if checksum != fields[0] {
+		return AsError(filePath, " does not match its checksum")
+	}
+	return nil
+}
+
+/*
+fileChecksum returns the hex encoded sha256 checksum of the file at filePath.
+*/
+func fileChecksum(filePath string) (string, error) {
+	file, err := os.Open(filePath)
+	if err != nil {
+		return "", err
+	}
+	defer file.Close()
+	hash := sha256.New()
+	if _, err = io.Copy(hash, file); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(hash.Sum(nil)), nil
+}
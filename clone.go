@@ -0,0 +1,101 @@
+package sherlog
+
+import "sync/atomic"
+
+/*
+Clone returns a copy of the exception that can be changed (with SetLevel, WithField, PrependMsg, and so on)
+without affecting the original.
+*/
+func (se *StdException) Clone() *StdException {
+	clone := new(StdException)
+	se.cloneInto(clone)
+	return clone
+}
+
+/*
+WithLevel returns a LeveledException with level that is a copy of the exception.
+*/
+func (se *StdException) WithLevel(level Level) *LeveledException {
+	leveled := &LeveledException{level: level}
+	se.cloneInto(&leveled.StdException)
+	return leveled
+}
+
+/*
+cloneInto copies the exception into clone, which must be new. The stack trace string isn't copied, so it is
+rendered again if it is needed.
+*/
+func (se *StdException) cloneInto(clone *StdException) {
+	clone.stackTrace = append([]*StackTraceEntry(nil), se.stackTrace...)
+	clone.maxStackTraceSize = se.maxStackTraceSize
+	clone.message = se.message
+	clone.messageChain = append([]string(nil), se.messageChain...)
+	clone.cause = se.cause
+	clone.httpStatus = se.httpStatus
+	clone.sequence = se.sequenceNumber()
+	clone.correlationID = se.correlationID
+	clone.spanID = se.spanID
+	clone.fields = copyFields(se.fields)
+	clone.duration = se.duration
+	clone.NonLoggedMsg = se.NonLoggedMsg
+	if se.timestamp != nil {
+		timestamp := *se.timestamp
+		clone.timestamp = &timestamp
+	}
+}
+
+/*
+Clone returns a copy of the exception that can be changed (with SetLevel, WithField, PrependMsg, and so on)
+without affecting the original.
+*/
+func (le *LeveledException) Clone() *LeveledException {
+	return le.WithLevel(le.level)
+}
+
+/*
+WithLevel returns a copy of the exception with level. Use it instead of SetLevel on an exception that may have
+been handed to other goroutines, such as one that was already logged to a PolyLogger.
+*/
+func (le *LeveledException) WithLevel(level Level) *LeveledException {
+	return le.StdException.WithLevel(level)
+}
+
+/*
+markShared records that the exceptions in values were handed to a logger, which may still be reading them in
+other goroutines. Graduating a shared exception to a new level copies it instead of changing it.
+*/
+func markShared(values []interface{}) {
+	for _, value := range values {
+		if err, isErr := value.(error); isErr {
+			if stdException := stdExceptionOf(err); stdException != nil {
+				atomic.StoreInt32(&stdException.shared, 1)
+			}
+		}
+	}
+}
+
+/*
+unshared returns err, or a copy of it if it is a sherlog exception that was handed to a logger (see markShared), so
+that the copy can be changed without racing with the loggers that may still be reading the original. Every
+function that changes an exception and returns it goes through unshared first.
+*/
+func unshared(err error) error {
+	switch exception := err.(type) {
+	case *LeveledException:
+		if exception != nil && exception.isShared() {
+			return exception.Clone()
+		}
+	case *StdException:
+		if exception != nil && exception.isShared() {
+			return exception.Clone()
+		}
+	}
+	return err
+}
+
+/*
+isShared returns true if the exception was handed to a logger (see markShared).
+*/
+func (se *StdException) isShared() bool {
+	return atomic.LoadInt32(&se.shared) == 1
+}
@@ -0,0 +1,130 @@
+/*
+sherlog-ringdump writes the entries in a ring file (see sherlog.RingFile) to stdout, oldest first. It only reads
+the file, so it can be run after a crash or while the process is still logging:
+
+	go run github.com/Nick-Anderssohn/sherlog/cmd/sherlog-ringdump /var/log/app.ring
+
+When stdout is a terminal (and NO_COLOR isn't set), the first line of each entry is colored like the console
+formatter colors it (see sherlog.RegisterLevelDisplay). With -levels, the number of entries at each level is
+written to stderr afterwards, in the order sherlog.SortLevels puts the levels in.
+*/
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/Nick-Anderssohn/sherlog"
+)
+
+const ansiReset = "\x1b[0m"
+
+func main() {
+	showLevels := flag.Bool("levels", false, "write the number of entries at each level to stderr")
+	flag.Usage = func() {
+		fmt.Fprintln(os.Stderr, "usage: sherlog-ringdump [-levels] <ring file>")
+	}
+	flag.Parse()
+	if flag.NArg() != 1 {
+		flag.Usage()
+		os.Exit(2)
+	}
+	colored := isTerminal(os.Stdout) && os.Getenv("NO_COLOR") == ""
+
+	// Print whatever could be read even if the file turned out to be corrupt part way through
+	entries, err := sherlog.ReadRingFile(flag.Arg(0))
+	stdout := bufio.NewWriter(os.Stdout)
+	counts := map[sherlog.Level]int{}
+	for _, entry := range entries {
+		level := levelOf(entry)
+		if level != nil {
+			counts[level]++
+		}
+		writeEntry(stdout, entry, level, colored)
+	}
+	stdout.Flush()
+	if *showLevels {
+		writeLevelCounts(counts)
+	}
+	if err != nil {
+		if exception, isException := err.(*sherlog.LeveledException); isException {
+			fmt.Fprintln(os.Stderr, exception.GetMessage())
+		} else {
+			fmt.Fprintln(os.Stderr, err)
+		}
+		os.Exit(1)
+	}
+}
+
+/*
+writeEntry writes entry on its own line, with its first line in the color of level if colored is true.
+*/
+func writeEntry(stdout *bufio.Writer, entry []byte, level sherlog.Level, colored bool) {
+	if color := sherlog.DisplayOf(level).Color; colored && level != nil && color != "" {
+		firstLine := entry
+		if newline := bytes.IndexByte(entry, '\n'); newline >= 0 {
+			firstLine = entry[:newline]
+		}
+		stdout.WriteString(color)
+		stdout.Write(firstLine)
+		stdout.WriteString(ansiReset)
+		entry = entry[len(firstLine):]
+	}
+	stdout.Write(entry)
+	if len(entry) == 0 || entry[len(entry)-1] != '\n' {
+		stdout.WriteByte('\n')
+	}
+}
+
+/*
+writeLevelCounts writes the number of entries at each level to stderr, one level per line.
+*/
+func writeLevelCounts(counts map[sherlog.Level]int) {
+	levels := make([]sherlog.Level, 0, len(counts))
+	for level := range counts {
+		levels = append(levels, level)
+	}
+	sherlog.SortLevels(levels)
+	for _, level := range levels {
+		fmt.Fprintf(os.Stderr, "%-3s %-10s %d\n", sherlog.DisplayOf(level).ShortCode, level.GetLabel(), counts[level])
+	}
+}
+
+/*
+levelOf returns the level of an entry written in the default text format or as json, or nil if it doesn't have
+a level that sherlog knows (see sherlog.LevelWithLabel).
+*/
+func levelOf(entry []byte) sherlog.Level {
+	if bytes.HasPrefix(entry, []byte("{")) {
+		var jsonEntry struct{ Level string }
+		if json.Unmarshal(entry, &jsonEntry) != nil {
+			return nil
+		}
+		level, _ := sherlog.LevelWithLabel(jsonEntry.Level)
+		return level
+	}
+	firstLine := entry
+	if newline := bytes.IndexByte(entry, '\n'); newline >= 0 {
+		firstLine = entry[:newline]
+	}
+	// The level comes after the time and any service info, sequence number, or correlation ID
+	parts := bytes.Split(firstLine, []byte(" - "))
+	for i := 1; i < len(parts)-1; i++ {
+		if level, isLevel := sherlog.LevelWithLabel(string(parts[i])); isLevel {
+			return level
+		}
+	}
+	return nil
+}
+
+/*
+isTerminal returns true if file is a terminal (character device).
+*/
+func isTerminal(file *os.File) bool {
+	info, err := file.Stat()
+	return err == nil && info.Mode()&os.ModeCharDevice != 0
+}
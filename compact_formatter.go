@@ -0,0 +1,67 @@
+package sherlog
+
+import (
+	"bytes"
+	"path/filepath"
+	"strconv"
+)
+
+/*
+DefaultCompactTimeLayout is the abbreviated timestamp that CompactFormatter uses by default: month, day, and time
+of day, without the year.
+*/
+const DefaultCompactTimeLayout = "0102 15:04:05"
+
+/*
+CompactFormatter is a Formatter that writes each entry on one short line, for devices where every byte of storage
+counts:
+
+	1003 07:51:14 OE could not connect to postgres {retries=3} @db.go:87
+
+The level is written as the ShortCode of its display (see LevelDisplay), such as C, E, OE, W, I, and D for the
+built in levels, and as "-" for entries without a level. Fields come after the message, and the file name and line
+of the top stack frame come last if IncludeCaller is on. Stack traces are never written.
+*/
+type CompactFormatter struct {
+	// TimeLayout is the layout of the timestamp. Defaults to DefaultCompactTimeLayout.
+	TimeLayout string
+
+	// IncludeCaller turns on writing " @file.go:line" for entries that have a stack trace.
+	IncludeCaller bool
+}
+
+/*
+NewCompactFormatter returns a new CompactFormatter that includes the caller.
+*/
+func NewCompactFormatter() *CompactFormatter {
+	return &CompactFormatter{IncludeCaller: true}
+}
+
+/*
+Format turns entry into a single line.
+*/
+func (cf *CompactFormatter) Format(entry *Entry) ([]byte, error) {
+	layout := cf.TimeLayout
+	if layout == "" {
+		layout = DefaultCompactTimeLayout
+	}
+	var buf bytes.Buffer
+	buf.WriteString(entry.Time.Format(layout))
+	buf.WriteString(" ")
+	if shortCode := DisplayOf(entry.Level).ShortCode; shortCode != "" {
+		buf.WriteString(shortCode)
+	} else {
+		buf.WriteString("-")
+	}
+	buf.WriteString(" ")
+	buf.WriteString(sanitizeText(entry.Message, true))
+	writeFields(&buf, entry.Fields)
+	if cf.IncludeCaller && len(entry.StackTrace) > 0 {
+		frame := entry.StackTrace[0]
+		buf.WriteString(" @")
+		buf.WriteString(filepath.Base(frame.File))
+		buf.WriteString(":")
+		buf.WriteString(strconv.Itoa(frame.Line))
+	}
+	return buf.Bytes(), nil
+}
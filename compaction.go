@@ -0,0 +1,366 @@
+package sherlog
+
+import (
+	"bufio"
+	"compress/gzip"
+	"encoding/json"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+)
+
+const summaryFileNameInfix = "_summary_"
+
+/*
+headerDecorationRegex matches the duration and fields that the text format writes after the message.
+*/
+var headerDecorationRegex = regexp.MustCompile(`( \(took [^)]*\))?( \{.*\})?$`)
+
+/*
+FingerprintSummary sums up every occurrence of one error (see Fingerprint) on one day.
+*/
+type FingerprintSummary struct {
+	Fingerprint string
+	Level       string `json:",omitempty"`
+	Message     string
+	Count       int
+	FirstSeen   time.Time
+	LastSeen    time.Time
+	SampleStack string `json:",omitempty"`
+}
+
+/*
+DaySummary is the content of a summary file written by Compact. Errors is sorted by Count, highest first.
+Compacted holds the paths (relative to the directory of the base file path) of the files that were counted.
+*/
+type DaySummary struct {
+	Day       string
+	Errors    []*FingerprintSummary
+	Compacted []string `json:",omitempty"`
+}
+
+/*
+Compact rewrites the rolled files (including compressed .gz ones) that were last modified more than olderThan ago
+into per-day summaries, and then deletes them. Each summary groups the day's entries by fingerprint and keeps the
+count, the first and last time it was seen, and the stack trace of one occurrence. Summaries are json files named
+after the base file path and the day, such as app_summary_2018-10-03.json for app.log, and are merged with the
+summary of the same day if Compact already wrote one.
+
+Files in the default text format and in the format written by LogJson can be compacted. When Log was given
+multiple errors, only the first one (not the ones after "Caused by:") is counted. Levels are only recognized if
+they are built in or registered with RegisterLevelDisplay. Entries without a timestamp in the logger's time layout are skipped.
+
+Summaries are written to a .tmp file and renamed before anything is deleted, so a crash never loses data. Each
+summary also lists the files it counted, so that a file a crash left behind is deleted by the next Compact without
+being counted again. Returns the paths of the summary files that were written.
+*/
+func (rfl *RollingFileLogger) Compact(olderThan time.Duration) ([]string, error) {
+	filePaths, err := rfl.rolledFilePaths()
+	if err != nil {
+		return nil, AsError(err)
+	}
+	compressedFilePaths, err := rfl.rolledFilePathsWithSuffix(".gz")
+	if err != nil {
+		return nil, AsError(err)
+	}
+
+	rfl.mutex.Lock()
+	currentFilePath := rfl.logFilePath
+	layout := layoutOrDefault(rfl.timeLayout)
+	rfl.mutex.Unlock()
+
+	var toCompact []string
+	cutoff := Clock().Add(-olderThan)
+	for _, filePath := range append(filePaths, compressedFilePaths...) {
+		if filePath == currentFilePath || strings.Contains(filepath.Base(filePath), summaryFileNameInfix) {
+			continue
+		}
+		if info, err := os.Stat(filePath); err == nil && info.ModTime().Before(cutoff) {
+			toCompact = append(toCompact, filePath)
+		}
+	}
+	if len(toCompact) == 0 {
+		return nil, nil
+	}
+
+	// Maps days to the files with entries on that day, to the summaries of those entries by fingerprint
+	days := map[string]map[string]map[string]*FingerprintSummary{}
+	for _, filePath := range toCompact {
+		fileDays := map[string]map[string]*FingerprintSummary{}
+		if err = summarizeFile(filePath, layout, fileDays); err != nil {
+			return nil, AsError(err)
+		}
+		fileName := rfl.compactedFileName(filePath)
+		for day, summaries := range fileDays {
+			if days[day] == nil {
+				days[day] = map[string]map[string]*FingerprintSummary{}
+			}
+			days[day][fileName] = summaries
+		}
+	}
+
+	var written []string
+	for day, files := range days {
+		summaryPath := rfl.summaryFilePath(day)
+		if err = writeDaySummary(summaryPath, day, files); err != nil {
+			return written, AsError(err)
+		}
+		written = append(written, summaryPath)
+	}
+	sort.Strings(written)
+
+	for _, filePath := range toCompact {
+		if err = os.Remove(filePath); err != nil {
+			return written, AsError(err)
+		}
+		os.Remove(filePath + ChecksumSuffix)
+		removeEmptyTimeBuckets(filepath.Dir(filePath), filepath.Dir(rfl.baseFilePath))
+	}
+	return written, nil
+}
+
+/*
+summaryFilePath returns the path of the summary file for day.
+*/
+func (rfl *RollingFileLogger) summaryFilePath(day string) string {
+	ext := filepath.Ext(rfl.baseFilePath)
+	return rfl.baseFilePath[:len(rfl.baseFilePath)-len(ext)] + summaryFileNameInfix + day + ".json"
+}
+
+/*
+compactedFileName returns how a summary's Compacted lists the file at filePath.
+*/
+func (rfl *RollingFileLogger) compactedFileName(filePath string) string {
+	if fileName, err := filepath.Rel(filepath.Dir(rfl.baseFilePath), filePath); err == nil {
+		return filepath.ToSlash(fileName)
+	}
+	return filepath.Base(filePath)
+}
+
+/*
+summarizeFile adds every entry in the file at filePath to days, which maps days to fingerprints to summaries.
+*/
+func summarizeFile(filePath, layout string, days map[string]map[string]*FingerprintSummary) error {
+	file, err := os.Open(filePath)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	var reader io.Reader = file
+	if strings.HasSuffix(filePath, ".gz") {
+		gzipReader, err := gzip.NewReader(file)
+		if err != nil {
+			return err
+		}
+		defer gzipReader.Close()
+		reader = gzipReader
+	}
+
+	add := func(entry *Entry, stack string) {
+		if entry == nil {
+			return
+		}
+		day := entry.Time.Format("2006-01-02")
+		if days[day] == nil {
+			days[day] = map[string]*FingerprintSummary{}
+		}
+		fingerprint := fingerprintOf(entry.LevelLabel(), entry.Message, entry.StackTrace)
+		addOccurrence(days[day], &FingerprintSummary{
+			Fingerprint: fingerprint,
+			Level:       entry.LevelLabel(),
+			Message:     entry.Message,
+			Count:       1,
+			FirstSeen:   entry.Time,
+			LastSeen:    entry.Time,
+			SampleStack: stack,
+		})
+	}
+
+	scanner := bufio.NewScanner(reader)
+	scanner.Buffer(make([]byte, 64*1024), 16*1024*1024)
+	var block []string
+	var causedBy bool
+	for scanner.Scan() {
+		line := scanner.Text()
+		switch {
+		case len(block) == 0 && strings.HasPrefix(line, "{"):
+			add(parseJsonEntry(line, layout))
+		case line == "":
+			add(parseTextEntry(block, layout))
+			block, causedBy = nil, false
+		case line == "Caused by:":
+			causedBy = true
+		case !causedBy:
+			block = append(block, line)
+		}
+	}
+	add(parseTextEntry(block, layout))
+	return scanner.Err()
+}
+
+/*
+parseTextEntry parses the lines of an entry in the default text format. Returns nil if it couldn't be parsed.
+*/
+func parseTextEntry(lines []string, layout string) (*Entry, string) {
+	if len(lines) == 0 {
+		return nil, ""
+	}
+	parts := strings.Split(strings.TrimSuffix(lines[0], ":"), " - ")
+	timestamp, err := time.ParseInLocation(layout, parts[0], Location)
+	if err != nil {
+		return nil, ""
+	}
+	entry := &Entry{Time: timestamp}
+
+	// Skip the service info, sequence number, and correlation ID that may come before the level and message.
+	messageStart := len(parts) - 1
+	for i := 1; i < len(parts)-1; i++ {
+		if level, isLevel := LevelWithLabel(parts[i]); isLevel {
+			entry.Level = level
+			messageStart = i + 1
+			break
+		}
+	}
+	if entry.Level == nil {
+		for messageStart = 1; messageStart < len(parts)-1; messageStart++ {
+			part := parts[messageStart]
+			if !strings.HasPrefix(part, "#") && !(strings.HasPrefix(part, "[") && strings.HasSuffix(part, "]")) {
+				break
+			}
+		}
+	}
+	if messageStart < len(parts) {
+		entry.Message = headerDecorationRegex.ReplaceAllString(strings.Join(parts[messageStart:], " - "), "")
+	}
+
+	var stack []string
+	for _, line := range lines[1:] {
+		if !strings.HasPrefix(line, "\t") {
+			continue
+		}
+		stack = append(stack, line)
+		frame := strings.TrimPrefix(line, "\t")
+		if openParen := strings.LastIndex(frame, "("); openParen > 0 {
+			entry.StackTrace = append(entry.StackTrace, &StackTraceEntry{FunctionName: frame[:openParen]})
+		}
+	}
+	return entry, strings.Join(stack, "\n")
+}
+
+/*
+parseJsonEntry parses an entry written by LogJson. Returns nil if it couldn't be parsed.
+*/
+func parseJsonEntry(line, layout string) (*Entry, string) {
+	var jsonMap map[string]interface{}
+	if json.Unmarshal([]byte(line), &jsonMap) != nil {
+		return nil, ""
+	}
+	if inner, isEnvelope := jsonMap["entry"].(map[string]interface{}); isEnvelope {
+		jsonMap = inner
+	}
+	timeStr, _ := jsonMap["Time"].(string)
+	timestamp, err := time.ParseInLocation(layout, timeStr, Location)
+	if err != nil {
+		return nil, ""
+	}
+	entry := &Entry{Time: timestamp}
+	entry.Message, _ = jsonMap["Message"].(string)
+	if label, _ := jsonMap["Level"].(string); label != "" {
+		entry.Level, _ = LevelWithLabel(label)
+	}
+	frames, _ := jsonMap["StackTrace"].([]interface{})
+	for _, frame := range frames {
+		frameMap, _ := frame.(map[string]interface{})
+		functionName, _ := frameMap["FunctionName"].(string)
+		file, _ := frameMap["File"].(string)
+		line, _ := frameMap["Line"].(float64)
+		entry.StackTrace = append(entry.StackTrace, &StackTraceEntry{FunctionName: functionName, File: file, Line: int(line)})
+	}
+	stack, _ := jsonMap["StackTraceStr"].(string)
+	if stack == "" && len(entry.StackTrace) > 0 {
+		stack = stackTraceAsString(entry.StackTrace)
+	}
+	return entry, stack
+}
+
+/*
+addOccurrence merges summary into the summary with the same fingerprint in summaries.
+*/
+func addOccurrence(summaries map[string]*FingerprintSummary, summary *FingerprintSummary) {
+	existing, exists := summaries[summary.Fingerprint]
+	if !exists {
+		summaries[summary.Fingerprint] = summary
+		return
+	}
+	existing.Count += summary.Count
+	if summary.FirstSeen.Before(existing.FirstSeen) {
+		existing.FirstSeen = summary.FirstSeen
+	}
+	if summary.LastSeen.After(existing.LastSeen) {
+		existing.LastSeen = summary.LastSeen
+	}
+	if existing.SampleStack == "" {
+		existing.SampleStack = summary.SampleStack
+	}
+}
+
+/*
+writeDaySummary merges the summaries of files (which maps file names to summaries by fingerprint) with the summary
+already at summaryPath (if there is one) and writes the result to summaryPath. Files that the existing summary
+already counted are skipped.
+*/
+func writeDaySummary(summaryPath, day string, files map[string]map[string]*FingerprintSummary) error {
+	daySummary := DaySummary{Day: day}
+	summaries := map[string]*FingerprintSummary{}
+	if content, err := ioutil.ReadFile(summaryPath); err == nil {
+		var existing DaySummary
+		if err = json.Unmarshal(content, &existing); err != nil {
+			return err
+		}
+		for _, summary := range existing.Errors {
+			addOccurrence(summaries, summary)
+		}
+		daySummary.Compacted = existing.Compacted
+	}
+
+	counted := map[string]bool{}
+	for _, fileName := range daySummary.Compacted {
+		counted[fileName] = true
+	}
+	for fileName, fileSummaries := range files {
+		if counted[fileName] {
+			continue // Counted by a Compact that crashed before deleting the file
+		}
+		for _, summary := range fileSummaries {
+			addOccurrence(summaries, summary)
+		}
+		daySummary.Compacted = append(daySummary.Compacted, fileName)
+	}
+	sort.Strings(daySummary.Compacted)
+
+	for _, summary := range summaries {
+		daySummary.Errors = append(daySummary.Errors, summary)
+	}
+	sort.Slice(daySummary.Errors, func(i, j int) bool {
+		if daySummary.Errors[i].Count != daySummary.Errors[j].Count {
+			return daySummary.Errors[i].Count > daySummary.Errors[j].Count
+		}
+		return daySummary.Errors[i].Fingerprint < daySummary.Errors[j].Fingerprint
+	})
+	content, err := json.MarshalIndent(daySummary, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	tmpPath := summaryPath + tmpSuffix
+	if err = ioutil.WriteFile(tmpPath, content, 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmpPath, summaryPath)
+}
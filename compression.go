@@ -0,0 +1,55 @@
+package sherlog
+
+import (
+	"bytes"
+	"compress/gzip"
+)
+
+const defaultCompressMinSize = 1024
+
+/*
+Compressor compresses the bodies that HTTPShipper sends. Encoding is the Content-Encoding of the compressed
+bodies, such as "gzip". GzipCompressor is built in. Other encodings can be plugged in by wrapping a library, such
+as a Compressor with Encoding "zstd" that calls github.com/klauspost/compress/zstd.
+*/
+type Compressor interface {
+	Encoding() string
+	Compress(body []byte) ([]byte, error)
+}
+
+/*
+GzipCompressor is a Compressor that gzips bodies.
+*/
+type GzipCompressor struct {
+	// Level is the gzip compression level, such as gzip.BestSpeed. 0 means gzip.DefaultCompression.
+	Level int
+}
+
+/*
+Encoding returns "gzip".
+*/
+func (gc GzipCompressor) Encoding() string {
+	return "gzip"
+}
+
+/*
+Compress gzips body.
+*/
+func (gc GzipCompressor) Compress(body []byte) ([]byte, error) {
+	level := gc.Level
+	if level == 0 {
+		level = gzip.DefaultCompression
+	}
+	var buf bytes.Buffer
+	writer, err := gzip.NewWriterLevel(&buf, level)
+	if err != nil {
+		return nil, err
+	}
+	if _, err = writer.Write(body); err != nil {
+		return nil, err
+	}
+	if err = writer.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
@@ -0,0 +1,137 @@
+package sherlog
+
+import (
+	"bytes"
+	"os"
+)
+
+const ansiReset = "\x1b[0m"
+
+/*
+DefaultConsoleColors holds the ANSI escape codes that the built in levels are displayed with by default (see
+LevelDisplay). CRITICAL entries are bold white on red so they stand out. ConsoleFormatter uses the colors of the
+registered displays unless it is given its own Colors, so change those with RegisterLevelDisplay.
+*/
+var DefaultConsoleColors = map[Level]string{
+	EnumCritical: "\x1b[1;97;41m",
+	EnumError:    "\x1b[1;31m",
+	EnumOpsError: "\x1b[35m",
+	EnumWarning:  "\x1b[33m",
+	EnumInfo:     "\x1b[32m",
+	EnumDebug:    "\x1b[2m",
+}
+
+/*
+EmojiPrefixes can be given to ConsoleFormatter (or ConsoleLogger.SetLevelPrefixes) to start each entry with an emoji.
+*/
+var EmojiPrefixes = map[Level]string{
+	EnumCritical: "🔥",
+	EnumError:    "❌",
+	EnumOpsError: "🛠",
+	EnumWarning:  "⚠️",
+	EnumInfo:     "ℹ️",
+	EnumDebug:    "🐛",
+}
+
+/*
+SymbolPrefixes can be given to ConsoleFormatter (or ConsoleLogger.SetLevelPrefixes) to start each entry with a
+symbol. Use these instead of EmojiPrefixes if your terminal's font doesn't have emojis.
+*/
+var SymbolPrefixes = map[Level]string{
+	EnumCritical: "‼",
+	EnumError:    "✖",
+	EnumOpsError: "⚙",
+	EnumWarning:  "▲",
+	EnumInfo:     "●",
+	EnumDebug:    "·",
+}
+
+/*
+ConsoleFormatter is a Formatter meant for humans watching a terminal. Entries look like the default format,
+but the first line is colored by level and can start with a per-level prefix:
+
+	🔥 yyyy-mm-dd hh:mm:ss - CRITICAL - message:
+		sherlog.exampleFunc(exampleFile.go:18)
+
+When DisplayColors is true, entries are colored with the colors of the registered level displays (see
+RegisterLevelDisplay). Colors overrides those when it isn't nil. A zero ConsoleFormatter has neither, so it doesn't
+color anything. When Plain is true, colors and prefixes are left out so the output is plain text.
+*/
+type ConsoleFormatter struct {
+	Prefixes      map[Level]string
+	Colors        map[Level]string
+	DisplayColors bool
+	Plain         bool
+	IncludeStack  bool
+}
+
+/*
+NewConsoleFormatter returns a new ConsoleFormatter for entries that will be written to file. It uses
+the colors of the registered level displays and no prefixes. Plain is turned on if file is not a terminal (i.e. the output is
+redirected to a file or piped to another program) or if the NO_COLOR environment variable is set.
+*/
+func NewConsoleFormatter(file *os.File) *ConsoleFormatter {
+	return &ConsoleFormatter{
+		DisplayColors: true,
+		Plain:         !isTerminal(file) || os.Getenv("NO_COLOR") != "",
+		IncludeStack:  true,
+	}
+}
+
+/*
+Format turns entry into text, with colors and a prefix unless cf.Plain is true.
+*/
+func (cf *ConsoleFormatter) Format(entry *Entry) ([]byte, error) {
+	var buf bytes.Buffer
+	for _, msg := range entry.MessageChain {
+		buf.WriteString(sanitizeText(msg, true))
+		buf.WriteString("\nCaused by:\n")
+	}
+
+	var color string
+	if !cf.Plain && entry.Level != nil {
+		if prefix := cf.Prefixes[entry.Level]; prefix != "" {
+			buf.WriteString(prefix)
+			buf.WriteString(" ")
+		}
+		color = cf.colorOf(entry.Level)
+	}
+	buf.WriteString(color)
+	entry.writeHeader(&buf)
+	if color != "" {
+		buf.WriteString(ansiReset)
+	}
+
+	if cf.IncludeStack && len(entry.StackTrace) > 0 {
+		buf.WriteString(":\n")
+		buf.WriteString(entry.StackTraceAsString())
+	}
+	return buf.Bytes(), nil
+}
+
+/*
+colorOf returns the color of level's entries.
+*/
+func (cf *ConsoleFormatter) colorOf(level Level) string {
+	if cf.Colors != nil {
+		return cf.Colors[level]
+	}
+	if cf.DisplayColors {
+		return DisplayOf(level).Color
+	}
+	return ""
+}
+
+/*
+isTerminal returns true if file is a terminal (character device).
+*/
+func isTerminal(file *os.File) bool {
+	if file == nil {
+		return false
+	}
+	info, err := file.Stat()
+	if err != nil {
+		return false
+	}
+	return info.Mode()&os.ModeCharDevice != 0
+}
@@ -0,0 +1,192 @@
+package sherlog
+
+import (
+	"os"
+	"sync"
+)
+
+/*
+ConsoleLogger logs to stdout using a ConsoleFormatter. Entries are colored by level when stdout is a terminal,
+and automatically downgrade to plain text when the output is redirected. FileLogger is embedded, so all of its
+options (SetIncludeCaller, SetPrettyJson, etc.) work the same way. Use SetStderrLevel to send the more severe
+entries to stderr instead.
+*/
+type ConsoleLogger struct {
+	FileLogger
+	console     *ConsoleFormatter
+	stdout      *os.File
+	stderr      *os.File
+	stderrLevel Level
+	routeMutex  *sync.Mutex
+}
+
+/*
+NewConsoleLogger creates a new ConsoleLogger that writes to stdout.
+*/
+func NewConsoleLogger() *ConsoleLogger {
+	return newConsoleLogger(os.Stdout, os.Stderr)
+}
+
+func newConsoleLogger(stdout, stderr *os.File) *ConsoleLogger {
+	console := NewConsoleFormatter(stdout)
+	return &ConsoleLogger{
+		FileLogger: FileLogger{
+			file:      stdout,
+			mutex:     new(sync.Mutex),
+			formatter: console,
+			skipSync:  true,
+		},
+		console:    console,
+		stdout:     stdout,
+		stderr:     stderr,
+		routeMutex: new(sync.Mutex),
+	}
+}
+
+/*
+SetStderrLevel makes entries with level (or a more severe level) go to stderr while everything else goes to stdout.
+This matches 12-factor expectations and lets container runtimes route logs by stream:
+
+	logger.SetStderrLevel(sherlog.EnumWarning) // WARNING and above to stderr, INFO and DEBUG to stdout
+
+Errors that don't have a level always go to stdout. Whether output is plain text is decided by stdout alone.
+Pass nil to send everything to stdout, which is the default.
+*/
+func (cl *ConsoleLogger) SetStderrLevel(level Level) {
+	cl.stderrLevel = level
+}
+
+/*
+fileFor returns the stream that toLog should be written to.
+*/
+func (cl *ConsoleLogger) fileFor(toLog interface{}) *os.File {
+	if cl.stderrLevel == nil {
+		return cl.stdout
+	}
+	err, isErr := toLog.(error)
+	if !isErr {
+		return cl.stdout
+	}
+	if level := LevelOf(err); level != nil && level.GetLevelId() <= cl.stderrLevel.GetLevelId() {
+		return cl.stderr
+	}
+	return cl.stdout
+}
+
+/*
+route points the embedded FileLogger at the stream toLog belongs on while logFunc runs.
+*/
+func (cl *ConsoleLogger) route(toLog interface{}, logFunc func() error) error {
+	cl.routeMutex.Lock()
+	defer cl.routeMutex.Unlock()
+	cl.file = cl.fileFor(toLog)
+	return logFunc()
+}
+
+/*
+Log calls FileLogger's Log function on the stream that the first value in errorsToLog belongs on. Is thread safe :)
+*/
+func (cl *ConsoleLogger) Log(errorsToLog ...interface{}) error {
+	var first interface{}
+	if len(errorsToLog) > 0 {
+		first = errorsToLog[0]
+	}
+	return cl.route(first, func() error {
+		return cl.FileLogger.Log(errorsToLog...)
+	})
+}
+
+/*
+LogNoStack calls FileLogger's LogNoStack function on the stream that errToLog belongs on. Is thread safe :)
+*/
+func (cl *ConsoleLogger) LogNoStack(errToLog error) error {
+	return cl.route(errToLog, func() error {
+		return cl.FileLogger.LogNoStack(errToLog)
+	})
+}
+
+/*
+LogJson calls FileLogger's LogJson function on the stream that errToLog belongs on. Is thread safe :)
+*/
+func (cl *ConsoleLogger) LogJson(errToLog error) error {
+	return cl.route(errToLog, func() error {
+		return cl.FileLogger.LogJson(errToLog)
+	})
+}
+
+/*
+SetLevelPrefixes sets the prefix that each level's entries start with, such as EmojiPrefixes or SymbolPrefixes.
+Levels that are not in prefixes don't get one. Prefixes are left out when the output is plain text.
+*/
+func (cl *ConsoleLogger) SetLevelPrefixes(prefixes map[Level]string) {
+	cl.console.Prefixes = prefixes
+}
+
+/*
+SetLevelColors sets the ANSI escape code used to color the first line of each level's entries. Defaults to the
+colors of the registered level displays (see RegisterLevelDisplay). Pass nil to go back to them.
+*/
+func (cl *ConsoleLogger) SetLevelColors(colors map[Level]string) {
+	cl.console.Colors = colors
+}
+
+/*
+SetPlain turns on/off plain text output (no colors or prefixes). By default it is on when stdout is not a
+terminal or when the NO_COLOR environment variable is set.
+*/
+func (cl *ConsoleLogger) SetPlain(plain bool) {
+	cl.console.Plain = plain
+}
+
+/*
+Close does nothing since stdout should stay open.
+*/
+func (cl *ConsoleLogger) Close() {}
+
+/*
+Critical turns values into a *LeveledException with level CRITICAL and then calls the logger's
+Log function.
+*/
+func (cl *ConsoleLogger) Critical(values ...interface{}) error {
+	return cl.Log(cl.graduate(EnumCritical, values...))
+}
+
+/*
+Error turns values into a *LeveledException with level ERROR and then calls the logger's
+Log function.
+*/
+func (cl *ConsoleLogger) Error(values ...interface{}) error {
+	return cl.Log(cl.graduate(EnumError, values...))
+}
+
+/*
+OpsError turns values into a *LeveledException with level OPS_ERROR and then calls the logger's
+Log function.
+*/
+func (cl *ConsoleLogger) OpsError(values ...interface{}) error {
+	return cl.Log(cl.graduate(EnumOpsError, values...))
+}
+
+/*
+Warn turns values into a *LeveledException with level WARNING and then calls the logger's
+Log function.
+*/
+func (cl *ConsoleLogger) Warn(values ...interface{}) error {
+	return cl.Log(cl.graduate(EnumWarning, values...))
+}
+
+/*
+Info turns values into a *LeveledException with level INFO and then calls the logger's
+Log function.
+*/
+func (cl *ConsoleLogger) Info(values ...interface{}) error {
+	return cl.Log(cl.graduate(EnumInfo, values...))
+}
+
+/*
+Debug turns values into a *LeveledException with level DEBUG and then calls the logger's
+Log function.
+*/
+func (cl *ConsoleLogger) Debug(values ...interface{}) error {
+	return cl.Log(cl.graduate(EnumDebug, values...))
+}
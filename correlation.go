@@ -0,0 +1,256 @@
+package sherlog
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"io"
+	"net/http"
+)
+
+/*
+CorrelationIDHeader is the http header that CorrelationMiddleware reads the correlation ID from
+and writes it back to.
+*/
+const CorrelationIDHeader = "X-Correlation-ID"
+
+/*
+maxCorrelationIDBytes is how long a correlation ID can get before it is cut short. Real IDs are far shorter, this
+only stops a client from making every entry of its requests huge.
+*/
+const maxCorrelationIDBytes = 128
+
+type correlationIDKey struct{}
+
+type spanIDKey struct{}
+
+/*
+CorrelationIDWrapper is something that holds a modifiable correlation ID.
+*/
+type CorrelationIDWrapper interface {
+	GetCorrelationID() string
+	SetCorrelationID(id string)
+}
+
+/*
+NewCorrelationID returns a new random 32 character hex ID. Returns an empty string in the very
+unlikely event that the system's secure random number generator fails.
+*/
+func NewCorrelationID() string {
+	idBytes := make([]byte, 16)
+	if _, err := rand.Read(idBytes); err != nil {
+		return ""
+	}
+	return hex.EncodeToString(idBytes)
+}
+
+/*
+ContextWithCorrelationID returns a copy of ctx that carries id.
+*/
+func ContextWithCorrelationID(ctx context.Context, id string) context.Context {
+	return context.WithValue(ctx, correlationIDKey{}, id)
+}
+
+/*
+CorrelationIDFromContext returns the correlation ID carried by ctx, or an empty string if there is none.
+*/
+func CorrelationIDFromContext(ctx context.Context) string {
+	if ctx == nil {
+		return ""
+	}
+	id, _ := ctx.Value(correlationIDKey{}).(string)
+	return id
+}
+
+/*
+ContextWithSpanID returns a copy of ctx that carries spanID. Formatters that understand tracing (such as
+OTLPFormatter) use the correlation ID as the trace ID and this as the span ID.
+*/
+func ContextWithSpanID(ctx context.Context, spanID string) context.Context {
+	return context.WithValue(ctx, spanIDKey{}, spanID)
+}
+
+/*
+SpanIDFromContext returns the span ID carried by ctx, or an empty string if there is none.
+*/
+func SpanIDFromContext(ctx context.Context) string {
+	if ctx == nil {
+		return ""
+	}
+	spanID, _ := ctx.Value(spanIDKey{}).(string)
+	return spanID
+}
+
+/*
+WithCorrelationID stamps id onto err if err is a CorrelationIDWrapper (all sherlog exceptions are).
+Returns err, or a copy of it if err was already logged.
+*/
+func WithCorrelationID(err error, id string) error {
+	if id == "" {
+		return err
+	}
+	err = unshared(err)
+	if wrapper, ok := err.(CorrelationIDWrapper); ok {
+		wrapper.SetCorrelationID(id)
+	}
+	return err
+}
+
+/*
+WithContext stamps the correlation ID (and span ID, if there is one) carried by ctx onto err. Since the IDs
+travel with the exception, they show up no matter which file a MultiFileLogger decides to log it to. Returns err,
+or a copy of it if err was already logged.
+*/
+func WithContext(ctx context.Context, err error) error {
+	if spanID := SpanIDFromContext(ctx); spanID != "" {
+		err = unshared(err)
+		if stdException := stdExceptionOf(err); stdException != nil {
+			stdException.spanID = spanID
+		}
+	}
+	return WithCorrelationID(err, CorrelationIDFromContext(ctx))
+}
+
+/*
+CorrelationMiddleware makes sure every request's context carries a correlation ID. The ID is taken from the
+X-Correlation-ID request header if the client sent one. Otherwise, a new one is created. The ID is also written
+to the X-Correlation-ID response header. Since the header comes from the client, it is cleaned up like a message
+(see SanitizeText) and cut short at 128 bytes first.
+*/
+func CorrelationMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id := cleanCorrelationID(r.Header.Get(CorrelationIDHeader))
+		if id == "" {
+			id = NewCorrelationID()
+		}
+		w.Header().Set(CorrelationIDHeader, id)
+		next.ServeHTTP(w, r.WithContext(ContextWithCorrelationID(r.Context(), id)))
+	})
+}
+
+/*
+cleanCorrelationID returns id sanitized like a message and cut short at maxCorrelationIDBytes.
+*/
+func cleanCorrelationID(id string) string {
+	return capText(sanitizeText(id, true), maxCorrelationIDBytes)
+}
+
+/*
+writeCorrelationID writes " - [id]" to writer if there is an id. The id is cleaned up first, since it can be set
+from anywhere with WithCorrelationID.
+*/
+func writeCorrelationID(writer io.Writer, id string) error {
+	if id == "" {
+		return nil
+	}
+	_, err := writer.Write([]byte(" - [" + cleanCorrelationID(id) + "]"))
+	return err
+}
+
+/*
+ContextLogger stamps the correlation ID of a context onto every sherlog exception before passing it on
+to the Logger it wraps. Create one per request:
+
+	logger := sherlog.NewContextLogger(r.Context(), baseLogger)
+	logger.Error("could not find user ", userID)
+
+Non-sherlog errors are passed through untouched since they can't hold a correlation ID.
+*/
+type ContextLogger struct {
+	callerSkipper
+	ctx    context.Context
+	logger Logger
+}
+
+/*
+NewContextLogger returns a new ContextLogger that stamps the correlation ID of ctx onto everything logged with logger.
+*/
+func NewContextLogger(ctx context.Context, logger Logger) *ContextLogger {
+	return &ContextLogger{
+		ctx:    ctx,
+		logger: logger,
+	}
+}
+
+/*
+Log stamps the correlation ID onto errorsToLog and then calls the wrapped logger's Log function.
+*/
+func (cl *ContextLogger) Log(errorsToLog ...interface{}) error {
+	stamped := make([]interface{}, len(errorsToLog))
+	for i, errToLog := range errorsToLog {
+		if err, isErr := errToLog.(error); isErr {
+			errToLog = WithContext(cl.ctx, err)
+		}
+		stamped[i] = errToLog
+	}
+	return cl.logger.Log(stamped...)
+}
+
+/*
+LogNoStack stamps the correlation ID onto errToLog and then calls the wrapped logger's LogNoStack function.
+*/
+func (cl *ContextLogger) LogNoStack(errToLog error) error {
+	return cl.logger.LogNoStack(WithContext(cl.ctx, errToLog))
+}
+
+/*
+LogJson stamps the correlation ID onto errToLog and then calls the wrapped logger's LogJson function.
+*/
+func (cl *ContextLogger) LogJson(errToLog error) error {
+	return cl.logger.LogJson(WithContext(cl.ctx, errToLog))
+}
+
+/*
+Close closes the wrapped logger.
+*/
+func (cl *ContextLogger) Close() {
+	cl.logger.Close()
+}
+
+/*
+Critical turns values into a *LeveledException with level CRITICAL and then calls the logger's
+Log function.
+*/
+func (cl *ContextLogger) Critical(values ...interface{}) error {
+	return cl.Log(cl.graduate(EnumCritical, values...))
+}
+
+/*
+Error turns values into a *LeveledException with level ERROR and then calls the logger's
+Log function.
+*/
+func (cl *ContextLogger) Error(values ...interface{}) error {
+	return cl.Log(cl.graduate(EnumError, values...))
+}
+
+/*
+OpsError turns values into a *LeveledException with level OPS_ERROR and then calls the logger's
+Log function.
+*/
+func (cl *ContextLogger) OpsError(values ...interface{}) error {
+	return cl.Log(cl.graduate(EnumOpsError, values...))
+}
+
+/*
+Warn turns values into a *LeveledException with level WARNING and then calls the logger's
+Log function.
+*/
+func (cl *ContextLogger) Warn(values ...interface{}) error {
+	return cl.Log(cl.graduate(EnumWarning, values...))
+}
+
+/*
+Info turns values into a *LeveledException with level INFO and then calls the logger's
+Log function.
+*/
+func (cl *ContextLogger) Info(values ...interface{}) error {
+	return cl.Log(cl.graduate(EnumInfo, values...))
+}
+
+/*
+Debug turns values into a *LeveledException with level DEBUG and then calls the logger's
+Log function.
+*/
+func (cl *ContextLogger) Debug(values ...interface{}) error {
+	return cl.Log(cl.graduate(EnumDebug, values...))
+}
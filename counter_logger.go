@@ -0,0 +1,223 @@
+package sherlog
+
+import (
+	"fmt"
+	"sync"
+)
+
+const (
+	// OtherFingerprints is the fingerprint that a CounterLogger counts entries under once it has counted 1000
+	// different fingerprints, so that errors with ever changing messages can't use up all the memory.
+	OtherFingerprints = "other"
+
+	maxCounterFingerprints = 1000
+)
+
+/*
+CounterSnapshot holds the counts of a CounterLogger at a point in time.
+*/
+type CounterSnapshot struct {
+	// Total is the number of entries logged.
+	Total uint64
+
+	// ByLevel counts entries by level label. Entries without a level are counted under "".
+	ByLevel map[string]uint64
+
+	// ByCode counts entries by the http status set with WithHTTPStatus. Entries without one are not counted.
+	ByCode map[int]uint64
+
+	// ByFingerprint counts entries by Fingerprint. At most 1000 fingerprints are counted, the entries with
+	// fingerprints after that are counted under OtherFingerprints.
+	ByFingerprint map[string]uint64
+}
+
+/*
+CounterLogger does no I/O. It only tallies the entries it is given by level, http status code, and fingerprint.
+Add it to a PolyLogger so that error rates can be tracked even when file logging is off:
+
+	counter := sherlog.NewCounterLogger()
+	logger := sherlog.NewPolyLogger([]sherlog.Logger{fileLogger, counter})
+	...
+	errorsSoFar := counter.Counts().ByLevel["ERROR"]
+
+Register it with TrackStats to publish the counts with expvar and StatsHandler too. When Log is given multiple errors, only the first one is counted since they make up a single entry.
+Is thread safe :)
+*/
+type CounterLogger struct {
+	callerSkipper
+	middlewareChain
+	counts CounterSnapshot
+	mutex  *sync.Mutex
+}
+
+/*
+NewCounterLogger returns a new CounterLogger with every count at 0.
+*/
+func NewCounterLogger() *CounterLogger {
+	return &CounterLogger{
+		counts: CounterSnapshot{
+			ByLevel:       map[string]uint64{},
+			ByCode:        map[int]uint64{},
+			ByFingerprint: map[string]uint64{},
+		},
+		mutex: new(sync.Mutex),
+	}
+}
+
+/*
+Counts returns a copy of the current counts.
+*/
+func (cl *CounterLogger) Counts() CounterSnapshot {
+	cl.mutex.Lock()
+	defer cl.mutex.Unlock()
+	snapshot := CounterSnapshot{
+		Total:         cl.counts.Total,
+		ByLevel:       make(map[string]uint64, len(cl.counts.ByLevel)),
+		ByCode:        make(map[int]uint64, len(cl.counts.ByCode)),
+		ByFingerprint: make(map[string]uint64, len(cl.counts.ByFingerprint)),
+	}
+	for label, count := range cl.counts.ByLevel {
+		snapshot.ByLevel[label] = count
+	}
+	for code, count := range cl.counts.ByCode {
+		snapshot.ByCode[code] = count
+	}
+	for fingerprint, count := range cl.counts.ByFingerprint {
+		snapshot.ByFingerprint[fingerprint] = count
+	}
+	return snapshot
+}
+
+/*
+Reset sets every count back to 0.
+*/
+func (cl *CounterLogger) Reset() {
+	cl.mutex.Lock()
+	defer cl.mutex.Unlock()
+	cl.counts = CounterSnapshot{
+		ByLevel:       map[string]uint64{},
+		ByCode:        map[int]uint64{},
+		ByFingerprint: map[string]uint64{},
+	}
+}
+
+/*
+count tallies toLog.
+*/
+func (cl *CounterLogger) count(toLog interface{}) error {
+	if toLog == nil {
+		return AsError("tried to log nil error")
+	}
+	err, isErr := toLog.(error)
+	if !isErr {
+		err = fmt.Errorf("%v", toLog)
+	}
+	level := LevelOf(err)
+	label := ""
+	if level != nil {
+		label = level.GetLabel()
+	}
+	code := explicitHTTPStatusOf(err)
+	fingerprint := Fingerprint(err)
+
+	cl.mutex.Lock()
+	defer cl.mutex.Unlock()
+	cl.counts.Total++
+	cl.counts.ByLevel[label]++
+	if code > 0 {
+		cl.counts.ByCode[code]++
+	}
+	if _, counted := cl.counts.ByFingerprint[fingerprint]; !counted && len(cl.counts.ByFingerprint) >= maxCounterFingerprints {
+		fingerprint = OtherFingerprints
+	}
+	cl.counts.ByFingerprint[fingerprint]++
+	return nil
+}
+
+/*
+Log counts the first value of errorsToLog.
+*/
+func (cl *CounterLogger) Log(errorsToLog ...interface{}) error {
+	return cl.through(cl.logValues, errorsToLog)
+}
+
+func (cl *CounterLogger) logValues(errorsToLog ...interface{}) error {
+	if len(errorsToLog) < 1 {
+		return AsError("no parameters provided to Log")
+	}
+	return cl.count(errorsToLog[0])
+}
+
+/*
+LogNoStack counts errToLog.
+*/
+func (cl *CounterLogger) LogNoStack(errToLog error) error {
+	return cl.throughWithError(cl.logError, errToLog)
+}
+
+/*
+LogJson counts errToLog.
+*/
+func (cl *CounterLogger) LogJson(errToLog error) error {
+	return cl.throughWithError(cl.logError, errToLog)
+}
+
+func (cl *CounterLogger) logError(errToLog error) error {
+	if errToLog == nil {
+		return AsError("tried to log nil error")
+	}
+	return cl.count(errToLog)
+}
+
+/*
+Close does nothing since there is nothing to close.
+*/
+func (cl *CounterLogger) Close() {}
+
+/*
+Critical turns values into a *LeveledException with level CRITICAL and then calls the logger's
+Log function.
+*/
+func (cl *CounterLogger) Critical(values ...interface{}) error {
+	return cl.Log(cl.graduate(EnumCritical, values...))
+}
+
+/*
+Error turns values into a *LeveledException with level ERROR and then calls the logger's
+Log function.
+*/
+func (cl *CounterLogger) Error(values ...interface{}) error {
+	return cl.Log(cl.graduate(EnumError, values...))
+}
+
+/*
+OpsError turns values into a *LeveledException with level OPS_ERROR and then calls the logger's
+Log function.
+*/
+func (cl *CounterLogger) OpsError(values ...interface{}) error {
+	return cl.Log(cl.graduate(EnumOpsError, values...))
+}
+
+/*
+Warn turns values into a *LeveledException with level WARNING and then calls the logger's
+Log function.
+*/
+func (cl *CounterLogger) Warn(values ...interface{}) error {
+	return cl.Log(cl.graduate(EnumWarning, values...))
+}
+
+/*
+Info turns values into a *LeveledException with level INFO and then calls the logger's
+Log function.
+*/
+func (cl *CounterLogger) Info(values ...interface{}) error {
+	return cl.Log(cl.graduate(EnumInfo, values...))
+}
+
+/*
+Debug turns values into a *LeveledException with level DEBUG and then calls the logger's
+Log function.
+*/
+func (cl *CounterLogger) Debug(values ...interface{}) error {
+	return cl.Log(cl.graduate(EnumDebug, values...))
+}
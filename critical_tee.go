@@ -0,0 +1,184 @@
+package sherlog
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"sync"
+)
+
+/*
+CriticalTeeLogger wraps any Logger and also writes every CRITICAL entry straight to stderr before passing it on.
+The stderr write happens synchronously, before the wrapped logger gets the entry, so CRITICAL entries are
+visible even if the log files or remote destinations are broken during an incident:
+
+	logger := sherlog.NewCriticalTeeLogger(fileLogger)
+	logger.Critical("database is unreachable") // Written to stderr and to fileLogger
+
+Entries of other levels are only passed on.
+*/
+type CriticalTeeLogger struct {
+	callerSkipper
+	logger Logger
+	stderr io.Writer
+	mutex  *sync.Mutex
+}
+
+/*
+NewCriticalTeeLogger returns a new CriticalTeeLogger that passes everything on to logger.
+*/
+func NewCriticalTeeLogger(logger Logger) *CriticalTeeLogger {
+	return &CriticalTeeLogger{
+		logger: logger,
+		stderr: os.Stderr,
+		mutex:  new(sync.Mutex),
+	}
+}
+
+func isCritical(toLog interface{}) bool {
+	err, isErr := toLog.(error)
+	if !isErr {
+		return false
+	}
+	level := LevelOf(err)
+	return level != nil && level.GetLevelId() == EnumCritical.GetLevelId()
+}
+
+/*
+tee runs logFunc on stderr if toLog is CRITICAL.
+*/
+func (ctl *CriticalTeeLogger) tee(toLog interface{}, logFunc logFunction) error {
+	if !isCritical(toLog) {
+		return nil
+	}
+	ctl.mutex.Lock()
+	defer ctl.mutex.Unlock()
+	err := logFunc(ctl.stderr)
+	if err != nil {
+		return err
+	}
+	_, err = ctl.stderr.Write([]byte("\n"))
+	return err
+}
+
+/*
+Log writes errorsToLog to stderr if the first one is CRITICAL and then calls the wrapped logger's Log function.
+The wrapped logger's error takes priority over an error from writing to stderr.
+*/
+func (ctl *CriticalTeeLogger) Log(errorsToLog ...interface{}) error {
+	var teeErr error
+	if len(errorsToLog) > 0 {
+		teeErr = ctl.tee(errorsToLog[0], func(writer io.Writer) error {
+			for i, errToLog := range errorsToLog {
+				var err error
+				switch impl := errToLog.(type) {
+				case Loggable:
+					err = impl.Log(writer)
+				default:
+					_, err = writer.Write([]byte(sanitizeText(fmt.Sprint(impl), true)))
+				}
+				if err != nil {
+					return err
+				}
+				if i < len(errorsToLog)-1 {
+					writer.Write([]byte("\nCaused by:\n"))
+				}
+			}
+			return nil
+		})
+	}
+	if err := ctl.logger.Log(errorsToLog...); err != nil {
+		return err
+	}
+	return teeErr
+}
+
+/*
+LogNoStack writes errToLog to stderr without the stack trace if it is CRITICAL and then calls the wrapped
+logger's LogNoStack function.
+*/
+func (ctl *CriticalTeeLogger) LogNoStack(errToLog error) error {
+	teeErr := ctl.tee(errToLog, func(writer io.Writer) error {
+		if loggable, isLoggable := errToLog.(LoggableWithNoStackOption); isLoggable {
+			return loggable.LogNoStack(writer)
+		}
+		_, err := writer.Write([]byte(sanitizeText(errToLog.Error(), true)))
+		return err
+	})
+	if err := ctl.logger.LogNoStack(errToLog); err != nil {
+		return err
+	}
+	return teeErr
+}
+
+/*
+LogJson writes errToLog to stderr as json if it is CRITICAL and then calls the wrapped logger's LogJson function.
+*/
+func (ctl *CriticalTeeLogger) LogJson(errToLog error) error {
+	teeErr := ctl.tee(errToLog, func(writer io.Writer) error {
+		if loggable, isLoggable := errToLog.(JsonLoggable); isLoggable {
+			return loggable.LogAsJson(writer)
+		}
+		_, err := writer.Write([]byte(sanitizeText(errToLog.Error(), true)))
+		return err
+	})
+	if err := ctl.logger.LogJson(errToLog); err != nil {
+		return err
+	}
+	return teeErr
+}
+
+/*
+Close closes the wrapped logger.
+*/
+func (ctl *CriticalTeeLogger) Close() {
+	ctl.logger.Close()
+}
+
+/*
+Critical turns values into a *LeveledException with level CRITICAL and then calls the logger's
+Log function.
+*/
+func (ctl *CriticalTeeLogger) Critical(values ...interface{}) error {
+	return ctl.Log(ctl.graduate(EnumCritical, values...))
+}
+
+/*
+Error turns values into a *LeveledException with level ERROR and then calls the logger's
+Log function.
+*/
+func (ctl *CriticalTeeLogger) Error(values ...interface{}) error {
+	return ctl.Log(ctl.graduate(EnumError, values...))
+}
+
+/*
+OpsError turns values into a *LeveledException with level OPS_ERROR and then calls the logger's
+Log function.
+*/
+func (ctl *CriticalTeeLogger) OpsError(values ...interface{}) error {
+	return ctl.Log(ctl.graduate(EnumOpsError, values...))
+}
+
+/*
+Warn turns values into a *LeveledException with level WARNING and then calls the logger's
+Log function.
+*/
+func (ctl *CriticalTeeLogger) Warn(values ...interface{}) error {
+	return ctl.Log(ctl.graduate(EnumWarning, values...))
+}
+
+/*
+Info turns values into a *LeveledException with level INFO and then calls the logger's
+Log function.
+*/
+func (ctl *CriticalTeeLogger) Info(values ...interface{}) error {
+	return ctl.Log(ctl.graduate(EnumInfo, values...))
+}
+
+/*
+Debug turns values into a *LeveledException with level DEBUG and then calls the logger's
+Log function.
+*/
+func (ctl *CriticalTeeLogger) Debug(values ...interface{}) error {
+	return ctl.Log(ctl.graduate(EnumDebug, values...))
+}
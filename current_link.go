@@ -0,0 +1,75 @@
+package sherlog
+
+import (
+	"os"
+	"path/filepath"
+)
+
+/*
+SetCurrentLink turns on/off keeping a link at the logger's base file path (such as app.log) that points at the
+file currently being logged to (such as app_2018-10-03.log), so that people and tools like tail -F always have a
+stable path to follow. The link is updated atomically every time the logger rolls. It is a relative symlink where
+possible. Where symlinks can't be created (Windows without the privilege to), it is a hard link instead, which
+also always has the content of the current file. Turning it off removes the link. Off by default.
+
+Returns an error if the link could not be created, or if something other than a link is already at the base
+file path.
+*/
+func (rfl *RollingFileLogger) SetCurrentLink(link bool) error {
+	rfl.mutex.Lock()
+	defer rfl.mutex.Unlock()
+	if !rfl.isLinkOrMissing(rfl.baseFilePath) {
+		return AsError(rfl.baseFilePath, " already exists and is not a link")
+	}
+	rfl.currentLink = link
+	if link {
+		return rfl.updateCurrentLink()
+	}
+	if err := os.Remove(rfl.baseFilePath); err != nil && !os.IsNotExist(err) {
+		return AsError(err)
+	}
+	return nil
+}
+
+/*
+updateCurrentLink points the link at the base file path to the current file. The mutex must be held.
+*/
+func (rfl *RollingFileLogger) updateCurrentLink() error {
+	tmpPath := rfl.baseFilePath + ".tmp"
+	os.Remove(tmpPath)
+	target, err := filepath.Rel(filepath.Dir(rfl.baseFilePath), rfl.logFilePath)
+	if err != nil {
+		target = rfl.logFilePath
+	}
+	if err = os.Symlink(target, tmpPath); err != nil {
+		if err = os.Link(rfl.logFilePath, tmpPath); err != nil {
+			return AsError(err)
+		}
+	}
+	if err = os.Rename(tmpPath, rfl.baseFilePath); err != nil {
+		os.Remove(tmpPath)
+		return AsError(err)
+	}
+	return nil
+}
+
+/*
+isLinkOrMissing returns true if nothing is at filePath, or if it is a symlink or a hard link to one of the
+logger's files.
+*/
+func (rfl *RollingFileLogger) isLinkOrMissing(filePath string) bool {
+	info, err := os.Lstat(filePath)
+	if err != nil {
+		return os.IsNotExist(err)
+	}
+	if info.Mode()&os.ModeSymlink != 0 {
+		return true
+	}
+	filePaths, _ := rfl.rolledFilePaths()
+	for _, rolledFilePath := range filePaths {
+		if rolledInfo, err := os.Stat(rolledFilePath); err == nil && os.SameFile(info, rolledInfo) {
+			return true
+		}
+	}
+	return false
+}
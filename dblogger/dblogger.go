@@ -0,0 +1,345 @@
+/*
+Package dblogger provides a sherlog.Logger that inserts entries into a SQL table, so small deployments can query
+their errors with SQL instead of grep.
+*/
+package dblogger
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/Nick-Anderssohn/sherlog"
+)
+
+/*
+Dialect is the flavor of SQL the database speaks.
+*/
+type Dialect int
+
+const (
+	// SQLite uses ? placeholders and stores json as TEXT.
+	SQLite Dialect = iota
+	// Postgres uses $1 placeholders and stores json as JSONB.
+	Postgres
+)
+
+/*
+placeholder returns the placeholder for the nth (starting at 1) parameter of a statement.
+*/
+func (d Dialect) placeholder(n int) string {
+	if d == Postgres {
+		return "$" + strconv.Itoa(n)
+	}
+	return "?"
+}
+
+/*
+CreateTableSQL returns the statement that creates table with the columns DBLogger inserts into.
+*/
+func (d Dialect) CreateTableSQL(table string) string {
+	timestampType, jsonType := "TEXT", "TEXT"
+	if d == Postgres {
+		timestampType, jsonType = "TIMESTAMPTZ", "JSONB"
+	}
+	return "CREATE TABLE IF NOT EXISTS " + table + " (" +
+		"logged_at " + timestampType + " NOT NULL, " +
+		"level TEXT NOT NULL, " +
+		"message TEXT NOT NULL, " +
+		"stack " + jsonType + ", " +
+		"fields " + jsonType + ", " +
+		"code INTEGER)"
+}
+
+/*
+Options configures a DBLogger.
+*/
+type Options struct {
+	// Table is the table entries are inserted into. Defaults to "sherlog_entries".
+	Table string
+
+	// BatchSize is how many entries are buffered before they get inserted in a single transaction.
+	// Defaults to 1, which inserts every entry right away.
+	BatchSize int
+
+	// FlushInterval inserts buffered entries this often even if the batch isn't full. 0 turns it off.
+	FlushInterval time.Duration
+
+	// Retry is how failed batches are retried. Defaults to no retries. Every error is retried unless
+	// Retry.Retryable says otherwise. A batch that still fails is dropped and reported to the diagnostics logger
+	// (see sherlog.SetDiagnosticsLogger), so a database outage or a bad row can't make memory grow forever.
+	Retry sherlog.RetryPolicy
+}
+
+/*
+DBLogger inserts every entry as a row of a table with the columns:
+
+	logged_at   when the exception was created
+	level       the level label, or an empty string if there is none
+	message     the message
+	stack       the stack trace as json, or NULL (always NULL for LogNoStack)
+	fields      the fields (see sherlog.WithField) as json, or NULL
+	code        the http status set with sherlog.WithHTTPStatus, or NULL
+
+Entries are inserted in batches with a prepared statement. Use Dialect.CreateTableSQL to create the table:
+
+	db, _ := sql.Open("sqlite3", "errors.db")
+	db.Exec(dblogger.SQLite.CreateTableSQL("sherlog_entries"))
+	logger, _ := dblogger.New(db, dblogger.SQLite, dblogger.Options{BatchSize: 100, FlushInterval: time.Second})
+
+When Log is given multiple errors, only the first one is inserted. Is thread safe :)
+*/
+type DBLogger struct {
+	db         *sql.DB
+	insertStmt *sql.Stmt
+	options    Options
+	batch      [][]interface{}
+	mutex      *sync.Mutex
+	stop       chan struct{}
+	done       chan struct{}
+	callerSkip int
+}
+
+/*
+New creates a new DBLogger that inserts into db. The table has to exist already.
+*/
+func New(db *sql.DB, dialect Dialect, options Options) (*DBLogger, error) {
+	if options.Table == "" {
+		options.Table = "sherlog_entries"
+	}
+	if options.BatchSize < 1 {
+		options.BatchSize = 1
+	}
+	if options.Retry.Retryable == nil {
+		options.Retry.Retryable = func(err error) bool { return true }
+	}
+
+	placeholders := make([]string, 6)
+	for i := range placeholders {
+		placeholders[i] = dialect.placeholder(i + 1)
+	}
+	insertStmt, err := db.Prepare("INSERT INTO " + options.Table + " (logged_at, level, message, stack, fields, code) VALUES (" + strings.Join(placeholders, ", ") + ")")
+	if err != nil {
+		return nil, sherlog.AsError(err)
+	}
+
+	dl := &DBLogger{
+		db:         db,
+		insertStmt: insertStmt,
+		options:    options,
+		mutex:      new(sync.Mutex),
+	}
+	if options.FlushInterval > 0 {
+		dl.stop = make(chan struct{})
+		dl.done = make(chan struct{})
+		go dl.flushPeriodically()
+	}
+	return dl, nil
+}
+
+/*
+SetCallerSkip sets how many extra stack frames are skipped when the leveled functions create a new exception,
+like sherlog.FileLogger.SetCallerSkip.
+*/
+func (dl *DBLogger) SetCallerSkip(skip int) {
+	dl.callerSkip = skip
+}
+
+func (dl *DBLogger) flushPeriodically() {
+	defer close(dl.done)
+	ticker := time.NewTicker(dl.options.FlushInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			dl.Flush()
+		case <-dl.stop:
+			return
+		}
+	}
+}
+
+/*
+row turns toLog into the values of a row.
+*/
+func row(toLog interface{}, includeStack bool) ([]interface{}, error) {
+	entry := sherlog.NewEntry(toLog)
+	var stack, fields, code interface{}
+	if includeStack && len(entry.StackTrace) > 0 {
+		stackBytes, err := json.Marshal(entry.StackTrace)
+		if err != nil {
+			return nil, err
+		}
+		stack = string(stackBytes)
+	}
+	if len(entry.Fields) > 0 {
+		fieldsBytes, err := json.Marshal(entry.Fields)
+		if err != nil {
+			return nil, err
+		}
+		fields = string(fieldsBytes)
+	}
+	if entry.HTTPStatus > 0 {
+		code = entry.HTTPStatus
+	}
+	return []interface{}{entry.Time, entry.LevelLabel(), entry.Message, stack, fields, code}, nil
+}
+
+/*
+add buffers a row and inserts the batch if it is full.
+*/
+func (dl *DBLogger) add(toLog interface{}, includeStack bool) error {
+	if toLog == nil {
+		return nil // Logging nil is a no-op, like it is for sherlog's own loggers
+	}
+	values, err := row(toLog, includeStack)
+	if err != nil {
+		return sherlog.AsError(err)
+	}
+	dl.mutex.Lock()
+	defer dl.mutex.Unlock()
+	dl.batch = append(dl.batch, values)
+	if len(dl.batch) < dl.options.BatchSize {
+		return nil
+	}
+	return dl.flush()
+}
+
+/*
+Flush inserts every buffered entry.
+*/
+func (dl *DBLogger) Flush() error {
+	dl.mutex.Lock()
+	defer dl.mutex.Unlock()
+	return dl.flush()
+}
+
+/*
+flush inserts the batch, retrying as the options say. The batch is dropped even if inserting it fails so that a
+database outage can't make memory grow forever. The mutex must be held.
+*/
+func (dl *DBLogger) flush() error {
+	if len(dl.batch) == 0 {
+		return nil
+	}
+	batch := dl.batch
+	dl.batch = nil
+	err := dl.options.Retry.Do(context.Background(), func() error {
+		return dl.insert(batch)
+	})
+	if err != nil {
+		sherlog.Diagnose(sherlog.NewWarning(fmt.Sprintf("dropped %d entries that could not be inserted into %s", len(batch), dl.options.Table)))
+	}
+	return err
+}
+
+/*
+insert inserts batch in a single transaction.
+*/
+func (dl *DBLogger) insert(batch [][]interface{}) error {
+	tx, err := dl.db.Begin()
+	if err != nil {
+		return sherlog.AsError(err)
+	}
+	stmt := tx.Stmt(dl.insertStmt)
+	for _, values := range batch {
+		if _, err = stmt.Exec(values...); err != nil {
+			tx.Rollback()
+			return sherlog.AsError(err)
+		}
+	}
+	if err = tx.Commit(); err != nil {
+		return sherlog.AsError(err)
+	}
+	return nil
+}
+
+/*
+Log inserts the first value of errorsToLog.
+*/
+func (dl *DBLogger) Log(errorsToLog ...interface{}) error {
+	if len(errorsToLog) < 1 {
+		return sherlog.AsError("no parameters provided to Log")
+	}
+	return dl.add(errorsToLog[0], true)
+}
+
+/*
+LogNoStack inserts errToLog without its stack trace.
+*/
+func (dl *DBLogger) LogNoStack(errToLog error) error {
+	return dl.add(errToLog, false)
+}
+
+/*
+LogJson inserts errToLog. Rows are already structured, so it is the same as Log.
+*/
+func (dl *DBLogger) LogJson(errToLog error) error {
+	return dl.add(errToLog, true)
+}
+
+/*
+Close inserts every buffered entry and closes the prepared statement. The *sql.DB is left open since it
+belongs to the caller.
+*/
+func (dl *DBLogger) Close() {
+	if dl.stop != nil {
+		close(dl.stop)
+		<-dl.done
+	}
+	dl.Flush()
+	dl.insertStmt.Close()
+}
+
+/*
+Critical turns values into a *LeveledException with level CRITICAL and then calls the logger's
+Log function.
+*/
+func (dl *DBLogger) Critical(values ...interface{}) error {
+	return dl.Log(sherlog.GraduateWithSkip(sherlog.EnumCritical, dl.callerSkip, values...))
+}
+
+/*
+Error turns values into a *LeveledException with level ERROR and then calls the logger's
+Log function.
+*/
+func (dl *DBLogger) Error(values ...interface{}) error {
+	return dl.Log(sherlog.GraduateWithSkip(sherlog.EnumError, dl.callerSkip, values...))
+}
+
+/*
+OpsError turns values into a *LeveledException with level OPS_ERROR and then calls the logger's
+Log function.
+*/
+func (dl *DBLogger) OpsError(values ...interface{}) error {
+	return dl.Log(sherlog.GraduateWithSkip(sherlog.EnumOpsError, dl.callerSkip, values...))
+}
+
+/*
+Warn turns values into a *LeveledException with level WARNING and then calls the logger's
+Log function.
+*/
+func (dl *DBLogger) Warn(values ...interface{}) error {
+	return dl.Log(sherlog.GraduateWithSkip(sherlog.EnumWarning, dl.callerSkip, values...))
+}
+
+/*
+Info turns values into a *LeveledException with level INFO and then calls the logger's
+Log function.
+*/
+func (dl *DBLogger) Info(values ...interface{}) error {
+	return dl.Log(sherlog.GraduateWithSkip(sherlog.EnumInfo, dl.callerSkip, values...))
+}
+
+/*
+Debug turns values into a *LeveledException with level DEBUG and then calls the logger's
+Log function.
+*/
+func (dl *DBLogger) Debug(values ...interface{}) error {
+	return dl.Log(sherlog.GraduateWithSkip(sherlog.EnumDebug, dl.callerSkip, values...))
+}
@@ -0,0 +1,127 @@
+package dblogger
+
+import (
+	"bytes"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/Nick-Anderssohn/sherlog"
+)
+
+// recordingDriver is a database/sql driver that keeps the args of every insert.
+type recordingDriver struct {
+	mutex    sync.Mutex
+	prepared []string
+	rows     [][]driver.Value
+	commits  int
+	failures int // How many more Execs fail
+}
+
+func (rd *recordingDriver) Open(name string) (driver.Conn, error) { return &recordingConn{rd}, nil }
+
+type recordingConn struct{ driver *recordingDriver }
+
+func (rc *recordingConn) Prepare(query string) (driver.Stmt, error) {
+	rc.driver.mutex.Lock()
+	defer rc.driver.mutex.Unlock()
+	rc.driver.prepared = append(rc.driver.prepared, query)
+	return &recordingStmt{rc.driver}, nil
+}
+func (rc *recordingConn) Close() error              { return nil }
+func (rc *recordingConn) Begin() (driver.Tx, error) { return &recordingTx{rc.driver}, nil }
+
+type recordingStmt struct{ driver *recordingDriver }
+
+func (rs *recordingStmt) Close() error  { return nil }
+func (rs *recordingStmt) NumInput() int { return 6 }
+func (rs *recordingStmt) Exec(args []driver.Value) (driver.Result, error) {
+	rs.driver.mutex.Lock()
+	defer rs.driver.mutex.Unlock()
+	if rs.driver.failures > 0 {
+		rs.driver.failures--
+		return nil, errors.New("database is down")
+	}
+	rs.driver.rows = append(rs.driver.rows, args)
+	return driver.RowsAffected(1), nil
+}
+func (rs *recordingStmt) Query(args []driver.Value) (driver.Rows, error) { return nil, driver.ErrSkip }
+
+type recordingTx struct{ driver *recordingDriver }
+
+func (rt *recordingTx) Commit() error {
+	rt.driver.mutex.Lock()
+	defer rt.driver.mutex.Unlock()
+	rt.driver.commits++
+	return nil
+}
+func (rt *recordingTx) Rollback() error { return nil }
+
+func TestDBLogger(t *testing.T) {
+	recorder := &recordingDriver{}
+	sql.Register("recording", recorder)
+	db, err := sql.Open("recording", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	logger, err := New(db, Postgres, Options{BatchSize: 2})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(recorder.prepared[0], "INSERT INTO sherlog_entries") || !strings.Contains(recorder.prepared[0], "$6)") {
+		t.Error("wrong insert statement:", recorder.prepared[0])
+	}
+
+	logger.Error("first")
+	if len(recorder.rows) != 0 {
+		t.Error("entry was inserted before the batch was full")
+	}
+	logger.LogNoStack(sherlog.WithField(sherlog.WithHTTPStatus(sherlog.NewWarning("second"), 404), "user", 42))
+	logger.Info("third")
+	logger.Close()
+
+	if len(recorder.rows) != 3 || recorder.commits != 2 {
+		t.Fatal("wrong number of rows or transactions:", len(recorder.rows), recorder.commits)
+	}
+	first, second := recorder.rows[0], recorder.rows[1]
+	if first[1] != "ERROR" || first[2] != "first" || !strings.Contains(first[3].(string), "TestDBLogger") {
+		t.Error("wrong first row:", first)
+	}
+	if second[1] != "WARNING" || second[3] != nil || second[4] != `{"user":42}` || second[5] != int64(404) {
+		t.Error("wrong second row:", second)
+	}
+}
+
+func TestDBLoggerDropsFailedBatches(t *testing.T) {
+	recorder := &recordingDriver{failures: 3}
+	sql.Register("failing", recorder)
+	db, err := sql.Open("failing", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	var diagnostics bytes.Buffer
+	sherlog.SetDiagnosticsLogger(sherlog.NewMultiWriterLogger(&diagnostics))
+	defer sherlog.SetDiagnosticsLogger(nil)
+
+	logger, err := New(db, SQLite, Options{Retry: sherlog.RetryPolicy{MaxAttempts: 2, InitialBackoff: time.Millisecond}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer logger.Close()
+	if logger.Error("lost") == nil {
+		t.Error("a batch that failed every attempt did not return an error")
+	}
+	if !strings.Contains(diagnostics.String(), "dropped 1 entries that could not be inserted into sherlog_entries") {
+		t.Error("the dropped batch was not reported:", diagnostics.String())
+	}
+	if logger.Error("retried") != nil || len(recorder.rows) != 1 || recorder.rows[0][2] != "retried" {
+		t.Error("the dropped batch was kept, or a failed insert was not retried:", recorder.rows)
+	}
+}
@@ -77,9 +77,9 @@ func (le LevelEnum) GetLabel() string {
 
 /*
 AsCritical graduates a normal error to a LeveledException with error level CRITICAL.
-If err is already a LevelWrapper, then it's level will be changed to CRITICAL without
-overriding the stack trace. As of 1.7.0: if multiple values are passed in, then they will
-be concatenated before returning the error.
+If err is already a LevelWrapper, then DefaultLevelPolicy decides whether it's level will be
+changed to CRITICAL. The stack trace is never overridden. As of 1.7.0: if multiple values are
+passed in, then they will be concatenated before returning the error.
 */
 func AsCritical(values ...interface{}) error {
 	return graduateOrConcatAndCreate(EnumCritical, values...)
@@ -87,9 +87,9 @@ func AsCritical(values ...interface{}) error {
 
 /*
 AsError graduates a normal error to a LeveledException with error level ERROR.
-If err is already a LevelWrapper, then it's level will be changed to ERROR without
-overriding the stack trace. As of 1.7.0: if multiple values are passed in, then they will
-be concatenated before returning the error.
+If err is already a LevelWrapper, then DefaultLevelPolicy decides whether it's level will be
+changed to ERROR. The stack trace is never overridden. As of 1.7.0: if multiple values are
+passed in, then they will be concatenated before returning the error.
 */
 func AsError(values ...interface{}) error {
 	return graduateOrConcatAndCreate(EnumError, values...)
@@ -97,9 +97,9 @@ func AsError(values ...interface{}) error {
 
 /*
 AsOpsError graduates a normal error to a LeveledException with error level OPS_ERROR.
-If err is already a LevelWrapper, then it's level will be changed to OPS_ERROR without
-overriding the stack trace. As of 1.7.0: if multiple values are passed in, then they will
-be concatenated before returning the error.
+If err is already a LevelWrapper, then DefaultLevelPolicy decides whether it's level will be
+changed to OPS_ERROR. The stack trace is never overridden. As of 1.7.0: if multiple values are
+passed in, then they will be concatenated before returning the error.
 */
 func AsOpsError(values ...interface{}) error {
 	return graduateOrConcatAndCreate(EnumOpsError, values...)
@@ -107,9 +107,9 @@ func AsOpsError(values ...interface{}) error {
 
 /*
 AsWarning graduates a normal error to a LeveledException with error level WARNING.
-If err is already a LevelWrapper, then it's level will be changed to WARNING without
-overriding the stack trace. As of 1.7.0: if multiple values are passed in, then they will
-be concatenated before returning the error.
+If err is already a LevelWrapper, then DefaultLevelPolicy decides whether it's level will be
+changed to WARNING. The stack trace is never overridden. As of 1.7.0: if multiple values are
+passed in, then they will be concatenated before returning the error.
 */
 func AsWarning(values ...interface{}) error {
 	return graduateOrConcatAndCreate(EnumWarning, values...)
@@ -117,9 +117,9 @@ func AsWarning(values ...interface{}) error {
 
 /*
 AsInfo graduates a normal error to a LeveledException with error level INFO.
-If err is already a LevelWrapper, then it's level will be changed to INFO without
-overriding the stack trace. As of 1.7.0: if multiple values are passed in, then they will
-be concatenated before returning the error.
+If err is already a LevelWrapper, then DefaultLevelPolicy decides whether it's level will be
+changed to INFO. The stack trace is never overridden. As of 1.7.0: if multiple values are
+passed in, then they will be concatenated before returning the error.
 */
 func AsInfo(values ...interface{}) error {
 	return graduateOrConcatAndCreate(EnumInfo, values...)
@@ -127,9 +127,9 @@ func AsInfo(values ...interface{}) error {
 
 /*
 AsDebug graduates a normal error to a LeveledException with error level DEBUG.
-If err is already a LevelWrapper, then it's level will be changed to DEBUG without
-overriding the stack trace. As of 1.7.0: if multiple values are passed in, then they will
-be concatenated before returning the error.
+If err is already a LevelWrapper, then DefaultLevelPolicy decides whether it's level will be
+changed to DEBUG. The stack trace is never overridden. As of 1.7.0: if multiple values are
+passed in, then they will be concatenated before returning the error.
 */
 func AsDebug(values ...interface{}) error {
 	return graduateOrConcatAndCreate(EnumDebug, values...)
@@ -140,19 +140,27 @@ graduateOrConcatAndCreate was added in 1.7.0 to extend the behavior of the AsFoo
 so that they can accept multiple arguments.
 */
 func graduateOrConcatAndCreate(level Level, values ...interface{}) error {
+	return graduateOrConcatAndCreateWithPolicy(level, DefaultLevelPolicy, 8, values...)
+}
+
+/*
+graduateOrConcatAndCreateWithPolicy is graduateOrConcatAndCreate with control over the LevelPolicy.
+skip is passed on to the stack trace if a new exception needs to be created.
+*/
+func graduateOrConcatAndCreateWithPolicy(level Level, policy LevelPolicy, skip int, values ...interface{}) error {
 	// If values simply contains one err, maintain behavior from 1.6.2
 	if len(values) == 1 {
 		err, ok := values[0].(error)
 		if ok {
-			return errorToLeveledError(err, level, 7)
+			return errorToLeveledErrorWithPolicy(err, level, policy, skip)
 		}
 		if values[0] == nil {
 			return nil
 		}
 	}
 
-	// ^1.7.0 will concatenate values into an error
-	return errorToLeveledError(fmt.Errorf(fmt.Sprint(values...)), level, 7)
+	// ^1.7.0 will concatenate values into an error. There is one less function call in between, so skip one less frame.
+	return newLeveledException(fmt.Sprint(values...), level, defaultStackTraceDepth, skip-1)
 }
 
 /*
@@ -161,15 +169,41 @@ If err is already a *LeveledException, then it's level will be changed without c
 a new stack trace.
 */
 func errorToLeveledError(err error, level Level, skip int) error {
+	return errorToLeveledErrorWithPolicy(err, level, Overwrite, skip+1)
+}
+
+/*
+errorToLeveledErrorWithPolicy graduates a normal error to a LeveledException with the specified level.
+If err is already a *LeveledException, then policy decides whether it's level will be changed. A new stack
+trace is never created for an existing *LeveledException. If it was already logged, it is copied (see WithLevel)
+instead of changed, since loggers may still be reading it. Otherwise, err is kept as the cause of the new
+LeveledException so that it can still be reached with Unwrap. If err (or an error it wraps) already carries a stack
+trace, such as errors from github.com/pkg/errors, the new LeveledException uses that stack trace instead of one
+pointing at where err was graduated.
+*/
+func errorToLeveledErrorWithPolicy(err error, level Level, policy LevelPolicy, skip int) error {
 	if err == nil {
 		return nil
 	}
 	leveledException, ok := err.(*LeveledException)
 	if ok {
+		if !shouldReplaceLevel(leveledException.GetLevel(), level, policy) {
+			return leveledException
+		}
+		if leveledException.isShared() {
+			return leveledException.WithLevel(level)
+		}
 		leveledException.SetLevel(level)
 		return leveledException
 	}
-	return newLeveledException(err.Error(), level, defaultStackTraceDepth, skip)
+	if stackTrace := thirdPartyStackTrace(err); stackTrace != nil {
+		leveledException = &LeveledException{level: level}
+		leveledException.StdException.initWithStackTrace(err.Error(), stackTrace, defaultStackTraceDepth)
+	} else {
+		leveledException = newLeveledException(err.Error(), level, defaultStackTraceDepth, skip)
+	}
+	leveledException.cause = err
+	return leveledException
 }
 
 /*
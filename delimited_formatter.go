@@ -0,0 +1,84 @@
+package sherlog
+
+import (
+	"bytes"
+	"encoding/csv"
+	"strconv"
+	"strings"
+)
+
+var delimitedEscaper = strings.NewReplacer("\\", "\\\\", "\n", "\\n", "\r", "\\r", "\t", "\\t")
+
+/*
+DelimitedFormatter is a Formatter that writes one CSV (or TSV) row per entry, which makes it easy to pull an
+incident window into a spreadsheet. The columns are:
+
+	timestamp,level,message,top frame,code
+
+code is the http status set with WithHTTPStatus, or empty. Newlines and tabs inside of values are escaped
+as \n and \t so that every entry stays on one row. The full stack trace is dropped.
+*/
+type DelimitedFormatter struct {
+	Comma rune
+}
+
+/*
+NewCSVFormatter returns a new DelimitedFormatter that separates values with commas.
+*/
+func NewCSVFormatter() *DelimitedFormatter {
+	return &DelimitedFormatter{Comma: ','}
+}
+
+/*
+NewTSVFormatter returns a new DelimitedFormatter that separates values with tabs.
+*/
+func NewTSVFormatter() *DelimitedFormatter {
+	return &DelimitedFormatter{Comma: '\t'}
+}
+
+/*
+Header returns the header row (without a trailing newline). Write it once at the top of a new file if you want one.
+*/
+func (df *DelimitedFormatter) Header() []byte {
+	row, _ := df.formatRow([]string{"timestamp", "level", "message", "top frame", "code"})
+	return row
+}
+
+/*
+Format turns entry into a single row.
+*/
+func (df *DelimitedFormatter) Format(entry *Entry) ([]byte, error) {
+	var topFrame string
+	if len(entry.StackTrace) > 0 {
+		topFrame = entry.StackTrace[0].String()
+	}
+	var code string
+	if entry.HTTPStatus > 0 {
+		code = strconv.Itoa(entry.HTTPStatus)
+	}
+
+	return df.formatRow([]string{
+		entry.FormattedTime(),
+		entry.LevelLabel(),
+		entry.Message,
+		topFrame,
+		code,
+	})
+}
+
+func (df *DelimitedFormatter) formatRow(values []string) ([]byte, error) {
+	var buf bytes.Buffer
+	writer := csv.NewWriter(&buf)
+	writer.Comma = df.Comma
+	for i, val := range values {
+		values[i] = delimitedEscaper.Replace(sanitizeText(val, false))
+	}
+	if err := writer.Write(values); err != nil {
+		return nil, err
+	}
+	writer.Flush()
+	if err := writer.Error(); err != nil {
+		return nil, err
+	}
+	return bytes.TrimRight(buf.Bytes(), "\r\n"), nil
+}
@@ -0,0 +1,58 @@
+package sherlog
+
+import (
+	"log"
+	"sync"
+)
+
+var diagnostics = struct {
+	logger Logger
+	mutex  sync.RWMutex
+}{}
+
+/*
+SetDiagnosticsLogger sets where sherlog reports its own problems and maintenance, so that the logging system
+itself can be observed. It gets:
+
+  - ERROR and OPS_ERROR: failures that were not returned to anyone, such as a logger failing inside a PolyLogger,
+    a scheduled roll failing, or a background batch failing to ship (see the Err* variables for their kinds)
+  - WARNING: entries that were dropped
+  - INFO: routine maintenance, such as expired files being deleted or a connection being re-established
+
+By default (and when logger is nil), ERROR, OPS_ERROR, and WARNING reports are printed with log.Println and
+INFO reports are discarded. If logger fails, the report and the failure are printed with log.Println. Don't use a
+logger whose failures would be reported to itself, such as a PolyLogger that contains it. Is thread safe :)
+*/
+func SetDiagnosticsLogger(logger Logger) {
+	diagnostics.mutex.Lock()
+	defer diagnostics.mutex.Unlock()
+	diagnostics.logger = logger
+}
+
+/*
+Diagnose reports report to the diagnostics logger (see SetDiagnosticsLogger), the way sherlog's own loggers report
+their problems. Use it in loggers that live outside of sherlog, such as a dropped batch in dblogger.
+*/
+func Diagnose(report error) {
+	diagnose(report)
+}
+
+/*
+diagnose reports report to the diagnostics logger.
+*/
+func diagnose(report error) {
+	diagnostics.mutex.RLock()
+	logger := diagnostics.logger
+	diagnostics.mutex.RUnlock()
+
+	if logger != nil {
+		if err := logger.Log(report); err != nil {
+			log.Println(report)
+			log.Println(err)
+		}
+		return
+	}
+	if level := LevelOf(report); level == nil || level.GetLevelId() < EnumInfo.GetLevelId() {
+		log.Println(report)
+	}
+}
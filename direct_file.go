@@ -0,0 +1,171 @@
+package sherlog
+
+import (
+	"io"
+	"os"
+	"sync"
+)
+
+const (
+	directBlockSize         = 4096
+	defaultDirectBufferSize = 1024 * 1024
+)
+
+/*
+DirectFileWriter appends to a file through an in-memory buffer that is written out in whole, aligned blocks. When
+built with the sherlog_odirect build tag on Linux, the file is opened with O_DIRECT so that writes skip the page
+cache, which keeps very high-volume logging from pushing the main application's data out of memory:
+
+	go build -tags sherlog_odirect
+
+	writer, _ := sherlog.OpenDirectFile("app.log", 0)
+	logger := sherlog.NewMultiWriterLogger(writer)
+
+Without the tag, on other systems, or on filesystems that don't support O_DIRECT (such as tmpfs), the file is
+opened normally and the buffer is appended as is. Use Direct to find out which one happened.
+
+Entries sit in the buffer until it fills up or Flush is called, so flush it periodically and before exiting
+(LogOnExit flushes it through the MultiWriterLogger). Is thread safe :)
+*/
+type DirectFileWriter struct {
+	file   *os.File
+	direct bool
+	buffer []byte
+	used   int
+	offset int64 // Where the buffer starts in the file. Always a multiple of directBlockSize when direct
+	mutex  *sync.Mutex
+}
+
+/*
+OpenDirectFile opens (or creates) the file at filePath for appending through a buffer of bufferSize bytes (1MB if
+bufferSize is 0 or less), rounded up to a multiple of the 4KB block size.
+*/
+func OpenDirectFile(filePath string, bufferSize int) (*DirectFileWriter, error) {
+	if bufferSize <= 0 {
+		bufferSize = defaultDirectBufferSize
+	}
+	bufferSize = (bufferSize + directBlockSize - 1) / directBlockSize * directBlockSize
+
+	dfw := &DirectFileWriter{
+		buffer: alignedBuffer(bufferSize),
+		mutex:  new(sync.Mutex),
+	}
+	file, err := openDirectFile(longPath(filePath))
+	if err == nil && file != nil {
+		dfw.file, dfw.direct = file, true
+		if err = dfw.loadTail(); err != nil {
+			file.Close()
+			return nil, AsError(err)
+		}
+		return dfw, nil
+	}
+	if dfw.file, err = openFile(filePath); err != nil {
+		return nil, AsError(err)
+	}
+	return dfw, nil
+}
+
+/*
+loadTail reads the last, partially filled block of the file into the buffer, since direct writes have to start at
+a block boundary.
+*/
+func (dfw *DirectFileWriter) loadTail() error {
+	info, err := dfw.file.Stat()
+	if err != nil {
+		return err
+	}
+	tailSize := int(info.Size() % directBlockSize)
+	dfw.offset = info.Size() - int64(tailSize)
+	if tailSize == 0 {
+		return nil
+	}
+	if _, err = dfw.file.ReadAt(dfw.buffer[:directBlockSize], dfw.offset); err != nil && err != io.EOF {
+		return err
+	}
+	dfw.used = tailSize
+	return nil
+}
+
+/*
+Direct returns true if the file was opened with O_DIRECT.
+*/
+func (dfw *DirectFileWriter) Direct() bool {
+	return dfw.direct
+}
+
+/*
+Write adds p to the buffer, writing the buffer to the file every time it fills up. Is thread safe :)
+*/
+func (dfw *DirectFileWriter) Write(p []byte) (int, error) {
+	dfw.mutex.Lock()
+	defer dfw.mutex.Unlock()
+	written := 0
+	for written < len(p) {
+		copied := copy(dfw.buffer[dfw.used:], p[written:])
+		dfw.used += copied
+		written += copied
+		if dfw.used == len(dfw.buffer) {
+			if err := dfw.flush(); err != nil {
+				return written, err
+			}
+		}
+	}
+	return written, nil
+}
+
+/*
+Flush writes the buffer to the file. Is thread safe :)
+*/
+func (dfw *DirectFileWriter) Flush() error {
+	dfw.mutex.Lock()
+	defer dfw.mutex.Unlock()
+	return dfw.flush()
+}
+
+/*
+flush writes the buffer to the file. When direct, the last block is padded with zeros to be written and the file is
+truncated back to its real size afterwards. The partial block stays in the buffer so that it is written again,
+together with what comes after it, next time. The mutex must be held.
+*/
+func (dfw *DirectFileWriter) flush() error {
+	if dfw.used == 0 {
+		return nil
+	}
+	if !dfw.direct {
+		_, err := dfw.file.Write(dfw.buffer[:dfw.used])
+		dfw.used = 0
+		return err
+	}
+
+	padded := (dfw.used + directBlockSize - 1) / directBlockSize * directBlockSize
+	for i := dfw.used; i < padded; i++ {
+		dfw.buffer[i] = 0
+	}
+	if _, err := dfw.file.WriteAt(dfw.buffer[:padded], dfw.offset); err != nil {
+		return err
+	}
+	if padded != dfw.used {
+		if err := dfw.file.Truncate(dfw.offset + int64(dfw.used)); err != nil {
+			return err
+		}
+	}
+
+	fullBlocks := dfw.used / directBlockSize * directBlockSize
+	copy(dfw.buffer, dfw.buffer[fullBlocks:dfw.used])
+	dfw.offset += int64(fullBlocks)
+	dfw.used -= fullBlocks
+	return nil
+}
+
+/*
+Close flushes the buffer and closes the file.
+*/
+func (dfw *DirectFileWriter) Close() error {
+	dfw.mutex.Lock()
+	defer dfw.mutex.Unlock()
+	err := dfw.flush()
+	if closeErr := dfw.file.Close(); err == nil {
+		err = closeErr
+	}
+	return err
+}
@@ -0,0 +1,34 @@
+//go:build linux && sherlog_odirect
+// +build linux,sherlog_odirect
+
+package sherlog
+
+import (
+	"os"
+	"syscall"
+	"unsafe"
+)
+
+/*
+openDirectFile opens filePath with O_DIRECT. Returns nil if the filesystem doesn't support it.
+*/
+func openDirectFile(filePath string) (*os.File, error) {
+	file, err := os.OpenFile(filePath, os.O_RDWR|os.O_CREATE|syscall.O_DIRECT, 0644)
+	if pathErr, isPathErr := err.(*os.PathError); isPathErr && pathErr.Err == syscall.EINVAL {
+		return nil, nil
+	}
+	return file, err
+}
+
+/*
+alignedBuffer returns a buffer of size bytes whose start is aligned to the block size, which O_DIRECT requires.
+*/
+func alignedBuffer(size int) []byte {
+	buffer := make([]byte, size+directBlockSize)
+	misalignment := int(uintptr(unsafe.Pointer(&buffer[0])) % directBlockSize)
+	start := 0
+	if misalignment != 0 {
+		start = directBlockSize - misalignment
+	}
+	return buffer[start : start+size : start+size]
+}
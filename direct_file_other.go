@@ -0,0 +1,20 @@
+//go:build !linux || !sherlog_odirect
+// +build !linux !sherlog_odirect
+
+package sherlog
+
+import "os"
+
+/*
+openDirectFile returns nil, since O_DIRECT is only used on Linux when built with the sherlog_odirect tag.
+*/
+func openDirectFile(filePath string) (*os.File, error) {
+	return nil, nil
+}
+
+/*
+alignedBuffer returns a buffer of size bytes. It doesn't have to be aligned without O_DIRECT.
+*/
+func alignedBuffer(size int) []byte {
+	return make([]byte, size)
+}
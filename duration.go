@@ -0,0 +1,76 @@
+package sherlog
+
+import (
+	"io"
+	"time"
+)
+
+/*
+DurationWrapper is something that holds how long an operation took.
+*/
+type DurationWrapper interface {
+	GetDuration() time.Duration
+	SetDuration(duration time.Duration)
+}
+
+/*
+Timer measures how long an operation takes. It uses the monotonic clock, so changes to the wall clock don't
+affect it.
+*/
+type Timer struct {
+	start time.Time
+}
+
+/*
+StartTimer returns a Timer that started now. Use it to log how long an operation took:
+
+	timer := sherlog.StartTimer()
+	rows, err := db.Query(query)
+	if timer.Elapsed() > time.Second {
+		logger.Warn(sherlog.WithDuration(sherlog.NewWarning("query took longer than expected"), timer.Elapsed()))
+	}
+*/
+func StartTimer() *Timer {
+	return &Timer{start: time.Now()}
+}
+
+/*
+Elapsed returns how long it has been since the timer was started.
+*/
+func (t *Timer) Elapsed() time.Duration {
+	return time.Since(t.start)
+}
+
+/*
+WithDuration attaches duration to err if err is a DurationWrapper (all sherlog exceptions are). It shows up as
+"(took 1.234s)" after the message in text output and as "DurationMs" (in milliseconds) in json output.
+Returns err, or a copy of it if err was already logged.
+*/
+func WithDuration(err error, duration time.Duration) error {
+	err = unshared(err)
+	if wrapper, ok := err.(DurationWrapper); ok {
+		wrapper.SetDuration(duration)
+	}
+	return err
+}
+
+/*
+writeDuration writes " (took 1.234s)" to writer if there is a duration.
+*/
+func writeDuration(writer io.Writer, duration time.Duration) error {
+	if duration == 0 {
+		return nil
+	}
+	if duration >= time.Millisecond {
+		duration = duration.Round(time.Millisecond)
+	}
+	_, err := writer.Write([]byte(" (took " + duration.String() + ")"))
+	return err
+}
+
+/*
+durationMillis returns duration in milliseconds.
+*/
+func durationMillis(duration time.Duration) float64 {
+	return float64(duration) / float64(time.Millisecond)
+}
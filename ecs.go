@@ -0,0 +1,95 @@
+package sherlog
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+)
+
+/*
+ecsVersion is the version of the Elastic Common Schema that ECSFormatter follows.
+*/
+const ecsVersion = "1.6.0"
+
+/*
+ECSFormatter is a Formatter that writes json using Elastic Common Schema (ECS) field names so that
+entries can go straight into Elasticsearch/Kibana without an ingest pipeline. Entries look like this:
+
+	{
+	   "@timestamp":"2018-10-03T07:51:14.123Z",
+	   "ecs":{"version":"1.6.0"},
+	   "log":{"level":"ERROR"},
+	   "message":"could not connect to postgres",
+	   "error":{
+		  "message":"could not connect to postgres",
+		  "type":"*errors.errorString",
+		  "stack_trace":"\tgithub.com/Nick-Anderssohn/sherlog.TestLogJson(/home/nick/go/src/github.com/Nick-Anderssohn/sherlog/scratch_test.go:68)"
+	   },
+	   "service":{"name":"user-service"}
+	}
+
+error.type is the Go type of the root cause of the error.
+*/
+type ECSFormatter struct {
+	ServiceName string
+}
+
+/*
+NewECSFormatter returns a new ECSFormatter. serviceName is used for service.name. If it is empty, the name set
+with SetServiceInfo is used instead. service.version always comes from SetServiceInfo.
+*/
+func NewECSFormatter(serviceName string) *ECSFormatter {
+	return &ECSFormatter{ServiceName: serviceName}
+}
+
+/*
+Format turns entry into an ECS json blob.
+*/
+func (ef *ECSFormatter) Format(entry *Entry) ([]byte, error) {
+	return json.Marshal(ef.ToECSMap(entry))
+}
+
+/*
+ToECSMap creates the map[string]interface{} that Format marshals.
+*/
+func (ef *ECSFormatter) ToECSMap(entry *Entry) map[string]interface{} {
+	ecsMap := map[string]interface{}{
+		"@timestamp": entry.Time.UTC().Format(time.RFC3339Nano),
+		"ecs":        map[string]interface{}{"version": ecsVersion},
+		"message":    entry.Message,
+	}
+	if entry.Level != nil {
+		ecsMap["log"] = map[string]interface{}{"level": entry.Level.GetLabel()}
+	}
+	if entry.Err != nil {
+		errMap := map[string]interface{}{
+			"message": entry.Message,
+			"type":    fmt.Sprintf("%T", RootCause(entry.Err)),
+		}
+		if len(entry.StackTrace) > 0 {
+			errMap["stack_trace"] = entry.StackTraceAsString()
+		}
+		ecsMap["error"] = errMap
+	}
+	serviceMap := map[string]interface{}{}
+	if serviceName := ef.serviceName(); serviceName != "" {
+		serviceMap["name"] = serviceName
+	}
+	if serviceInfo.Version != "" {
+		serviceMap["version"] = serviceInfo.Version
+	}
+	if len(serviceMap) > 0 {
+		ecsMap["service"] = serviceMap
+	}
+	if entry.CorrelationID != "" {
+		ecsMap["trace"] = map[string]interface{}{"id": entry.CorrelationID}
+	}
+	return ecsMap
+}
+
+func (ef *ECSFormatter) serviceName() string {
+	if ef.ServiceName != "" {
+		return ef.ServiceName
+	}
+	return serviceInfo.Name
+}
@@ -0,0 +1,101 @@
+package sherlog
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"reflect"
+	"strings"
+)
+
+/*
+detailPrinter collects what an error that implements xerrors.Formatter prints about itself. It has the methods of
+xerrors.Printer, so it can be passed to FormatError without sherlog having to depend on xerrors.
+*/
+type detailPrinter struct {
+	buf strings.Builder
+}
+
+func (dp *detailPrinter) Print(args ...interface{}) {
+	dp.buf.WriteString(fmt.Sprint(args...))
+}
+
+func (dp *detailPrinter) Printf(format string, args ...interface{}) {
+	fmt.Fprintf(&dp.buf, format, args...)
+}
+
+/*
+Detail always returns true so that errors print everything they know, such as the frame they were created in.
+*/
+func (dp *detailPrinter) Detail() bool {
+	return true
+}
+
+/*
+ErrorDetail returns what the errors in err's Unwrap chain that implement xerrors.Formatter print about themselves
+when asked for detail, like they do for %+v. Each of them usually prints its message and the frame it was created
+in. Outermost first, one error after another. Returns an empty string if no error in the chain implements
+xerrors.Formatter.
+
+Text output writes the detail under the stack trace, and json output writes it as "Detail".
+*/
+func ErrorDetail(err error) string {
+	var details []string
+	walkChain(err, func(cur error) bool {
+		if detail := formatErrorDetail(cur); detail != "" {
+			details = append(details, detail)
+		}
+		return true
+	})
+	return strings.Join(details, "\n")
+}
+
+/*
+formatErrorDetail calls err's FormatError method with a detailPrinter and returns what it printed, or an empty
+string if err doesn't have a FormatError method that takes an xerrors.Printer. Reflection is used since the
+method's parameter is xerrors.Printer rather than a type sherlog knows.
+*/
+func formatErrorDetail(err error) string {
+	method := reflect.ValueOf(err).MethodByName("FormatError")
+	if !method.IsValid() {
+		return ""
+	}
+	printer := &detailPrinter{}
+	methodType := method.Type()
+	if methodType.NumIn() != 1 || methodType.In(0).Kind() != reflect.Interface ||
+		!reflect.TypeOf(printer).Implements(methodType.In(0)) {
+		return ""
+	}
+	method.Call([]reflect.Value{reflect.ValueOf(printer)})
+	return strings.TrimSpace(printer.buf.String())
+}
+
+/*
+writeErrorDetail writes the detail of err (see ErrorDetail), if it has any, after a stack trace:
+
+	Detail:
+	    read config
+	    main.loadConfig
+	        /app/config.go:31
+
+Every line is indented by four spaces and blank lines are left out, so that the detail can't be mistaken for
+stack trace frames or for the end of the entry.
+*/
+func writeErrorDetail(writer io.Writer, err error) error {
+	detail := ErrorDetail(err)
+	if detail == "" {
+		return nil
+	}
+	var buf bytes.Buffer
+	buf.WriteString("\nDetail:")
+	for _, line := range strings.Split(detail, "\n") {
+		line = strings.TrimRight(line, " \t\r")
+		if line == "" {
+			continue
+		}
+		buf.WriteString("\n    ")
+		buf.WriteString(sanitizeText(line, true))
+	}
+	_, err = writer.Write(buf.Bytes())
+	return err
+}
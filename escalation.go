@@ -0,0 +1,166 @@
+package sherlog
+
+import (
+	"sync"
+	"time"
+)
+
+// EscalatedFromField is the field that an Escalator puts the original level of an escalated entry in.
+const EscalatedFromField = "escalated_from"
+
+/*
+EscalationRule says that once more than Threshold entries at Level (and with Fingerprint, if it is set) were
+logged within Window, the ones after that are logged at EscalateTo instead.
+*/
+type EscalationRule struct {
+	// Level is the level of the entries that are counted. Required.
+	Level Level
+
+	// Fingerprint limits the rule to the entries with this fingerprint (see Fingerprint). If it is empty, the
+	// entries of each fingerprint are counted separately.
+	Fingerprint string
+
+	// Threshold is how many entries are allowed within Window before the ones after that are escalated.
+	Threshold int
+
+	// Window is how far back entries are counted.
+	Window time.Duration
+
+	// EscalateTo is the level that entries are escalated to. Defaults to EnumCritical.
+	EscalateTo Level
+}
+
+/*
+escalationKey identifies the entries that are counted together.
+*/
+type escalationKey struct {
+	rule        int
+	fingerprint string
+}
+
+/*
+Escalator is a Middleware that escalates entries when they happen too often, so that alerting catches a degradation
+that no single entry would trigger:
+
+	escalator := sherlog.NewEscalator(sherlog.EscalationRule{
+		Level:     sherlog.EnumOpsError,
+		Threshold: 50,
+		Window:    5 * time.Minute,
+	})
+	logger.Use(escalator.Escalate)
+
+With that rule, the 51st OPS_ERROR with the same fingerprint within 5 minutes (and every one after it, until they
+slow down) is logged as CRITICAL, with the original level in the escalated_from field. The first rule that matches
+an entry decides what happens to it. Entries are copied before they are escalated, so the caller's exception keeps
+its level. When Log is given multiple errors, only the first one is looked at. Is thread safe :)
+*/
+type Escalator struct {
+	rules       []EscalationRule
+	occurrences map[escalationKey][]time.Time
+	lastPrune   time.Time
+	mutex       *sync.Mutex
+}
+
+/*
+NewEscalator returns a new Escalator that follows rules. Fills in the defaults of rules.
+*/
+func NewEscalator(rules ...EscalationRule) *Escalator {
+	rules = append([]EscalationRule(nil), rules...)
+	for i := range rules {
+		if rules[i].EscalateTo == nil {
+			rules[i].EscalateTo = EnumCritical
+		}
+		if rules[i].Threshold < 0 {
+			rules[i].Threshold = 0
+		}
+	}
+	return &Escalator{
+		rules:       rules,
+		occurrences: map[escalationKey][]time.Time{},
+		lastPrune:   Clock(),
+		mutex:       new(sync.Mutex),
+	}
+}
+
+/*
+Escalate is the Middleware. Pass it to Use.
+*/
+func (e *Escalator) Escalate(next LogFunc) LogFunc {
+	return func(values ...interface{}) error {
+		if len(values) > 0 {
+			if err, isErr := values[0].(error); isErr {
+				if escalated := e.escalate(err); escalated != err {
+					values = append([]interface{}{escalated}, values[1:]...)
+				}
+			}
+		}
+		return next(values...)
+	}
+}
+
+/*
+escalate counts err and returns the escalated copy of it if there were too many like it, or err as is otherwise.
+*/
+func (e *Escalator) escalate(err error) error {
+	level := LevelOf(err)
+	if level == nil {
+		return err
+	}
+	var fingerprint string
+	for i, rule := range e.rules {
+		if rule.Level == nil || rule.Level.GetLevelId() != level.GetLevelId() {
+			continue
+		}
+		if fingerprint == "" {
+			fingerprint = Fingerprint(err)
+		}
+		if rule.Fingerprint != "" && rule.Fingerprint != fingerprint {
+			continue
+		}
+		if !e.exceeded(escalationKey{rule: i, fingerprint: fingerprint}, rule) {
+			return err
+		}
+		var escalated error
+		if leveledException, isLeveled := err.(*LeveledException); isLeveled {
+			escalated = leveledException.WithLevel(rule.EscalateTo)
+		} else {
+			escalated = GraduateWithPolicy(rule.EscalateTo, Overwrite, err)
+		}
+		return WithField(escalated, EscalatedFromField, level.GetLabel())
+	}
+	return err
+}
+
+/*
+exceeded records an occurrence for key and returns true if there have now been more than rule.Threshold of them
+within rule.Window. Only the last Threshold+1 occurrences are kept, since that's all it takes to tell.
+*/
+func (e *Escalator) exceeded(key escalationKey, rule EscalationRule) bool {
+	now := Clock()
+	e.mutex.Lock()
+	defer e.mutex.Unlock()
+	e.pruneIfDue(now)
+
+	occurrences := append(e.occurrences[key], now)
+	if len(occurrences) > rule.Threshold+1 {
+		occurrences = append(occurrences[:0], occurrences[len(occurrences)-rule.Threshold-1:]...)
+	}
+	e.occurrences[key] = occurrences
+	return len(occurrences) > rule.Threshold && now.Sub(occurrences[0]) <= rule.Window
+}
+
+/*
+pruneIfDue forgets the keys that haven't occurred within their rule's window, at most once per minute, so that
+rules without a Fingerprint don't keep every fingerprint they ever saw. The mutex must be held.
+*/
+func (e *Escalator) pruneIfDue(now time.Time) {
+	if now.Sub(e.lastPrune) < time.Minute {
+		return
+	}
+	e.lastPrune = now
+	for key, occurrences := range e.occurrences {
+		if now.Sub(occurrences[len(occurrences)-1]) > e.rules[key.rule].Window {
+			delete(e.occurrences, key)
+		}
+	}
+}
@@ -40,9 +40,9 @@ func ExampleReturnError() error {
 	if err != nil {
 		// funcThatReturnsError already called sherlog.AsError, but
 		// if I called sherlog.AsError again, it wouldn't matter. The AsError would detect that the
-		// error already has a stack trace and would not overwrite it. However, it would overwrite the
-		// log level if it had a different one. In this case the log level is already ERROR, so it would be overwritten
-		// to the same value anyways. All of the AsSomeLogLevel functions work in this manner.
+		// error already has a stack trace and would not overwrite it. By default, it would not overwrite the
+		// log level either (see sherlog.DefaultLevelPolicy). In this case the log level is already ERROR, so it
+		// would stay the same regardless of the policy. All of the AsSomeLogLevel functions work in this manner.
 
 		// So, these end up resulting in the same thing:
 		// return sherlog.AsError(err)
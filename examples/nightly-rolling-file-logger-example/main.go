@@ -8,17 +8,11 @@ import (
 )
 
 func main() {
-	var done bool
+	heartbeat := sherlog.NewHeartbeatLogger(exlogger.Logger, "Still testing", time.Minute)
 
 	// kill this example after 25 hours
-	go func() {
+	heartbeat.Run(func() error {
 		<-time.After(25 * time.Hour)
-		done = true
-	}()
-
-	for !done {
-		err := sherlog.NewInfo("Still testing")
-		exlogger.Logger.Log(err)
-		time.Sleep(time.Minute)
-	}
+		return nil
+	})
 }
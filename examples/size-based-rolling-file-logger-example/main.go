@@ -3,6 +3,7 @@ package main
 import (
 	"errors"
 
+	"github.com/Nick-Anderssohn/sherlog"
 	"github.com/Nick-Anderssohn/sherlog/examples/ex"
 	"github.com/Nick-Anderssohn/sherlog/examples/size-based-rolling-file-logger-example/exlogger"
 )
@@ -10,22 +11,12 @@ import (
 func main() {
 	// the rolling logger should create multiple files as they fill up. we set it to be limited to 5 messages per file.
 	for i := 0; i < 4; i++ {
-		err := ex.ExampleReturnOpsError()
-		if err != nil {
-			exlogger.Logger.Log(err)
-		}
+		// LogAndReturn only logs the error if it isn't nil
+		sherlog.LogAndReturn(exlogger.Logger, ex.ExampleReturnOpsError())
+		sherlog.LogAndReturn(exlogger.Logger, ex.ExampleReturnError())
+		sherlog.LogAndReturn(exlogger.Logger, ex.ExampleReturnCustomLeveledException())
 
-		err = ex.ExampleReturnError()
-		if err != nil {
-			exlogger.Logger.Log(err)
-		}
-
-		err = ex.ExampleReturnCustomLeveledException()
-		if err != nil {
-			exlogger.Logger.Log(err)
-		}
-
-		err = errors.New("test an accidental non-sherlog error to see that it is handled correctly")
+		err := errors.New("test an accidental non-sherlog error to see that it is handled correctly")
 		exlogger.Logger.Log(err)
 	}
 }
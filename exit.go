@@ -0,0 +1,87 @@
+package sherlog
+
+import (
+	"fmt"
+	"os"
+	"os/signal"
+	"sync"
+	"syscall"
+	"time"
+)
+
+var processStart = time.Now()
+
+/*
+Flusher is implemented by loggers that hold entries in memory and need to be told to write them out.
+*/
+type Flusher interface {
+	Flush() error
+}
+
+/*
+QueueDepther is implemented by loggers that queue entries before writing them. QueueDepth returns
+the number of entries that have not been written yet.
+*/
+type QueueDepther interface {
+	QueueDepth() int
+}
+
+/*
+LogOnExit registers handlers for SIGINT and SIGTERM. When one of them is received, an INFO entry is logged to every
+one of loggers saying which signal it was, how long the process was up, and how many entries were still queued:
+
+	yyyy-mm-dd hh:mm:ss - INFO - shutting down: signal=terminated uptime=26h3m12s pending=0
+
+Then every logger that is a Flusher is flushed, every logger is closed, and the process exits with status 128+signal
+(130 for SIGINT and 143 for SIGTERM), like it would have without the handlers. Call the returned function to
+unregister the handlers. It is safe to call more than once.
+*/
+func LogOnExit(loggers ...Logger) (stop func()) {
+	signals := make(chan os.Signal, 1)
+	done := make(chan struct{})
+	signal.Notify(signals, os.Interrupt, syscall.SIGTERM)
+	go func() {
+		select {
+		case sig := <-signals:
+			logShutdown(sig, loggers)
+			os.Exit(exitCodeFor(sig))
+		case <-done:
+		}
+	}()
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			signal.Stop(signals)
+			close(done)
+		})
+	}
+}
+
+/*
+logShutdown logs the shutdown entry to loggers and then flushes and closes them.
+*/
+func logShutdown(sig os.Signal, loggers []Logger) {
+	var pending int
+	for _, logger := range loggers {
+		if depther, ok := logger.(QueueDepther); ok {
+			pending += depther.QueueDepth()
+		}
+	}
+	uptime := time.Since(processStart).Round(time.Second)
+	message := fmt.Sprintf("shutting down: signal=%v uptime=%v pending=%d", sig, uptime, pending)
+
+	for _, logger := range loggers {
+		logger.Log(NewInfo(message))
+		if flusher, ok := logger.(Flusher); ok {
+			flusher.Flush()
+		}
+		logger.Close()
+	}
+}
+
+func exitCodeFor(sig os.Signal) int {
+	if sysSig, ok := sig.(syscall.Signal); ok {
+		return 128 + int(sysSig)
+	}
+	return 1
+}
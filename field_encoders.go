@@ -0,0 +1,149 @@
+package sherlog
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"reflect"
+	"strconv"
+	"sync"
+	"time"
+)
+
+/*
+fieldEncoders holds the encoders registered with RegisterFieldEncoder by type.
+*/
+var fieldEncoders = struct {
+	sync.RWMutex
+	byType map[reflect.Type]func(value interface{}) interface{}
+}{byType: map[reflect.Type]func(value interface{}) interface{}{
+	reflect.TypeOf(time.Duration(0)): func(value interface{}) interface{} {
+		return durationMillis(value.(time.Duration))
+	},
+}}
+
+/*
+RegisterFieldEncoder makes structured output (json, and the formats built from the json map) write field values
+with the same type as example as whatever encode returns, which must be json marshalable. Replaces the encoder
+already registered for the type, if any. time.Duration values are written as milliseconds by default.
+
+	sherlog.RegisterFieldEncoder(net.IP{}, func(value interface{}) interface{} {
+		return value.(net.IP).String()
+	})
+*/
+func RegisterFieldEncoder(example interface{}, encode func(value interface{}) interface{}) {
+	fieldEncoders.Lock()
+	defer fieldEncoders.Unlock()
+	fieldEncoders.byType[reflect.TypeOf(example)] = encode
+}
+
+/*
+SanitizeFieldValue returns value in a form that can always be marshaled to json, so that logging never fails
+because of what was attached with WithField. In order, it uses:
+
+	the encoder registered for value's type with RegisterFieldEncoder
+	value itself if it is a string, bool, or finite number
+	the json of a json.Marshaler if it marshals, or else the value formatted with %+v
+	the message of an error
+	the String of a fmt.Stringer
+	the underlying value of named strings, bools, and numbers (type Celsius float64 is written as a number)
+	the json of maps, slices, and structs if they marshal, or else the value formatted with %+v
+	the type name of channels and funcs, and the formatted value of anything else
+
+Values that had to be marshaled to find out if they can be are returned as the json.RawMessage they marshaled to, so
+that they aren't marshaled again. An encoder (or String, or Error, or MarshalJSON) that panics is treated like a
+value that can't be marshaled.
+*/
+func SanitizeFieldValue(value interface{}) (sanitized interface{}) {
+	defer func() {
+		if recover() != nil {
+			sanitized = fmt.Sprintf("%T", value)
+		}
+	}()
+	if value == nil {
+		return nil
+	}
+	fieldEncoders.RLock()
+	encode, hasEncoder := fieldEncoders.byType[reflect.TypeOf(value)]
+	fieldEncoders.RUnlock()
+	if hasEncoder {
+		return encode(value)
+	}
+
+	switch val := value.(type) {
+	case string, bool, int, int8, int16, int32, int64, uint, uint8, uint16, uint32, uint64, uintptr:
+		return value
+	case float32:
+		return finiteOrString(float64(val))
+	case float64:
+		return finiteOrString(val)
+	case json.Marshaler:
+		return marshaledOrFormatted(value)
+	case error:
+		return val.Error()
+	case fmt.Stringer:
+		return val.String()
+	case map[string]interface{}:
+		return sanitizeFields(val)
+	case []interface{}:
+		sanitizedSlice := make([]interface{}, len(val))
+		for i, elem := range val {
+			sanitizedSlice[i] = SanitizeFieldValue(elem)
+		}
+		return sanitizedSlice
+	}
+
+	reflected := reflect.ValueOf(value)
+	switch reflected.Kind() {
+	case reflect.Chan, reflect.Func, reflect.UnsafePointer:
+		return fmt.Sprintf("%T", value)
+	case reflect.Map, reflect.Slice, reflect.Array, reflect.Struct, reflect.Ptr:
+		return marshaledOrFormatted(value)
+	case reflect.String:
+		return reflected.String()
+	case reflect.Bool:
+		return reflected.Bool()
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return reflected.Int()
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		return reflected.Uint()
+	case reflect.Float32, reflect.Float64:
+		return finiteOrString(reflected.Float())
+	}
+	return fmt.Sprint(value)
+}
+
+/*
+marshaledOrFormatted returns the json of value, or value formatted with %+v if it can't be marshaled.
+*/
+func marshaledOrFormatted(value interface{}) interface{} {
+	marshaled, err := json.Marshal(value)
+	if err != nil {
+		return fmt.Sprintf("%+v", value)
+	}
+	return json.RawMessage(marshaled)
+}
+
+/*
+finiteOrString returns val, or val formatted as a string if it is NaN or infinite since json can't represent those.
+*/
+func finiteOrString(val float64) interface{} {
+	if math.IsNaN(val) || math.IsInf(val, 0) {
+		return strconv.FormatFloat(val, 'g', -1, 64)
+	}
+	return val
+}
+
+/*
+sanitizeFields returns a copy of fields with every value passed through SanitizeFieldValue.
+*/
+func sanitizeFields(fields map[string]interface{}) map[string]interface{} {
+	if len(fields) == 0 {
+		return nil
+	}
+	sanitized := make(map[string]interface{}, len(fields))
+	for key, value := range fields {
+		sanitized[key] = SanitizeFieldValue(value)
+	}
+	return sanitized
+}
@@ -0,0 +1,113 @@
+package sherlog
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+)
+
+/*
+FieldsWrapper is something that holds key/value data.
+*/
+type FieldsWrapper interface {
+	GetFields() map[string]interface{}
+	SetField(key string, value interface{})
+}
+
+/*
+WithField attaches key and value to err if err is a FieldsWrapper (all sherlog exceptions are). Fields show up
+after the message in text output ({key=value}), under "Fields" in json output, and in the fields map of protobuf
+output. Structured output writes value as SanitizeFieldValue returns it. Returns err, or a copy of it if err was
+already logged, so that the loggers that may still be writing it aren't affected.
+*/
+func WithField(err error, key string, value interface{}) error {
+	err = unshared(err)
+	if wrapper, ok := err.(FieldsWrapper); ok {
+		wrapper.SetField(key, value)
+	}
+	return err
+}
+
+/*
+WithFields attaches every key and value of fields to err, like WithField. Returns err, or a copy of it if err was
+already logged.
+*/
+func WithFields(err error, fields map[string]interface{}) error {
+	err = unshared(err)
+	if wrapper, ok := err.(FieldsWrapper); ok {
+		for key, value := range fields {
+			wrapper.SetField(key, value)
+		}
+	}
+	return err
+}
+
+/*
+FieldsOf returns the fields of err and of every error it wraps. If several errors have the same key, the outermost
+one wins. Returns nil if there are none.
+*/
+func FieldsOf(err error) map[string]interface{} {
+	var fields map[string]interface{}
+	walkChain(err, func(cur error) bool {
+		wrapper, ok := cur.(FieldsWrapper)
+		if !ok {
+			return true
+		}
+		for key, value := range wrapper.GetFields() {
+			if fields == nil {
+				fields = map[string]interface{}{}
+			}
+			if _, exists := fields[key]; !exists {
+				fields[key] = value
+			}
+		}
+		return true
+	})
+	return fields
+}
+
+/*
+sortedFieldKeys returns the keys of fields in alphabetical order.
+*/
+func sortedFieldKeys(fields map[string]interface{}) []string {
+	keys := make([]string, 0, len(fields))
+	for key := range fields {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+/*
+writeFields writes " {key1=value1 key2=value2}" to writer, sorted by key, if there are any fields.
+*/
+func writeFields(writer io.Writer, fields map[string]interface{}) error {
+	if len(fields) == 0 {
+		return nil
+	}
+	var buf strings.Builder
+	buf.WriteString(" {")
+	for i, key := range sortedFieldKeys(fields) {
+		if i > 0 {
+			buf.WriteString(" ")
+		}
+		buf.WriteString(sanitizeText(key, true))
+		buf.WriteString("=")
+		buf.WriteString(sanitizeText(fmt.Sprint(fields[key]), true))
+	}
+	buf.WriteString("}")
+	_, err := writer.Write([]byte(buf.String()))
+	return err
+}
+
+func copyFields(fields map[string]interface{}) map[string]interface{} {
+	if len(fields) == 0 {
+		return nil
+	}
+	fieldsCopy := make(map[string]interface{}, len(fields))
+	for key, value := range fields {
+		fieldsCopy[key] = value
+	}
+	return fieldsCopy
+}
@@ -0,0 +1,214 @@
+package sherlog
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+/*
+FilterRule matches entries. Every condition that is set has to match for the rule to match. A rule with no
+conditions set matches everything.
+*/
+type FilterRule struct {
+	// Message matches entries whose message matches the regular expression.
+	Message *regexp.Regexp
+
+	// Levels matches entries with one of these levels.
+	Levels []Level
+
+	// Fields matches entries whose fields (see WithField) or json keys (see ToJsonMap) match the regular
+	// expressions. A key that is missing never matches.
+	Fields map[string]*regexp.Regexp
+
+	// PackagePrefix matches entries whose top stack frame is in a function whose name starts with PackagePrefix,
+	// such as "github.com/lib/pq".
+	PackagePrefix string
+}
+
+/*
+FilterRules decides which entries a FilterLogger lets through. If there are Include rules, an entry has to match
+at least one of them. An entry that matches any of the Exclude rules is dropped.
+*/
+type FilterRules struct {
+	Include []FilterRule
+	Exclude []FilterRule
+}
+
+/*
+FilterLogger drops the entries that its rules don't allow and passes everything else on to the Logger it wraps.
+Use it to silence noisy errors for a single destination:
+
+	pqFilter := sherlog.FilterRules{
+		Exclude: []sherlog.FilterRule{{
+			Levels:        []sherlog.Level{sherlog.EnumWarning, sherlog.EnumInfo},
+			PackagePrefix: "github.com/lib/pq",
+		}},
+	}
+	logger := sherlog.NewFilterLogger(fileLogger, pqFilter)
+
+When Log is given multiple errors, the first one decides whether they get logged.
+*/
+type FilterLogger struct {
+	callerSkipper
+	logger Logger
+	rules  FilterRules
+}
+
+/*
+NewFilterLogger returns a new FilterLogger that passes the entries rules allow on to logger.
+*/
+func NewFilterLogger(logger Logger, rules FilterRules) *FilterLogger {
+	return &FilterLogger{
+		logger: logger,
+		rules:  rules,
+	}
+}
+
+/*
+Allows returns true if toLog would be passed on.
+*/
+func (fl *FilterLogger) Allows(toLog interface{}) bool {
+	if toLog == nil {
+		return true // Let the wrapped logger complain about it
+	}
+	entry := NewEntry(toLog)
+	if len(fl.rules.Include) > 0 && !anyRuleMatches(fl.rules.Include, entry) {
+		return false
+	}
+	return !anyRuleMatches(fl.rules.Exclude, entry)
+}
+
+func anyRuleMatches(rules []FilterRule, entry *Entry) bool {
+	for i := range rules {
+		if rules[i].Matches(entry) {
+			return true
+		}
+	}
+	return false
+}
+
+/*
+Matches returns true if every condition of fr that is set matches entry.
+*/
+func (fr *FilterRule) Matches(entry *Entry) bool {
+	if fr.Message != nil && !fr.Message.MatchString(entry.Message) {
+		return false
+	}
+	if len(fr.Levels) > 0 && !levelIsIn(entry.Level, fr.Levels) {
+		return false
+	}
+	if fr.PackagePrefix != "" && (len(entry.StackTrace) == 0 || !strings.HasPrefix(entry.StackTrace[0].FunctionName, fr.PackagePrefix)) {
+		return false
+	}
+	if len(fr.Fields) > 0 {
+		jsonMap := entry.ToJsonMap()
+		for key, pattern := range fr.Fields {
+			val, hasKey := entry.Fields[key]
+			if !hasKey {
+				val, hasKey = jsonMap[key]
+			}
+			if !hasKey || !pattern.MatchString(fmt.Sprint(val)) {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+func levelIsIn(level Level, levels []Level) bool {
+	if level == nil {
+		return false
+	}
+	for _, other := range levels {
+		if other.GetLevelId() == level.GetLevelId() {
+			return true
+		}
+	}
+	return false
+}
+
+/*
+Log calls the wrapped logger's Log function if the first value of errorsToLog is allowed.
+*/
+func (fl *FilterLogger) Log(errorsToLog ...interface{}) error {
+	if len(errorsToLog) > 0 && !fl.Allows(errorsToLog[0]) {
+		return nil
+	}
+	return fl.logger.Log(errorsToLog...)
+}
+
+/*
+LogNoStack calls the wrapped logger's LogNoStack function if errToLog is allowed.
+*/
+func (fl *FilterLogger) LogNoStack(errToLog error) error {
+	if !fl.Allows(errToLog) {
+		return nil
+	}
+	return fl.logger.LogNoStack(errToLog)
+}
+
+/*
+LogJson calls the wrapped logger's LogJson function if errToLog is allowed.
+*/
+func (fl *FilterLogger) LogJson(errToLog error) error {
+	if !fl.Allows(errToLog) {
+		return nil
+	}
+	return fl.logger.LogJson(errToLog)
+}
+
+/*
+Close closes the wrapped logger.
+*/
+func (fl *FilterLogger) Close() {
+	fl.logger.Close()
+}
+
+/*
+Critical turns values into a *LeveledException with level CRITICAL and then calls the logger's
+Log function.
+*/
+func (fl *FilterLogger) Critical(values ...interface{}) error {
+	return fl.Log(fl.graduate(EnumCritical, values...))
+}
+
+/*
+Error turns values into a *LeveledException with level ERROR and then calls the logger's
+Log function.
+*/
+func (fl *FilterLogger) Error(values ...interface{}) error {
+	return fl.Log(fl.graduate(EnumError, values...))
+}
+
+/*
+OpsError turns values into a *LeveledException with level OPS_ERROR and then calls the logger's
+Log function.
+*/
+func (fl *FilterLogger) OpsError(values ...interface{}) error {
+	return fl.Log(fl.graduate(EnumOpsError, values...))
+}
+
+/*
+Warn turns values into a *LeveledException with level WARNING and then calls the logger's
+Log function.
+*/
+func (fl *FilterLogger) Warn(values ...interface{}) error {
+	return fl.Log(fl.graduate(EnumWarning, values...))
+}
+
+/*
+Info turns values into a *LeveledException with level INFO and then calls the logger's
+Log function.
+*/
+func (fl *FilterLogger) Info(values ...interface{}) error {
+	return fl.Log(fl.graduate(EnumInfo, values...))
+}
+
+/*
+Debug turns values into a *LeveledException with level DEBUG and then calls the logger's
+Log function.
+*/
+func (fl *FilterLogger) Debug(values ...interface{}) error {
+	return fl.Log(fl.graduate(EnumDebug, values...))
+}
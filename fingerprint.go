@@ -0,0 +1,39 @@
+package sherlog
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"regexp"
+)
+
+/*
+fingerprintVariableRegex matches the words with a digit in them, which are usually ids, counts, or durations that
+change from one occurrence of an error to the next.
+*/
+var fingerprintVariableRegex = regexp.MustCompile(`\w*\d\w*`)
+
+/*
+Fingerprint returns a short hash that identifies where err came from, so that occurrences of the same error can be
+grouped together. It covers the level, the message, and the function names of the stack trace. Words in the message
+that have a digit in them (such as ids) are left out, so "user 42 not found" and "user 43 not found" get the same
+fingerprint. Line numbers are left out so that the fingerprint survives unrelated edits to the same file.
+*/
+func Fingerprint(err error) string {
+	if err == nil {
+		return ""
+	}
+	entry := NewEntry(err)
+	return fingerprintOf(entry.LevelLabel(), entry.Message, entry.StackTrace)
+}
+
+/*
+fingerprintOf returns the fingerprint of an entry with levelLabel, message, and stackTrace.
+*/
+func fingerprintOf(levelLabel, message string, stackTrace []*StackTraceEntry) string {
+	hash := sha256.New()
+	hash.Write([]byte(levelLabel + "\n" + fingerprintVariableRegex.ReplaceAllString(message, "#") + "\n"))
+	for _, frame := range stackTrace {
+		hash.Write([]byte(frame.FunctionName + "\n"))
+	}
+	return hex.EncodeToString(hash.Sum(nil))[:16]
+}
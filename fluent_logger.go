@@ -0,0 +1,264 @@
+package sherlog
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/base64"
+	"io"
+	"net"
+	"strings"
+	"sync"
+	"time"
+)
+
+const fluentAckTimeout = 10 * time.Second
+
+/*
+FluentLogger sends entries to Fluentd or Fluent Bit using the forward protocol (MessagePack over TCP), so that
+sherlog plugs into an existing EFK stack. Each entry is tagged with the logger's tag prefix and the lowercase
+level label, such as "app.error" or "app.info". Entries without a level use the tag prefix by itself.
+
+The record of each entry holds the same keys as MsgpackFormatter's output. Log and LogJson include the stack trace,
+LogNoStack does not. When Log is given multiple errors, only the first one is sent. Reconnects once if a send
+fails. Is thread safe :)
+*/
+type FluentLogger struct {
+	callerSkipper
+	middlewareChain
+	networkTimeouts
+	address    string
+	tagPrefix  string
+	requireAck bool
+	conn       net.Conn
+	mutex      *sync.Mutex
+}
+
+/*
+NewFluentLogger connects to the forward input of Fluentd or Fluent Bit at address (host:port, usually port 24224).
+*/
+func NewFluentLogger(address, tagPrefix string) (*FluentLogger, error) {
+	fl := &FluentLogger{
+		address:   address,
+		tagPrefix: tagPrefix,
+		mutex:     new(sync.Mutex),
+	}
+	if err := fl.connect(); err != nil {
+		return nil, err
+	}
+	return fl, nil
+}
+
+/*
+SetRequireAck turns on/off waiting for Fluentd to acknowledge each entry (the require_ack_response option of
+out_forward). When on, an entry that isn't acknowledged within 10 seconds makes the Log function return an
+error. Off by default.
+*/
+func (fl *FluentLogger) SetRequireAck(require bool) {
+	fl.requireAck = require
+}
+
+/*
+connect dials Fluentd. The mutex must be held (or the logger not shared yet).
+*/
+func (fl *FluentLogger) connect() error {
+	conn, err := net.DialTimeout("tcp", fl.address, brokerDialTimeout)
+	if err != nil {
+		return AsError(err)
+	}
+	fl.conn = conn
+	return nil
+}
+
+/*
+tagFor returns the tag entry should be sent with.
+*/
+func (fl *FluentLogger) tagFor(entry *Entry) string {
+	if entry.Level == nil {
+		return fl.tagPrefix
+	}
+	return fl.tagPrefix + "." + strings.ToLower(entry.Level.GetLabel())
+}
+
+/*
+forwardMessage encodes entry as a forward protocol message: [tag, time, record, option].
+The time is an EventTime so that nanoseconds aren't lost.
+*/
+func (fl *FluentLogger) forwardMessage(entry *Entry, includeStack bool, chunk string) []byte {
+	encoder := msgpackEncoder{}
+	buf := encoder.appendArrayHeader(nil, 4)
+	buf = encoder.appendString(buf, fl.tagFor(entry))
+	buf = append(buf, 0xd7, 0x00) // fixext 8, EventTime
+	buf = appendUint32BE(buf, uint32(entry.Time.Unix()))
+	buf = appendUint32BE(buf, uint32(entry.Time.Nanosecond()))
+
+	jsonMap := entry.ToJsonMap()
+	removeStackRepresentations(jsonMap, false, includeStack)
+	buf = appendBinaryValue(encoder, buf, toSchemaMap(jsonMap, CurrentJsonSchema))
+
+	option := map[string]interface{}{}
+	if chunk != "" {
+		option["chunk"] = chunk
+	}
+	return appendBinaryValue(encoder, buf, option)
+}
+
+/*
+send sends toLog and waits for the ack if SetRequireAck is on.
+*/
+func (fl *FluentLogger) send(toLog interface{}, includeStack bool) error {
+	if toLog == nil {
+		return AsError("tried to log nil error")
+	}
+	var chunk string
+	if fl.requireAck {
+		chunkBytes := make([]byte, 16)
+		if _, err := rand.Read(chunkBytes); err != nil {
+			return AsError(err)
+		}
+		chunk = base64.StdEncoding.EncodeToString(chunkBytes)
+	}
+	message := fl.forwardMessage(NewEntry(toLog), includeStack, chunk)
+	return fl.withRetries(func() error {
+		return fl.sendMessage(message, chunk)
+	})
+}
+
+/*
+sendMessage makes one attempt at sending message and reading the ack for chunk (if it isn't empty).
+*/
+func (fl *FluentLogger) sendMessage(message []byte, chunk string) error {
+	deadline, err := fl.sendDeadline()
+	if err != nil {
+		return err
+	}
+	fl.mutex.Lock()
+	defer fl.mutex.Unlock()
+	if err = writeWithReconnect(fl.ctx, &fl.conn, fl.connect, message, deadline); err != nil {
+		return err
+	}
+	if chunk == "" {
+		return nil
+	}
+	if err = fl.readAck(chunk, deadline); err != nil {
+		fl.conn.Close()
+		fl.conn = nil
+		return err
+	}
+	return nil
+}
+
+/*
+readAck reads the {"ack": chunk} response, giving up at deadline if it is before the ack timeout. The mutex must
+be held.
+*/
+func (fl *FluentLogger) readAck(chunk string, deadline time.Time) error {
+	expected := appendBinaryValue(msgpackEncoder{}, nil, map[string]interface{}{"ack": chunk})
+	response := make([]byte, len(expected))
+	fl.conn.SetReadDeadline(earliest(time.Now().Add(fluentAckTimeout), deadline))
+	defer fl.conn.SetReadDeadline(time.Time{})
+	stop := interruptWhenDone(fl.ctx, fl.conn)
+	defer stop()
+	if _, err := io.ReadFull(fl.conn, response); err != nil {
+		return loggerFailure(ErrDestinationUnavailable, err)
+	}
+	if !bytes.Equal(response, expected) {
+		return loggerFailure(ErrDestinationUnavailable, "fluentd did not acknowledge chunk ", chunk)
+	}
+	return nil
+}
+
+/*
+Log sends the first value of errorsToLog with its stack trace.
+*/
+func (fl *FluentLogger) Log(errorsToLog ...interface{}) error {
+	return fl.through(fl.logValues, errorsToLog)
+}
+
+func (fl *FluentLogger) logValues(errorsToLog ...interface{}) error {
+	if len(errorsToLog) < 1 {
+		return AsError("no parameters provided to Log")
+	}
+	return fl.send(errorsToLog[0], true)
+}
+
+/*
+LogNoStack sends errToLog without its stack trace.
+*/
+func (fl *FluentLogger) LogNoStack(errToLog error) error {
+	return fl.throughWithError(fl.logNoStack, errToLog)
+}
+
+func (fl *FluentLogger) logNoStack(errToLog error) error {
+	return fl.send(errToLog, false)
+}
+
+/*
+LogJson sends errToLog with its stack trace. Records are always structured, so it is the same as Log.
+*/
+func (fl *FluentLogger) LogJson(errToLog error) error {
+	return fl.throughWithError(fl.logJson, errToLog)
+}
+
+func (fl *FluentLogger) logJson(errToLog error) error {
+	return fl.send(errToLog, true)
+}
+
+/*
+Close closes the connection.
+*/
+func (fl *FluentLogger) Close() {
+	fl.mutex.Lock()
+	defer fl.mutex.Unlock()
+	if fl.conn != nil {
+		fl.conn.Close()
+		fl.conn = nil
+	}
+}
+
+/*
+Critical turns values into a *LeveledException with level CRITICAL and then calls the logger's
+Log function.
+*/
+func (fl *FluentLogger) Critical(values ...interface{}) error {
+	return fl.Log(fl.graduate(EnumCritical, values...))
+}
+
+/*
+Error turns values into a *LeveledException with level ERROR and then calls the logger's
+Log function.
+*/
+func (fl *FluentLogger) Error(values ...interface{}) error {
+	return fl.Log(fl.graduate(EnumError, values...))
+}
+
+/*
+OpsError turns values into a *LeveledException with level OPS_ERROR and then calls the logger's
+Log function.
+*/
+func (fl *FluentLogger) OpsError(values ...interface{}) error {
+	return fl.Log(fl.graduate(EnumOpsError, values...))
+}
+
+/*
+Warn turns values into a *LeveledException with level WARNING and then calls the logger's
+Log function.
+*/
+func (fl *FluentLogger) Warn(values ...interface{}) error {
+	return fl.Log(fl.graduate(EnumWarning, values...))
+}
+
+/*
+Info turns values into a *LeveledException with level INFO and then calls the logger's
+Log function.
+*/
+func (fl *FluentLogger) Info(values ...interface{}) error {
+	return fl.Log(fl.graduate(EnumInfo, values...))
+}
+
+/*
+Debug turns values into a *LeveledException with level DEBUG and then calls the logger's
+Log function.
+*/
+func (fl *FluentLogger) Debug(values ...interface{}) error {
+	return fl.Log(fl.graduate(EnumDebug, values...))
+}
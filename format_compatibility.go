@@ -0,0 +1,66 @@
+package sherlog
+
+/*
+FormatStability is how much an output format is allowed to change between sherlog releases.
+*/
+type FormatStability int
+
+const (
+	// FormatStable output never changes without an opt-in. Changes ship as a new version (such as a new
+	// JsonSchema) and the previous version keeps being available.
+	FormatStable FormatStability = iota
+
+	// FormatAdditive output keeps everything it has today in the same place, but new optional parts may show up
+	// where they don't move anything else (such as a new decoration at the end of the header line). Parsers should
+	// ignore what they don't recognize.
+	FormatAdditive
+
+	// FormatUnstable output is meant for people and may change in any release. Don't parse it.
+	FormatUnstable
+)
+
+/*
+FormatCompatibility is the promise that sherlog makes for one output format.
+*/
+type FormatCompatibility struct {
+	Format    string
+	Stability FormatStability
+	Details   string
+}
+
+/*
+FormatCompatibilityPolicy lists what consumers of sherlog's output can rely on between releases. The text and json
+promises are enforced by the golden files in testdata/golden, which only change together with this policy.
+*/
+var FormatCompatibilityPolicy = []FormatCompatibility{
+	{
+		Format:    "json (LogJson, JsonFormatter)",
+		Stability: FormatStable,
+		Details: "The keys of an entry are pinned by the schema in its envelope (see JsonSchema). New keys only appear in a " +
+			"new schema version, and CurrentJsonSchema can be set to an older version to keep the old layout.",
+	},
+	{
+		Format:    "text (Log)",
+		Stability: FormatAdditive,
+		Details: `The header line is "time - [service - ][#seq - ][[correlation] - ][LEVEL - ]message" followed by an ` +
+			`optional " (took X)", an optional " {k=v}", and a colon if a stack trace follows. Frames are on their own ` +
+			`lines starting with a tab, entries end with a blank line, and causes follow a "Caused by:" line. New ` +
+			`decorations only ever go at the end of the header line, before the colon.`,
+	},
+	{
+		Format:    "msgpack and cbor (MsgpackFormatter, CBORFormatter)",
+		Stability: FormatStable,
+		Details:   "Encode the same map as json, so they follow the json schema.",
+	},
+	{
+		Format:    "compact (CompactFormatter)",
+		Stability: FormatAdditive,
+		Details: `One line per entry: "time CODE message", followed by an optional " {k=v}" and an optional ` +
+			`" @file:line". New decorations only ever go at the end of the line.`,
+	},
+	{
+		Format:    "console (ConsoleLogger)",
+		Stability: FormatUnstable,
+		Details:   "Meant to be read by people.",
+	},
+}
@@ -0,0 +1,199 @@
+package sherlog
+
+import (
+	"bytes"
+	"fmt"
+	"time"
+)
+
+/*
+Entry holds everything a Formatter needs to know about a single thing being logged.
+*/
+type Entry struct {
+	Time          time.Time
+	Level         Level // nil if the error does not have a level
+	Message       string
+	StackTrace    []*StackTraceEntry
+	MessageChain  []string
+	CorrelationID string
+	SpanID        string
+	Sequence      uint64
+	Fields        map[string]interface{}
+	Duration      time.Duration // 0 if the error does not have a duration
+	HTTPStatus    int           // 0 if no status was set with WithHTTPStatus
+
+	// TimeLayout is the layout the logger wants timestamps in (see SetTimeLayout). Empty means TimeLayoutDefault.
+	TimeLayout string
+
+	// Err is the error the entry was created from. nil if a non-error value was logged.
+	Err error
+}
+
+/*
+Formatter turns an Entry into the bytes of a single log entry. Formatters should not add a trailing newline,
+loggers take care of separating entries.
+*/
+type Formatter interface {
+	Format(entry *Entry) ([]byte, error)
+}
+
+/*
+FormatterFunc lets an ordinary function be used as a Formatter.
+*/
+type FormatterFunc func(entry *Entry) ([]byte, error)
+
+/*
+Format calls ff(entry).
+*/
+func (ff FormatterFunc) Format(entry *Entry) ([]byte, error) {
+	return ff(entry)
+}
+
+/*
+stdExceptionOf returns the StdException that backs err, or nil if err is not a sherlog exception (or is a nil one).
+*/
+func stdExceptionOf(err error) *StdException {
+	switch impl := err.(type) {
+	case *LeveledException:
+		if impl == nil {
+			return nil
+		}
+		return &impl.StdException
+	case *StdException:
+		return impl
+	}
+	return nil
+}
+
+/*
+NewEntry creates an Entry out of something that is being logged. Sherlog exceptions fill out every field.
+Other errors (and non-error values) only get a Message and use the current time, since that's all there is.
+*/
+func NewEntry(toLog interface{}) *Entry {
+	err, isErr := toLog.(error)
+	if !isErr {
+		return &Entry{
+			Time:    Clock().In(Location),
+			Message: fmt.Sprint(toLog),
+		}
+	}
+
+	entry := &Entry{
+		Err:        err,
+		Level:      LevelOf(err),
+		Fields:     FieldsOf(err),
+		HTTPStatus: explicitHTTPStatusOf(err),
+	}
+
+	stdException := stdExceptionOf(err)
+	if stdException == nil {
+		entry.Time = Clock().In(Location) // Use log time instead of time of creation since we don't have one....
+		entry.Message = err.Error()
+		entry.StackTrace = StackOf(err)
+		return entry
+	}
+
+	entry.Time = *stdException.timestamp
+	entry.Message = stdException.message
+	entry.StackTrace = stdException.stackTrace
+	entry.MessageChain = limitMessageChain(stdException.messageChain)
+	entry.CorrelationID = stdException.correlationID
+	entry.SpanID = stdException.spanID
+	entry.Sequence = stdException.sequenceNumber()
+	entry.Duration = stdException.duration
+	return entry
+}
+
+/*
+StackTraceAsString returns the entry's stack trace formatted like GetStackTraceAsString.
+*/
+func (e *Entry) StackTraceAsString() string {
+	if stackTraceWrapper, ok := e.Err.(StackTraceWrapper); ok {
+		return stackTraceWrapper.GetStackTraceAsString()
+	}
+	return stackTraceAsString(e.StackTrace)
+}
+
+/*
+FormattedTime returns the entry's time formatted with its TimeLayout.
+*/
+func (e *Entry) FormattedTime() string {
+	return e.Time.Format(layoutOrDefault(e.TimeLayout))
+}
+
+/*
+LevelLabel returns the label of the entry's level, or an empty string if it does not have one.
+*/
+func (e *Entry) LevelLabel() string {
+	if e.Level == nil {
+		return ""
+	}
+	return e.Level.GetLabel()
+}
+
+/*
+writeHeader writes the first line of the default text format to buf:
+
+	yyyy-mm-dd hh:mm:ss - LEVEL - message
+
+The level is left out if the entry doesn't have one.
+*/
+func (e *Entry) writeHeader(buf *bytes.Buffer) {
+	buf.WriteString(e.FormattedTime())
+	writeServiceInfo(buf)
+	writeSequenceNumber(buf, e.Sequence)
+	writeCorrelationID(buf, e.CorrelationID)
+	if e.Level != nil {
+		buf.WriteString(" - ")
+		buf.WriteString(e.Level.GetLabel())
+	}
+	buf.WriteString(" - ")
+	buf.WriteString(sanitizeText(e.Message, true))
+	writeDuration(buf, e.Duration)
+	writeFields(buf, e.Fields)
+}
+
+/*
+ToJsonMap creates the same map[string]interface{} that the ToJsonMap function of sherlog exceptions creates.
+If the entry was created from an error that implements JsonMapper, that is used so that nothing is lost, with the
+time still formatted with the entry's TimeLayout.
+*/
+func (e *Entry) ToJsonMap() map[string]interface{} {
+	if mapper, ok := e.Err.(JsonMapper); ok {
+		jsonMap := mapper.ToJsonMap()
+		if jsonMap != nil {
+			jsonMap["Time"] = e.FormattedTime()
+		}
+		return jsonMap
+	}
+	jsonMap := map[string]interface{}{
+		"Time":    e.FormattedTime(),
+		"Message": e.Message,
+	}
+	if e.Level != nil {
+		jsonMap["Level"] = e.Level.GetLabel()
+	}
+	if len(e.StackTrace) > 0 {
+		jsonMap["StackTrace"] = e.StackTrace
+		jsonMap["StackTraceStr"] = e.StackTraceAsString()
+	}
+	if e.Sequence != 0 {
+		jsonMap["Sequence"] = e.Sequence
+	}
+	if e.CorrelationID != "" {
+		jsonMap["CorrelationID"] = e.CorrelationID
+	}
+	if len(e.Fields) > 0 {
+		jsonMap["Fields"] = sanitizeFields(e.Fields)
+	}
+	if e.Duration != 0 {
+		jsonMap["DurationMs"] = durationMillis(e.Duration)
+	}
+	if len(e.MessageChain) > 0 {
+		jsonMap["MessageChain"] = e.MessageChain
+	}
+	if detail := ErrorDetail(e.Err); detail != "" {
+		jsonMap["Detail"] = detail
+	}
+	return jsonMap
+}
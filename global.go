@@ -1,13 +1,16 @@
 package sherlog
 
-import "time"
+import (
+	"sync/atomic"
+	"time"
+)
 
 const (
 	defaultStackTraceDepth    = 256
 	defaultStackTraceLineLen  = 96
 	defaultStackTraceNumBytes = defaultStackTraceLineLen * defaultStackTraceDepth
 	timeFmt                   = "2006-01-02 15:04:05" // yyyy-mm-dd hh:mm:ss
-	timeFileNameFmt           = "_2006-01-02"
+	defaultMaxChainDepth      = 32
 )
 
 var (
@@ -18,4 +21,93 @@ var (
 		sherlog.Location, _ = time.LoadLocation("America/Los_Angeles")
 	Wikipedia has a good list of IANA time zones: https://en.wikipedia.org/wiki/List_of_tz_database_time_zones*/
 	Location = time.UTC
+
+	/*FileNameTimeLayout is the layout of the timestamp that rolling loggers add to the end of file names, before the
+	extension. Defaults to "_2006-01-02". Characters that Windows doesn't allow in file names, such as the colons
+	of "_2006-01-02T15:04", are replaced with dashes, so app.log becomes app_2018-10-03T07-51.log on every OS.*/
+	FileNameTimeLayout = "_2006-01-02"
+
+	/*DefaultLevelPolicy is the LevelPolicy used by the AsFoo functions (and the leveled logger functions
+	such as logger.Error) when they are given an error that already has a level.
+	Defaults to KeepOriginalLevel. Set it to Overwrite to get the behavior from before 1.8.0:
+		sherlog.DefaultLevelPolicy = sherlog.Overwrite*/
+	DefaultLevelPolicy = KeepOriginalLevel
+
+	/*IncludeInternalMessage turns on writing an exception's NonLoggedMsg as "InternalMessage" in json output.
+	Text output never includes it. Only turn it on if your json pipeline is allowed to see internal messages.
+	Off by default.*/
+	IncludeInternalMessage = false
+
+	/*MaxChainDepth limits how many messages added with PrependMsg are written, and how far chains of wrapped
+	errors (see Unwrapper) are followed. Longer message chains end with a "... N more messages" marker, and
+	longer error chains (or ones that wrap themselves) are cut off with a marker where one is written, such as
+	in protobuf output. Defaults to 32.*/
+	MaxChainDepth = defaultMaxChainDepth
+
+	/*SanitizeText turns on cleaning up messages and field values before they are written in text formats, so that
+	a message containing something like "\n\n2018-10-03 07:51:14 - CRITICAL - fake" can't forge a fake entry in
+	a shared file, and one containing ANSI escape sequences can't mess with the terminal of whoever reads it.
+	Newlines are escaped as \n, ANSI escape sequences and control characters are removed, and invalid UTF-8 is
+	replaced with U+FFFD. Json output is always safe since json escapes all of these. On by default.*/
+	SanitizeText = true
+
+	/*PanicOnFailedAssertion turns on panicking after Check or Assert logs a failure, so that broken invariants stop
+	the program instead of letting it carry on in a bad state. Handy in tests and during development. Must always
+	panics. Off by default.*/
+	PanicOnFailedAssertion = false
+
+	/*StackTailFrames is how many frames from the bottom of the stack (main or the function a goroutine started
+	in) are kept when a stack trace is deeper than the depth limit (256 frames unless given, such as to
+	NewStdExceptionWithStackTraceSize). The top frames fill the rest of the limit, and a "...N more frames" frame
+	goes in between, which makes deep recursions much easier to debug. The marker is added whenever frames are
+	left out, even if StackTailFrames is 0. Then the rest of the stack isn't walked just to count the frames, so
+	the marker is "...more frames". Defaults to 0.*/
+	StackTailFrames = 0
+
+	/*TrimBuildPaths turns on rewriting the file paths of stack frames in the form that go build -trimpath uses
+	wherever frames are written: in text, in the structured "StackTrace" of json, in "Caller", and in the binary
+	formats. Files in the module cache keep their module@version path, files in GOROOT become relative to it
+	(runtime/proc.go), and everything else is placed under the import path of its package. Turn it on so that logs
+	don't leak the directories and user names of the machine the binary was built on, such as /home/nick/go/src/.
+	Paths are only rewritten when they are written, so GetStackTrace still returns the real ones. Set it once at
+	startup, like StackRender, since exceptions cache their stack trace string. Off by default.*/
+	TrimBuildPaths = false
+
+	/*StackRender controls how stack traces are rendered as text. Json output keeps every frame in "StackTrace"
+	no matter what. Set it once at startup, before anything is logged, since exceptions cache their stack trace
+	string. For example, to get short, module relative stack traces of at most 20 frames:
+		sherlog.StackRender = sherlog.StackRenderOptions{
+			RelativePaths:      true,
+			ShortFunctionNames: true,
+			MaxFrames:          20,
+		}*/
+	StackRender StackRenderOptions
 )
+
+/*
+clock holds the func() time.Time that Clock calls, once SetClock was called.
+*/
+var clock atomic.Value
+
+/*
+Clock returns the current time. Timestamps, the names of rolled files, and the cutoffs of SetMaxFileAge and Compact
+all come from it. It calls time.Now unless a fake clock was installed with SetClock. Durations and scheduled rolls
+still use the real time. Is thread safe :)
+*/
+func Clock() time.Time {
+	if now, isSet := clock.Load().(func() time.Time); isSet {
+		return now()
+	}
+	return time.Now()
+}
+
+/*
+SetClock makes Clock call now, so that tests get deterministic output (see the sherlogtest package). Pass nil to go
+back to time.Now. Is thread safe :)
+*/
+func SetClock(now func() time.Time) {
+	if now == nil {
+		now = time.Now
+	}
+	clock.Store(now)
+}
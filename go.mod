@@ -0,0 +1,3 @@
+module github.com/Nick-Anderssohn/sherlog
+
+go 1.12
@@ -0,0 +1,127 @@
+package sherlog
+
+import (
+	"sync"
+	"time"
+)
+
+const defaultHeartbeatInterval = time.Minute
+
+/*
+HeartbeatLogger logs an INFO entry every interval while a long running job is going, so that it's easy to tell
+from the log that the job is still alive and how far along it is. Every entry has the status fields set with
+SetStatus and Add, plus "running_for". Is thread safe :)
+
+	heartbeat := sherlog.NewHeartbeatLogger(logger, "reindexing users", time.Minute)
+	err := heartbeat.Run(func() error {
+		heartbeat.SetStatus("stage", "loading")
+		for _, user := range users {
+			...
+			heartbeat.Add("items_processed", 1)
+		}
+		return nil
+	})
+*/
+type HeartbeatLogger struct {
+	logger   Logger
+	message  string
+	interval time.Duration
+	timer    *Timer
+	status   map[string]interface{}
+	mutex    *sync.Mutex
+	stop     chan struct{}
+	stopped  chan struct{}
+	stopOnce sync.Once
+}
+
+/*
+NewHeartbeatLogger starts logging message with level INFO to logger every interval until Stop is called (or the
+job given to Run returns). The first entry is logged one interval from now. An interval of 0 or less means every
+minute.
+*/
+func NewHeartbeatLogger(logger Logger, message string, interval time.Duration) *HeartbeatLogger {
+	if interval <= 0 {
+		interval = defaultHeartbeatInterval
+	}
+	hl := &HeartbeatLogger{
+		logger:   logger,
+		message:  message,
+		interval: interval,
+		timer:    StartTimer(),
+		status:   map[string]interface{}{},
+		mutex:    new(sync.Mutex),
+		stop:     make(chan struct{}),
+		stopped:  make(chan struct{}),
+	}
+	go hl.beat()
+	return hl
+}
+
+/*
+beat logs a heartbeat every interval until the heartbeat is stopped.
+*/
+func (hl *HeartbeatLogger) beat() {
+	defer close(hl.stopped)
+	ticker := time.NewTicker(hl.interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			hl.logger.Log(WithFields(NewInfo(hl.message), hl.fields()))
+		case <-hl.stop:
+			return
+		}
+	}
+}
+
+/*
+fields returns a copy of the status fields plus how long the heartbeat has been running.
+*/
+func (hl *HeartbeatLogger) fields() map[string]interface{} {
+	hl.mutex.Lock()
+	defer hl.mutex.Unlock()
+	fields := make(map[string]interface{}, len(hl.status)+1)
+	for key, value := range hl.status {
+		fields[key] = value
+	}
+	fields["running_for"] = hl.timer.Elapsed().Round(time.Second)
+	return fields
+}
+
+/*
+SetStatus sets a status field that is included in every heartbeat from now on, such as the current stage.
+*/
+func (hl *HeartbeatLogger) SetStatus(key string, value interface{}) {
+	hl.mutex.Lock()
+	defer hl.mutex.Unlock()
+	hl.status[key] = value
+}
+
+/*
+Add adds delta to the status field key, such as the number of items processed. The field starts at 0. If it was
+set to something other than an int64 with SetStatus, it is replaced.
+*/
+func (hl *HeartbeatLogger) Add(key string, delta int64) {
+	hl.mutex.Lock()
+	defer hl.mutex.Unlock()
+	count, _ := hl.status[key].(int64)
+	hl.status[key] = count + delta
+}
+
+/*
+Run calls job, stops the heartbeat once job returns, and returns what job returned.
+*/
+func (hl *HeartbeatLogger) Run(job func() error) error {
+	defer hl.Stop()
+	return job()
+}
+
+/*
+Stop stops the heartbeat. No heartbeat is logged after Stop returns. Calling it more than once does nothing.
+*/
+func (hl *HeartbeatLogger) Stop() {
+	hl.stopOnce.Do(func() {
+		close(hl.stop)
+	})
+	<-hl.stopped
+}
@@ -0,0 +1,149 @@
+package sherlog
+
+import "reflect"
+
+/*
+RegisterHook adds a pair of hooks to the logger's pipeline (see Use). Either one may be nil.
+
+preWrite is called with an Entry for every value before it gets written. It can change the entry (such as adding
+fields) and return it, or return nil to drop the value. Changes to the message, time, level, correlation ID,
+span ID, fields, and duration are copied back onto sherlog exceptions, so they show up no matter how the exception gets
+written. Only the values that preWrite changed are copied back, onto a copy of the exception, so the caller's
+exception and every other logger it is passed to are left alone. Removing a field only removes it from the outermost
+exception. Other values are passed on untouched.
+
+postWrite is called with every entry after the write finished, along with the error that the write returned
+(nil if it succeeded). Use it to observe failures, or how long entries took to get written after they were created:
+
+	logger.RegisterHook(
+		func(entry *sherlog.Entry) *sherlog.Entry {
+			if entry.Fields == nil {
+				entry.Fields = map[string]interface{}{}
+			}
+			entry.Fields["host"] = hostname
+			return entry
+		},
+		func(entry *sherlog.Entry, err error) {
+			writeLag.Observe(time.Since(entry.Time).Seconds())
+			if err != nil {
+				failedWrites.Inc()
+			}
+		},
+	)
+*/
+func (mc *middlewareChain) RegisterHook(preWrite func(entry *Entry) *Entry, postWrite func(entry *Entry, err error)) {
+	mc.Use(func(next LogFunc) LogFunc {
+		return func(values ...interface{}) error {
+			entries := make([]*Entry, 0, len(values))
+			kept := make([]interface{}, 0, len(values))
+			for _, value := range values {
+				if value == nil {
+					kept = append(kept, value)
+					continue
+				}
+				entry := NewEntry(value)
+				if preWrite != nil {
+					original := *entry
+					original.Fields = copyFields(entry.Fields)
+					if entry = preWrite(entry); entry == nil {
+						continue
+					}
+					entry.Err = entry.applyToErr(&original)
+				}
+				entries = append(entries, entry)
+				if entry.Err != nil {
+					value = entry.Err
+				}
+				kept = append(kept, value)
+			}
+			if len(kept) == 0 {
+				return nil
+			}
+
+			err := next(kept...)
+			if postWrite != nil {
+				for _, entry := range entries {
+					postWrite(entry, err)
+				}
+			}
+			return err
+		}
+	})
+}
+
+/*
+applyToErr copies the message, time, level, correlation ID, span ID, fields, and duration that differ from original
+onto a copy of e.Err, if it is a sherlog exception, and returns the copy. Returns e.Err if nothing changed.
+*/
+func (e *Entry) applyToErr(original *Entry) error {
+	stdException := stdExceptionOf(e.Err)
+	if stdException == nil {
+		return e.Err
+	}
+	levelChanged := e.Level != nil && (original.Level == nil || e.Level.GetLevelId() != original.Level.GetLevelId() ||
+		e.Level.GetLabel() != original.Level.GetLabel())
+	changedFields, removedFields := changedFieldsOf(original.Fields, e.Fields)
+	if !levelChanged && len(changedFields) == 0 && len(removedFields) == 0 && e.Message == original.Message &&
+		e.Time.Equal(original.Time) && e.CorrelationID == original.CorrelationID && e.SpanID == original.SpanID &&
+		e.Duration == original.Duration {
+		return e.Err
+	}
+
+	var changed error
+	switch exception := e.Err.(type) {
+	case *LeveledException:
+		level := exception.GetLevel()
+		if levelChanged {
+			level = e.Level
+		}
+		changed = exception.WithLevel(level)
+	case *StdException:
+		if levelChanged {
+			changed = exception.WithLevel(e.Level)
+		} else {
+			changed = exception.Clone()
+		}
+	}
+	stdException = stdExceptionOf(changed)
+	stdException.message = e.Message
+	if !e.Time.IsZero() {
+		timestamp := e.Time
+		stdException.timestamp = &timestamp
+	}
+	stdException.correlationID = e.CorrelationID
+	stdException.spanID = e.SpanID
+	stdException.duration = e.Duration
+	for _, key := range removedFields {
+		delete(stdException.fields, key)
+	}
+	for key, value := range changedFields {
+		if stdException.fields == nil {
+			stdException.fields = map[string]interface{}{}
+		}
+		stdException.fields[key] = value
+	}
+	return changed
+}
+
+/*
+changedFieldsOf returns the fields that were added to or changed in after compared to before, and the keys of the
+ones that were removed.
+*/
+func changedFieldsOf(before, after map[string]interface{}) (map[string]interface{}, []string) {
+	var changed map[string]interface{}
+	for key, value := range after {
+		if previous, existed := before[key]; !existed || !reflect.DeepEqual(previous, value) {
+			if changed == nil {
+				changed = map[string]interface{}{}
+			}
+			changed[key] = value
+		}
+	}
+	var removed []string
+	for key := range before {
+		if _, exists := after[key]; !exists {
+			removed = append(removed, key)
+		}
+	}
+	return changed, removed
+}
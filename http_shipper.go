@@ -0,0 +1,504 @@
+package sherlog
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	defaultShipperBatchSize     = 100
+	defaultShipperFlushInterval = time.Second
+	defaultShipperTimeout       = 10 * time.Second
+)
+
+/*
+HTTPShipperConfig configures an HTTPShipper. Only URL is required. DatadogShipperConfig and SplunkHECShipperConfig
+return ready-made configurations.
+*/
+type HTTPShipperConfig struct {
+	// URL is where batches are sent.
+	URL string
+
+	// Method is the http method used to send batches. Defaults to POST.
+	Method string
+
+	// Headers are added to every request, such as authentication headers.
+	Headers map[string]string
+
+	// ContentType is the Content-Type of every request. Defaults to application/x-ndjson.
+	ContentType string
+
+	// Encode turns a batch of entries into the body of a request. Defaults to EncodeJsonLines.
+	Encode func(entries []*Entry) ([]byte, error)
+
+	// BatchSize is how many entries are buffered before a batch is sent. Defaults to 100.
+	BatchSize int
+
+	// FlushInterval sends buffered entries this often even if the batch isn't full. Defaults to 1 second.
+	FlushInterval time.Duration
+
+	// Client sends the requests. Defaults to a client with a 10 second timeout.
+	Client *http.Client
+
+	// Context is the base context of every request. Once it is done, sends are abandoned and new batches fail
+	// right away. Cancel it at shutdown so that a hung collector can't block the process from exiting. Defaults
+	// to context.Background().
+	Context context.Context
+
+	// FlushTimeout limits how long sending one batch may take, including retries, on top of Client's timeout. 0
+	// means no limit.
+	FlushTimeout time.Duration
+
+	// Compressor compresses batches before they are sent, such as GzipCompressor{}. Defaults to no compression.
+	// If the endpoint responds with 415 Unsupported Media Type, the batch is resent uncompressed and compression
+	// is turned off for good.
+	Compressor Compressor
+
+	// CompressMinSize is the smallest body that is compressed, since compressing small bodies costs more than it
+	// saves. Defaults to 1KB.
+	CompressMinSize int
+
+	// Retry is how failed batches are retried. Defaults to no retries. Use DefaultRetryPolicy for a sensible
+	// policy. Responses with a 4xx status other than 408 and 429 fail with ErrRejected and aren't retried.
+	Retry RetryPolicy
+
+	// OnError is called with errors from batches that were sent in the background. Defaults to reporting them to
+	// the diagnostics logger (see SetDiagnosticsLogger).
+	OnError func(err error)
+}
+
+/*
+HTTPShipper buffers entries and sends them in batches to an http endpoint, such as the intake of a log
+aggregator. A batch is sent when it is full (by the Log call that filled it, which returns the error if sending
+fails), every FlushInterval, and when Flush or Close is called. Batches are sent, and retried, without holding up
+the entries logged in the meantime.
+
+When Log is given multiple errors, only the first one is shipped. LogNoStack ships the entry without its stack
+trace. Is thread safe :)
+*/
+type HTTPShipper struct {
+	callerSkipper
+	middlewareChain
+	config        HTTPShipperConfig
+	batch         []*Entry
+	queued        int32 // len(batch), readable without the mutex
+	sending       int32 // How many batches are being sent
+	closed        bool
+	noCompression int32 // 1 once the endpoint refused compressed bodies
+	retries       RetryCounts
+	shipping      sync.WaitGroup // The batches that were taken out of batch and are being sent
+	mutex         *sync.Mutex
+	stop          chan struct{}
+	stopOnce      sync.Once
+	done          chan struct{}
+}
+
+/*
+NewHTTPShipper returns a new HTTPShipper that sends batches as config says. Fills in the defaults of config.
+*/
+func NewHTTPShipper(config HTTPShipperConfig) *HTTPShipper {
+	if config.Method == "" {
+		config.Method = http.MethodPost
+	}
+	if config.ContentType == "" {
+		config.ContentType = "application/x-ndjson"
+	}
+	if config.Encode == nil {
+		config.Encode = EncodeJsonLines
+	}
+	if config.BatchSize < 1 {
+		config.BatchSize = defaultShipperBatchSize
+	}
+	if config.FlushInterval <= 0 {
+		config.FlushInterval = defaultShipperFlushInterval
+	}
+	if config.Client == nil {
+		config.Client = &http.Client{Timeout: defaultShipperTimeout}
+	}
+	if config.Context == nil {
+		config.Context = context.Background()
+	}
+	if config.CompressMinSize <= 0 {
+		config.CompressMinSize = defaultCompressMinSize
+	}
+	if config.OnError == nil {
+		config.OnError = defaultHandleLoggerFail
+	}
+	hs := &HTTPShipper{
+		config: config,
+		mutex:  new(sync.Mutex),
+		stop:   make(chan struct{}),
+		done:   make(chan struct{}),
+	}
+	go hs.flushPeriodically()
+	return hs
+}
+
+/*
+EncodeJsonLines is the default HTTPShipperConfig.Encode. It writes each entry as the json LogJson would write,
+followed by a newline.
+*/
+func EncodeJsonLines(entries []*Entry) ([]byte, error) {
+	var buf bytes.Buffer
+	for _, entry := range entries {
+		jsonBytes, err := marshalJsonEntry(ShipperJsonMap(entry), false)
+		if err != nil {
+			return nil, err
+		}
+		buf.Write(jsonBytes)
+		buf.WriteByte('\n')
+	}
+	return buf.Bytes(), nil
+}
+
+/*
+ShipperJsonMap returns the json map of entry (see Entry.ToJsonMap) for use in a custom HTTPShipperConfig.Encode.
+The stack trace is left out if the entry was logged with LogNoStack, and StackTraceStr is always left out.
+*/
+func ShipperJsonMap(entry *Entry) map[string]interface{} {
+	jsonMap := entry.ToJsonMap()
+	removeStackRepresentations(jsonMap, false, len(entry.StackTrace) > 0)
+	return jsonMap
+}
+
+func (hs *HTTPShipper) flushPeriodically() {
+	defer close(hs.done)
+	ticker := time.NewTicker(hs.config.FlushInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			if err := hs.Flush(); err != nil {
+				hs.config.OnError(err)
+			}
+		case <-hs.stop:
+			return
+		}
+	}
+}
+
+/*
+add buffers toLog and sends the batch if it is full.
+*/
+func (hs *HTTPShipper) add(toLog interface{}, includeStack bool) error {
+	if toLog == nil {
+		return AsError("tried to log nil error")
+	}
+	entry := NewEntry(toLog)
+	if !includeStack {
+		entry.StackTrace = nil
+	}
+	hs.mutex.Lock()
+	if hs.closed {
+		hs.mutex.Unlock()
+		return loggerFailure(ErrLoggerClosed)
+	}
+	hs.batch = append(hs.batch, entry)
+	atomic.StoreInt32(&hs.queued, int32(len(hs.batch)))
+	var batch []*Entry
+	if len(hs.batch) >= hs.config.BatchSize {
+		batch = hs.takeBatch()
+	}
+	hs.mutex.Unlock()
+	return hs.ship(context.Background(), batch)
+}
+
+/*
+Flush sends every buffered entry.
+*/
+func (hs *HTTPShipper) Flush() error {
+	return hs.FlushContext(context.Background())
+}
+
+/*
+FlushContext sends every buffered entry, abandoning the send if ctx (or the base context in the config) is done
+first. The entries are dropped either way.
+*/
+func (hs *HTTPShipper) FlushContext(ctx context.Context) error {
+	hs.mutex.Lock()
+	batch := hs.takeBatch()
+	hs.mutex.Unlock()
+	return hs.ship(ctx, batch)
+}
+
+/*
+Retries returns how many times batches were retried, and how many still failed after that.
+*/
+func (hs *HTTPShipper) Retries() RetryCounts {
+	return hs.retries.load()
+}
+
+/*
+QueueDepth returns the number of buffered entries that haven't been sent yet. Doesn't block while a batch is
+being sent.
+*/
+func (hs *HTTPShipper) QueueDepth() int {
+	return int(atomic.LoadInt32(&hs.queued))
+}
+
+/*
+Pressure returns how full the batch is, or 1 while a batch is being sent since Log blocks until the send is done.
+Doesn't block.
+*/
+func (hs *HTTPShipper) Pressure() float64 {
+	if atomic.LoadInt32(&hs.sending) > 0 {
+		return 1
+	}
+	return float64(atomic.LoadInt32(&hs.queued)) / float64(hs.config.BatchSize)
+}
+
+/*
+takeBatch returns the buffered entries and empties the batch. ship must be called with what it returns. The mutex
+must be held.
+*/
+func (hs *HTTPShipper) takeBatch() []*Entry {
+	batch := hs.batch
+	hs.batch = nil
+	atomic.StoreInt32(&hs.queued, 0)
+	if len(batch) > 0 {
+		hs.shipping.Add(1)
+	}
+	return batch
+}
+
+/*
+ship sends batch, which came from takeBatch. The batch is dropped even if sending fails so that a dead endpoint
+can't make memory grow forever. The mutex must not be held, so that logging isn't blocked while waiting on the
+endpoint or between retries.
+*/
+func (hs *HTTPShipper) ship(ctx context.Context, batch []*Entry) error {
+	if len(batch) == 0 {
+		return nil
+	}
+	defer hs.shipping.Done()
+	ctx, cancel := withBaseContext(ctx, hs.config.Context)
+	defer cancel()
+	if hs.config.FlushTimeout > 0 {
+		ctx, cancel = context.WithTimeout(ctx, hs.config.FlushTimeout)
+		defer cancel()
+	}
+	body, err := hs.config.Encode(batch)
+	if err == nil {
+		err = hs.config.Retry.do(ctx, &hs.retries, func() error {
+			return hs.send(ctx, body)
+		})
+	} else {
+		err = loggerFailure(ErrFormat, err)
+	}
+	if err != nil {
+		diagnose(NewWarning(fmt.Sprintf("dropped %d entries that could not be shipped to %s", len(batch), hs.config.URL)))
+	}
+	return err
+}
+
+/*
+send sends body to the endpoint, compressed if the config says so and it is big enough. Returns an error if the
+response status isn't 2xx.
+*/
+func (hs *HTTPShipper) send(ctx context.Context, body []byte) error {
+	atomic.AddInt32(&hs.sending, 1)
+	defer atomic.AddInt32(&hs.sending, -1)
+	if compressor := hs.config.Compressor; compressor != nil && len(body) >= hs.config.CompressMinSize && atomic.LoadInt32(&hs.noCompression) == 0 {
+		compressed, err := compressor.Compress(body)
+		if err != nil {
+			diagnose(NewWarning(fmt.Sprintf("sending uncompressed batch to %s since %s compression failed: %v", hs.config.URL, compressor.Encoding(), err)))
+		} else {
+			statusCode, err := hs.post(ctx, compressed, compressor.Encoding())
+			if statusCode != http.StatusUnsupportedMediaType {
+				return err
+			}
+			atomic.StoreInt32(&hs.noCompression, 1)
+			diagnose(NewInfo(fmt.Sprintf("%s does not accept %s bodies, sending batches uncompressed from now on", hs.config.URL, compressor.Encoding())))
+		}
+	}
+	_, err := hs.post(ctx, body, "")
+	return err
+}
+
+/*
+post makes the request with body, setting Content-Encoding to encoding unless it is empty. Returns the response
+status (0 if there was no response) and an error if it isn't 2xx.
+*/
+func (hs *HTTPShipper) post(ctx context.Context, body []byte, encoding string) (int, error) {
+	request, err := http.NewRequest(hs.config.Method, hs.config.URL, bytes.NewReader(body))
+	if err != nil {
+		return 0, AsError(err)
+	}
+	request = request.WithContext(ctx)
+	request.Header.Set("Content-Type", hs.config.ContentType)
+	if encoding != "" {
+		request.Header.Set("Content-Encoding", encoding)
+	}
+	for key, value := range hs.config.Headers {
+		request.Header.Set(key, value)
+	}
+	response, err := hs.config.Client.Do(request)
+	if err != nil {
+		return 0, loggerFailure(ErrDestinationUnavailable, err)
+	}
+	defer response.Body.Close()
+	if response.StatusCode < 200 || response.StatusCode > 299 {
+		responseBody, _ := ioutil.ReadAll(io.LimitReader(response.Body, 512))
+		kind := ErrDestinationUnavailable
+		if response.StatusCode < 500 && response.StatusCode != http.StatusRequestTimeout && response.StatusCode != http.StatusTooManyRequests {
+			kind = ErrRejected
+		}
+		return response.StatusCode, loggerFailure(kind, "shipping logs to ", hs.config.URL, " failed with status ", strconv.Itoa(response.StatusCode), ": ", string(responseBody))
+	}
+	io.Copy(ioutil.Discard, response.Body) // Lets the connection be reused
+	return response.StatusCode, nil
+}
+
+/*
+Log buffers the first value of errorsToLog.
+*/
+func (hs *HTTPShipper) Log(errorsToLog ...interface{}) error {
+	return hs.through(hs.logValues, errorsToLog)
+}
+
+func (hs *HTTPShipper) logValues(errorsToLog ...interface{}) error {
+	if len(errorsToLog) < 1 {
+		return AsError("no parameters provided to Log")
+	}
+	return hs.add(errorsToLog[0], true)
+}
+
+/*
+LogNoStack buffers errToLog without its stack trace.
+*/
+func (hs *HTTPShipper) LogNoStack(errToLog error) error {
+	return hs.throughWithError(hs.logNoStack, errToLog)
+}
+
+func (hs *HTTPShipper) logNoStack(errToLog error) error {
+	return hs.add(errToLog, false)
+}
+
+/*
+LogJson buffers errToLog. How entries are encoded is up to HTTPShipperConfig.Encode, so it is the same as Log.
+*/
+func (hs *HTTPShipper) LogJson(errToLog error) error {
+	return hs.throughWithError(hs.logJson, errToLog)
+}
+
+func (hs *HTTPShipper) logJson(errToLog error) error {
+	return hs.add(errToLog, true)
+}
+
+/*
+Close stops the background flushing and sends every buffered entry. Errors go to OnError.
+*/
+func (hs *HTTPShipper) Close() {
+	if err := hs.CloseContext(context.Background()); err != nil {
+		hs.config.OnError(err)
+	}
+}
+
+/*
+CloseContext stops the background flushing, sends every buffered entry, and waits for the batches that are still
+being sent, giving up once ctx is done so that
+shutdown can't be held up by a hung collector:
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	shipper.CloseContext(ctx)
+*/
+func (hs *HTTPShipper) CloseContext(ctx context.Context) error {
+	closing := false
+	hs.stopOnce.Do(func() {
+		close(hs.stop)
+		closing = true
+	})
+	if !closing {
+		return nil // Already closed
+	}
+	<-hs.done
+	hs.mutex.Lock()
+	hs.closed = true
+	hs.mutex.Unlock()
+	err := hs.FlushContext(ctx)
+	shipped := make(chan struct{})
+	go func() {
+		hs.shipping.Wait()
+		close(shipped)
+	}()
+	select {
+	case <-shipped:
+	case <-ctx.Done():
+	}
+	return err
+}
+
+/*
+withBaseContext returns a context that is done when either ctx or base is done.
+*/
+func withBaseContext(ctx, base context.Context) (context.Context, context.CancelFunc) {
+	ctx, cancel := context.WithCancel(ctx)
+	if base.Done() == nil {
+		return ctx, cancel
+	}
+	go func() {
+		select {
+		case <-base.Done():
+			cancel()
+		case <-ctx.Done():
+		}
+	}()
+	return ctx, cancel
+}
+
+/*
+Critical turns values into a *LeveledException with level CRITICAL and then calls the logger's
+Log function.
+*/
+func (hs *HTTPShipper) Critical(values ...interface{}) error {
+	return hs.Log(hs.graduate(EnumCritical, values...))
+}
+
+/*
+Error turns values into a *LeveledException with level ERROR and then calls the logger's
+Log function.
+*/
+func (hs *HTTPShipper) Error(values ...interface{}) error {
+	return hs.Log(hs.graduate(EnumError, values...))
+}
+
+/*
+OpsError turns values into a *LeveledException with level OPS_ERROR and then calls the logger's
+Log function.
+*/
+func (hs *HTTPShipper) OpsError(values ...interface{}) error {
+	return hs.Log(hs.graduate(EnumOpsError, values...))
+}
+
+/*
+Warn turns values into a *LeveledException with level WARNING and then calls the logger's
+Log function.
+*/
+func (hs *HTTPShipper) Warn(values ...interface{}) error {
+	return hs.Log(hs.graduate(EnumWarning, values...))
+}
+
+/*
+Info turns values into a *LeveledException with level INFO and then calls the logger's
+Log function.
+*/
+func (hs *HTTPShipper) Info(values ...interface{}) error {
+	return hs.Log(hs.graduate(EnumInfo, values...))
+}
+
+/*
+Debug turns values into a *LeveledException with level DEBUG and then calls the logger's
+Log function.
+*/
+func (hs *HTTPShipper) Debug(values ...interface{}) error {
+	return hs.Log(hs.graduate(EnumDebug, values...))
+}
@@ -0,0 +1,165 @@
+package sherlog
+
+import (
+	"encoding/json"
+	"net/http"
+)
+
+/*
+HTTPStatusWrapper is something that holds a modifiable http status code.
+*/
+type HTTPStatusWrapper interface {
+	GetHTTPStatus() int
+	SetHTTPStatus(status int)
+}
+
+/*
+HTTPStatusByLevel holds the http status code that HTTPStatusOf returns for an error
+that has a level, but was never given an explicit status with WithHTTPStatus.
+Levels that are not in the map fall back to http.StatusInternalServerError.
+Custom levels can be added:
+
+	sherlog.HTTPStatusByLevel[MyCustomLevel] = http.StatusTeapot
+*/
+var HTTPStatusByLevel = map[Level]int{
+	EnumCritical: http.StatusInternalServerError,
+	EnumError:    http.StatusInternalServerError,
+	EnumOpsError: http.StatusServiceUnavailable,
+	EnumWarning:  http.StatusOK,
+	EnumInfo:     http.StatusOK,
+	EnumDebug:    http.StatusOK,
+}
+
+/*
+httpStatusError attaches an http status code to an error that can't hold one itself.
+*/
+type httpStatusError struct {
+	error
+	status int
+}
+
+func (hse *httpStatusError) GetHTTPStatus() int {
+	return hse.status
+}
+
+func (hse *httpStatusError) SetHTTPStatus(status int) {
+	hse.status = status
+}
+
+func (hse *httpStatusError) Unwrap() error {
+	return hse.error
+}
+
+/*
+WithHTTPStatus attaches status to err. If err is an HTTPStatusWrapper (all sherlog exceptions are),
+then the status is set on err (or on a copy of it if err was already logged) and that is returned. Otherwise, err
+gets wrapped in an error that holds the status. Returns nil if err is nil.
+*/
+func WithHTTPStatus(err error, status int) error {
+	if err == nil {
+		return nil
+	}
+	err = unshared(err)
+	if statusWrapper, ok := err.(HTTPStatusWrapper); ok {
+		statusWrapper.SetHTTPStatus(status)
+		return err
+	}
+	return &httpStatusError{error: err, status: status}
+}
+
+/*
+HTTPStatusOf returns the http status code that should be used to respond with err.
+The Unwrap chain is walked and the outermost status set with WithHTTPStatus wins.
+If there is none, the status comes from HTTPStatusByLevel using LevelOf(err).
+Falls back to http.StatusInternalServerError. Returns http.StatusOK if err is nil.
+*/
+func HTTPStatusOf(err error) int {
+	if err == nil {
+		return http.StatusOK
+	}
+	if status := explicitHTTPStatusOf(err); status > 0 {
+		return status
+	}
+	if level := LevelOf(err); level != nil {
+		if status, ok := HTTPStatusByLevel[level]; ok {
+			return status
+		}
+	}
+	return http.StatusInternalServerError
+}
+
+/*
+explicitHTTPStatusOf returns the outermost status set with WithHTTPStatus in err's chain, or 0 if there is none.
+*/
+func explicitHTTPStatusOf(err error) (status int) {
+	walkChain(err, func(cur error) bool {
+		if statusWrapper, ok := cur.(HTTPStatusWrapper); ok && statusWrapper.GetHTTPStatus() > 0 {
+			status = statusWrapper.GetHTTPStatus()
+		}
+		return status == 0
+	})
+	return
+}
+
+/*
+publicMessageOf returns the NonLoggedMsg of the outermost sherlog exception in err's chain that has one.
+Falls back to the standard text for status so that internal error messages are never leaked to clients.
+*/
+func publicMessageOf(err error, status int) string {
+	message := http.StatusText(status)
+	walkChain(err, func(cur error) bool {
+		switch impl := cur.(type) {
+		case *LeveledException:
+			if impl.NonLoggedMsg != "" {
+				message = impl.NonLoggedMsg
+				return false
+			}
+		case *StdException:
+			if impl.NonLoggedMsg != "" {
+				message = impl.NonLoggedMsg
+				return false
+			}
+		}
+		return true
+	})
+	return message
+}
+
+/*
+WriteHTTPError logs the full exception with logger and then responds to the client with a json blob
+that only contains the status and the public message:
+
+	{
+	   "Status":503,
+	   "Message":"Service Unavailable"
+	}
+
+The status comes from HTTPStatusOf. The public message is the exception's NonLoggedMsg if one was set,
+otherwise it is the standard text for the status. Returns the error from logging or writing, if there was one.
+*/
+func WriteHTTPError(w http.ResponseWriter, logger Logger, err error) error {
+	if err == nil {
+		return nil
+	}
+	status := HTTPStatusOf(err)
+
+	var logErr error
+	if logger != nil {
+		logErr = logger.Log(err)
+	}
+
+	jsonBytes, marshalErr := json.Marshal(map[string]interface{}{
+		"Status":  status,
+		"Message": publicMessageOf(err, status),
+	})
+	if marshalErr != nil {
+		return marshalErr
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	if _, writeErr := w.Write(jsonBytes); writeErr != nil {
+		return writeErr
+	}
+	return logErr
+}
@@ -0,0 +1,265 @@
+package sherlog
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+)
+
+const (
+	defaultJournalSegmentSize = 64 * 1024 * 1024
+
+	// JournalIndexRecordSize is the size of every record in a journal index file.
+	JournalIndexRecordSize = 17
+
+	// JournalNoLevel is the level byte of index records for entries without a level.
+	JournalNoLevel = 0xff
+)
+
+/*
+JournalLogger writes entries to a binary local store that can be queried by time and level without reading every
+entry (see parser.QueryJournal). The store is a directory of segments. Each segment is a pair of files:
+
+	segment-000001.log   the entries, encoded as MessagePack like MsgpackFormatter, one after another
+	segment-000001.idx   one 17 byte record per entry: the entry's time in unix nanoseconds (8 bytes, big
+	                     endian), the level id (1 byte, 0xff if there is none), and the offset of the entry in
+	                     the .log file (8 bytes, big endian)
+
+A new segment is started once the current one would grow past the segment size. Reopening a journal keeps
+appending to its last segment. Log and LogJson include the stack trace, LogNoStack does not. When Log is given
+multiple errors, only the first one is written. Entries whose level id is outside 0-254 can't be indexed, so
+they are rejected with ErrFormat. Is thread safe :)
+*/
+type JournalLogger struct {
+	callerSkipper
+	middlewareChain
+	dir         string
+	segmentSize int64
+	segment     int
+	logFile     *os.File
+	indexFile   *os.File
+	offset      int64
+	mutex       *sync.Mutex
+}
+
+/*
+NewJournalLogger opens the journal in dir, creating dir if it doesn't exist. Segments are started fresh once
+they reach segmentSize bytes (64MB if segmentSize is 0 or less).
+*/
+func NewJournalLogger(dir string, segmentSize int64) (*JournalLogger, error) {
+	if segmentSize <= 0 {
+		segmentSize = defaultJournalSegmentSize
+	}
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, AsError(err)
+	}
+	segments, err := JournalSegments(dir)
+	if err != nil {
+		return nil, err
+	}
+	segment := 1
+	if len(segments) > 0 {
+		segment = segments[len(segments)-1]
+	}
+	jl := &JournalLogger{
+		dir:         dir,
+		segmentSize: segmentSize,
+		mutex:       new(sync.Mutex),
+	}
+	if err = jl.openSegment(segment); err != nil {
+		return nil, err
+	}
+	return jl, nil
+}
+
+/*
+JournalSegmentPath returns the path of the .log (or .idx, depending on ext) file of segment in dir.
+*/
+func JournalSegmentPath(dir string, segment int, ext string) string {
+	return filepath.Join(dir, fmt.Sprintf("segment-%06d%s", segment, ext))
+}
+
+/*
+JournalSegments returns the numbers of the segments in dir in ascending order.
+*/
+func JournalSegments(dir string) ([]int, error) {
+	paths, err := filepath.Glob(filepath.Join(dir, "segment-*.log"))
+	if err != nil {
+		return nil, AsError(err)
+	}
+	segments := make([]int, 0, len(paths))
+	for _, path := range paths {
+		var segment int
+		if _, err := fmt.Sscanf(filepath.Base(path), "segment-%d.log", &segment); err == nil {
+			segments = append(segments, segment)
+		}
+	}
+	sort.Ints(segments)
+	return segments, nil
+}
+
+/*
+openSegment opens (or creates) the files of segment for appending. The mutex must be held (or the logger not
+shared yet).
+*/
+func (jl *JournalLogger) openSegment(segment int) error {
+	logFile, err := openFile(JournalSegmentPath(jl.dir, segment, ".log"))
+	if err != nil {
+		return AsError(err)
+	}
+	indexFile, err := openFile(JournalSegmentPath(jl.dir, segment, ".idx"))
+	if err != nil {
+		logFile.Close()
+		return AsError(err)
+	}
+	info, err := logFile.Stat()
+	if err != nil {
+		logFile.Close()
+		indexFile.Close()
+		return AsError(err)
+	}
+	jl.segment, jl.logFile, jl.indexFile, jl.offset = segment, logFile, indexFile, info.Size()
+	return nil
+}
+
+/*
+write appends toLog to the current segment, starting a new segment first if it would get too big.
+*/
+func (jl *JournalLogger) write(toLog interface{}, includeStack bool) error {
+	if toLog == nil {
+		return AsError("tried to log nil error")
+	}
+	entry := NewEntry(toLog)
+	jsonMap := entry.ToJsonMap()
+	removeStackRepresentations(jsonMap, false, includeStack)
+	record := appendBinaryValue(msgpackEncoder{}, nil, toSchemaMap(jsonMap, CurrentJsonSchema))
+
+	levelId := byte(JournalNoLevel)
+	if entry.Level != nil {
+		// The index has one byte for the level, and 0xff is taken by JournalNoLevel
+		id := entry.Level.GetLevelId()
+		if id < 0 || id >= JournalNoLevel {
+			return loggerFailure(ErrFormat, fmt.Sprintf("level id %d of %s does not fit in a journal index (0-254)", id, entry.Level.GetLabel()))
+		}
+		levelId = byte(id)
+	}
+
+	jl.mutex.Lock()
+	defer jl.mutex.Unlock()
+	if jl.offset > 0 && jl.offset+int64(len(record)) > jl.segmentSize {
+		jl.logFile.Close()
+		jl.indexFile.Close()
+		if err := jl.openSegment(jl.segment + 1); err != nil {
+			return err
+		}
+	}
+
+	if _, err := jl.logFile.Write(record); err != nil {
+		return AsError(err)
+	}
+	indexRecord := make([]byte, 0, JournalIndexRecordSize)
+	indexRecord = appendUint64BE(indexRecord, uint64(entry.Time.UnixNano()))
+	indexRecord = append(indexRecord, levelId)
+	indexRecord = appendUint64BE(indexRecord, uint64(jl.offset))
+	if _, err := jl.indexFile.Write(indexRecord); err != nil {
+		return AsError(err)
+	}
+	jl.offset += int64(len(record))
+	return nil
+}
+
+/*
+Log writes the first value of errorsToLog with its stack trace.
+*/
+func (jl *JournalLogger) Log(errorsToLog ...interface{}) error {
+	return jl.through(jl.logValues, errorsToLog)
+}
+
+func (jl *JournalLogger) logValues(errorsToLog ...interface{}) error {
+	if len(errorsToLog) < 1 {
+		return AsError("no parameters provided to Log")
+	}
+	return jl.write(errorsToLog[0], true)
+}
+
+/*
+LogNoStack writes errToLog without its stack trace.
+*/
+func (jl *JournalLogger) LogNoStack(errToLog error) error {
+	return jl.throughWithError(jl.logNoStack, errToLog)
+}
+
+func (jl *JournalLogger) logNoStack(errToLog error) error {
+	return jl.write(errToLog, false)
+}
+
+/*
+LogJson writes errToLog with its stack trace. Entries are always structured, so it is the same as Log.
+*/
+func (jl *JournalLogger) LogJson(errToLog error) error {
+	return jl.throughWithError(jl.logJson, errToLog)
+}
+
+func (jl *JournalLogger) logJson(errToLog error) error {
+	return jl.write(errToLog, true)
+}
+
+/*
+Close closes the files of the current segment.
+*/
+func (jl *JournalLogger) Close() {
+	jl.mutex.Lock()
+	defer jl.mutex.Unlock()
+	jl.logFile.Close()
+	jl.indexFile.Close()
+}
+
+/*
+Critical turns values into a *LeveledException with level CRITICAL and then calls the logger's
+Log function.
+*/
+func (jl *JournalLogger) Critical(values ...interface{}) error {
+	return jl.Log(jl.graduate(EnumCritical, values...))
+}
+
+/*
+Error turns values into a *LeveledException with level ERROR and then calls the logger's
+Log function.
+*/
+func (jl *JournalLogger) Error(values ...interface{}) error {
+	return jl.Log(jl.graduate(EnumError, values...))
+}
+
+/*
+OpsError turns values into a *LeveledException with level OPS_ERROR and then calls the logger's
+Log function.
+*/
+func (jl *JournalLogger) OpsError(values ...interface{}) error {
+	return jl.Log(jl.graduate(EnumOpsError, values...))
+}
+
+/*
+Warn turns values into a *LeveledException with level WARNING and then calls the logger's
+Log function.
+*/
+func (jl *JournalLogger) Warn(values ...interface{}) error {
+	return jl.Log(jl.graduate(EnumWarning, values...))
+}
+
+/*
+Info turns values into a *LeveledException with level INFO and then calls the logger's
+Log function.
+*/
+func (jl *JournalLogger) Info(values ...interface{}) error {
+	return jl.Log(jl.graduate(EnumInfo, values...))
+}
+
+/*
+Debug turns values into a *LeveledException with level DEBUG and then calls the logger's
+Log function.
+*/
+func (jl *JournalLogger) Debug(values ...interface{}) error {
+	return jl.Log(jl.graduate(EnumDebug, values...))
+}
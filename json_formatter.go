@@ -0,0 +1,30 @@
+package sherlog
+
+/*
+JsonFormatter is a Formatter that writes entries in sherlog's own json layout (see JsonSchema).
+By default it only includes the structured "StackTrace". Turn on IncludeStackString to also get "StackTraceStr".
+*/
+type JsonFormatter struct {
+	IncludeStackString bool
+	IncludeStackFrames bool
+	Transformers       []JsonTransformer
+
+	// Pretty indents the json so that it is readable for humans. Keys are always sorted, so the order is stable.
+	Pretty bool
+}
+
+/*
+NewJsonFormatter returns a new JsonFormatter that includes the structured stack trace but not the stack trace string.
+*/
+func NewJsonFormatter() *JsonFormatter {
+	return &JsonFormatter{IncludeStackFrames: true}
+}
+
+/*
+Format turns entry into sherlog json.
+*/
+func (jf *JsonFormatter) Format(entry *Entry) ([]byte, error) {
+	jsonMap := entry.ToJsonMap()
+	removeStackRepresentations(jsonMap, jf.IncludeStackString, jf.IncludeStackFrames)
+	return marshalJsonEntry(jsonMap, jf.Pretty, jf.Transformers...)
+}
@@ -0,0 +1,132 @@
+package sherlog
+
+import "encoding/json"
+
+/*
+JsonSchema identifies the layout of the json written by LogAsJson and Logger.LogJson.
+
+Changelog of the json schema:
+
+	1: The raw output of ToJsonMap with no envelope. Keys get added whenever ToJsonMap gains one.
+	   Time, Message, StackTrace, StackTraceStr, and (for leveled exceptions) Level.
+	2: Entries are wrapped in an envelope: {"sherlog":"2","entry":{...}}. Only these keys can appear in entry:
+	   Time, Message                                    always
+	   Level                                            if the error has a level
+	   StackTrace                                       if the error has a stack trace (and the logger/formatter includes frames)
+	   StackTraceStr                                    if the error has a stack trace and the logger/formatter
+	                                                    has IncludeStackString turned on (off by default)
+	   Sequence                                         if sequence numbers were being stamped
+	   CorrelationID                                    if one was stamped on the error
+	   Caller                                           if the logger has SetIncludeCaller(true)
+	   New keys will only ever show up in a new schema version. Keys added by a logger's JsonTransformers
+	   are the exception since they are under your control.
+	3: Same as 2 with the envelope {"sherlog":"3","entry":{...}}, plus:
+	   Service                                          if SetServiceInfo (or SetServiceInfoFromBuildInfo) was
+	                                                    called. An object with Name, Version, and Commit
+	4: Same as 3 with the envelope {"sherlog":"4","entry":{...}}, plus:
+	   Fields                                           if fields were attached with WithField or WithFields
+	5: Same as 4 with the envelope {"sherlog":"5","entry":{...}}, plus:
+	   MessageChain                                     if messages were added with PrependMsg. Outermost first,
+	                                                    formatted like the "Caused by" lines of text output
+	   InternalMessage                                  if IncludeInternalMessage is on and NonLoggedMsg is set
+	6: Same as 5 with the envelope {"sherlog":"6","entry":{...}}, plus:
+	   DurationMs                                       if a duration was attached with WithDuration. A number
+	7: Same as 6 with the envelope {"sherlog":"7","entry":{...}}, plus:
+	   Detail                                           if an error in the chain implements xerrors.Formatter
+	                                                    (see ErrorDetail)
+*/
+type JsonSchema string
+
+const (
+	// JsonSchemaV1 is the legacy layout without an envelope. Use it if you have parsers that depend on it.
+	JsonSchemaV1 JsonSchema = "1"
+
+	// JsonSchemaV2 wraps entries in a versioned envelope and only allows the keys listed in the changelog.
+	JsonSchemaV2 JsonSchema = "2"
+
+	// JsonSchemaV3 adds the "Service" key to JsonSchemaV2.
+	JsonSchemaV3 JsonSchema = "3"
+
+	// JsonSchemaV4 adds the "Fields" key to JsonSchemaV3.
+	JsonSchemaV4 JsonSchema = "4"
+
+	// JsonSchemaV5 adds the "MessageChain" and "InternalMessage" keys to JsonSchemaV4.
+	JsonSchemaV5 JsonSchema = "5"
+
+	// JsonSchemaV6 adds the "DurationMs" key to JsonSchemaV5.
+	JsonSchemaV6 JsonSchema = "6"
+
+	// JsonSchemaV7 adds the "Detail" key to JsonSchemaV6.
+	JsonSchemaV7 JsonSchema = "7"
+)
+
+/*
+CurrentJsonSchema is the JsonSchema used for all json output. Defaults to JsonSchemaV7.
+*/
+var CurrentJsonSchema = JsonSchemaV7
+
+var jsonSchemaKeys = map[JsonSchema][]string{
+	JsonSchemaV2: {"Time", "Message", "Level", "StackTrace", "StackTraceStr", "Sequence", "CorrelationID", "Caller"},
+	JsonSchemaV3: {"Time", "Message", "Level", "StackTrace", "StackTraceStr", "Sequence", "CorrelationID", "Caller", "Service"},
+	JsonSchemaV4: {"Time", "Message", "Level", "StackTrace", "StackTraceStr", "Sequence", "CorrelationID", "Caller", "Service", "Fields"},
+	JsonSchemaV5: {"Time", "Message", "Level", "StackTrace", "StackTraceStr", "Sequence", "CorrelationID", "Caller", "Service", "Fields", "MessageChain", "InternalMessage"},
+	JsonSchemaV6: {"Time", "Message", "Level", "StackTrace", "StackTraceStr", "Sequence", "CorrelationID", "Caller", "Service", "Fields", "MessageChain", "InternalMessage", "DurationMs"},
+	JsonSchemaV7: {"Time", "Message", "Level", "StackTrace", "StackTraceStr", "Sequence", "CorrelationID", "Caller", "Service", "Fields", "MessageChain", "InternalMessage", "DurationMs", "Detail"},
+}
+
+/*
+toSchemaMap converts the output of ToJsonMap into the layout of schema.
+transformers are run on the entry after the keys are filtered.
+*/
+func toSchemaMap(jsonMap map[string]interface{}, schema JsonSchema, transformers ...JsonTransformer) map[string]interface{} {
+	keys, hasKeys := jsonSchemaKeys[schema]
+	if !hasKeys {
+		return transformJsonMap(jsonMap, transformers)
+	}
+
+	entry := make(map[string]interface{}, len(keys))
+	for _, key := range keys {
+		if val, ok := jsonMap[key]; ok {
+			entry[key] = val
+		}
+	}
+	return map[string]interface{}{
+		"sherlog": string(schema),
+		"entry":   transformJsonMap(entry, transformers),
+	}
+}
+
+func transformJsonMap(jsonMap map[string]interface{}, transformers []JsonTransformer) map[string]interface{} {
+	for _, transformer := range transformers {
+		jsonMap = transformer(jsonMap)
+	}
+	return jsonMap
+}
+
+/*
+removeStackRepresentations deletes the stack trace keys from jsonMap that should not be included.
+*/
+func removeStackRepresentations(jsonMap map[string]interface{}, includeStackString, includeStackFrames bool) {
+	if !includeStackString {
+		delete(jsonMap, "StackTraceStr")
+	}
+	if !includeStackFrames {
+		delete(jsonMap, "StackTrace")
+	}
+}
+
+/*
+marshalJsonEntry marshals the output of ToJsonMap using CurrentJsonSchema. The service info is added if it was set.
+If pretty is true, the json is indented with two spaces per level. Keys are always sorted, so the order is stable
+either way.
+*/
+func marshalJsonEntry(jsonMap map[string]interface{}, pretty bool, transformers ...JsonTransformer) ([]byte, error) {
+	if !serviceInfo.isEmpty() {
+		jsonMap["Service"] = serviceInfo.toJsonMap()
+	}
+	schemaMap := toSchemaMap(jsonMap, CurrentJsonSchema, transformers...)
+	if pretty {
+		return json.MarshalIndent(schemaMap, "", "  ")
+	}
+	return json.Marshal(schemaMap)
+}
@@ -0,0 +1,200 @@
+package sherlog
+
+import (
+	"encoding/json"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+/*
+k8sEnvFields maps the environment variables that deployments commonly fill from the Kubernetes downward API to
+the keys K8sFormatter writes them under.
+*/
+var k8sEnvFields = map[string]string{
+	"POD_NAME":      "pod",
+	"POD_NAMESPACE": "namespace",
+	"NODE_NAME":     "node",
+	"POD_IP":        "pod_ip",
+}
+
+/*
+K8sFormatter is a Formatter that writes single line json with the key names that fluent-bit's and most log
+platforms' default json parsers look for:
+
+	{"level":"error","msg":"could not connect to postgres","namespace":"prod","pod":"users-5d8f7","stack":"\tmain.main(main.go:12)","ts":"2018-10-03T07:51:14.123Z","user":42}
+
+Fields (see WithField) go at the top level. They can't replace the keys that K8sFormatter writes itself. The
+level is lowercase and ts is RFC3339 in UTC, with nanoseconds.
+*/
+type K8sFormatter struct {
+	// StaticFields are added to every entry, such as the pod and namespace.
+	StaticFields map[string]interface{}
+}
+
+/*
+NewK8sFormatter returns a new K8sFormatter whose StaticFields are filled from the POD_NAME, POD_NAMESPACE,
+NODE_NAME, and POD_IP environment variables (as pod, namespace, node, and pod_ip) when they are set. Expose
+them to the container with the downward API:
+
+	env:
+	  - name: POD_NAME
+	    valueFrom:
+	      fieldRef:
+	        fieldPath: metadata.name
+	  - name: POD_NAMESPACE
+	    valueFrom:
+	      fieldRef:
+	        fieldPath: metadata.namespace
+*/
+func NewK8sFormatter() *K8sFormatter {
+	staticFields := map[string]interface{}{}
+	for envVar, key := range k8sEnvFields {
+		if value := os.Getenv(envVar); value != "" {
+			staticFields[key] = value
+		}
+	}
+	return &K8sFormatter{StaticFields: staticFields}
+}
+
+/*
+Format turns entry into a single line of json.
+*/
+func (kf *K8sFormatter) Format(entry *Entry) ([]byte, error) {
+	return json.Marshal(kf.ToK8sMap(entry))
+}
+
+/*
+ToK8sMap creates the map[string]interface{} that Format marshals.
+*/
+func (kf *K8sFormatter) ToK8sMap(entry *Entry) map[string]interface{} {
+	k8sMap := map[string]interface{}{}
+	for key, value := range entry.Fields {
+		k8sMap[key] = SanitizeFieldValue(value)
+	}
+	for key, value := range kf.StaticFields {
+		k8sMap[key] = value
+	}
+	k8sMap["ts"] = entry.Time.UTC().Format(time.RFC3339Nano)
+	k8sMap["msg"] = entry.Message
+	if entry.Level != nil {
+		k8sMap["level"] = strings.ToLower(entry.Level.GetLabel())
+	}
+	if len(entry.StackTrace) > 0 {
+		k8sMap["stack"] = entry.StackTraceAsString()
+	}
+	if entry.CorrelationID != "" {
+		k8sMap["correlation_id"] = entry.CorrelationID
+	}
+	if entry.Duration != 0 {
+		k8sMap["duration_ms"] = durationMillis(entry.Duration)
+	}
+	return k8sMap
+}
+
+/*
+K8sLogger writes every entry to stdout as a single line of json using a K8sFormatter, which is what container
+log collectors expect. Log, LogNoStack, and LogJson all write the same json, LogNoStack just leaves out the
+stack. When Log is given multiple errors, each one is written on its own line. Is thread safe :)
+*/
+type K8sLogger struct {
+	FileLogger
+}
+
+/*
+NewK8sLogger creates a new K8sLogger that writes to stdout with the formatter returned by NewK8sFormatter.
+*/
+func NewK8sLogger() *K8sLogger {
+	return newK8sLogger(os.Stdout)
+}
+
+func newK8sLogger(stdout *os.File) *K8sLogger {
+	return &K8sLogger{
+		FileLogger: FileLogger{
+			file:      stdout,
+			mutex:     new(sync.Mutex),
+			formatter: NewK8sFormatter(),
+			skipSync:  true,
+		},
+	}
+}
+
+/*
+LogNoStack writes errToLog without its stack trace. Is thread safe :)
+*/
+func (kl *K8sLogger) LogNoStack(errToLog error) error {
+	return kl.throughWithError(kl.logNoStack, errToLog)
+}
+
+func (kl *K8sLogger) logNoStack(errToLog error) error {
+	if errToLog == nil {
+		return AsError("tried to log nil error")
+	}
+	entry := NewEntry(errToLog)
+	entry.StackTrace = nil
+	entry.Err = nil // So that StackTraceAsString can't bring the stack back
+	kl.mutex.Lock()
+	defer kl.mutex.Unlock()
+	return kl.writeEntry(entry)
+}
+
+/*
+LogJson writes errToLog the same way as Log, since entries are always json. Is thread safe :)
+*/
+func (kl *K8sLogger) LogJson(errToLog error) error {
+	return kl.Log(errToLog)
+}
+
+/*
+Close does nothing since stdout should stay open.
+*/
+func (kl *K8sLogger) Close() {}
+
+/*
+Critical turns values into a *LeveledException with level CRITICAL and then calls the logger's
+Log function.
+*/
+func (kl *K8sLogger) Critical(values ...interface{}) error {
+	return kl.Log(kl.graduate(EnumCritical, values...))
+}
+
+/*
+Error turns values into a *LeveledException with level ERROR and then calls the logger's
+Log function.
+*/
+func (kl *K8sLogger) Error(values ...interface{}) error {
+	return kl.Log(kl.graduate(EnumError, values...))
+}
+
+/*
+OpsError turns values into a *LeveledException with level OPS_ERROR and then calls the logger's
+Log function.
+*/
+func (kl *K8sLogger) OpsError(values ...interface{}) error {
+	return kl.Log(kl.graduate(EnumOpsError, values...))
+}
+
+/*
+Warn turns values into a *LeveledException with level WARNING and then calls the logger's
+Log function.
+*/
+func (kl *K8sLogger) Warn(values ...interface{}) error {
+	return kl.Log(kl.graduate(EnumWarning, values...))
+}
+
+/*
+Info turns values into a *LeveledException with level INFO and then calls the logger's
+Log function.
+*/
+func (kl *K8sLogger) Info(values ...interface{}) error {
+	return kl.Log(kl.graduate(EnumInfo, values...))
+}
+
+/*
+Debug turns values into a *LeveledException with level DEBUG and then calls the logger's
+Log function.
+*/
+func (kl *K8sLogger) Debug(values ...interface{}) error {
+	return kl.Log(kl.graduate(EnumDebug, values...))
+}
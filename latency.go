@@ -0,0 +1,125 @@
+package sherlog
+
+import (
+	"sync/atomic"
+	"time"
+)
+
+/*
+latencyBounds are the upper bounds of the buckets of every LatencyHistogram.
+*/
+var latencyBounds = []time.Duration{
+	50 * time.Microsecond,
+	100 * time.Microsecond,
+	250 * time.Microsecond,
+	500 * time.Microsecond,
+	time.Millisecond,
+	2500 * time.Microsecond,
+	5 * time.Millisecond,
+	10 * time.Millisecond,
+	25 * time.Millisecond,
+	50 * time.Millisecond,
+	100 * time.Millisecond,
+	250 * time.Millisecond,
+	500 * time.Millisecond,
+	time.Second,
+	2500 * time.Millisecond,
+	5 * time.Second,
+}
+
+/*
+LatencyBucket is one bucket of a LatencyHistogram. Count is how many writes took UpTo or less, so the counts
+of the buckets only ever grow from one bucket to the next.
+*/
+type LatencyBucket struct {
+	UpTo  time.Duration
+	Count uint64
+}
+
+/*
+LatencyHistogram is an approximate histogram of how long the writes of a logger took, from when the entry was
+handed to the logger to when the logger returned. Count includes the writes that were slower than the last bucket.
+*/
+type LatencyHistogram struct {
+	Count   uint64
+	Total   time.Duration
+	Max     time.Duration
+	Buckets []LatencyBucket
+}
+
+/*
+Mean returns the average time a write took.
+*/
+func (lh LatencyHistogram) Mean() time.Duration {
+	if lh.Count == 0 {
+		return 0
+	}
+	return lh.Total / time.Duration(lh.Count)
+}
+
+/*
+Quantile returns the approximate time that the fraction q (from 0 to 1) of writes finished within, such as 0.99 for
+the 99th percentile. It is the upper bound of the bucket that the quantile falls in, or Max if it falls beyond the
+last bucket.
+*/
+func (lh LatencyHistogram) Quantile(q float64) time.Duration {
+	if lh.Count == 0 {
+		return 0
+	}
+	rank := uint64(q * float64(lh.Count))
+	for _, bucket := range lh.Buckets {
+		if bucket.Count >= rank && bucket.Count > 0 {
+			if bucket.UpTo > lh.Max {
+				return lh.Max
+			}
+			return bucket.UpTo
+		}
+	}
+	return lh.Max
+}
+
+/*
+latencyRecorder counts write latencies into the buckets of latencyBounds. Is thread safe :)
+*/
+type latencyRecorder struct {
+	count   uint64
+	total   int64
+	max     int64
+	buckets []uint64
+}
+
+func newLatencyRecorder() *latencyRecorder {
+	return &latencyRecorder{buckets: make([]uint64, len(latencyBounds))}
+}
+
+func (lr *latencyRecorder) record(latency time.Duration) {
+	atomic.AddUint64(&lr.count, 1)
+	atomic.AddInt64(&lr.total, int64(latency))
+	for {
+		max := atomic.LoadInt64(&lr.max)
+		if int64(latency) <= max || atomic.CompareAndSwapInt64(&lr.max, max, int64(latency)) {
+			break
+		}
+	}
+	for i, bound := range latencyBounds {
+		if latency <= bound {
+			atomic.AddUint64(&lr.buckets[i], 1)
+			return
+		}
+	}
+}
+
+func (lr *latencyRecorder) snapshot() LatencyHistogram {
+	histogram := LatencyHistogram{
+		Count:   atomic.LoadUint64(&lr.count),
+		Total:   time.Duration(atomic.LoadInt64(&lr.total)),
+		Max:     time.Duration(atomic.LoadInt64(&lr.max)),
+		Buckets: make([]LatencyBucket, len(latencyBounds)),
+	}
+	var cumulative uint64
+	for i, bound := range latencyBounds {
+		cumulative += atomic.LoadUint64(&lr.buckets[i])
+		histogram.Buckets[i] = LatencyBucket{UpTo: bound, Count: cumulative}
+	}
+	return histogram
+}
@@ -0,0 +1,147 @@
+package sherlog
+
+import (
+	"reflect"
+	"time"
+)
+
+/*
+LevelConfig describes the file that a level gets logged to by a MultiFileLogger created with
+NewMultiFileLoggerFromConfig. At most one of RollNightly, RollEvery, and RollAfterMessages can be set.
+If none of them are, the file never rolls.
+*/
+type LevelConfig struct {
+	Path string
+
+	// RollNightly rolls the file at midnight.
+	RollNightly bool
+
+	// RollEvery rolls the file every duration.
+	RollEvery time.Duration
+
+	// RollAfterMessages rolls the file after this many messages.
+	RollAfterMessages int
+
+	// MaxFileAge deletes rolled files older than this (see SetMaxFileAge). Requires a roll policy.
+	MaxFileAge time.Duration
+
+	// Formatter is used for the entries of the file (see SetFormatter). nil uses the default format.
+	Formatter Formatter
+}
+
+/*
+NewMultiFileLoggerFromConfig returns a new MultiFileLogger where every level has its own path, roll policy,
+retention, and formatter. For example, DEBUG can roll hourly and be kept for a day while ERROR rolls nightly
+and is kept for 90 days:
+
+	logger, err := sherlog.NewMultiFileLoggerFromConfig(map[sherlog.Level]sherlog.LevelConfig{
+		sherlog.EnumDebug: {Path: "debug.log", RollEvery: time.Hour, MaxFileAge: 24 * time.Hour},
+		sherlog.EnumError: {Path: "error.log", RollNightly: true, MaxFileAge: 90 * 24 * time.Hour},
+	}, sherlog.LevelConfig{Path: "default.log"})
+
+defaultConfig is used for levels that are not in configs and for errors without a level. Levels (including the
+default) that have the same Path share one logger, so they must have the same config. Returns an error if they
+don't.
+*/
+func NewMultiFileLoggerFromConfig(configs map[Level]LevelConfig, defaultConfig LevelConfig) (*MultiFileLogger, error) {
+	byPath := map[string]LevelConfig{defaultConfig.Path: defaultConfig}
+	for _, config := range configs {
+		if existing, exists := byPath[config.Path]; exists && !reflect.DeepEqual(existing, config) {
+			return nil, NewLeveledException("levels that share the path "+config.Path+" have different configs", EnumError)
+		}
+		byPath[config.Path] = config
+	}
+
+	created := map[string]Logger{}
+	closeCreated := func() {
+		for _, logger := range created {
+			logger.Close()
+		}
+	}
+	loggerFor := func(config LevelConfig) (Logger, error) {
+		if logger, exists := created[config.Path]; exists {
+			return logger, nil
+		}
+		logger, err := newLoggerFromConfig(config)
+		if err != nil {
+			return nil, err
+		}
+		created[config.Path] = logger
+		return logger, nil
+	}
+
+	defaultLogger, err := loggerFor(defaultConfig)
+	if err != nil {
+		return nil, err
+	}
+	loggers := make(map[Level]Logger, len(configs))
+	for level, config := range configs {
+		loggers[level], err = loggerFor(config)
+		if err != nil {
+			closeCreated()
+			return nil, err
+		}
+	}
+	return &MultiFileLogger{
+		loggers:       loggers,
+		defaultLogger: defaultLogger,
+	}, nil
+}
+
+/*
+newLoggerFromConfig creates the kind of logger that config describes.
+*/
+func newLoggerFromConfig(config LevelConfig) (Logger, error) {
+	numRollPolicies := 0
+	for _, isSet := range []bool{config.RollNightly, config.RollEvery > 0, config.RollAfterMessages > 0} {
+		if isSet {
+			numRollPolicies++
+		}
+	}
+	if numRollPolicies > 1 {
+		return nil, NewLeveledException("only one roll policy can be set for "+config.Path, EnumError)
+	}
+
+	var fileLogger *FileLogger
+	var rollingFileLogger *RollingFileLogger
+	var logger Logger
+	switch {
+	case config.RollNightly:
+		nightly, err := NewNightlyRollingFileLogger(config.Path)
+		if err != nil {
+			return nil, err
+		}
+		fileLogger, rollingFileLogger, logger = &nightly.FileLogger, nightly, nightly
+	case config.RollEvery > 0:
+		custom, err := NewCustomRollingFileLogger(config.Path, config.RollEvery)
+		if err != nil {
+			return nil, err
+		}
+		fileLogger, rollingFileLogger, logger = &custom.FileLogger, custom, custom
+	case config.RollAfterMessages > 0:
+		sizeBased, err := NewRollingFileLoggerWithSizeLimit(config.Path, config.RollAfterMessages)
+		if err != nil {
+			return nil, err
+		}
+		fileLogger, rollingFileLogger, logger = &sizeBased.FileLogger, &sizeBased.RollingFileLogger, sizeBased
+	default:
+		plain, err := NewFileLogger(config.Path)
+		if err != nil {
+			return nil, err
+		}
+		fileLogger, logger = plain, plain
+	}
+
+	fileLogger.SetFormatter(config.Formatter)
+	if config.MaxFileAge > 0 {
+		if rollingFileLogger == nil {
+			logger.Close()
+			return nil, NewLeveledException("MaxFileAge requires a roll policy for "+config.Path, EnumError)
+		}
+		if err := rollingFileLogger.SetMaxFileAge(config.MaxFileAge, nil); err != nil {
+			logger.Close()
+			return nil, err
+		}
+	}
+	return logger, nil
+}
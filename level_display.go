@@ -0,0 +1,109 @@
+package sherlog
+
+import (
+	"sort"
+	"sync"
+	"unicode/utf8"
+)
+
+/*
+LevelDisplay is how a level is shown to humans.
+*/
+type LevelDisplay struct {
+	// Color is the ANSI escape code that ConsoleFormatter colors the level's entries with. Empty means no color.
+	Color string
+
+	// ShortCode is a 1 to 3 character abbreviation of the level's label, such as "OE" for OPS_ERROR.
+	ShortCode string
+
+	// Rank decides the order levels are sorted in by SortLevels, lowest first. The built in levels are ranked by
+	// their ids, so CRITICAL comes first.
+	Rank int
+}
+
+/*
+levelDisplays holds the displays registered with RegisterLevelDisplay, along with the built in levels' defaults.
+*/
+var levelDisplays = struct {
+	sync.RWMutex
+	byLevel map[Level]LevelDisplay
+}{byLevel: map[Level]LevelDisplay{
+	EnumCritical: {Color: DefaultConsoleColors[EnumCritical], ShortCode: "C", Rank: int(EnumCritical)},
+	EnumError:    {Color: DefaultConsoleColors[EnumError], ShortCode: "E", Rank: int(EnumError)},
+	EnumOpsError: {Color: DefaultConsoleColors[EnumOpsError], ShortCode: "OE", Rank: int(EnumOpsError)},
+	EnumWarning:  {Color: DefaultConsoleColors[EnumWarning], ShortCode: "W", Rank: int(EnumWarning)},
+	EnumInfo:     {Color: DefaultConsoleColors[EnumInfo], ShortCode: "I", Rank: int(EnumInfo)},
+	EnumDebug:    {Color: DefaultConsoleColors[EnumDebug], ShortCode: "D", Rank: int(EnumDebug)},
+}}
+
+/*
+RegisterLevelDisplay sets how level is shown, replacing its current display. Use it to give custom levels a color
+and short code, or to restyle the built in ones. Registered levels are also recognized by their labels when
+reading log files back, such as by Compact. Is thread safe :)
+
+	sherlog.RegisterLevelDisplay(Audit, sherlog.LevelDisplay{Color: "\x1b[36m", ShortCode: "A", Rank: 35})
+*/
+func RegisterLevelDisplay(level Level, display LevelDisplay) {
+	levelDisplays.Lock()
+	defer levelDisplays.Unlock()
+	levelDisplays.byLevel[level] = display
+}
+
+/*
+DisplayOf returns how level is shown. Levels that were never registered get no color, the first letter of their
+label as the short code, and their id as the rank.
+*/
+func DisplayOf(level Level) LevelDisplay {
+	levelDisplays.RLock()
+	display, registered := levelDisplays.byLevel[level]
+	levelDisplays.RUnlock()
+	if registered || level == nil {
+		return display
+	}
+	display.Rank = level.GetLevelId()
+	if label := level.GetLabel(); label != "" {
+		_, size := utf8.DecodeRuneInString(label)
+		display.ShortCode = label[:size]
+	}
+	return display
+}
+
+/*
+SortLevels sorts levels by the Rank of their display, breaking ties by label.
+*/
+func SortLevels(levels []Level) {
+	sort.SliceStable(levels, func(i, j int) bool {
+		rankI, rankJ := DisplayOf(levels[i]).Rank, DisplayOf(levels[j]).Rank
+		if rankI != rankJ {
+			return rankI < rankJ
+		}
+		return levels[i].GetLabel() < levels[j].GetLabel()
+	})
+}
+
+/*
+LevelWithLabel returns the built in or registered (see RegisterLevelDisplay) level with label. Returns false if there
+isn't one.
+*/
+func LevelWithLabel(label string) (Level, bool) {
+	for level, levelLabel := range levelLabels {
+		if levelLabel == label {
+			return level, true
+		}
+	}
+	return registeredLevelWithLabel(label)
+}
+
+/*
+registeredLevelWithLabel returns the registered level with label.
+*/
+func registeredLevelWithLabel(label string) (Level, bool) {
+	levelDisplays.RLock()
+	defer levelDisplays.RUnlock()
+	for level := range levelDisplays.byLevel {
+		if level.GetLabel() == label {
+			return level, true
+		}
+	}
+	return nil, false
+}
@@ -0,0 +1,56 @@
+package sherlog
+
+/*
+LevelPolicy decides what happens to the level of an existing *LeveledException when it
+gets graduated again (for example, an OPS_ERROR that bubbles up through a handler that
+calls AsError).
+*/
+type LevelPolicy int
+
+const (
+	/*
+		KeepOriginalLevel leaves the existing level alone. This preserves the information of
+		whoever created the exception closest to the actual problem.
+	*/
+	KeepOriginalLevel LevelPolicy = iota
+
+	/*
+		EscalateOnly only changes the level if the new level is more severe than the existing one.
+		Severity is determined by LevelId: a lower LevelId is more severe (EnumCritical is 0, EnumDebug is 5).
+	*/
+	EscalateOnly
+
+	/*
+		Overwrite always replaces the existing level with the new one. This was the behavior prior to 1.8.0.
+	*/
+	Overwrite
+)
+
+/*
+GraduateWithPolicy works like the AsFoo functions, but uses policy instead of DefaultLevelPolicy
+to decide what to do if the error already has a level.
+*/
+func GraduateWithPolicy(level Level, policy LevelPolicy, values ...interface{}) error {
+	return graduateOrConcatAndCreateWithPolicy(level, policy, 7, values...)
+}
+
+/*
+shouldReplaceLevel returns true if policy says that current should be replaced by next.
+*/
+func shouldReplaceLevel(current, next Level, policy LevelPolicy) bool {
+	switch {
+	case current == nil:
+		return true
+	case next == nil:
+		return false
+	}
+
+	switch policy {
+	case Overwrite:
+		return true
+	case EscalateOnly:
+		return next.GetLevelId() < current.GetLevelId()
+	default:
+		return false
+	}
+}
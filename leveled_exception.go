@@ -50,7 +50,7 @@ func (le *LeveledException) GetLevel() Level {
 }
 
 /*
-SetLevel sets the level.
+SetLevel sets the level. Use WithLevel instead if the exception may be in use by other goroutines.
 */
 func (le *LeveledException) SetLevel(level Level) {
 	le.level = level
@@ -80,11 +80,10 @@ func NewLeveledExceptionWithStackTraceSize(message string, level Level, maxStack
 	return newLeveledException(message, level, maxStackTraceDepth, 5)
 }
 
-func newLeveledException(message string, level Level, maxStackTraceDepth, skip int) error {
-	return &LeveledException{
-		StdException: *newStdException(message, maxStackTraceDepth, skip),
-		level:        level,
-	}
+func newLeveledException(message string, level Level, maxStackTraceDepth, skip int) *LeveledException {
+	le := &LeveledException{level: level}
+	le.StdException.init(message, maxStackTraceDepth, skip)
+	return le
 }
 
 /*
@@ -107,6 +106,32 @@ func (le *LeveledException) Log(writer io.Writer) error {
 		return err
 	}
 	_, err = writer.Write([]byte(le.GetStackTraceAsString()))
+	if err != nil {
+		return err
+	}
+	return writeErrorDetail(writer, le.cause)
+}
+
+/*
+LogOmittingCommonFrames works like Log, but the frames at the bottom of the stack trace that are also at the
+bottom of innerStackTrace are replaced with a single line:
+
+	yyyy-mm-dd hh:mm:ss - LEVEL - message:
+		sherlog.exampleFunc(exampleFile.go:18)
+		...2 common frames omitted
+
+Returns an error if there was one.
+*/
+func (le *LeveledException) LogOmittingCommonFrames(writer io.Writer, innerStackTrace []*StackTraceEntry) error {
+	err := le.LogNoStack(writer)
+	if err != nil {
+		return err
+	}
+	_, err = writer.Write([]byte(":\n"))
+	if err != nil {
+		return err
+	}
+	_, err = writer.Write([]byte(stackTraceAsStringOmittingCommon(le.stackTrace, countCommonFrames(le.stackTrace, innerStackTrace))))
 	return err
 }
 
@@ -119,11 +144,23 @@ Note that it does not have the stack trace.
 Returns the string that was logged or an error if there was one.
 */
 func (le *LeveledException) LogNoStack(writer io.Writer) error {
-	for _, msg := range le.messageChain {
-		writer.Write([]byte(msg))
+	for _, msg := range limitMessageChain(le.messageChain) {
+		writer.Write([]byte(sanitizeText(msg, true)))
 		writer.Write([]byte("\nCaused by:\n"))
 	}
-	_, err := writer.Write([]byte(le.timestamp.Format(timeFmt)))
+	_, err := writer.Write([]byte(le.timestamp.Format(timeLayoutOf(writer))))
+	if err != nil {
+		return err
+	}
+	err = writeServiceInfo(writer)
+	if err != nil {
+		return err
+	}
+	err = writeSequenceNumber(writer, le.sequenceNumber())
+	if err != nil {
+		return err
+	}
+	err = writeCorrelationID(writer, le.correlationID)
 	if err != nil {
 		return err
 	}
@@ -139,42 +176,47 @@ func (le *LeveledException) LogNoStack(writer io.Writer) error {
 	if err != nil {
 		return err
 	}
-	_, err = writer.Write([]byte(le.message))
-	return err
+	_, err = writer.Write([]byte(sanitizeText(le.message, true)))
+	if err != nil {
+		return err
+	}
+	err = writeDuration(writer, le.duration)
+	if err != nil {
+		return err
+	}
+	return writeFields(writer, le.fields)
 }
 
 /*
 LogAsJson packages up the exception's info into json and writes it to writer.
 
-The json is formatted like this
+The json is wrapped in the envelope of CurrentJsonSchema (see JsonSchema). With JsonSchemaV7 it is formatted like this
 	{
-	   "Level":"INFO",
-	   "Message":"I'm informative!",
-	   "StackTrace":[
-		  {
-			 "FunctionName":"github.com/Nick-Anderssohn/sherlog.TestLogJson",
-			 "File":"/home/nick/go/src/github.com/Nick-Anderssohn/sherlog/scratch_test.go",
-			 "Line":68
-		  },
-		  {
-			 "FunctionName":"testing.tRunner",
-			 "File":"/usr/local/go/src/testing/testing.go",
-			 "Line":777
-		  },
-		  {
-			 "FunctionName":"runtime.goexit",
-			 "File":"/usr/local/go/src/runtime/asm_amd64.s",
-			 "Line":2361
-		  }
-	   ],
-	   "StackTraceStr":"\tgithub.com/Nick-Anderssohn/sherlog.TestLogJson(/home/nick/go/src/github.com/Nick-Anderssohn/sherlog/scratch_test.go:68)\n\ttesting.tRunner(/usr/local/go/src/testing/testing.go:777)\n\truntime.goexit(/usr/local/go/src/runtime/asm_amd64.s:2361)\n",
-	   "Time":"2018-10-03 07:51:14"
+	   "sherlog":"7",
+	   "entry":{
+		  "Level":"INFO",
+		  "Message":"I'm informative!",
+		  "StackTrace":[
+			 {
+				"FunctionName":"github.com/Nick-Anderssohn/sherlog.TestLogJson",
+				"File":"/home/nick/go/src/github.com/Nick-Anderssohn/sherlog/scratch_test.go",
+				"Line":68
+			 },
+			 {
+				"FunctionName":"testing.tRunner",
+				"File":"/usr/local/go/src/testing/testing.go",
+				"Line":777
+			 }
+		  ],
+		  "StackTraceStr":"\tgithub.com/Nick-Anderssohn/sherlog.TestLogJson(/home/nick/go/src/github.com/Nick-Anderssohn/sherlog/scratch_test.go:68)\n\ttesting.tRunner(/usr/local/go/src/testing/testing.go:777)",
+		  "Time":"2018-10-03 07:51:14"
+	   }
 	}
 
 Returns an error if there was one.
 */
 func (le *LeveledException) LogAsJson(writer io.Writer) error {
-	jsonBytes, err := le.ToJsonBytes()
+	jsonBytes, err := marshalJsonEntry(le.ToJsonMap(), false)
 
 	if err != nil {
 		return err
@@ -0,0 +1,156 @@
+package sherlog
+
+/*
+LogCritical turns values into a *LeveledException with level CRITICAL just like logger.Critical, logs it with
+logger, and returns it so that logging and returning it is one call:
+
+	if err != nil {
+		exception, _ := sherlog.LogCritical(logger, "could not start: ", err)
+		return exception
+	}
+
+Also returns the error logger.Log returned, if any. Returns nil, nil if values is a single nil.
+*/
+func LogCritical(logger Logger, values ...interface{}) (*LeveledException, error) {
+	return logLeveled(logger, GraduateWithSkip(EnumCritical, 0, values...))
+}
+
+/*
+LogError turns values into a *LeveledException with level ERROR just like logger.Error, logs it with logger, and
+returns it. Also returns the error logger.Log returned, if any. Returns nil, nil if values is a single nil.
+*/
+func LogError(logger Logger, values ...interface{}) (*LeveledException, error) {
+	return logLeveled(logger, GraduateWithSkip(EnumError, 0, values...))
+}
+
+/*
+LogOpsError turns values into a *LeveledException with level OPS_ERROR just like logger.OpsError, logs it with
+logger, and returns it. Also returns the error logger.Log returned, if any. Returns nil, nil if values is a
+single nil.
+*/
+func LogOpsError(logger Logger, values ...interface{}) (*LeveledException, error) {
+	return logLeveled(logger, GraduateWithSkip(EnumOpsError, 0, values...))
+}
+
+/*
+LogWarn turns values into a *LeveledException with level WARNING just like logger.Warn, logs it with logger, and
+returns it. Also returns the error logger.Log returned, if any. Returns nil, nil if values is a single nil.
+*/
+func LogWarn(logger Logger, values ...interface{}) (*LeveledException, error) {
+	return logLeveled(logger, GraduateWithSkip(EnumWarning, 0, values...))
+}
+
+/*
+LogInfo turns values into a *LeveledException with level INFO just like logger.Info, logs it with logger, and
+returns it. Also returns the error logger.Log returned, if any. Returns nil, nil if values is a single nil.
+*/
+func LogInfo(logger Logger, values ...interface{}) (*LeveledException, error) {
+	return logLeveled(logger, GraduateWithSkip(EnumInfo, 0, values...))
+}
+
+/*
+LogDebug turns values into a *LeveledException with level DEBUG just like logger.Debug, logs it with logger, and
+returns it. Also returns the error logger.Log returned, if any. Returns nil, nil if values is a single nil.
+*/
+func LogDebug(logger Logger, values ...interface{}) (*LeveledException, error) {
+	return logLeveled(logger, GraduateWithSkip(EnumDebug, 0, values...))
+}
+
+/*
+logLeveled logs graduated, which is nil or a *LeveledException, and returns it.
+*/
+func logLeveled(logger Logger, graduated error) (*LeveledException, error) {
+	exception, _ := graduated.(*LeveledException)
+	if exception == nil {
+		return nil, nil
+	}
+	return exception, logger.Log(exception)
+}
+
+/*
+LogAndReturn logs err with logger if it isn't nil and returns it unchanged, which replaces the usual
+
+	if err != nil {
+		logger.Log(err)
+	}
+	return err
+
+with
+
+	return sherlog.LogAndReturn(logger, err)
+
+If logger fails to log err, the failure is reported to the diagnostics logger (see SetDiagnosticsLogger). The LogAndReturnFoo variants log err with
+level Foo instead (following DefaultLevelPolicy, like logger.Foo), but still return err unchanged.
+*/
+func LogAndReturn(logger Logger, err error) error {
+	if err != nil {
+		handleLogAndReturnFail(logger.Log(err))
+	}
+	return err
+}
+
+/*
+LogAndReturnCritical logs err with level CRITICAL if it isn't nil and returns it unchanged. See LogAndReturn.
+*/
+func LogAndReturnCritical(logger Logger, err error) error {
+	if err != nil {
+		handleLogAndReturnFail(logger.Log(GraduateWithSkip(EnumCritical, 0, err)))
+	}
+	return err
+}
+
+/*
+LogAndReturnError logs err with level ERROR if it isn't nil and returns it unchanged. See LogAndReturn.
+*/
+func LogAndReturnError(logger Logger, err error) error {
+	if err != nil {
+		handleLogAndReturnFail(logger.Log(GraduateWithSkip(EnumError, 0, err)))
+	}
+	return err
+}
+
+/*
+LogAndReturnOpsError logs err with level OPS_ERROR if it isn't nil and returns it unchanged. See LogAndReturn.
+*/
+func LogAndReturnOpsError(logger Logger, err error) error {
+	if err != nil {
+		handleLogAndReturnFail(logger.Log(GraduateWithSkip(EnumOpsError, 0, err)))
+	}
+	return err
+}
+
+/*
+LogAndReturnWarn logs err with level WARNING if it isn't nil and returns it unchanged. See LogAndReturn.
+*/
+func LogAndReturnWarn(logger Logger, err error) error {
+	if err != nil {
+		handleLogAndReturnFail(logger.Log(GraduateWithSkip(EnumWarning, 0, err)))
+	}
+	return err
+}
+
+/*
+LogAndReturnInfo logs err with level INFO if it isn't nil and returns it unchanged. See LogAndReturn.
+*/
+func LogAndReturnInfo(logger Logger, err error) error {
+	if err != nil {
+		handleLogAndReturnFail(logger.Log(GraduateWithSkip(EnumInfo, 0, err)))
+	}
+	return err
+}
+
+/*
+LogAndReturnDebug logs err with level DEBUG if it isn't nil and returns it unchanged. See LogAndReturn.
+*/
+func LogAndReturnDebug(logger Logger, err error) error {
+	if err != nil {
+		handleLogAndReturnFail(logger.Log(GraduateWithSkip(EnumDebug, 0, err)))
+	}
+	return err
+}
+
+func handleLogAndReturnFail(logErr error) {
+	if logErr != nil {
+		defaultHandleLoggerFail(logErr)
+	}
+}
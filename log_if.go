@@ -0,0 +1,87 @@
+package sherlog
+
+/*
+LogIfErr logs err with logger if it isn't nil, and does nothing if it is. Use it to log the result of a call that
+may or may not have failed without logging a useless entry for nil:
+
+	sherlog.LogIfErr(logger, file.Close())
+
+Returns the error logger.Log returned, if any.
+*/
+func LogIfErr(logger Logger, err error) error {
+	if err == nil {
+		return nil
+	}
+	return logger.Log(err)
+}
+
+/*
+CriticalIf logs values with level CRITICAL just like logger.Critical if cond is true, and does nothing if it
+isn't. The values are only turned into an exception when cond is true, so it is cheap to call when cond is
+usually false:
+
+	sherlog.DebugIf(logger, verbose, "cache miss for ", key)
+
+Nothing is logged if values is a single nil error either. Returns the error logger.Log returned, if any.
+*/
+func CriticalIf(logger Logger, cond bool, values ...interface{}) error {
+	if !cond {
+		return nil
+	}
+	return LogIfErr(logger, GraduateWithSkip(EnumCritical, 0, values...))
+}
+
+/*
+ErrorIf logs values with level ERROR just like logger.Error if cond is true, and does nothing if it isn't.
+See CriticalIf.
+*/
+func ErrorIf(logger Logger, cond bool, values ...interface{}) error {
+	if !cond {
+		return nil
+	}
+	return LogIfErr(logger, GraduateWithSkip(EnumError, 0, values...))
+}
+
+/*
+OpsErrorIf logs values with level OPS_ERROR just like logger.OpsError if cond is true, and does nothing if it isn't.
+See CriticalIf.
+*/
+func OpsErrorIf(logger Logger, cond bool, values ...interface{}) error {
+	if !cond {
+		return nil
+	}
+	return LogIfErr(logger, GraduateWithSkip(EnumOpsError, 0, values...))
+}
+
+/*
+WarnIf logs values with level WARNING just like logger.Warn if cond is true, and does nothing if it isn't.
+See CriticalIf.
+*/
+func WarnIf(logger Logger, cond bool, values ...interface{}) error {
+	if !cond {
+		return nil
+	}
+	return LogIfErr(logger, GraduateWithSkip(EnumWarning, 0, values...))
+}
+
+/*
+InfoIf logs values with level INFO just like logger.Info if cond is true, and does nothing if it isn't.
+See CriticalIf.
+*/
+func InfoIf(logger Logger, cond bool, values ...interface{}) error {
+	if !cond {
+		return nil
+	}
+	return LogIfErr(logger, GraduateWithSkip(EnumInfo, 0, values...))
+}
+
+/*
+DebugIf logs values with level DEBUG just like logger.Debug if cond is true, and does nothing if it isn't.
+See CriticalIf.
+*/
+func DebugIf(logger Logger, cond bool, values ...interface{}) error {
+	if !cond {
+		return nil
+	}
+	return LogIfErr(logger, GraduateWithSkip(EnumDebug, 0, values...))
+}
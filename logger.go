@@ -1,12 +1,10 @@
 package sherlog
 
 import (
-	"encoding/json"
 	"fmt"
 	"io"
 	"os"
 	"sync"
-	"time"
 )
 
 type logFunction func(writer io.Writer) error
@@ -27,6 +25,15 @@ type LoggableWithNoStackOption interface {
 	LogNoStack(writer io.Writer) error
 }
 
+/*
+LoggableWithCommonFramesOmitted should be implemented by something for a Logger's Log function to be able to
+collapse the frames it shares with the stack trace of the error it was caused by.
+*/
+type LoggableWithCommonFramesOmitted interface {
+	Loggable
+	LogOmittingCommonFrames(writer io.Writer, innerStackTrace []*StackTraceEntry) error
+}
+
 /*
 JsonLoggable should be implemented by something for it to be loggable by a Logger's LogJson function
 */
@@ -35,6 +42,20 @@ type JsonLoggable interface {
 	LogAsJson(writer io.Writer) error
 }
 
+/*
+JsonMapper is implemented by errors that can convert themselves into a map that gets marshaled as json.
+All sherlog exceptions implement it.
+*/
+type JsonMapper interface {
+	ToJsonMap() map[string]interface{}
+}
+
+/*
+JsonTransformer modifies the json map of an entry before it gets marshaled. It may modify jsonMap in place
+and return it, or return a new map.
+*/
+type JsonTransformer func(jsonMap map[string]interface{}) map[string]interface{}
+
 /*
 Logger is an interface representing a Logger that can call all of a Loggable's log functions.
 */
@@ -56,9 +77,21 @@ FileLogger logs exceptions to a single file path.
 Writes are not buffered. Opens and closes per exception written.
 */
 type FileLogger struct {
-	logFilePath string
-	mutex       *sync.Mutex
-	file        *os.File
+	callerSkipper
+	middlewareChain
+	logFilePath          string
+	mutex                *sync.Mutex
+	file                 *os.File
+	collapseCommonFrames bool
+	includeCaller        bool
+	formatter            Formatter
+	jsonTransformers     []JsonTransformer
+	includeStackString   bool
+	omitStackFrames      bool
+	prettyJson           bool
+	skipSync             bool // Terminals and pipes can't be synced
+	timeLayout           string
+	closed               bool
 }
 
 /*
@@ -78,8 +111,51 @@ func NewFileLogger(logFilePath string) (*FileLogger, error) {
 	}, nil
 }
 
+/*
+CurrentFilePath returns the path of the file being written to. Empty for loggers that write to stdout or stderr.
+*/
+func (l *FileLogger) CurrentFilePath() string {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	return l.logFilePath
+}
+
 func openFile(fileName string) (*os.File, error) {
-	return os.OpenFile(fileName, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	return os.OpenFile(longPath(fileName), os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+}
+
+/*
+SetCollapseCommonFrames turns on/off collapsing of common stack frames. When on and Log is given multiple
+errors, each error's stack trace leaves out the frames that are also at the bottom of the next (inner) error's
+stack trace, and shows "...N common frames omitted" instead. Off by default.
+*/
+func (l *FileLogger) SetCollapseCommonFrames(collapse bool) {
+	l.collapseCommonFrames = collapse
+}
+
+/*
+SetIncludeCaller turns on/off including the caller (file:line of the top stack frame) when logging without the
+stack trace. When on, LogNoStack appends " (file:line)" to the line, and LogJson adds a "Caller" field if the
+error has a stack trace. Off by default.
+*/
+func (l *FileLogger) SetIncludeCaller(include bool) {
+	l.includeCaller = include
+}
+
+/*
+SetFormatter makes Log use formatter instead of the Loggable's Log function. Each value passed to Log becomes
+its own entry, followed by a newline (unless the formatter is an EntrySeparator). Pass nil to go back to the default format. LogNoStack and LogJson are not
+affected.
+*/
+func (l *FileLogger) SetFormatter(formatter Formatter) {
+	l.formatter = formatter
+}
+
+/*
+GetFormatter returns the formatter set with SetFormatter, or nil if the default format is used.
+*/
+func (l *FileLogger) GetFormatter() Formatter {
+	return l.formatter
 }
 
 /*
@@ -87,9 +163,16 @@ Log calls loggable's Log function. Is thread safe :)
 Non-sherlog errors get logged with only timestamp and message
 */
 func (l *FileLogger) Log(errorsToLog ...interface{}) error {
+	return l.through(l.logValues, errorsToLog)
+}
+
+func (l *FileLogger) logValues(errorsToLog ...interface{}) error {
 	if len(errorsToLog) < 1 {
 		return AsError("no parameters provided to Log")
 	}
+	if l.formatter != nil {
+		return l.logFormatted(errorsToLog)
+	}
 
 	l.mutex.Lock()
 	defer func() {
@@ -101,19 +184,25 @@ func (l *FileLogger) Log(errorsToLog ...interface{}) error {
 			return AsError("tried to log nil error")
 		}
 
+		var err error
 		switch impl := errToLog.(type) {
-		case Loggable:
-			err := l.log(impl.Log)
-			if err != nil {
-				return AsError(err)
+		case LoggableWithCommonFramesOmitted:
+			if innerStackTrace := l.innerStackTraceToCollapse(errorsToLog, i); innerStackTrace != nil {
+				err = l.log(func(writer io.Writer) error {
+					return impl.LogOmittingCommonFrames(writer, innerStackTrace)
+				})
+			} else {
+				err = l.log(impl.Log)
 			}
+		case Loggable:
+			err = l.log(impl.Log)
 		case error:
-			err := l.logNonSherlogError(impl)
-			if err != nil {
-				return AsError(err)
-			}
+			err = l.logNonSherlogError(impl)
 		default:
-			l.file.Write([]byte(fmt.Sprintf("%v", impl)))
+			l.file.Write([]byte(sanitizeText(fmt.Sprintf("%v", impl), true)))
+		}
+		if err != nil {
+			return AsError(err)
 		}
 
 		if i < len(errorsToLog)-1 {
@@ -123,11 +212,64 @@ func (l *FileLogger) Log(errorsToLog ...interface{}) error {
 	return nil
 }
 
+/*
+logFormatted writes each value in errorsToLog as its own entry using the logger's formatter.
+*/
+func (l *FileLogger) logFormatted(errorsToLog []interface{}) error {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	for _, errToLog := range errorsToLog {
+		if errToLog == nil {
+			return AsError("tried to log nil error")
+		}
+		if err := l.writeEntry(NewEntry(errToLog)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+/*
+writeEntry writes entry using the logger's formatter. The mutex must be held.
+*/
+func (l *FileLogger) writeEntry(entry *Entry) error {
+	entry.TimeLayout = l.timeLayout
+	entryBytes, err := l.formatter.Format(entry)
+	if err != nil {
+		return loggerFailure(ErrFormat, err)
+	}
+	err = l.log(func(writer io.Writer) error {
+		_, err := writer.Write(append(entryBytes, separatorFor(l.formatter)...))
+		return err
+	})
+	if err != nil {
+		return AsError(err)
+	}
+	return nil
+}
+
+/*
+innerStackTraceToCollapse returns the stack trace of the error after errorsToLog[i] if frames should be collapsed.
+*/
+func (l *FileLogger) innerStackTraceToCollapse(errorsToLog []interface{}, i int) []*StackTraceEntry {
+	if !l.collapseCommonFrames || i >= len(errorsToLog)-1 {
+		return nil
+	}
+	if stackTraceWrapper, ok := errorsToLog[i+1].(StackTraceWrapper); ok {
+		return stackTraceWrapper.GetStackTrace()
+	}
+	return nil
+}
+
 /*
 LogNoStack calls loggable's LogNoStack function. Is thread safe :)
 Non-sherlog errors get logged with only timestamp and message
 */
 func (l *FileLogger) LogNoStack(errToLog error) error {
+	return l.throughWithError(l.logNoStack, errToLog)
+}
+
+func (l *FileLogger) logNoStack(errToLog error) error {
 	if errToLog == nil {
 		return AsError("tried to log nil error")
 	}
@@ -139,16 +281,28 @@ func (l *FileLogger) LogNoStack(errToLog error) error {
 	}()
 
 	if loggable, isLoggable := errToLog.(LoggableWithNoStackOption); isLoggable {
-		return l.log(loggable.LogNoStack)
+		err := l.log(loggable.LogNoStack)
+		if err != nil || !l.includeCaller {
+			return err
+		}
+		if caller := callerOf(errToLog); caller != "" {
+			_, err = l.file.Write([]byte(" (" + caller + ")"))
+		}
+		return err
 	}
 	return l.logNonSherlogError(errToLog)
 }
 
 /*
-LogJson calls loggable's LogJson function. Is thread safe :)
-Non-sherlog errors get logged with only timestamp and message
+LogJson logs the error as a json blob. Is thread safe :)
+Sherlog exceptions only get the structured "StackTrace" by default (see SetIncludeStackString and
+SetIncludeStackFrames). Non-sherlog errors get logged with only timestamp and message
 */
 func (l *FileLogger) LogJson(errToLog error) error {
+	return l.throughWithError(l.logJson, errToLog)
+}
+
+func (l *FileLogger) logJson(errToLog error) error {
 	if errToLog == nil {
 		return AsError("tried to log nil error")
 	}
@@ -159,35 +313,103 @@ func (l *FileLogger) LogJson(errToLog error) error {
 		l.mutex.Unlock()
 	}()
 
-	if loggable, isLoggable := errToLog.(JsonLoggable); isLoggable {
+	mapper, isMapper := errToLog.(JsonMapper)
+	if loggable, isLoggable := errToLog.(JsonLoggable); isLoggable && !isMapper {
 		return l.log(loggable.LogAsJson)
 	}
 
-	// Else, manually extract info...
-	jsonBytes, err := json.Marshal(map[string]interface{}{
-		"Time":    time.Now().In(Location).Format(timeFmt), // Use log time instead of time of creation since we don't have one....
-		"Message": errToLog.Error(),
-	})
+	var jsonMap map[string]interface{}
+	if isMapper {
+		jsonMap = mapper.ToJsonMap()
+		if caller := callerOf(errToLog); caller != "" && l.includeCaller {
+			jsonMap["Caller"] = caller
+		}
+		if stdException := stdExceptionOf(errToLog); stdException != nil && l.timeLayout != "" {
+			jsonMap["Time"] = stdException.timestamp.Format(l.timeLayout)
+		}
+	} else {
+		// Else, manually extract info...
+		jsonMap = map[string]interface{}{
+			"Time":    Clock().In(Location).Format(layoutOrDefault(l.timeLayout)), // Use log time instead of time of creation since we don't have one....
+			"Message": errToLog.Error(),
+		}
+		if seq := nextSequenceNumber(); seq != 0 {
+			jsonMap["Sequence"] = seq
+		}
+	}
+
+	removeStackRepresentations(jsonMap, l.includeStackString, !l.omitStackFrames)
+	jsonBytes, err := marshalJsonEntry(jsonMap, l.prettyJson, l.jsonTransformers...)
 	if err != nil {
-		return err
+		return loggerFailure(ErrFormat, err)
 	}
 
-	_, err = l.file.Write(jsonBytes)
+	if _, err = l.file.Write(jsonBytes); isClosedFileErr(err) {
+		return loggerFailure(ErrLoggerClosed, err)
+	}
 	return err
 }
 
 /*
-Close closes the file writer.
+SetIncludeStackString turns on/off the "StackTraceStr" key in LogJson's output. It holds the same information as
+"StackTrace", so it is off by default to keep entries small.
+*/
+func (l *FileLogger) SetIncludeStackString(include bool) {
+	l.includeStackString = include
+}
+
+/*
+SetPrettyJson turns on/off indenting the json written by LogJson. Each entry then spans multiple lines, which is
+much easier to read when tailing a local log file, but harder for log shippers that expect one entry per line.
+Keys are always sorted alphabetically, so the order is stable either way. Off by default.
+*/
+func (l *FileLogger) SetPrettyJson(pretty bool) {
+	l.prettyJson = pretty
+}
+
+/*
+SetIncludeStackFrames turns on/off the structured "StackTrace" key in LogJson's output. On by default.
+*/
+func (l *FileLogger) SetIncludeStackFrames(include bool) {
+	l.omitStackFrames = !include
+}
+
+/*
+AddJsonTransformer registers a transformer that LogJson runs on every entry's json map right before it gets
+marshaled. Transformers run in the order they were added, after the keys have been filtered by CurrentJsonSchema,
+so keys they add are always kept. Use them to add service metadata, rename keys, or drop keys you don't need:
+
+	logger.AddJsonTransformer(func(jsonMap map[string]interface{}) map[string]interface{} {
+		delete(jsonMap, "StackTraceStr")
+		jsonMap["Service"] = "user-service"
+		return jsonMap
+	})
+*/
+func (l *FileLogger) AddJsonTransformer(transformer JsonTransformer) {
+	l.jsonTransformers = append(l.jsonTransformers, transformer)
+}
+
+/*
+Close closes the file writer. Is thread safe :)
 */
 func (l *FileLogger) Close() {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	l.closed = true
 	l.file.Close()
 }
 
 func (l *FileLogger) log(logFunc logFunction) error {
-	err := logFunc(l.file)
+	err := logFunc(l.writer())
+	if isClosedFileErr(err) {
+		return loggerFailure(ErrLoggerClosed, err)
+	}
 	if err != nil {
 		return err
 	}
+	if l.skipSync {
+		return nil
+	}
 	//l.file.Write([]byte("\n\n"))
 	err = l.file.Sync() // To improve perf, may want to move this to just run every minute or so
 	if err != nil {
@@ -197,20 +419,48 @@ func (l *FileLogger) log(logFunc logFunction) error {
 }
 
 func (l *FileLogger) logNonSherlogError(errToLog error) error {
-	now := time.Now().In(Location).Format(timeFmt) // Use log time instead of time of creation since we don't have one....
+	return writeNonSherlogError(l.writer(), errToLog)
+}
+
+/*
+writeNonSherlogError writes errToLog to writer with only a timestamp and message. If errToLog carries a stack
+trace the way github.com/pkg/errors does, or implements xerrors.Formatter (see ErrorDetail), those are written too.
+*/
+func writeNonSherlogError(writer io.Writer, errToLog error) error {
+	now := Clock().In(Location).Format(timeLayoutOf(writer)) // Use log time instead of time of creation since we don't have one....
 
-	_, err := l.file.Write([]byte(now))
+	_, err := writer.Write([]byte(now))
 	if err != nil {
 		return err
 	}
 
-	_, err = l.file.Write([]byte(" - "))
+	err = writeServiceInfo(writer)
 	if err != nil {
 		return err
 	}
 
-	_, err = l.file.Write([]byte(errToLog.Error()))
-	return err
+	err = writeSequenceNumber(writer, nextSequenceNumber())
+	if err != nil {
+		return err
+	}
+
+	_, err = writer.Write([]byte(" - "))
+	if err != nil {
+		return err
+	}
+
+	_, err = writer.Write([]byte(sanitizeText(errToLog.Error(), true)))
+	if err != nil {
+		return err
+	}
+
+	if stackTrace := thirdPartyStackTrace(errToLog); stackTrace != nil {
+		_, err = writer.Write([]byte(":\n" + stackTraceAsString(stackTrace)))
+		if err != nil {
+			return err
+		}
+	}
+	return writeErrorDetail(writer, errToLog)
 }
 
 /*
@@ -218,7 +468,7 @@ Critical turns values into a *LeveledException with level CRITICAL and then call
 Log function.
 */
 func (l *FileLogger) Critical(values ...interface{}) error {
-	return l.Log(graduateOrConcatAndCreate(EnumCritical, values...))
+	return l.Log(l.graduate(EnumCritical, values...))
 }
 
 /*
@@ -226,7 +476,7 @@ Error turns values into a *LeveledException with level ERROR and then calls the
 Log function.
 */
 func (l *FileLogger) Error(values ...interface{}) error {
-	return l.Log(graduateOrConcatAndCreate(EnumError, values...))
+	return l.Log(l.graduate(EnumError, values...))
 }
 
 /*
@@ -234,7 +484,7 @@ OpsError turns values into a *LeveledException with level OPS_ERROR and then cal
 Log function.
 */
 func (l *FileLogger) OpsError(values ...interface{}) error {
-	return l.Log(graduateOrConcatAndCreate(EnumOpsError, values...))
+	return l.Log(l.graduate(EnumOpsError, values...))
 }
 
 /*
@@ -242,7 +492,7 @@ Warn turns values into a *LeveledException with level WARNING and then calls the
 Log function.
 */
 func (l *FileLogger) Warn(values ...interface{}) error {
-	return l.Log(graduateOrConcatAndCreate(EnumWarning, values...))
+	return l.Log(l.graduate(EnumWarning, values...))
 }
 
 /*
@@ -250,7 +500,7 @@ Info turns values into a *LeveledException with level INFO and then calls the lo
 Log function.
 */
 func (l *FileLogger) Info(values ...interface{}) error {
-	return l.Log(graduateOrConcatAndCreate(EnumInfo, values...))
+	return l.Log(l.graduate(EnumInfo, values...))
 }
 
 /*
@@ -258,5 +508,5 @@ Debug turns values into a *LeveledException with level DEBUG and then calls the
 Log function.
 */
 func (l *FileLogger) Debug(values ...interface{}) error {
-	return l.Log(graduateOrConcatAndCreate(EnumDebug, values...))
+	return l.Log(l.graduate(EnumDebug, values...))
 }
@@ -0,0 +1,84 @@
+package sherlog
+
+import (
+	"errors"
+	"fmt"
+	"os"
+)
+
+/*
+The kinds of failures that loggers report. Log functions return an exception whose cause is one of these, so that
+handleLoggerFail callbacks and callers can branch on what went wrong with Is instead of matching strings:
+
+	logger := sherlog.NewPolyLoggerWithHandleLoggerFail(loggers, func(err error) {
+		if sherlog.Is(err, sherlog.ErrDestinationUnavailable) {
+			fallbackLogger.Log(err)
+		}
+	})
+*/
+var (
+	// ErrLoggerClosed is returned when something is logged with a logger that has been closed.
+	ErrLoggerClosed = errors.New("sherlog: logger is closed")
+
+	// ErrQueueFull is returned by loggers with a bounded queue when an entry was dropped because the queue is full.
+	ErrQueueFull = errors.New("sherlog: queue is full")
+
+	// ErrDestinationUnavailable is returned when a network destination (a collector, broker, or http endpoint)
+	// could not be reached or refused the entries.
+	ErrDestinationUnavailable = errors.New("sherlog: destination is unavailable")
+
+	// ErrRejected is returned when a destination was reached but refused the entries as invalid, such as an http
+	// endpoint responding with 400. Retrying won't help.
+	ErrRejected = errors.New("sherlog: destination rejected the entries")
+
+	// ErrFormat is returned when an entry could not be formatted or encoded.
+	ErrFormat = errors.New("sherlog: could not format entry")
+)
+
+/*
+Is walks the Unwrap chain of err and returns true if target is in it. It works like errors.Is from Go 1.13.
+*/
+func Is(err, target error) (found bool) {
+	walkChain(err, func(cur error) bool {
+		found = cur == target
+		return !found
+	})
+	return
+}
+
+/*
+loggerFailure returns an OPS_ERROR exception caused by kind, with a message that describes both kind and details.
+Returns details as is if it already is a failure of some kind.
+*/
+func loggerFailure(kind error, details ...interface{}) error {
+	if len(details) == 1 {
+		if err, isErr := details[0].(error); isErr && isLoggerFailure(err) {
+			return err
+		}
+	}
+	message := kind.Error()
+	if len(details) > 0 {
+		message += ": " + fmt.Sprint(details...)
+	}
+	// Skip loggerFailure and the functions that create the exception so the stack starts at the caller
+	exception := newLeveledException(message, EnumOpsError, defaultStackTraceDepth, 5)
+	exception.cause = kind
+	return exception
+}
+
+/*
+isLoggerFailure returns true if err was created by loggerFailure.
+*/
+func isLoggerFailure(err error) bool {
+	return Is(err, ErrLoggerClosed) || Is(err, ErrQueueFull) || Is(err, ErrDestinationUnavailable) || Is(err, ErrRejected) || Is(err, ErrFormat)
+}
+
+/*
+isClosedFileErr returns true if err came from using a closed *os.File.
+*/
+func isClosedFileErr(err error) bool {
+	if pathErr, isPathErr := err.(*os.PathError); isPathErr {
+		err = pathErr.Err
+	}
+	return err == os.ErrClosed
+}
@@ -1,7 +1,34 @@
 package sherlog
 
 import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"errors"
+	"expvar"
+	"flag"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"log"
+	"math"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"regexp"
+	"runtime"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"syscall"
 	"testing"
+	"time"
+	"unicode/utf8"
 )
 
 var testSte = StackTraceEntry{
@@ -91,6 +118,2843 @@ func Test_graduateOrConcatAndCreate_returnsNilWhenPassedNil(t *testing.T) {
 	}
 }
 
+func TestLevelPolicy(t *testing.T) {
+	opsErr := NewOpsError("db offline")
+
+	err := GraduateWithPolicy(EnumError, KeepOriginalLevel, opsErr)
+	errorIfFalse(err.(LevelWrapper).GetLevel() == EnumOpsError, t, "KeepOriginalLevel changed the level")
+
+	err = GraduateWithPolicy(EnumWarning, EscalateOnly, opsErr)
+	errorIfFalse(err.(LevelWrapper).GetLevel() == EnumOpsError, t, "EscalateOnly lowered the severity")
+
+	err = GraduateWithPolicy(EnumCritical, EscalateOnly, opsErr)
+	errorIfFalse(err.(LevelWrapper).GetLevel() == EnumCritical, t, "EscalateOnly did not raise the severity")
+
+	err = GraduateWithPolicy(EnumDebug, Overwrite, opsErr)
+	errorIfFalse(err.(LevelWrapper).GetLevel() == EnumDebug, t, "Overwrite did not change the level")
+}
+
+func TestAsErrorStackTraceStartsAtCaller(t *testing.T) {
+	err := AsError(fmt.Errorf("not a sherlog error"))
+	stackTrace := err.(*LeveledException).GetStackTrace()
+	errorIfFalse(strings.HasSuffix(stackTrace[0].FunctionName, "TestAsErrorStackTraceStartsAtCaller"), t, "stack trace does not start at the caller")
+
+	err = GraduateWithPolicy(EnumError, Overwrite, "concat", "enated")
+	stackTrace = err.(*LeveledException).GetStackTrace()
+	errorIfFalse(strings.HasSuffix(stackTrace[0].FunctionName, "TestAsErrorStackTraceStartsAtCaller"), t, "stack trace does not start at the caller")
+}
+
+type testWrapper struct {
+	cause error
+}
+
+func (tw *testWrapper) Error() string { return "wrapped: " + tw.cause.Error() }
+func (tw *testWrapper) Unwrap() error { return tw.cause }
+
+func TestChainNavigation(t *testing.T) {
+	root := fmt.Errorf("connection refused")
+	opsErr := AsOpsError(root)
+	wrapped := &testWrapper{cause: opsErr}
+
+	errorIfFalse(RootCause(wrapped) == root, t, "RootCause did not return the innermost error")
+	errorIfFalse(LevelOf(wrapped) == EnumOpsError, t, "LevelOf did not find the wrapped level")
+	errorIfFalse(len(StackOf(wrapped)) > 0, t, "StackOf did not find the wrapped stack trace")
+	errorIfFalse(LevelOf(root) == nil, t, "LevelOf found a level on a plain error")
+	errorIfFalse(RootCause(nil) == nil, t, "RootCause(nil) was not nil")
+}
+
+func TestHTTPStatusOf(t *testing.T) {
+	errorIfFalse(HTTPStatusOf(NewOpsError("db offline")) == http.StatusServiceUnavailable, t, "OPS_ERROR did not map to 503")
+	errorIfFalse(HTTPStatusOf(NewWarning("slow")) == http.StatusOK, t, "WARNING did not map to 200")
+	errorIfFalse(HTTPStatusOf(fmt.Errorf("plain")) == http.StatusInternalServerError, t, "plain error did not map to 500")
+	errorIfFalse(HTTPStatusOf(WithHTTPStatus(NewError("missing"), http.StatusNotFound)) == http.StatusNotFound, t, "explicit status was ignored")
+	errorIfFalse(HTTPStatusOf(WithHTTPStatus(fmt.Errorf("plain"), http.StatusNotFound)) == http.StatusNotFound, t, "explicit status on a plain error was ignored")
+}
+
+func TestWriteHTTPError(t *testing.T) {
+	err := NewOpsError("could not connect to postgres at 10.0.0.7")
+	err.(*LeveledException).NonLoggedMsg = "try again later"
+	recorder := httptest.NewRecorder()
+
+	errorIfFalse(WriteHTTPError(recorder, nil, err) == nil, t, "WriteHTTPError returned an error")
+	errorIfFalse(recorder.Code == http.StatusServiceUnavailable, t, "wrong status code written")
+	errorIfFalse(strings.Contains(recorder.Body.String(), "try again later"), t, "public message was not written")
+	errorIfFalse(!strings.Contains(recorder.Body.String(), "postgres"), t, "internal message was leaked")
+}
+
+func panicSite() {
+	panic("kaboom")
+}
+
+func nilPanicSite() {
+	var ste *StackTraceEntry
+	_ = ste.Line
+}
+
+func recoverFromPanic(panicker func()) (exception *LeveledException) {
+	defer func() {
+		exception = FromPanic(recover())
+	}()
+	panicker()
+	return
+}
+
+func TestFromPanic(t *testing.T) {
+	exception := recoverFromPanic(panicSite)
+	errorIfFalse(exception.GetLevel() == EnumCritical, t, "panic was not CRITICAL")
+	errorIfFalse(exception.GetMessage() == "kaboom", t, "wrong panic message")
+	errorIfFalse(strings.HasSuffix(exception.GetStackTrace()[0].FunctionName, "panicSite"), t, "stack trace does not start at the panic site")
+
+	exception = recoverFromPanic(nilPanicSite)
+	errorIfFalse(exception.Unwrap() != nil, t, "runtime error was not kept as the cause")
+	errorIfFalse(strings.HasSuffix(exception.GetStackTrace()[0].FunctionName, "nilPanicSite"), t, "stack trace does not start at the nil dereference")
+
+	errorIfFalse(FromPanic(nil) == nil, t, "FromPanic(nil) was not nil")
+}
+
+func TestStackTraceAsStringOmittingCommon(t *testing.T) {
+	outer := []*StackTraceEntry{{FunctionName: "wrap", File: "f.go", Line: 1}, {FunctionName: "main", File: "m.go", Line: 2}}
+	inner := []*StackTraceEntry{{FunctionName: "root", File: "r.go", Line: 3}, {FunctionName: "main", File: "m.go", Line: 2}}
+
+	numCommon := countCommonFrames(outer, inner)
+	errorIfFalse(numCommon == 1, t, "wrong number of common frames")
+	errorIfFalse(stackTraceAsStringOmittingCommon(outer, numCommon) == "\twrap(f.go:1)\n\t...1 common frames omitted", t, "common frames were not collapsed")
+	errorIfFalse(stackTraceAsStringOmittingCommon(outer, 0) == stackTraceAsString(outer), t, "frames were collapsed when none were common")
+}
+
+func logErrorThroughHelper(logger Logger) {
+	logger.Error("logged through a helper")
+}
+
+func TestCallerSkipAndIncludeCaller(t *testing.T) {
+	dir, err := ioutil.TempDir("", "sherlog")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	logPath := filepath.Join(dir, "caller.log")
+	logger, err := NewFileLogger(logPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	logger.SetCallerSkip(1)
+	logger.SetIncludeCaller(true)
+
+	logErrorThroughHelper(logger)
+	logger.LogNoStack(NewError("no stack"))
+	logger.Close()
+
+	contents, err := ioutil.ReadFile(logPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	lines := strings.Split(string(contents), "\n")
+	errorIfFalse(strings.Contains(lines[1], "TestCallerSkipAndIncludeCaller"), t, "caller skip was not applied")
+	errorIfFalse(strings.Contains(string(contents), "no stack (") && strings.Contains(string(contents), "logging_test.go:"), t, "caller was not included")
+}
+
+func TestSequenceNumbers(t *testing.T) {
+	SetStampSequenceNumbers(true)
+	defer SetStampSequenceNumbers(false)
+
+	logger := NewMultiWriterLogger(ioutil.Discard)
+	first := NewInfo("first").(*LeveledException)
+	neverLogged := NewInfo("never logged").(*LeveledException)
+	second := NewInfo("second").(*LeveledException)
+	errorIfFalse(first.GetSequenceNumber() == 0, t, "sequence number stamped before the exception was logged")
+	logger.Log(first)
+	logger.Log(second)
+	errorIfFalse(second.GetSequenceNumber() == first.GetSequenceNumber()+1, t, "an exception that was never logged left a gap")
+	errorIfFalse(neverLogged.GetSequenceNumber() == 0, t, "an exception that was never logged got a sequence number")
+	logger.Log(second)
+	errorIfFalse(second.GetSequenceNumber() == first.GetSequenceNumber()+1, t, "logging an exception again changed its sequence number")
+	errorIfFalse(second.ToJsonMap()["Sequence"] == second.GetSequenceNumber(), t, "sequence number missing from json")
+
+	var buf strings.Builder
+	second.LogNoStack(&buf)
+	errorIfFalse(strings.Contains(buf.String(), fmt.Sprintf(" - #%d - INFO - second", second.GetSequenceNumber())), t, "sequence number missing from text")
+
+	SetStampSequenceNumbers(false)
+	third := NewInfo("third").(*LeveledException)
+	logger.Log(third)
+	errorIfFalse(third.GetSequenceNumber() == 0, t, "sequence number stamped while off")
+}
+
+type recordingLogger struct {
+	callerSkipper
+	logged []interface{}
+}
+
+func (rl *recordingLogger) Log(errorsToLog ...interface{}) error {
+	rl.logged = append(rl.logged, errorsToLog...)
+	return nil
+}
+func (rl *recordingLogger) Close()                          {}
+func (rl *recordingLogger) LogNoStack(errToLog error) error { return rl.Log(errToLog) }
+func (rl *recordingLogger) LogJson(errToLog error) error    { return rl.Log(errToLog) }
+func (rl *recordingLogger) Critical(values ...interface{}) error {
+	return rl.Log(rl.graduate(EnumCritical, values...))
+}
+func (rl *recordingLogger) Error(values ...interface{}) error {
+	return rl.Log(rl.graduate(EnumError, values...))
+}
+func (rl *recordingLogger) OpsError(values ...interface{}) error {
+	return rl.Log(rl.graduate(EnumOpsError, values...))
+}
+func (rl *recordingLogger) Warn(values ...interface{}) error {
+	return rl.Log(rl.graduate(EnumWarning, values...))
+}
+func (rl *recordingLogger) Info(values ...interface{}) error {
+	return rl.Log(rl.graduate(EnumInfo, values...))
+}
+func (rl *recordingLogger) Debug(values ...interface{}) error {
+	return rl.Log(rl.graduate(EnumDebug, values...))
+}
+
+func TestCorrelationMiddleware(t *testing.T) {
+	inner := &recordingLogger{}
+	handler := CorrelationMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		NewContextLogger(r.Context(), inner).Error("something broke")
+	}))
+
+	request := httptest.NewRequest(http.MethodGet, "/", nil)
+	request.Header.Set(CorrelationIDHeader, "abc123")
+	recorder := httptest.NewRecorder()
+	handler.ServeHTTP(recorder, request)
+
+	errorIfFalse(recorder.Header().Get(CorrelationIDHeader) == "abc123", t, "correlation ID was not echoed")
+	errorIfFalse(len(inner.logged) == 1, t, "nothing was logged")
+	exception := inner.logged[0].(*LeveledException)
+	errorIfFalse(exception.GetCorrelationID() == "abc123", t, "correlation ID was not stamped")
+
+	var buf strings.Builder
+	exception.LogNoStack(&buf)
+	errorIfFalse(strings.Contains(buf.String(), " - [abc123] - ERROR - something broke"), t, "correlation ID missing from text")
+	errorIfFalse(len(NewCorrelationID()) == 32, t, "wrong correlation ID length")
+
+	inner.logged = nil
+	request = httptest.NewRequest(http.MethodGet, "/", nil)
+	request.Header.Set(CorrelationIDHeader, "abc\x1b[31m"+strings.Repeat("é", 100))
+	handler.ServeHTTP(httptest.NewRecorder(), request)
+	id := inner.logged[0].(*LeveledException).GetCorrelationID()
+	errorIfFalse(strings.HasPrefix(id, "abcé") && len(id) <= 128, t, "correlation ID header was not cleaned up and capped")
+	errorIfFalse(utf8.ValidString(id), t, "capping the correlation ID split a character")
+
+	buf.Reset()
+	WithCorrelationID(NewError("something broke"), "forged]\n2018-10-03 - CRITICAL - fake").(*LeveledException).LogNoStack(&buf)
+	errorIfFalse(!strings.Contains(buf.String(), "\n2018"), t, "correlation ID was not sanitized in text output")
+}
+
+func TestECSFormatter(t *testing.T) {
+	entry := NewEntry(AsOpsError(fmt.Errorf("could not connect to postgres")))
+	ecsMap := NewECSFormatter("user-service").ToECSMap(entry)
+
+	errorIfFalse(ecsMap["message"] == "could not connect to postgres", t, "wrong message")
+	errorIfFalse(ecsMap["log"].(map[string]interface{})["level"] == "OPS_ERROR", t, "wrong log.level")
+	errorIfFalse(ecsMap["service"].(map[string]interface{})["name"] == "user-service", t, "wrong service.name")
+	errorMap := ecsMap["error"].(map[string]interface{})
+	errorIfFalse(errorMap["type"] == "*errors.errorString", t, "error.type is not the root cause's type")
+	errorIfFalse(strings.Contains(errorMap["stack_trace"].(string), "TestECSFormatter"), t, "missing error.stack_trace")
+	_, err := time.Parse(time.RFC3339Nano, ecsMap["@timestamp"].(string))
+	errorIfFalse(err == nil, t, "@timestamp is not RFC3339")
+}
+
+func TestOTLPFormatter(t *testing.T) {
+	ctx := ContextWithCorrelationID(context.Background(), "5b8efff798038103d269b633813fc60c")
+	ctx = ContextWithSpanID(ctx, "eee19b7ec3c1b174")
+	entry := NewEntry(WithContext(ctx, NewError("something broke")))
+	logRecord := NewOTLPFormatter("user-service").ToLogRecord(entry)
+
+	errorIfFalse(logRecord["severityNumber"] == 17, t, "wrong severityNumber")
+	errorIfFalse(logRecord["traceId"] == "5b8efff798038103d269b633813fc60c", t, "wrong traceId")
+	errorIfFalse(logRecord["spanId"] == "eee19b7ec3c1b174", t, "wrong spanId")
+
+	logRecord = NewOTLPFormatter("").ToLogRecord(NewEntry(WithCorrelationID(NewError("x"), "not-hex")))
+	_, hasTraceID := logRecord["traceId"]
+	errorIfFalse(!hasTraceID, t, "invalid trace ID was included")
+
+	_, err := NewOTLPFormatter("user-service").Format(entry)
+	errorIfFalse(err == nil, t, "Format returned an error")
+
+	observed := time.Date(2018, 10, 3, 7, 51, 14, 0, time.UTC)
+	defer SetClock(nil)
+	SetClock(func() time.Time { return observed })
+	logRecord = NewOTLPFormatter("").ToLogRecord(entry)
+	errorIfFalse(logRecord["observedTimeUnixNano"] == strconv.FormatInt(observed.UnixNano(), 10), t, "observedTimeUnixNano did not come from Clock")
+}
+
+func TestJsonSchemaEnvelope(t *testing.T) {
+	exception := NewInfo("I'm informative!").(*LeveledException)
+
+	var buf strings.Builder
+	exception.LogAsJson(&buf)
+	var envelope struct {
+		Sherlog string
+		Entry   map[string]interface{}
+	}
+	err := json.Unmarshal([]byte(buf.String()), &envelope)
+	errorIfFalse(err == nil, t, "LogAsJson did not write valid json")
+	errorIfFalse(envelope.Sherlog == "7", t, "wrong schema version")
+	errorIfFalse(envelope.Entry["Level"] == "INFO" && envelope.Entry["Message"] == "I'm informative!", t, "wrong entry")
+
+	legacy := toSchemaMap(map[string]interface{}{"Message": "m", "Unstable": true}, JsonSchemaV1)
+	errorIfFalse(legacy["Unstable"] == true, t, "JsonSchemaV1 should not filter keys")
+	v2 := toSchemaMap(map[string]interface{}{"Message": "m", "Unstable": true}, JsonSchemaV2)
+	_, hasUnstable := v2["entry"].(map[string]interface{})["Unstable"]
+	errorIfFalse(!hasUnstable, t, "JsonSchemaV2 let an unknown key through")
+}
+
+func TestJsonTransformer(t *testing.T) {
+	dropStackTraceStr := func(jsonMap map[string]interface{}) map[string]interface{} {
+		delete(jsonMap, "StackTraceStr")
+		jsonMap["Service"] = "user-service"
+		return jsonMap
+	}
+	schemaMap := toSchemaMap(NewError("x").(*LeveledException).ToJsonMap(), JsonSchemaV2, dropStackTraceStr)
+	entry := schemaMap["entry"].(map[string]interface{})
+
+	_, hasStackTraceStr := entry["StackTraceStr"]
+	errorIfFalse(!hasStackTraceStr, t, "transformer did not drop StackTraceStr")
+	errorIfFalse(entry["Service"] == "user-service", t, "key added by transformer was filtered out")
+}
+
+func TestJsonFormatterStackToggles(t *testing.T) {
+	formatter := NewJsonFormatter()
+	entryBytes, err := formatter.Format(NewEntry(NewError("x")))
+	errorIfFalse(err == nil, t, "Format returned an error")
+	errorIfFalse(strings.Contains(string(entryBytes), `"StackTrace":`), t, "frames were not included by default")
+	errorIfFalse(!strings.Contains(string(entryBytes), `"StackTraceStr":`), t, "stack string was included by default")
+
+	formatter.IncludeStackString = true
+	formatter.IncludeStackFrames = false
+	entryBytes, _ = formatter.Format(NewEntry(NewError("x")))
+	errorIfFalse(!strings.Contains(string(entryBytes), `"StackTrace":`), t, "frames were included when turned off")
+	errorIfFalse(strings.Contains(string(entryBytes), `"StackTraceStr":`), t, "stack string was not included when turned on")
+}
+
+func TestMarshalProtobuf(t *testing.T) {
+	frame := marshalProtoStackFrame(&StackTraceEntry{FunctionName: "f", File: "g", Line: 3})
+	errorIfFalse(string(frame) == "\x0a\x01f\x12\x01g\x18\x03", t, "wrong StackFrame encoding")
+	errorIfFalse(string(appendProtoVarint(nil, 300)) == "\xac\x02", t, "wrong varint encoding")
+
+	entry := NewEntry(AsError(fmt.Errorf("root")))
+	message := MarshalProtobuf(entry)
+	entryBytes, err := NewProtobufFormatter().Format(entry)
+	errorIfFalse(err == nil, t, "Format returned an error")
+	errorIfFalse(string(entryBytes) == string(appendProtoVarint(nil, uint64(len(message))))+string(message), t, "missing length prefix")
+	errorIfFalse(strings.Contains(string(message), "*errors.errorString"), t, "cause was not encoded")
+}
+
+func TestDelimitedFormatter(t *testing.T) {
+	err := WithHTTPStatus(NewError("line one\nline, two"), http.StatusNotFound)
+	row, formatErr := NewCSVFormatter().Format(NewEntry(err))
+	errorIfFalse(formatErr == nil, t, "Format returned an error")
+	errorIfFalse(!strings.Contains(string(row), "\n"), t, "row contains a newline")
+	errorIfFalse(strings.Contains(string(row), `,ERROR,"line one\nline, two",`), t, "message was not escaped/quoted")
+	errorIfFalse(strings.HasSuffix(string(row), ",404"), t, "missing code")
+
+	row, _ = NewTSVFormatter().Format(NewEntry(NewInfo("a\tb")))
+	errorIfFalse(len(strings.Split(string(row), "\t")) == 5, t, "tab inside of a value was not escaped")
+	errorIfFalse(string(NewCSVFormatter().Header()) == "timestamp,level,message,top frame,code", t, "wrong header")
+}
+
+func TestTemplateFormatter(t *testing.T) {
+	formatter, err := NewTemplateFormatter("[{{.Level}}] {{.Message}}{{range .Stack}} at {{.FunctionName}}{{end}}")
+	errorIfFalse(err == nil, t, "valid template was rejected")
+	entryBytes, err := formatter.Format(NewEntry(NewWarning("slow query")))
+	errorIfFalse(err == nil, t, "Format returned an error")
+	errorIfFalse(strings.HasPrefix(string(entryBytes), "[WARNING] slow query at "), t, "template was not applied")
+	errorIfFalse(strings.Contains(string(entryBytes), "TestTemplateFormatter"), t, "stack was not rendered")
+
+	_, err = NewTemplateFormatter("{{.Level")
+	errorIfFalse(err != nil, t, "invalid template was accepted")
+}
+
+func TestPrettyJson(t *testing.T) {
+	formatter := NewJsonFormatter()
+	formatter.Pretty = true
+	entryBytes, err := formatter.Format(NewEntry(NewInfo("readable")))
+	errorIfFalse(err == nil, t, "Format returned an error")
+	errorIfFalse(strings.Contains(string(entryBytes), "\n  \"entry\": {\n    \"Level\": \"INFO\",\n    \"Message\""), t, "json was not indented with sorted keys")
+}
+
+func TestConsoleFormatter(t *testing.T) {
+	formatter := &ConsoleFormatter{Prefixes: EmojiPrefixes, Colors: DefaultConsoleColors, IncludeStack: true}
+	entryBytes, _ := formatter.Format(NewEntry(NewCritical("on fire")))
+	errorIfFalse(strings.HasPrefix(string(entryBytes), "🔥 "+DefaultConsoleColors[EnumCritical]), t, "critical entry did not start with its prefix and color")
+	errorIfFalse(strings.Contains(string(entryBytes), " - CRITICAL - on fire"+ansiReset+":\n\t"), t, "color was not reset before the stack trace")
+
+	formatter.Plain = true
+	entryBytes, _ = formatter.Format(NewEntry(NewCritical("on fire")))
+	errorIfFalse(!strings.Contains(string(entryBytes), "\x1b") && !strings.Contains(string(entryBytes), "🔥"), t, "plain output had colors or prefixes")
+}
+
+func TestConsoleLoggerDowngradesWhenRedirected(t *testing.T) {
+	file, err := ioutil.TempFile("", "console")
+	errorIfFalse(err == nil, t, "could not create temp file")
+	defer os.Remove(file.Name())
+	defer file.Close()
+
+	logger := newConsoleLogger(file, file)
+	logger.SetLevelPrefixes(SymbolPrefixes)
+	logger.Warn("redirected")
+	logged, _ := ioutil.ReadFile(file.Name())
+	errorIfFalse(strings.Contains(string(logged), " - WARNING - redirected:\n"), t, "warning was not logged")
+	errorIfFalse(!strings.Contains(string(logged), "\x1b") && !strings.Contains(string(logged), SymbolPrefixes[EnumWarning]), t, "redirected output was not plain")
+}
+
+func TestStackRender(t *testing.T) {
+	defer func() { StackRender = StackRenderOptions{} }()
+	StackRender = StackRenderOptions{
+		RelativePaths:      true,
+		ModulePath:         "github.com/Nick-Anderssohn/sherlog",
+		ShortFunctionNames: true,
+		MaxFrames:          2,
+	}
+	stackTrace := []*StackTraceEntry{
+		{FunctionName: "github.com/Nick-Anderssohn/sherlog/parser.Decode", File: "/go/src/github.com/Nick-Anderssohn/sherlog/parser/msgpack.go", Line: 7},
+		{FunctionName: "main.main", File: "/home/nick/other/main.go", Line: 12},
+		{FunctionName: "runtime.main", File: "/usr/local/go/src/runtime/proc.go", Line: 250},
+	}
+	expected := "\tparser.Decode(parser/msgpack.go:7)\n\tmain.main(/home/nick/other/main.go:12)\n\t...1 more frames"
+	errorIfFalse(stackTraceAsString(stackTrace) == expected, t, "stack trace was not rendered with StackRender: "+stackTraceAsString(stackTrace))
+}
+
+func TestServiceInfo(t *testing.T) {
+	SetServiceInfo("user-service", "1.4.2", "9f3c2ab")
+	defer SetServiceInfo("", "", "")
+
+	var buf strings.Builder
+	NewWarning("slow query").(*LeveledException).LogNoStack(&buf)
+	errorIfFalse(strings.Contains(buf.String(), " - user-service@1.4.2 (9f3c2ab) - WARNING - slow query"), t, "service info was not in the text header")
+
+	jsonBytes, err := marshalJsonEntry(NewWarning("slow query").(*LeveledException).ToJsonMap(), false)
+	errorIfFalse(err == nil, t, "could not marshal entry")
+	errorIfFalse(strings.Contains(string(jsonBytes), `"Service":{"Commit":"9f3c2ab","Name":"user-service","Version":"1.4.2"}`), t, "service info was not in the json")
+
+	SetServiceInfo("user-service", "1.4.2\n2018-10-03 - CRITICAL - fake", strings.Repeat("f", 1000))
+	buf.Reset()
+	NewWarning("slow query").(*LeveledException).LogNoStack(&buf)
+	errorIfFalse(!strings.Contains(buf.String(), "\n2018"), t, "service info was not sanitized in text output")
+	errorIfFalse(len(buf.String()) < 600, t, "service info was not capped in text output")
+}
+
+func TestConsoleLoggerStderrLevel(t *testing.T) {
+	dir, err := ioutil.TempDir("", "sherlog")
+	errorIfFalse(err == nil, t, "could not create temp dir")
+	defer os.RemoveAll(dir)
+	stdout, _ := os.Create(filepath.Join(dir, "stdout"))
+	defer stdout.Close()
+	stderr, _ := os.Create(filepath.Join(dir, "stderr"))
+	defer stderr.Close()
+
+	logger := newConsoleLogger(stdout, stderr)
+	logger.SetStderrLevel(EnumWarning)
+	logger.Info("to stdout")
+	logger.Warn("to stderr")
+	logger.LogNoStack(NewCritical("also to stderr"))
+
+	stdoutBytes, _ := ioutil.ReadFile(stdout.Name())
+	stderrBytes, _ := ioutil.ReadFile(stderr.Name())
+	errorIfFalse(strings.Contains(string(stdoutBytes), "to stdout") && !strings.Contains(string(stdoutBytes), "to stderr"), t, "stdout got the wrong entries")
+	errorIfFalse(strings.Contains(string(stderrBytes), "to stderr") && strings.Contains(string(stderrBytes), "also to stderr") && !strings.Contains(string(stderrBytes), "to stdout"), t, "stderr got the wrong entries")
+}
+
+func TestCriticalTeeLogger(t *testing.T) {
+	inner := &recordingLogger{}
+	var stderr strings.Builder
+	logger := NewCriticalTeeLogger(inner)
+	logger.stderr = &stderr
+
+	logger.Error("not teed")
+	logger.Critical("database is unreachable")
+	errorIfFalse(len(inner.logged) == 2, t, "entries were not passed on")
+	errorIfFalse(!strings.Contains(stderr.String(), "not teed"), t, "ERROR was written to stderr")
+	errorIfFalse(strings.Contains(stderr.String(), " - CRITICAL - database is unreachable:\n\t"), t, "CRITICAL was not written to stderr")
+
+	stderr.Reset()
+	logger.Log(NewCritical("database is unreachable"), "cause\n2006-01-02 - CRITICAL - forged\x1b[31m")
+	errorIfFalse(strings.Contains(stderr.String(), `cause\n2006-01-02 - CRITICAL - forged`), t, "non-loggable value was not sanitized")
+	errorIfFalse(!strings.Contains(stderr.String(), "\x1b"), t, "ANSI escape reached stderr")
+}
+
+func TestLogShutdown(t *testing.T) {
+	inner := &recordingLogger{}
+	logShutdown(syscall.SIGTERM, []Logger{inner})
+	errorIfFalse(len(inner.logged) == 1, t, "shutdown entry was not logged")
+	message := inner.logged[0].(*LeveledException).GetMessage()
+	errorIfFalse(strings.HasPrefix(message, "shutting down: signal=terminated uptime=") && strings.HasSuffix(message, " pending=0"), t, "wrong shutdown message: "+message)
+	errorIfFalse(exitCodeFor(syscall.SIGTERM) == 143, t, "wrong exit code for SIGTERM")
+
+	stop := LogOnExit(inner)
+	stop()
+	stop()
+}
+
+func TestTimeBucketedDirs(t *testing.T) {
+	dir, err := ioutil.TempDir("", "sherlog")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	logger, err := NewRollingFileLoggerWithSizeLimit(filepath.Join(dir, "bucketed.log"), 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer logger.Close()
+	flatFilePath := logger.logFilePath
+	errorIfFalse(logger.SetTimeBucketedDirs(true) == nil, t, "could not turn on time bucketed dirs")
+	logger.Error("bucketed")
+
+	now := time.Now().In(Location)
+	matches, _ := filepath.Glob(filepath.Join(dir, now.Format("2006"), now.Format("01"), now.Format("02"), "bucketed_*.log"))
+	errorIfFalse(len(matches) == 2, t, "rolled files were not placed in the time bucket")
+	errorIfFalse(!fileExists(flatFilePath), t, "empty flat file was not removed")
+}
+
+func TestRollOnDemand(t *testing.T) {
+	dir, err := ioutil.TempDir("", "sherlog")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	logger, err := NewRollingFileLoggerWithSizeLimit(filepath.Join(dir, "single.log"), 100)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer logger.Close()
+	var rolledFilePaths []string
+	logger.SetOnRoll(func(rolledFilePath string) {
+		rolledFilePaths = append(rolledFilePaths, rolledFilePath)
+	})
+	firstFilePath := logger.logFilePath
+	errorIfFalse(logger.Roll() == nil, t, "could not roll")
+	errorIfFalse(len(rolledFilePaths) == 1 && rolledFilePaths[0] == firstFilePath, t, "OnRoll was not given the rolled file")
+
+	paths := map[Level]string{
+		EnumError:   filepath.Join(dir, "errors.log"),
+		EnumWarning: filepath.Join(dir, "errors.log"),
+		EnumInfo:    filepath.Join(dir, "info.log"),
+	}
+	multiLogger, err := NewMultiFileLoggerWithSizeBaseRollingLogs(paths, filepath.Join(dir, "default.log"), 100)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer multiLogger.Close()
+	errorIfFalse(multiLogger.RollAll() == nil, t, "could not roll all")
+	errorFiles, _ := filepath.Glob(filepath.Join(dir, "errors_*.log"))
+	infoFiles, _ := filepath.Glob(filepath.Join(dir, "info_*.log"))
+	errorIfFalse(len(errorFiles) == 2 && len(infoFiles) == 2, t, "every logger should have been rolled exactly once")
+}
+
+func TestMaxFileAge(t *testing.T) {
+	dir, err := ioutil.TempDir("", "sherlog")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	oldBucket := filepath.Join(dir, "2001", "02", "03")
+	os.MkdirAll(oldBucket, 0755)
+	expiredFilePaths := []string{filepath.Join(dir, "aged_2001-02-03.log"), filepath.Join(oldBucket, "aged_2001-02-03.log"), filepath.Join(dir, "aged_2001-02-03(1).log")}
+	keptFilePath := filepath.Join(dir, "aged_2001-02-04.log")
+	unrelatedFilePath := filepath.Join(dir, "aged_audit.log")
+	longAgo := time.Now().Add(-48 * time.Hour)
+	for _, filePath := range append(expiredFilePaths, keptFilePath, unrelatedFilePath) {
+		ioutil.WriteFile(filePath, []byte("old entry"), 0644)
+		os.Chtimes(filePath, longAgo, longAgo)
+	}
+	os.Chtimes(keptFilePath, time.Now(), time.Now())
+
+	logger, err := NewRollingFileLoggerWithSizeLimit(filepath.Join(dir, "aged.log"), 100)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer logger.Close()
+	var deleted []string
+	err = logger.SetMaxFileAge(24*time.Hour, func(deletedFilePaths []string) {
+		deleted = deletedFilePaths
+	})
+	errorIfFalse(err == nil, t, "SetMaxFileAge returned an error")
+	errorIfFalse(len(deleted) == 3 && !fileExists(expiredFilePaths[0]) && !fileExists(expiredFilePaths[1]) && !fileExists(expiredFilePaths[2]), t, "expired files were not deleted")
+	errorIfFalse(fileExists(unrelatedFilePath), t, "a file that the logger didn't roll was deleted")
+	errorIfFalse(fileExists(keptFilePath) && fileExists(logger.logFilePath), t, "a file that was not expired was deleted")
+	errorIfFalse(!fileExists(filepath.Join(dir, "2001")), t, "empty time buckets were not removed")
+}
+
+func TestRecoverOrphanedFiles(t *testing.T) {
+	dir, err := ioutil.TempDir("", "sherlog")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	ioutil.WriteFile(filepath.Join(dir, "rec_2001-01-01.log"), nil, 0644)
+	ioutil.WriteFile(filepath.Join(dir, "rec_2001-01-01(1).log"), nil, 0644)
+	ioutil.WriteFile(filepath.Join(dir, "rec_2001-01-02.log"), []byte("old entry"), 0644)
+	ioutil.WriteFile(filepath.Join(dir, "rec_2001-01-02.log.sha256.tmp"), []byte("partial"), 0644)
+	ioutil.WriteFile(filepath.Join(dir, "rec_summary_2001-01-02.json.tmp"), []byte("partial"), 0644)
+	ioutil.WriteFile(filepath.Join(dir, "rec.log.tmp"), nil, 0644)
+	ioutil.WriteFile(filepath.Join(dir, "rec_audit.log"), nil, 0644)
+	ioutil.WriteFile(filepath.Join(dir, "rec_audit.json.tmp"), nil, 0644)
+
+	logger, err := NewRollingFileLoggerWithSizeLimit(filepath.Join(dir, "rec.log"), 100)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer logger.Close()
+	errorIfFalse(logger.RecoverOrphanedFiles() == nil, t, "RecoverOrphanedFiles returned an error")
+
+	errorIfFalse(!fileExists(filepath.Join(dir, "rec_2001-01-01.log")) && !fileExists(filepath.Join(dir, "rec_2001-01-01(1).log")), t, "empty files were not deleted")
+	errorIfFalse(fileExists(filepath.Join(dir, "rec_2001-01-02.log")), t, "a file with entries was deleted")
+	for _, name := range []string{"rec_2001-01-02.log.sha256.tmp", "rec_summary_2001-01-02.json.tmp", "rec.log.tmp"} {
+		errorIfFalse(!fileExists(filepath.Join(dir, name)), t, "unfinished .tmp file was not deleted")
+	}
+	errorIfFalse(fileExists(filepath.Join(dir, "rec_audit.log")) && fileExists(filepath.Join(dir, "rec_audit.json.tmp")), t, "a file that the logger didn't write was deleted")
+	logged, _ := ioutil.ReadFile(logger.logFilePath)
+	errorIfFalse(strings.Contains(string(logged), "INFO - recovered orphaned log files: deleted 2 empty files, deleted 3 unfinished .tmp files"), t, "recovery was not reported: "+string(logged))
+}
+
+func TestNewMultiFileLoggerFromLoggers(t *testing.T) {
+	errorLogger, infoLogger, defaultLogger := &recordingLogger{}, &recordingLogger{}, &recordingLogger{}
+	logger, err := NewMultiFileLoggerFromLoggers(map[Level]Logger{
+		EnumError: errorLogger,
+		EnumInfo:  infoLogger,
+	}, defaultLogger)
+	errorIfFalse(err == nil, t, "could not create MultiFileLogger")
+	logger.Error("to errorLogger")
+	logger.Info("to infoLogger")
+	logger.Debug("to defaultLogger")
+	logger.Log(NewStdException("also to defaultLogger"))
+	errorIfFalse(len(errorLogger.logged) == 1 && len(infoLogger.logged) == 1 && len(defaultLogger.logged) == 2, t, "entries were not routed by level")
+
+	_, err = NewMultiFileLoggerFromLoggers(map[Level]Logger{EnumError: nil}, defaultLogger)
+	errorIfFalse(err != nil, t, "nil logger was accepted")
+}
+
+func TestMultiFileLoggerUncomparableLoggers(t *testing.T) {
+	inner := &recordingLogger{}
+	shared := uncomparableLogger{recordingLogger: inner, tags: []string{"shared"}}
+	logger, err := NewMultiFileLoggerFromLoggers(map[Level]Logger{
+		EnumError: shared,
+		EnumInfo:  shared,
+	}, uncomparableLogger{recordingLogger: &recordingLogger{}})
+	errorIfFalse(err == nil, t, "could not create MultiFileLogger")
+	logger.Error("to shared")
+	errorIfFalse(logger.RollAll() == nil, t, "RollAll failed")
+	logger.Close()
+	errorIfFalse(len(inner.logged) == 1, t, "entry was not routed to a logger that can't be compared")
+}
+
+/*
+formattableLogger is a FormatterSetter value that can't be compared or used as a map key.
+*/
+type formattableLogger struct {
+	uncomparableLogger
+	formatters *[]Formatter
+}
+
+func (fl formattableLogger) SetFormatter(formatter Formatter) {
+	*fl.formatters = append(*fl.formatters, formatter)
+}
+
+func TestSetFormattersUncomparableLoggers(t *testing.T) {
+	var formatters []Formatter
+	shared := formattableLogger{uncomparableLogger: uncomparableLogger{recordingLogger: &recordingLogger{}}, formatters: &formatters}
+	logger, err := NewMultiFileLoggerFromLoggers(map[Level]Logger{EnumError: shared, EnumInfo: shared}, &recordingLogger{})
+	errorIfFalse(err == nil, t, "could not create MultiFileLogger")
+	jsonFormatter := NewJsonFormatter()
+	err = logger.SetFormatters(map[Level]Formatter{EnumError: jsonFormatter, EnumInfo: jsonFormatter})
+	errorIfFalse(err == nil && len(formatters) == 2, t, "loggers that can't be compared were not given their formatters")
+}
+
+func TestNewMultiFileLoggerFromConfig(t *testing.T) {
+	dir, err := ioutil.TempDir("", "sherlog")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	logger, err := NewMultiFileLoggerFromConfig(map[Level]LevelConfig{
+		EnumDebug: {Path: filepath.Join(dir, "debug.log"), RollAfterMessages: 1, MaxFileAge: time.Hour, Formatter: NewJsonFormatter()},
+		EnumError: {Path: filepath.Join(dir, "error.log")},
+	}, LevelConfig{Path: filepath.Join(dir, "default.log")})
+	errorIfFalse(err == nil, t, "could not create MultiFileLogger")
+	logger.Debug("rolled json")
+	logger.Error("plain")
+	logger.Close()
+
+	debugFiles, _ := filepath.Glob(filepath.Join(dir, "debug_*.log"))
+	errorIfFalse(len(debugFiles) == 2, t, "DEBUG file did not roll after one message")
+	errorLog, _ := ioutil.ReadFile(filepath.Join(dir, "error.log"))
+	errorIfFalse(strings.Contains(string(errorLog), " - ERROR - plain"), t, "ERROR was not logged to its own file")
+
+	_, err = NewMultiFileLoggerFromConfig(nil, LevelConfig{Path: filepath.Join(dir, "bad.log"), RollNightly: true, RollAfterMessages: 5})
+	errorIfFalse(err != nil, t, "two roll policies were accepted")
+	_, err = NewMultiFileLoggerFromConfig(nil, LevelConfig{Path: filepath.Join(dir, "bad.log"), MaxFileAge: time.Hour})
+	errorIfFalse(err != nil, t, "MaxFileAge without a roll policy was accepted")
+
+	sharedPath := filepath.Join(dir, "shared.log")
+	_, err = NewMultiFileLoggerFromConfig(map[Level]LevelConfig{
+		EnumDebug: {Path: sharedPath, RollEvery: time.Hour},
+		EnumInfo:  {Path: sharedPath, RollNightly: true},
+	}, LevelConfig{Path: filepath.Join(dir, "default.log")})
+	errorIfFalse(err != nil, t, "different configs for one path were accepted")
+	errorIfFalse(!fileExists(sharedPath), t, "a file was created for a config that was rejected")
+	logger, err = NewMultiFileLoggerFromConfig(map[Level]LevelConfig{
+		EnumDebug: {Path: sharedPath, RollEvery: time.Hour},
+		EnumInfo:  {Path: sharedPath, RollEvery: time.Hour},
+	}, LevelConfig{Path: sharedPath, RollEvery: time.Hour})
+	if err != nil {
+		t.Fatal("the same config for one path was rejected")
+	}
+	logger.Close()
+}
+
+func TestMultiWriterLogger(t *testing.T) {
+	var first, second bytes.Buffer
+	logger := NewMultiWriterLogger(&first, &second)
+	logger.Error("fanned out")
+	errorIfFalse(strings.Contains(first.String(), " - ERROR - fanned out:\n\t") && first.String() == second.String(), t, "writers did not get the same entry")
+
+	numFormatted := 0
+	logger.SetFormatter(FormatterFunc(func(entry *Entry) ([]byte, error) {
+		numFormatted++
+		return []byte(entry.Message), nil
+	}))
+	logger.Info("formatted once")
+	errorIfFalse(numFormatted == 1, t, "entry was formatted more than once")
+	errorIfFalse(strings.HasSuffix(second.String(), "formatted once\n"), t, "formatted entry was not written")
+}
+
+func TestFilterLogger(t *testing.T) {
+	inner := &recordingLogger{}
+	logger := NewFilterLogger(inner, FilterRules{
+		Include: []FilterRule{{Levels: []Level{EnumError, EnumWarning}}},
+		Exclude: []FilterRule{
+			{Message: regexp.MustCompile("^connection reset")},
+			{Fields: map[string]*regexp.Regexp{"CorrelationID": regexp.MustCompile("^health-")}},
+			{PackagePrefix: "github.com/noisy/lib"},
+		},
+	})
+
+	logger.Error("kept")
+	logger.Info("not included")
+	logger.Warn("connection reset by peer")
+	logger.LogNoStack(WithCorrelationID(NewError("health check failed"), "health-123"))
+	noisy := NewError("noisy").(*LeveledException)
+	noisy.stackTrace = []*StackTraceEntry{{FunctionName: "github.com/noisy/lib.Do"}}
+	logger.Log(noisy)
+
+	errorIfFalse(len(inner.logged) == 1 && inner.logged[0].(*LeveledException).GetMessage() == "kept", t, "wrong entries were let through")
+}
+
+func TestMiddleware(t *testing.T) {
+	var buf bytes.Buffer
+	logger := NewMultiWriterLogger(&buf)
+	var order []string
+	logger.Use(
+		func(next LogFunc) LogFunc {
+			return func(values ...interface{}) error {
+				order = append(order, "first")
+				if strings.Contains(fmt.Sprint(values...), "drop me") {
+					return nil
+				}
+				return next(values...)
+			}
+		},
+		func(next LogFunc) LogFunc {
+			return func(values ...interface{}) error {
+				order = append(order, "second")
+				return next(WithCorrelationID(values[0].(error), "enriched"))
+			}
+		},
+	)
+
+	logger.Error("drop me")
+	logger.LogNoStack(NewError("keep me"))
+	errorIfFalse(strings.Join(order, ",") == "first,first,second", t, "middleware ran in the wrong order: "+strings.Join(order, ","))
+	errorIfFalse(!strings.Contains(buf.String(), "drop me"), t, "dropped entry was logged")
+	errorIfFalse(strings.Contains(buf.String(), " - [enriched] - ERROR - keep me"), t, "enriched entry was not logged")
+}
+
+func TestRegisterHook(t *testing.T) {
+	var buf bytes.Buffer
+	logger := NewMultiWriterLogger(&buf)
+	var observed []*Entry
+	logger.RegisterHook(
+		func(entry *Entry) *Entry {
+			if entry.Message == "skip" {
+				return nil
+			}
+			if entry.Fields == nil {
+				entry.Fields = map[string]interface{}{}
+			}
+			entry.Fields["host"] = "web-1"
+			return entry
+		},
+		func(entry *Entry, err error) {
+			errorIfFalse(err == nil, t, "post write hook got an error")
+			observed = append(observed, entry)
+		},
+	)
+
+	logger.Warn("skip")
+	logger.LogNoStack(WithField(NewError("disk full"), "disk", "sda1"))
+	errorIfFalse(len(observed) == 1, t, "post write hook was not called once")
+	errorIfFalse(strings.Contains(buf.String(), " - ERROR - disk full {disk=sda1 host=web-1}"), t, "hook fields were not logged: "+buf.String())
+	errorIfFalse(!strings.Contains(buf.String(), "skip"), t, "dropped entry was logged")
+
+	buf.Reset()
+	logger.LogJson(WithField(NewInfo("json"), "disk", "sda2"))
+	errorIfFalse(strings.Contains(buf.String(), `"Fields":{"disk":"sda2","host":"web-1"}`), t, "hook fields were not in json: "+buf.String())
+
+	exception := WithField(NewError("caller's"), "disk", "sda3")
+	buf.Reset()
+	logger.LogNoStack(exception)
+	errorIfFalse(strings.Contains(buf.String(), "{disk=sda3 host=web-1}"), t, "hook fields were not logged: "+buf.String())
+	errorIfFalse(FieldsOf(exception)["host"] == nil, t, "hook changed the caller's exception")
+}
+
+func TestPolyLoggerSetEncoding(t *testing.T) {
+	var text, json, noStack bytes.Buffer
+	textLogger := NewMultiWriterLogger(&text)
+	jsonLogger := NewMultiWriterLogger(&json)
+	noStackLogger := NewMultiWriterLogger(&noStack)
+	polyLogger := NewPolyLogger([]Logger{textLogger, jsonLogger, noStackLogger})
+	polyLogger.SetEncoding(jsonLogger, EncodingJson)
+	polyLogger.SetEncoding(noStackLogger, EncodingNoStack)
+
+	polyLogger.Error("per destination")
+	errorIfFalse(strings.Contains(text.String(), " - ERROR - per destination:\n\t"), t, "text destination did not get the stack trace")
+	errorIfFalse(strings.HasPrefix(json.String(), `{"entry":`), t, "json destination did not get json: "+json.String())
+	errorIfFalse(strings.HasSuffix(noStack.String(), " - ERROR - per destination\n\n"), t, "no stack destination got a stack trace")
+
+	polyLogger.SetEncoding(jsonLogger, EncodingAsCalled)
+	json.Reset()
+	polyLogger.LogNoStack(NewInfo("as called"))
+	errorIfFalse(strings.HasSuffix(json.String(), " - INFO - as called\n\n"), t, "EncodingAsCalled did not use the called function")
+}
+
+func TestJsonMessageChain(t *testing.T) {
+	exception := PrependMsg(NewError("connection refused"), "failed to load user").(*LeveledException)
+	exception.NonLoggedMsg = "db host is 10.0.0.5"
+
+	var buf strings.Builder
+	exception.LogAsJson(&buf)
+	errorIfFalse(strings.Contains(buf.String(), ` - failed to load user"]`), t, "message chain was not in json: "+buf.String())
+	errorIfFalse(!strings.Contains(buf.String(), "InternalMessage"), t, "internal message was logged without opting in")
+
+	IncludeInternalMessage = true
+	defer func() { IncludeInternalMessage = false }()
+	buf.Reset()
+	exception.LogAsJson(&buf)
+	errorIfFalse(strings.Contains(buf.String(), `"InternalMessage":"db host is 10.0.0.5"`), t, "internal message was not in json: "+buf.String())
+}
+
+func TestSetTimeLayout(t *testing.T) {
+	dir, err := ioutil.TempDir("", "sherlog")
+	errorIfFalse(err == nil, t, "could not create temp dir")
+	defer os.RemoveAll(dir)
+	logger, err := NewFileLogger(filepath.Join(dir, "offset.log"))
+	errorIfFalse(err == nil, t, "could not create logger")
+	defer logger.Close()
+
+	exception := NewInfo("with offset").(*LeveledException)
+	logger.SetTimeLayout(TimeLayoutWithOffset)
+	logger.LogNoStack(exception)
+	logger.SetTimeLayout(TimeLayoutRFC3339)
+	logger.LogJson(exception)
+
+	logBytes, _ := ioutil.ReadFile(filepath.Join(dir, "offset.log"))
+	errorIfFalse(strings.HasPrefix(string(logBytes), exception.timestamp.Format(TimeLayoutWithOffset)+" - INFO - with offset"), t, "text timestamp has no offset: "+string(logBytes))
+	errorIfFalse(strings.Contains(string(logBytes), `"Time":"`+exception.timestamp.Format(time.RFC3339)+`"`), t, "json timestamp is not RFC3339: "+string(logBytes))
+
+	entry := NewEntry(exception)
+	entry.TimeLayout = TimeLayoutRFC3339
+	errorIfFalse(entry.ToJsonMap()["Time"] == exception.timestamp.Format(time.RFC3339), t, "ToJsonMap ignored the entry's time layout")
+}
+
+func TestWithDuration(t *testing.T) {
+	timer := StartTimer()
+	errorIfFalse(timer.Elapsed() >= 0, t, "timer went backwards")
+
+	exception := WithDuration(NewWarning("query took longer than expected"), 1234*time.Millisecond).(*LeveledException)
+	var text, jsonBuf strings.Builder
+	exception.LogNoStack(&text)
+	exception.LogAsJson(&jsonBuf)
+	errorIfFalse(strings.HasSuffix(text.String(), " - WARNING - query took longer than expected (took 1.234s)"), t, "duration was not in text: "+text.String())
+	errorIfFalse(strings.Contains(jsonBuf.String(), `"DurationMs":1234`), t, "duration was not in json: "+jsonBuf.String())
+}
+
+func TestAuditLogger(t *testing.T) {
+	dir, err := ioutil.TempDir("", "sherlog")
+	errorIfFalse(err == nil, t, "could not create temp dir")
+	defer os.RemoveAll(dir)
+	auditPath := filepath.Join(dir, "audit.log")
+
+	logger, err := NewAuditLogger(auditPath)
+	errorIfFalse(err == nil, t, "could not create logger")
+	logger.Info("user 42 changed their password")
+	errorIfFalse(logger.LogNoStack(NewInfo("incomplete")) != nil, t, "LogNoStack was allowed")
+	logger.Close()
+
+	logger, err = NewAuditLogger(auditPath)
+	errorIfFalse(err == nil, t, "could not reopen logger")
+	logger.LogJson(NewInfo("user 42 logged out"))
+	logger.Close()
+
+	info, _ := os.Stat(auditPath)
+	errorIfFalse(info.Mode().Perm() == 0600, t, "audit log is readable by others")
+	auditBytes, _ := ioutil.ReadFile(auditPath)
+	errorIfFalse(strings.Contains(string(auditBytes), "\naudit #2 sha256:"), t, "chain was not continued: "+string(auditBytes))
+	errorIfFalse(VerifyAuditLog(auditPath) == nil, t, "valid audit log did not verify")
+
+	ioutil.WriteFile(auditPath, bytes.Replace(auditBytes, []byte("user 42 changed"), []byte("user 43 changed"), 1), 0600)
+	errorIfFalse(VerifyAuditLog(auditPath) != nil, t, "tampered audit log verified")
+}
+
+func TestAuditLoggerTornWrite(t *testing.T) {
+	dir, err := ioutil.TempDir("", "sherlog")
+	errorIfFalse(err == nil, t, "could not create temp dir")
+	defer os.RemoveAll(dir)
+	auditPath := filepath.Join(dir, "audit.log")
+
+	logger, err := NewAuditLogger(auditPath)
+	errorIfFalse(err == nil, t, "could not create logger")
+	logger.Info("complete")
+	logger.Close()
+	file, _ := os.OpenFile(auditPath, os.O_APPEND|os.O_WRONLY, 0600)
+	file.WriteString("2018-10-03 07:51:14 - INFO - half writ")
+	file.Close()
+
+	logger, err = NewAuditLogger(auditPath)
+	errorIfFalse(err == nil, t, "could not reopen logger after a torn write")
+	logger.Info("after the crash")
+	logger.Close()
+	auditBytes, _ := ioutil.ReadFile(auditPath)
+	errorIfFalse(!strings.Contains(string(auditBytes), "half writ"), t, "torn record was not cut off: "+string(auditBytes))
+	errorIfFalse(VerifyAuditLog(auditPath) == nil, t, "audit log did not verify after a torn write")
+}
+
+func TestAuditLoggerForgedTrailer(t *testing.T) {
+	dir, err := ioutil.TempDir("", "sherlog")
+	errorIfFalse(err == nil, t, "could not create temp dir")
+	defer os.RemoveAll(dir)
+	auditPath := filepath.Join(dir, "audit.log")
+	defer func() { SanitizeText = true }()
+	SanitizeText = false
+
+	logger, err := NewAuditLogger(auditPath)
+	errorIfFalse(err == nil, t, "could not create logger")
+	logger.Info("user 42 changed their password\naudit #1 sha256:" + strings.Repeat("0", 64) + "\n\nforged")
+	logger.Close()
+
+	logger, err = NewAuditLogger(auditPath)
+	errorIfFalse(err == nil, t, "could not reopen logger after a forged trailer")
+	logger.Info("user 42 logged out")
+	logger.Close()
+	auditBytes, _ := ioutil.ReadFile(auditPath)
+	errorIfFalse(strings.Contains(string(auditBytes), "\n\\audit #1 sha256:"), t, "forged trailer was not escaped: "+string(auditBytes))
+	errorIfFalse(VerifyAuditLog(auditPath) == nil, t, "audit log with a forged trailer did not verify")
+}
+
+func TestCounterLogger(t *testing.T) {
+	counter := NewCounterLogger()
+	for i := 0; i < 2; i++ {
+		counter.Error("same place")
+	}
+	counter.LogNoStack(WithHTTPStatus(NewWarning("not found"), 404))
+	counter.Log(fmt.Errorf("plain"))
+
+	counts := counter.Counts()
+	errorIfFalse(counts.Total == 4, t, "wrong total")
+	errorIfFalse(counts.ByLevel["ERROR"] == 2 && counts.ByLevel["WARNING"] == 1 && counts.ByLevel[""] == 1, t, "wrong counts by level")
+	errorIfFalse(counts.ByCode[404] == 1 && len(counts.ByCode) == 1, t, "wrong counts by code")
+	errorIfFalse(len(counts.ByFingerprint) == 3, t, "errors from the same place got different fingerprints")
+
+	counter.Reset()
+	errorIfFalse(counter.Counts().Total == 0, t, "Reset did not reset the counts")
+
+	for i := 0; i < 3; i++ {
+		counter.Error("user ", i, " not found")
+	}
+	errorIfFalse(len(counter.Counts().ByFingerprint) == 1, t, "ids in messages gave errors from the same place different fingerprints")
+
+	counter.Reset()
+	for i := 0; i < maxCounterFingerprints+10; i++ {
+		counter.Log(NewError(string([]byte{'a' + byte(i%26), 'a' + byte(i/26%26), 'a' + byte(i/676)})))
+	}
+	counts = counter.Counts()
+	errorIfFalse(len(counts.ByFingerprint) == maxCounterFingerprints+1 && counts.ByFingerprint[OtherFingerprints] == 10, t, "fingerprint counts were not bounded")
+
+	err := TrackStats("TestCounterLogger", counter)
+	errorIfFalse(err == nil, t, "could not track the stats of the counter")
+	statsCounts := Stats()["TestCounterLogger"].Counts
+	errorIfFalse(statsCounts != nil && statsCounts.Total == uint64(maxCounterFingerprints+10), t, "counts were not in the stats")
+}
+
+func TestSampler(t *testing.T) {
+	inner := &recordingLogger{}
+	logger := NewMultiWriterLogger(ioutil.Discard)
+	logger.Use(NewSampler(SamplingPolicy{
+		Rates: map[Level]float64{
+			EnumCritical: 0,
+			EnumError:    1,
+			EnumInfo:     0,
+		},
+	}))
+	logger.Use(func(next LogFunc) LogFunc {
+		return func(values ...interface{}) error {
+			return inner.Log(values...)
+		}
+	})
+
+	logger.Info("sampled out")
+	logger.Error("kept")
+	logger.Critical("bypasses sampling")
+	logger.Warn("no rate")
+	errorIfFalse(len(inner.logged) == 3, t, "wrong entries were sampled")
+}
+
+func TestNATSLogger(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	errorIfFalse(err == nil, t, "could not listen")
+	defer listener.Close()
+	received := make(chan string, 1)
+	go func() {
+		conn, err := listener.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		conn.Write([]byte("INFO {}\r\n"))
+		reader := bufio.NewReader(conn)
+		reader.ReadString('\n') // CONNECT
+		pub, _ := reader.ReadString('\n')
+		payload, _ := reader.ReadString('\n')
+		received <- pub + payload
+	}()
+
+	logger, err := NewNATSLogger(listener.Addr().String(), "logs.myapp")
+	errorIfFalse(err == nil, t, "could not connect")
+	defer logger.Close()
+	logger.LogNoStack(NewWarning("disk almost full"))
+	pub := <-received
+	errorIfFalse(strings.HasPrefix(pub, "PUB logs.myapp.warning "), t, "published to the wrong subject: "+pub)
+	errorIfFalse(strings.Contains(pub, `"Message":"disk almost full"`) && !strings.Contains(pub, "StackTrace"), t, "wrong payload: "+pub)
+}
+
+func TestMQTTLogger(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	errorIfFalse(err == nil, t, "could not listen")
+	defer listener.Close()
+	received := make(chan []byte, 1)
+	go func() {
+		conn, err := listener.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		header := make([]byte, 2)
+		io.ReadFull(conn, header)
+		io.ReadFull(conn, make([]byte, header[1])) // CONNECT
+		conn.Write([]byte{0x20, 2, 0, 0})
+		publish := make([]byte, 4096)
+		n, _ := conn.Read(publish)
+		received <- publish[:n]
+	}()
+
+	logger, err := NewMQTTLogger(listener.Addr().String(), "edge-1", "logs/myapp")
+	errorIfFalse(err == nil, t, "could not connect")
+	defer logger.Close()
+	logger.Error("sensor offline")
+	publish := <-received
+	errorIfFalse(publish[0] == 0x30, t, "did not get a PUBLISH packet")
+	errorIfFalse(bytes.Contains(publish, []byte("\x00\x10logs/myapp/error{")), t, "published to the wrong topic: "+string(publish))
+	errorIfFalse(bytes.Contains(publish, []byte(`"Message":"sensor offline"`)), t, "wrong payload: "+string(publish))
+}
+
+func TestFluentLogger(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	errorIfFalse(err == nil, t, "could not listen")
+	defer listener.Close()
+	received := make(chan []byte, 1)
+	go func() {
+		conn, err := listener.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		message := make([]byte, 4096)
+		n, _ := conn.Read(message)
+		message = message[:n]
+		received <- message
+		chunkStart := bytes.Index(message, []byte("\xa5chunk")) + len("\xa5chunk") + 1
+		ack := appendBinaryValue(msgpackEncoder{}, nil, map[string]interface{}{"ack": string(message[chunkStart : chunkStart+24])})
+		conn.Write(ack)
+	}()
+
+	logger, err := NewFluentLogger(listener.Addr().String(), "app")
+	errorIfFalse(err == nil, t, "could not connect")
+	defer logger.Close()
+	logger.SetRequireAck(true)
+	err = logger.Error("payment failed")
+	errorIfFalse(err == nil, t, "entry was not acknowledged")
+	message := <-received
+	errorIfFalse(message[0] == 0x94 && bytes.HasPrefix(message[1:], []byte("\xa9app.error")), t, "wrong tag")
+	errorIfFalse(bytes.Contains(message, []byte("payment failed")), t, "record is missing the message")
+}
+
+func TestNetworkSendInterruptedByContext(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	errorIfFalse(err == nil, t, "could not listen")
+	defer listener.Close()
+	go func() {
+		conn, err := listener.Accept()
+		if err == nil {
+			defer conn.Close()
+			time.Sleep(10 * time.Second) // Never reads, like a hung collector
+		}
+	}()
+
+	logger, err := NewFluentLogger(listener.Addr().String(), "app")
+	errorIfFalse(err == nil, t, "could not connect")
+	defer logger.Close()
+	ctx, cancel := context.WithCancel(context.Background())
+	logger.SetContext(ctx)
+	time.AfterFunc(100*time.Millisecond, cancel)
+	start := time.Now()
+	err = logger.LogNoStack(NewError(strings.Repeat("x", 16<<20)))
+	errorIfFalse(Is(err, ErrDestinationUnavailable), t, "interrupted send did not fail")
+	errorIfFalse(time.Since(start) < 5*time.Second, t, "canceling the context did not interrupt a blocked write")
+}
+
+func TestHTTPShipperConfigs(t *testing.T) {
+	var headers http.Header
+	var body []byte
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		headers = r.Header
+		body, _ = ioutil.ReadAll(r.Body)
+	}))
+	defer server.Close()
+
+	datadogConfig := DatadogShipperConfig("dd-key", "", "user-service")
+	errorIfFalse(datadogConfig.URL == "https://http-intake.logs.datadoghq.com/api/v2/logs", t, "wrong Datadog endpoint")
+	datadogConfig.URL = server.URL
+	shipper := NewHTTPShipper(datadogConfig)
+	shipper.Error("payment failed")
+	shipper.LogNoStack(NewInfo("no stack"))
+	shipper.Close()
+	errorIfFalse(headers.Get("DD-API-KEY") == "dd-key", t, "Datadog api key was not sent")
+	var records []map[string]interface{}
+	errorIfFalse(json.Unmarshal(body, &records) == nil && len(records) == 2, t, "Datadog batch is not a json array of 2 records: "+string(body))
+	errorIfFalse(records[0]["status"] == "error" && records[0]["service"] == "user-service" && records[0]["error.stack"] != nil, t, "wrong Datadog record")
+	errorIfFalse(records[1]["error.stack"] == nil, t, "LogNoStack entry was shipped with its stack trace")
+
+	splunkConfig := SplunkHECShipperConfig(server.URL+"/", "hec-token", "", "main")
+	errorIfFalse(splunkConfig.URL == server.URL+"/services/collector/event", t, "wrong Splunk endpoint")
+	shipper = NewHTTPShipper(splunkConfig)
+	shipper.Warn("disk almost full")
+	errorIfFalse(shipper.QueueDepth() == 1, t, "entry was not queued")
+	errorIfFalse(shipper.Flush() == nil, t, "flush failed")
+	shipper.Close()
+	errorIfFalse(headers.Get("Authorization") == "Splunk hec-token", t, "Splunk token was not sent")
+	var event map[string]interface{}
+	errorIfFalse(json.Unmarshal(body, &event) == nil, t, "Splunk event is not json: "+string(body))
+	errorIfFalse(event["sourcetype"] == "sherlog" && event["index"] == "main" && event["event"].(map[string]interface{})["Message"] == "disk almost full", t, "wrong Splunk event")
+}
+
+func TestLokiLogger(t *testing.T) {
+	var path string
+	var push struct {
+		Streams []struct {
+			Stream map[string]string
+			Values [][2]string
+		}
+	}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		path = r.URL.Path
+		json.NewDecoder(r.Body).Decode(&push)
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer server.Close()
+
+	logger := NewLokiLogger(server.URL, map[string]string{"service": "user-service", "env": "prod"})
+	logger.Error(WithField(NewError("first"), "user", 42))
+	logger.Info("second")
+	logger.Error("third")
+	logger.Close()
+
+	errorIfFalse(path == "/loki/api/v1/push", t, "wrong path: "+path)
+	errorIfFalse(len(push.Streams) == 2, t, "entries were not grouped by level")
+	errorStream := push.Streams[0]
+	errorIfFalse(errorStream.Stream["level"] == "error" && errorStream.Stream["env"] == "prod" && len(errorStream.Stream) == 3, t, "wrong labels")
+	errorIfFalse(len(errorStream.Values) == 2 && strings.Contains(errorStream.Values[0][1], `"Fields":{"user":42}`), t, "fields were not kept in the line")
+}
+
+func TestCompact(t *testing.T) {
+	dir, err := ioutil.TempDir("", "sherlog")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	oldFilePath := filepath.Join(dir, "cmp_2001-01-02.log")
+	ioutil.WriteFile(oldFilePath, []byte(
+		"2001-01-02 10:00:00 - ERROR - db is down {attempt=1}:\n\tmain.query(main.go:10)\n\tmain.main(main.go:3)\n\n"+
+			"2001-01-02 11:00:00 - ERROR - db is down {attempt=2}:\n\tmain.query(main.go:12)\n\tmain.main(main.go:3)\n\n"+
+			"2001-01-02 12:00:00 - INFO - a:\n\tmain.main(main.go:4)\nCaused by:\n2001-01-02 12:00:00 - ERROR - b:\n\tmain.main(main.go:4)\n\n"+
+			`{"sherlog":"6","entry":{"Level":"WARNING","Message":"slow","Time":"2001-01-03 08:00:00"}}`+"\n"), 0644)
+	old := time.Now().Add(-48 * time.Hour)
+	os.Chtimes(oldFilePath, old, old)
+
+	logger, err := NewRollingFileLoggerWithSizeLimit(filepath.Join(dir, "cmp.log"), 100)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer logger.Close()
+	written, err := logger.Compact(24 * time.Hour)
+	errorIfFalse(err == nil && len(written) == 2, t, "summaries were not written")
+	errorIfFalse(!fileExists(oldFilePath) && fileExists(logger.logFilePath), t, "wrong files were deleted")
+
+	var summary DaySummary
+	content, _ := ioutil.ReadFile(filepath.Join(dir, "cmp_summary_2001-01-02.json"))
+	json.Unmarshal(content, &summary)
+	errorIfFalse(summary.Day == "2001-01-02" && len(summary.Errors) == 2, t, "wrong summary: "+string(content))
+	dbDown := summary.Errors[0]
+	errorIfFalse(dbDown.Message == "db is down" && dbDown.Level == "ERROR" && dbDown.Count == 2, t, "occurrences were not grouped")
+	errorIfFalse(dbDown.FirstSeen.Hour() == 10 && dbDown.LastSeen.Hour() == 11, t, "wrong first and last seen")
+	errorIfFalse(dbDown.SampleStack == "\tmain.query(main.go:10)\n\tmain.main(main.go:3)", t, "wrong sample stack: "+dbDown.SampleStack)
+	errorIfFalse(summary.Errors[1].Message == "a", t, "caused by entries should not be counted")
+	errorIfFalse(len(summary.Compacted) == 1 && summary.Compacted[0] == "cmp_2001-01-02.log", t, "compacted file was not recorded")
+
+	// As if the last Compact crashed before deleting the file
+	ioutil.WriteFile(oldFilePath, []byte("2001-01-02 10:00:00 - ERROR - db is down {attempt=1}:\n\tmain.query(main.go:10)\n\n"), 0644)
+	os.Chtimes(oldFilePath, old, old)
+	_, err = logger.Compact(24 * time.Hour)
+	errorIfFalse(err == nil && !fileExists(oldFilePath), t, "file left behind by a crash was not deleted")
+	content, _ = ioutil.ReadFile(filepath.Join(dir, "cmp_summary_2001-01-02.json"))
+	summary = DaySummary{}
+	json.Unmarshal(content, &summary)
+	errorIfFalse(summary.Errors[0].Count == 2, t, "file left behind by a crash was counted twice: "+string(content))
+}
+
+func TestWriteChecksums(t *testing.T) {
+	dir, err := ioutil.TempDir("", "sherlog")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	logger, err := NewRollingFileLoggerWithSizeLimit(filepath.Join(dir, "sum.log"), 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer logger.Close()
+	logger.SetWriteChecksums(true)
+	var rolledFilePath string
+	logger.SetOnRoll(func(filePath string) {
+		rolledFilePath = filePath
+		errorIfFalse(fileExists(filePath+ChecksumSuffix), t, "sidecar was not written before onRoll")
+	})
+	logger.Error("shipped")
+
+	errorIfFalse(VerifyChecksum(rolledFilePath) == nil, t, "untouched file did not verify")
+	sidecar, _ := ioutil.ReadFile(rolledFilePath + ChecksumSuffix)
+	errorIfFalse(strings.HasSuffix(string(sidecar), "  "+filepath.Base(rolledFilePath)+"\n"), t, "sidecar is not in sha256sum format: "+string(sidecar))
+	ioutil.WriteFile(rolledFilePath, []byte("truncated"), 0644)
+	errorIfFalse(VerifyChecksum(rolledFilePath) != nil, t, "changed file verified")
+}
+
+func TestWindowsSafeFileNames(t *testing.T) {
+	errorIfFalse(incFileName(filepath.Join("Program Files (x86)", "app.log")) == filepath.Join("Program Files (x86)", "app(1).log"), t, "parentheses in the directory were treated as a version")
+	errorIfFalse(incFileName(filepath.Join("logs", "app_2018-10-03(9).log")) == filepath.Join("logs", "app_2018-10-03(10).log"), t, "version was not incremented")
+	errorIfFalse(incFileName("100%(1).log") == "100%(2).log", t, "percent signs broke incFileName")
+
+	defer func(layout string) { FileNameTimeLayout = layout }(FileNameTimeLayout)
+	FileNameTimeLayout = "_2006-01-02T15:04:05"
+	fileName := filepath.Base(getTimestampedFileName(filepath.Join(os.TempDir(), "app.log")))
+	errorIfFalse(!strings.Contains(fileName, ":") && strings.HasSuffix(fileName, ".log"), t, "file name is not Windows safe: "+fileName)
+}
+
+func TestSetCurrentLink(t *testing.T) {
+	dir, err := ioutil.TempDir("", "sherlog")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	linkPath := filepath.Join(dir, "cur.log")
+	logger, err := NewRollingFileLoggerWithSizeLimit(linkPath, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer logger.Close()
+	errorIfFalse(logger.SetCurrentLink(true) == nil, t, "SetCurrentLink returned an error")
+
+	logger.Error("first")
+	logger.Info("second")
+	logged, _ := ioutil.ReadFile(linkPath)
+	current, _ := ioutil.ReadFile(logger.logFilePath)
+	errorIfFalse(len(logged) == 0 && len(current) == 0, t, "link does not point at the new file after rolling")
+	logger.FileLogger.Warn("third")
+	logged, _ = ioutil.ReadFile(linkPath)
+	errorIfFalse(strings.Contains(string(logged), "WARNING - third"), t, "link does not follow the current file: "+string(logged))
+
+	errorIfFalse(logger.SetCurrentLink(false) == nil && !fileExists(linkPath), t, "link was not removed")
+	ioutil.WriteFile(linkPath, []byte("not a link"), 0644)
+	errorIfFalse(logger.SetCurrentLink(true) != nil, t, "a regular file was replaced with a link")
+}
+
+func TestK8sLogger(t *testing.T) {
+	file, err := ioutil.TempFile("", "k8s")
+	errorIfFalse(err == nil, t, "could not create temp file")
+	defer os.Remove(file.Name())
+	defer file.Close()
+
+	os.Setenv("POD_NAMESPACE", "prod")
+	defer os.Unsetenv("POD_NAMESPACE")
+	logger := newK8sLogger(file)
+	logger.Error(WithField(NewOpsError("db is down"), "msg", "ignored"))
+	logger.LogNoStack(WithField(NewWarning("slow"), "user", 42))
+
+	logged, _ := ioutil.ReadFile(file.Name())
+	lines := strings.Split(strings.TrimSpace(string(logged)), "\n")
+	errorIfFalse(len(lines) == 2, t, "entries were not single lines: "+string(logged))
+	var first, second map[string]interface{}
+	json.Unmarshal([]byte(lines[0]), &first)
+	json.Unmarshal([]byte(lines[1]), &second)
+	errorIfFalse(first["level"] == "ops_error" && first["msg"] == "db is down" && first["namespace"] == "prod", t, "wrong entry: "+lines[0])
+	errorIfFalse(strings.Contains(first["stack"].(string), "TestK8sLogger"), t, "stack is missing")
+	_, hasStack := second["stack"]
+	errorIfFalse(second["level"] == "warning" && second["user"] == float64(42) && !hasStack, t, "wrong entry: "+lines[1])
+}
+
+func TestNewAutoLogger(t *testing.T) {
+	file, err := ioutil.TempFile("", "auto")
+	errorIfFalse(err == nil, t, "could not create temp file")
+	defer os.Remove(file.Name())
+	defer file.Close()
+
+	_, isK8s := newAutoLogger(file, file).(*K8sLogger)
+	errorIfFalse(isK8s, t, "redirected output did not get json")
+	os.Setenv(AutoFormatEnvVar, "text")
+	defer os.Unsetenv(AutoFormatEnvVar)
+	_, isConsole := newAutoLogger(file, file).(*ConsoleLogger)
+	errorIfFalse(isConsole, t, "SHERLOG_FORMAT=text was ignored")
+}
+
+func TestLogError(t *testing.T) {
+	logger := NewCounterLogger()
+	exception, err := LogError(logger, "user ", 42, " not found")
+	errorIfFalse(err == nil && exception != nil, t, "LogError did not return the exception")
+	errorIfFalse(exception.GetMessage() == "user 42 not found" && exception.GetLevel() == EnumError, t, "wrong exception")
+	errorIfFalse(strings.Contains(exception.GetStackTrace()[0].FunctionName, "TestLogError"), t, "stack trace does not start at the caller")
+	errorIfFalse(logger.Counts().ByLevel["ERROR"] == 1, t, "exception was not logged")
+
+	exception, err = LogWarn(logger, nil)
+	errorIfFalse(exception == nil && err == nil && logger.Counts().Total == 1, t, "nil was logged")
+}
+
+func TestLogAndReturn(t *testing.T) {
+	logger := NewCounterLogger()
+	errorIfFalse(LogAndReturn(logger, nil) == nil && logger.Counts().Total == 0, t, "nil was logged")
+
+	err := fmt.Errorf("disk full")
+	errorIfFalse(LogAndReturnOpsError(logger, err) == err, t, "err was not returned unchanged")
+	errorIfFalse(logger.Counts().ByLevel["OPS_ERROR"] == 1, t, "err was not logged with the level")
+	errorIfFalse(LogAndReturn(logger, err) == err && logger.Counts().Total == 2, t, "err was not logged")
+}
+
+func TestLogIf(t *testing.T) {
+	logger := NewCounterLogger()
+	errorIfFalse(LogIfErr(logger, nil) == nil && DebugIf(logger, false, "skipped") == nil && WarnIf(logger, true, nil) == nil, t, "LogIf helpers returned an error")
+	errorIfFalse(logger.Counts().Total == 0, t, "something was logged")
+
+	ErrorIf(logger, true, "logged ", 1)
+	LogIfErr(logger, fmt.Errorf("also logged"))
+	counts := logger.Counts()
+	errorIfFalse(counts.Total == 2 && counts.ByLevel["ERROR"] == 1, t, "values were not logged")
+}
+
+func TestLoggingNilIsNoOp(t *testing.T) {
+	dir, err := ioutil.TempDir("", "sherlog")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	fileLogger, _ := NewFileLogger(filepath.Join(dir, "nil.log"))
+	sizeLogger, _ := NewRollingFileLoggerWithSizeLimit(filepath.Join(dir, "nil_size.log"), 1)
+	counter := NewCounterLogger()
+	loggers := []Logger{
+		fileLogger,
+		sizeLogger,
+		counter,
+		NewPolyLogger([]Logger{counter}),
+		NewContextLogger(context.Background(), counter),
+		NewMultiWriterLogger(ioutil.Discard),
+	}
+	var nilException *LeveledException
+	for _, logger := range loggers {
+		errorIfFalse(logger.Log(nil) == nil && logger.Log(nil, nilException) == nil, t, fmt.Sprintf("%T: Log(nil) returned an error", logger))
+		errorIfFalse(logger.LogNoStack(nil) == nil && logger.LogJson(nil) == nil, t, fmt.Sprintf("%T: LogNoStack(nil) or LogJson(nil) returned an error", logger))
+		errorIfFalse(logger.LogNoStack(nilException) == nil, t, fmt.Sprintf("%T: logging a nil exception returned an error", logger))
+	}
+	fileLogger.Close()
+	sizeLogger.Close()
+
+	logged, _ := ioutil.ReadFile(filepath.Join(dir, "nil.log"))
+	errorIfFalse(len(logged) == 0, t, "nil wrote something: "+string(logged))
+	errorIfFalse(counter.Counts().Total == 0, t, "nil was counted")
+	errorIfFalse(sizeLogger.curCount == 0, t, "nil counted towards rolling")
+}
+
+func TestLoggerFailureKinds(t *testing.T) {
+	dir, err := ioutil.TempDir("", "sherlog")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	fileLogger, _ := NewFileLogger(filepath.Join(dir, "kinds.log"))
+	fileLogger.Close()
+	err = fileLogger.Error("too late")
+	errorIfFalse(Is(err, ErrLoggerClosed) && !Is(err, ErrFormat), t, fmt.Sprint("logging to a closed file: ", err))
+
+	formatLogger, _ := NewFileLogger(filepath.Join(dir, "format.log"))
+	defer formatLogger.Close()
+	formatLogger.SetFormatter(FormatterFunc(func(entry *Entry) ([]byte, error) {
+		return nil, fmt.Errorf("bad template")
+	}))
+	err = formatLogger.Info("x")
+	errorIfFalse(Is(err, ErrFormat) && strings.Contains(err.Error(), "bad template"), t, fmt.Sprint("failing formatter: ", err))
+
+	shipper := NewHTTPShipper(HTTPShipperConfig{URL: "http://127.0.0.1:1/logs", BatchSize: 1, OnError: func(error) {}})
+	err = shipper.Error("unreachable")
+	errorIfFalse(Is(err, ErrDestinationUnavailable), t, fmt.Sprint("unreachable endpoint: ", err))
+	shipper.Close()
+	errorIfFalse(Is(shipper.Error("closed"), ErrLoggerClosed), t, "closed shipper did not return ErrLoggerClosed")
+}
+
+func TestPolyLoggerFailureHandler(t *testing.T) {
+	dir, err := ioutil.TempDir("", "sherlog")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	closedLogger, _ := NewFileLogger(filepath.Join(dir, "closed.log"))
+	closedLogger.Close()
+	fallback := NewCounterLogger()
+
+	var failedDestination Logger
+	var lostEntry, writeErr error
+	polyLogger := NewPolyLoggerWithFailureHandler([]Logger{closedLogger, NewCounterLogger()}, func(destination Logger, entry error, err error) {
+		failedDestination, lostEntry, writeErr = destination, entry, err
+		fallback.Log(entry)
+	})
+	polyLogger.Error("important")
+
+	errorIfFalse(failedDestination == closedLogger, t, "wrong destination")
+	errorIfFalse(lostEntry != nil && strings.Contains(lostEntry.Error(), "important"), t, "wrong entry")
+	errorIfFalse(Is(writeErr, ErrLoggerClosed), t, "wrong write error")
+	errorIfFalse(fallback.Counts().ByLevel["ERROR"] == 1, t, "entry was not routed to the fallback")
+}
+
+func TestSetDiagnosticsLogger(t *testing.T) {
+	diagnosticsLogger := NewCounterLogger()
+	SetDiagnosticsLogger(diagnosticsLogger)
+	defer SetDiagnosticsLogger(nil)
+
+	shipper := NewHTTPShipper(HTTPShipperConfig{URL: "http://127.0.0.1:1/logs", BatchSize: 2})
+	shipper.Error("lost")
+	shipper.Close() // The background error goes to OnError, which defaults to the diagnostics logger
+
+	counts := diagnosticsLogger.Counts()
+	errorIfFalse(counts.ByLevel["WARNING"] == 1, t, "dropped entries were not reported")
+	errorIfFalse(counts.ByLevel["OPS_ERROR"] == 1, t, "shipping failure was not reported")
+}
+
+func TestTrackStats(t *testing.T) {
+	dir, err := ioutil.TempDir("", "sherlog_stats")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	logger, err := NewRollingFileLoggerWithSizeLimit(filepath.Join(dir, "stats.log"), 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer logger.Close()
+	errorIfFalse(TrackStats("TestTrackStats", logger) == nil, t, "could not track stats")
+	errorIfFalse(TrackStats("TestTrackStats", logger) != nil, t, "name was allowed to be taken twice")
+	logger.Error("one")
+	logger.Error("two")
+	logger.Error("three")
+
+	recorder := httptest.NewRecorder()
+	StatsHandler().ServeHTTP(recorder, httptest.NewRequest("GET", "/debug/sherlog", nil))
+	var stats map[string]LoggerStats
+	errorIfFalse(json.Unmarshal(recorder.Body.Bytes(), &stats) == nil, t, "stats were not json")
+	loggerStats := stats["TestTrackStats"]
+	errorIfFalse(loggerStats.Written == 3, t, "written count is wrong")
+	errorIfFalse(loggerStats.Errors == 0, t, "error count is wrong")
+	errorIfFalse(loggerStats.LastRoll != nil, t, "last roll time is missing")
+	errorIfFalse(loggerStats.CurrentFile == logger.CurrentFilePath(), t, "current file is wrong")
+	errorIfFalse(strings.Contains(expvar.Get("sherlog").String(), "TestTrackStats"), t, "stats were not published with expvar")
+}
+
+func TestLatencyHistogram(t *testing.T) {
+	recorder := newLatencyRecorder()
+	for i := 0; i < 98; i++ {
+		recorder.record(80 * time.Microsecond)
+	}
+	recorder.record(3 * time.Millisecond)
+	recorder.record(7 * time.Second)
+	histogram := recorder.snapshot()
+	errorIfFalse(histogram.Count == 100, t, "count is wrong")
+	errorIfFalse(histogram.Max == 7*time.Second, t, "max is wrong")
+	errorIfFalse(histogram.Quantile(0.5) == 100*time.Microsecond, t, "median is wrong")
+	errorIfFalse(histogram.Quantile(0.99) == 5*time.Millisecond, t, "99th percentile is wrong")
+	errorIfFalse(histogram.Quantile(1) == 7*time.Second, t, "slowest write should fall back to max")
+
+	logger := NewCounterLogger()
+	errorIfFalse(TrackStats("TestLatencyHistogram", logger) == nil, t, "could not track stats")
+	logger.Error("timed")
+	errorIfFalse(Stats()["TestLatencyHistogram"].Latency.Count == 1, t, "write latency was not recorded")
+}
+
+func TestPressure(t *testing.T) {
+	shipper := NewHTTPShipper(HTTPShipperConfig{URL: "http://127.0.0.1:1/logs", BatchSize: 4, FlushInterval: time.Hour})
+	defer shipper.Close()
+	polyLogger := NewPolyLogger([]Logger{shipper, NewCounterLogger()})
+	errorIfFalse(PressureOf(polyLogger) == 0, t, "empty queue should have no pressure")
+	shipper.Info("one")
+	shipper.Info("two")
+	shipper.Info("three")
+	errorIfFalse(QueueDepthOf(polyLogger) == 3, t, "queue depth is wrong")
+	errorIfFalse(PressureOf(polyLogger) == 0.75, t, "pressure is wrong")
+	errorIfFalse(PressureOf(NewCounterLogger()) == 0, t, "loggers without a queue should have no pressure")
+}
+
+type testPressurer struct {
+	pressure float64
+}
+
+func (tp *testPressurer) Pressure() float64 {
+	return tp.pressure
+}
+
+func TestAdaptiveSampler(t *testing.T) {
+	source := &testPressurer{}
+	sampler := NewAdaptiveSampler(AdaptiveSamplingPolicy{Source: source})
+	counter := NewCounterLogger()
+	counter.Use(sampler.Sample)
+
+	counter.Debug("calm")
+	errorIfFalse(counter.Counts().ByLevel["DEBUG"] == 1, t, "entries were sampled without pressure")
+
+	source.pressure = 1
+	counter.Debug("busy")
+	counter.Error("busy")
+	errorIfFalse(sampler.Shedding(), t, "sampling did not start")
+	errorIfFalse(counter.Counts().ByLevel["DEBUG"] == 1, t, "DEBUG was kept under full pressure")
+	errorIfFalse(counter.Counts().ByLevel["ERROR"] == 1, t, "ERROR was sampled")
+
+	source.pressure = 0.6 // Between RestoreBelow and ShedAbove, so still sampling
+	counter.Debug("recovering")
+	errorIfFalse(sampler.Shedding(), t, "sampling stopped before pressure fell to RestoreBelow")
+
+	source.pressure = 0.4
+	counter.Debug("calm again")
+	errorIfFalse(!sampler.Shedding(), t, "sampling did not stop")
+	errorIfFalse(counter.Counts().ByLevel["DEBUG"] >= 2, t, "entries were sampled after pressure dropped")
+}
+
+var updateGolden = flag.Bool("update-golden", false, "rewrite the golden files in testdata/golden instead of comparing against them")
+
+/*
+goldenCases are representative entries whose text and json output is pinned by the files in testdata/golden. If a
+change makes TestGoldenFormats fail, check FormatCompatibilityPolicy before running the tests with -update-golden.
+*/
+func goldenCases() map[string][]interface{} {
+	withFrames := func(err error) error {
+		stdExceptionOf(err).stackTrace = []*StackTraceEntry{
+			{FunctionName: "main.loadConfig", File: "/app/config.go", Line: 42},
+			{FunctionName: "main.main", File: "/app/main.go", Line: 12},
+		}
+		return err
+	}
+	return map[string][]interface{}{
+		"std_exception":     {withFrames(NewStdException("could not open config"))},
+		"leveled_exception": {withFrames(NewError("user not found"))},
+		"decorated":         {withFrames(WithDuration(WithCorrelationID(WithField(NewWarning("slow query"), "table", "users"), "req-7"), 1500*time.Millisecond))},
+		"prepended":         {withFrames(PrependMsg(NewOpsError("connection refused"), "could not reach postgres"))},
+		"caused_by":         {withFrames(NewCritical("request failed")), withFrames(NewError("timeout"))},
+		"non_sherlog_error": {fmt.Errorf("plain error")},
+	}
+}
+
+func TestGoldenFormats(t *testing.T) {
+	defer SetClock(nil)
+	SetClock(func() time.Time { return time.Date(2018, 10, 3, 7, 51, 14, 0, time.UTC) })
+
+	dir, err := ioutil.TempDir("", "sherlog_golden")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	for name, values := range goldenCases() {
+		for _, ext := range []string{".txt", ".json"} {
+			logger, err := NewFileLogger(filepath.Join(dir, name+ext))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if ext == ".txt" {
+				err = logger.Log(values...)
+			} else {
+				err = logger.LogJson(values[0].(error))
+			}
+			logger.Close()
+			if err != nil {
+				t.Fatal(err)
+			}
+			actual, _ := ioutil.ReadFile(filepath.Join(dir, name+ext))
+
+			goldenPath := filepath.Join("testdata", "golden", name+ext)
+			if *updateGolden {
+				if err = ioutil.WriteFile(goldenPath, actual, 0644); err != nil {
+					t.Fatal(err)
+				}
+				continue
+			}
+			expected, err := ioutil.ReadFile(goldenPath)
+			if err != nil {
+				t.Fatal(err)
+			}
+			errorIfFalse(bytes.Equal(actual, expected), t, fmt.Sprintf("output of %s changed:\n%s\nexpected:\n%s", goldenPath, actual, expected))
+		}
+	}
+}
+
+/*
+hammer logs with logger from many goroutines at once, mixing every log function and non-sherlog errors, while
+disrupt runs alongside. Run with -race to check that the logger is thread safe.
+*/
+func hammer(t *testing.T, logger Logger, disrupt func()) {
+	const goroutines, entriesEach = 32, 20
+	var waitGroup sync.WaitGroup
+	for i := 0; i < goroutines; i++ {
+		waitGroup.Add(1)
+		go func(i int) {
+			defer waitGroup.Done()
+			for j := 0; j < entriesEach; j++ {
+				switch j % 4 {
+				case 0:
+					logger.Error("hammered ", i, j)
+				case 1:
+					logger.LogNoStack(NewWarning("hammered"))
+				case 2:
+					logger.LogJson(NewInfo("hammered"))
+				default:
+					logger.Log(fmt.Errorf("plain error %d %d", i, j), NewError("cause"))
+				}
+			}
+		}(i)
+	}
+	if disrupt != nil {
+		waitGroup.Add(1)
+		go func() {
+			defer waitGroup.Done()
+			disrupt()
+		}()
+	}
+	waitGroup.Wait()
+}
+
+func TestLoggersAreThreadSafe(t *testing.T) {
+	dir, err := ioutil.TempDir("", "sherlog_race")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	fileLogger, err := NewFileLogger(filepath.Join(dir, "file.log"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	hammer(t, fileLogger, nil)
+	fileLogger.Close()
+
+	rollingLogger, err := NewCustomRollingFileLogger(filepath.Join(dir, "rolling.log"), time.Millisecond)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rollingLogger.SetWriteChecksums(true)
+	hammer(t, rollingLogger, func() {
+		for i := 0; i < 20; i++ {
+			rollingLogger.Roll()
+			rollingLogger.SetTimeBucketedDirs(i%2 == 0)
+			rollingLogger.SetWriteChecksums(i%2 == 0)
+			rollingLogger.SetOnRoll(func(string) {})
+			rollingLogger.LastRollTime()
+			rollingLogger.CurrentFilePath()
+		}
+	})
+	rollingLogger.Close()
+
+	sizeLogger, err := NewRollingFileLoggerWithSizeLimit(filepath.Join(dir, "size.log"), 7)
+	if err != nil {
+		t.Fatal(err)
+	}
+	hammer(t, sizeLogger, func() {
+		for i := 0; i < 20; i++ {
+			sizeLogger.Roll()
+		}
+	})
+	sizeLogger.Close()
+
+	journalLogger, err := NewJournalLogger(filepath.Join(dir, "journal"), 4096)
+	if err != nil {
+		t.Fatal(err)
+	}
+	hammer(t, journalLogger, nil)
+	journalLogger.Close()
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer server.Close()
+	shipper := NewHTTPShipper(HTTPShipperConfig{URL: server.URL, BatchSize: 8, FlushInterval: time.Millisecond})
+	hammer(t, shipper, func() {
+		for i := 0; i < 20; i++ {
+			shipper.Pressure()
+			shipper.Flush()
+		}
+	})
+	shipper.Close()
+
+	counter := NewCounterLogger()
+	polyLogger := NewPolyLogger([]Logger{counter, NewMultiWriterLogger(ioutil.Discard)})
+	errorIfFalse(TrackStats("TestLoggersAreThreadSafe", polyLogger) == nil, t, "could not track stats")
+	hammer(t, polyLogger, func() {
+		for i := 0; i < 20; i++ {
+			Stats()
+			counter.Counts()
+		}
+	})
+	polyLogger.Close()
+}
+
+func TestSetOnWriteError(t *testing.T) {
+	dir, err := ioutil.TempDir("", "sherlog_on_write_error")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	logger, err := NewFileLogger(filepath.Join(dir, "closed.log"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	logger.Close()
+
+	backup := NewCounterLogger()
+	var lostEntry error
+	logger.SetOnWriteError(func(entry error, writeErr error) error {
+		lostEntry = entry
+		errorIfFalse(Is(writeErr, ErrLoggerClosed), t, "handler did not get the write error")
+		return backup.Log(entry)
+	})
+	errorIfFalse(logger.Error("rescued") == nil, t, "handler's result was not returned")
+	errorIfFalse(lostEntry != nil && strings.Contains(lostEntry.Error(), "rescued"), t, "handler did not get the entry")
+	errorIfFalse(logger.LogNoStack(NewWarning("rescued")) == nil, t, "handler did not run for LogNoStack")
+	errorIfFalse(backup.Counts().Total == 2, t, "entries were not recovered")
+
+	logger.SetOnWriteError(nil)
+	errorIfFalse(logger.Error("lost") != nil, t, "error was swallowed without a handler")
+}
+
+func TestHTTPShipperContext(t *testing.T) {
+	release := make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-release:
+		case <-r.Context().Done():
+		}
+	}))
+	defer server.Close()
+	defer close(release)
+
+	shipper := NewHTTPShipper(HTTPShipperConfig{URL: server.URL, FlushInterval: time.Hour, OnError: func(error) {}})
+	shipper.Error("stuck")
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	err := shipper.CloseContext(ctx)
+	errorIfFalse(Is(err, ErrDestinationUnavailable), t, "abandoned send did not fail")
+	errorIfFalse(time.Since(start) < 5*time.Second, t, "close waited on the hung collector")
+
+	base, cancelBase := context.WithCancel(context.Background())
+	cancelBase()
+	shipper = NewHTTPShipper(HTTPShipperConfig{URL: server.URL, BatchSize: 1, Context: base, OnError: func(error) {}})
+	defer shipper.Close()
+	errorIfFalse(Is(shipper.Error("canceled"), ErrDestinationUnavailable), t, "send went ahead after the base context was canceled")
+}
+
+func TestRetryPolicy(t *testing.T) {
+	var requests int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch atomic.AddInt32(&requests, 1) {
+		case 1:
+			w.WriteHeader(http.StatusServiceUnavailable)
+		case 2:
+			w.WriteHeader(http.StatusTooManyRequests)
+		case 3:
+			w.WriteHeader(http.StatusOK)
+		default:
+			w.WriteHeader(http.StatusBadRequest)
+		}
+	}))
+	defer server.Close()
+
+	before := Retries()
+	policy := RetryPolicy{MaxAttempts: 5, InitialBackoff: time.Millisecond, Jitter: 0.5}
+	shipper := NewHTTPShipper(HTTPShipperConfig{URL: server.URL, BatchSize: 1, Retry: policy, OnError: func(error) {}})
+	defer shipper.Close()
+	errorIfFalse(shipper.Error("flaky") == nil, t, "batch was not retried until it went through")
+	errorIfFalse(atomic.LoadInt32(&requests) == 3, t, "wrong number of attempts")
+	errorIfFalse(Retries().Retries-before.Retries == 2, t, "retries were not counted")
+	errorIfFalse(shipper.Retries().Retries == 2, t, "retries were not counted for the shipper")
+
+	err := shipper.Error("invalid")
+	errorIfFalse(Is(err, ErrRejected) && !IsRetryable(err), t, "400 was not a rejection")
+	errorIfFalse(atomic.LoadInt32(&requests) == 4, t, "rejected batch was retried")
+
+	attempts := 0
+	err = RetryPolicy{MaxAttempts: 3, InitialBackoff: time.Millisecond}.Do(context.Background(), func() error {
+		attempts++
+		return loggerFailure(ErrDestinationUnavailable, "down")
+	})
+	errorIfFalse(Is(err, ErrDestinationUnavailable) && attempts == 3, t, "policy did not stop after MaxAttempts")
+	errorIfFalse(Retries().Exhausted-before.Exhausted == 1, t, "giving up was not counted")
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	attempts = 0
+	DefaultRetryPolicy.Do(ctx, func() error {
+		attempts++
+		return loggerFailure(ErrDestinationUnavailable, "down")
+	})
+	errorIfFalse(attempts == 1, t, "policy kept retrying after the context was canceled")
+}
+
+func TestHTTPShipperLogsWhileSending(t *testing.T) {
+	release := make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-release
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer server.Close()
+
+	policy := RetryPolicy{MaxAttempts: 3, InitialBackoff: time.Millisecond}
+	shipper := NewHTTPShipper(HTTPShipperConfig{URL: server.URL, BatchSize: 2, FlushInterval: time.Hour, Retry: policy, OnError: func(error) {}})
+	defer shipper.Close()
+	defer close(release) // Before closing the shipper, which waits for the hung batch
+	shipper.Error("first")
+	go shipper.Error("fills the batch and hangs")
+	for shipper.Pressure() < 1 {
+		time.Sleep(time.Millisecond)
+	}
+
+	logged := make(chan struct{})
+	go func() {
+		shipper.Error("while sending")
+		close(logged)
+	}()
+	select {
+	case <-logged:
+	case <-time.After(5 * time.Second):
+		t.Error("logging waited on a batch that was being sent")
+	}
+}
+
+func TestHTTPShipperConcurrentClose(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer server.Close()
+	shipper := NewHTTPShipper(HTTPShipperConfig{URL: server.URL, FlushInterval: time.Hour, OnError: func(error) {}})
+	shipper.Error("shipped once")
+
+	var closers sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		closers.Add(1)
+		go func() {
+			defer closers.Done()
+			shipper.Close()
+		}()
+	}
+	closers.Wait()
+}
+
+func TestHTTPShipperCompression(t *testing.T) {
+	var encodings []string
+	var bodies []string
+	refuse := false
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		encoding := r.Header.Get("Content-Encoding")
+		if refuse && encoding != "" {
+			w.WriteHeader(http.StatusUnsupportedMediaType)
+			return
+		}
+		var body io.Reader = r.Body
+		if encoding == "gzip" {
+			gzipReader, err := gzip.NewReader(r.Body)
+			if err != nil {
+				t.Error(err)
+				return
+			}
+			body = gzipReader
+		}
+		content, _ := ioutil.ReadAll(body)
+		encodings = append(encodings, encoding)
+		bodies = append(bodies, string(content))
+	}))
+	defer server.Close()
+
+	shipper := NewHTTPShipper(HTTPShipperConfig{URL: server.URL, BatchSize: 1, Compressor: GzipCompressor{}, CompressMinSize: 2048, OnError: func(error) {}})
+	defer shipper.Close()
+	shipper.Error("small")
+	shipper.Error(strings.Repeat("big ", 1024))
+	errorIfFalse(len(encodings) == 2 && encodings[0] == "" && encodings[1] == "gzip", t, "only big batches should be compressed")
+	errorIfFalse(len(bodies) == 2 && strings.Contains(bodies[1], "big big"), t, "compressed batch was not readable")
+
+	refuse = true
+	errorIfFalse(shipper.Error(strings.Repeat("refused ", 1024)) == nil, t, "refused batch was not resent uncompressed")
+	refuse = false
+	shipper.Error(strings.Repeat("after ", 1024))
+	errorIfFalse(len(encodings) == 4 && encodings[2] == "" && encodings[3] == "", t, "compression was not turned off after a 415")
+}
+
+type testUnmarshalable struct {
+	Callback func()
+}
+
+type testPoint struct{ x, y int }
+
+func TestSanitizeFieldValue(t *testing.T) {
+	RegisterFieldEncoder(testPoint{}, func(value interface{}) interface{} {
+		point := value.(testPoint)
+		return []int{point.x, point.y}
+	})
+	err := WithFields(NewError("weird fields"), map[string]interface{}{
+		"chan":     make(chan int),
+		"func":     func() {},
+		"timeout":  1500 * time.Millisecond,
+		"cause":    errors.New("boom"),
+		"ip":       net.IPv4(10, 0, 0, 1),
+		"nan":      math.NaN(),
+		"struct":   testUnmarshalable{},
+		"nested":   map[string]interface{}{"func": func() {}},
+		"point":    testPoint{1, 2},
+		"when":     time.Date(2018, 10, 3, 0, 0, 0, 0, time.UTC),
+		"replicas": 3,
+		"future":   time.Date(12018, 10, 3, 0, 0, 0, 0, time.UTC),
+		"celsius":  testCelsius(21.5),
+	})
+	jsonBytes, marshalErr := json.Marshal(NewEntry(err).ToJsonMap())
+	errorIfFalse(marshalErr == nil, t, "fields could not be marshaled")
+	var decoded struct{ Fields map[string]interface{} }
+	json.Unmarshal(jsonBytes, &decoded)
+	fields := decoded.Fields
+	errorIfFalse(fields["chan"] == "chan int" && fields["func"] == "func()", t, "chans and funcs were not replaced by their type")
+	errorIfFalse(fields["timeout"] == 1500.0, t, "duration was not written in milliseconds")
+	errorIfFalse(fields["cause"] == "boom" && fields["ip"] == "10.0.0.1", t, "errors and Stringers were not written as strings")
+	errorIfFalse(fields["nan"] == "NaN", t, "NaN was not written as a string")
+	errorIfFalse(fields["struct"] == "{Callback:<nil>}", t, "unmarshalable struct was not formatted")
+	errorIfFalse(fields["nested"].(map[string]interface{})["func"] == "func()", t, "nested map was not sanitized")
+	errorIfFalse(fmt.Sprint(fields["point"]) == "[1 2]", t, "registered encoder was not used")
+	errorIfFalse(fields["when"] == "2018-10-03T00:00:00Z" && fields["replicas"] == 3.0, t, "marshalable values were changed")
+	errorIfFalse(strings.HasPrefix(fmt.Sprint(fields["future"]), "12018-10-03 00:00:00"), t, "a Marshaler that fails was not formatted")
+	errorIfFalse(fields["celsius"] == 21.5, t, "a named number was not written as a number")
+}
+
+type testCelsius float64
+
+type testSelfWrapping struct {
+	next error
+}
+
+func (sw *testSelfWrapping) Error() string { return "wraps itself" }
+func (sw *testSelfWrapping) Unwrap() error { return sw.next }
+
+func TestChainLimits(t *testing.T) {
+	looped := &testSelfWrapping{}
+	looped.next = &testSelfWrapping{next: looped}
+	errorIfFalse(!Is(looped, ErrFormat), t, "Is did not stop at the cycle")
+	errorIfFalse(RootCause(looped) == looped.next, t, "RootCause did not stop at the cycle")
+	entry := NewEntry(looped)
+	errorIfFalse(entry.Message == "wraps itself", t, "entry of a cyclic error was not created")
+	_, cutOff := causesOf(looped)
+	errorIfFalse(strings.Contains(cutOff, "wraps itself"), t, "cycle was not marked")
+
+	defer func(depth int) { MaxChainDepth = depth }(MaxChainDepth)
+	MaxChainDepth = 3
+	err := NewError("root")
+	for i := 0; i < 5; i++ {
+		err = PrependMsg(err, fmt.Sprintf("layer %d", i))
+	}
+	var buf bytes.Buffer
+	err.(*LeveledException).LogNoStack(&buf)
+	errorIfFalse(strings.Count(buf.String(), "layer") == 3 && strings.Contains(buf.String(), "... 2 more messages"), t, "text message chain was not truncated")
+	chain := err.(*LeveledException).ToJsonMap()["MessageChain"].([]string)
+	errorIfFalse(len(chain) == 4 && chain[3] == "... 2 more messages", t, "json message chain was not truncated")
+
+	deep := error(&testSelfWrapping{})
+	for i := 0; i < 5; i++ {
+		deep = &testSelfWrapping{next: deep}
+	}
+	causes, cutOff := causesOf(deep)
+	errorIfFalse(len(causes) == 2 && cutOff == "... chain cut off after 3 errors", t, "deep chain was not cut off")
+}
+
+func TestSizeLimits(t *testing.T) {
+	logFilePath := "testSizeLimits.log"
+	os.Remove(logFilePath)
+	defer os.Remove(logFilePath)
+	logger, err := NewFileLogger(logFilePath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer logger.Close()
+	logger.Use(SizeLimits{MaxMessageBytes: 100, MaxFrames: 1}.Enforce)
+
+	huge := NewError(strings.Repeat("é", 1000))
+	logger.Log(huge, errors.New(strings.Repeat("x", 1000)))
+	content, _ := ioutil.ReadFile(logFilePath)
+	errorIfFalse(strings.Count(string(content), "...[2000 bytes, truncated]") == 1, t, "sherlog message was not truncated with a marker")
+	errorIfFalse(strings.Contains(string(content), "...[1000 bytes, truncated]"), t, "non-sherlog message was not truncated")
+	errorIfFalse(utf8.Valid(content), t, "truncation split a character")
+	errorIfFalse(strings.Contains(string(content), "more frames\n"), t, "frames were not truncated with a marker")
+	errorIfFalse(len(huge.(*LeveledException).message) == 2000, t, "logged exception was modified")
+
+	limited := SizeLimits{MaxEntryBytes: 300}.limit(NewError(strings.Repeat("y", 1000)))
+	var buf bytes.Buffer
+	limited.(Loggable).Log(&buf)
+	errorIfFalse(buf.Len() <= 300 && strings.Contains(buf.String(), "truncated]"), t, "entry was not cut down to MaxEntryBytes")
+
+	small := NewError("small")
+	errorIfFalse(SizeLimits{MaxMessageBytes: 100, MaxFrames: 1000, MaxEntryBytes: 100000}.limit(small) == small, t, "entry within the limits was copied")
+}
+
+func TestSanitizeText(t *testing.T) {
+	forged := "login failed\n\n2018-10-03 07:51:14 - CRITICAL - \x1b[31mdisk on fire\x1b[0m\x07 \xff"
+	var buf bytes.Buffer
+	WithField(NewError(forged), "user", "bob\r\nadmin").(LoggableWithNoStackOption).LogNoStack(&buf)
+	errorIfFalse(!strings.Contains(buf.String(), "\n") && !strings.Contains(buf.String(), "\x1b") && !strings.Contains(buf.String(), "\x07"), t, "message was not sanitized")
+	errorIfFalse(strings.HasSuffix(buf.String(), `login failed\n\n2018-10-03 07:51:14 - CRITICAL - disk on fire `+"� {user=bob\\r\\nadmin}"), t, "message was not escaped as expected")
+
+	formatted, _ := NewCSVFormatter().Format(NewEntry(errors.New("a\nb\x1b[1mc")))
+	errorIfFalse(strings.Contains(string(formatted), `a\nbc`), t, "delimited message was not sanitized")
+
+	defer func() { SanitizeText = true }()
+	SanitizeText = false
+	buf.Reset()
+	NewError(forged).(LoggableWithNoStackOption).LogNoStack(&buf)
+	errorIfFalse(strings.Contains(buf.String(), forged), t, "message was sanitized after turning SanitizeText off")
+}
+
+type testAuditLevel struct{}
+
+func (testAuditLevel) GetLevelId() int  { return 35 }
+func (testAuditLevel) GetLabel() string { return "AUDIT" }
+
+type testUmlautLevel struct{}
+
+func (testUmlautLevel) GetLevelId() int  { return 90 }
+func (testUmlautLevel) GetLabel() string { return "ÜBER" }
+
+func TestLevelDisplay(t *testing.T) {
+	audit := testAuditLevel{}
+	errorIfFalse(DisplayOf(audit).ShortCode == "A" && DisplayOf(audit).Rank == 35, t, "unregistered level did not get a fallback display")
+	errorIfFalse(DisplayOf(EnumOpsError).ShortCode == "OE", t, "built in level did not have a default display")
+
+	RegisterLevelDisplay(audit, LevelDisplay{Color: "\x1b[36m", ShortCode: "AU", Rank: -1})
+	defer func() {
+		levelDisplays.Lock()
+		delete(levelDisplays.byLevel, audit)
+		levelDisplays.Unlock()
+	}()
+	levels := []Level{EnumInfo, audit, EnumCritical}
+	SortLevels(levels)
+	errorIfFalse(levels[0] == audit && levels[1] == EnumCritical && levels[2] == EnumInfo, t, "levels were not sorted by rank")
+
+	formatter := &ConsoleFormatter{DisplayColors: true}
+	entryBytes, _ := formatter.Format(NewEntry(NewLeveledException("audited", audit)))
+	errorIfFalse(strings.HasPrefix(string(entryBytes), "\x1b[36m"), t, "console formatter did not use the registered color")
+	entryBytes, _ = (&ConsoleFormatter{}).Format(NewEntry(NewLeveledException("audited", audit)))
+	errorIfFalse(!strings.Contains(string(entryBytes), "\x1b["), t, "a zero console formatter colored the entry")
+	errorIfFalse(DisplayOf(testUmlautLevel{}).ShortCode == "Ü", t, "the default short code split a character")
+	level, found := LevelWithLabel("AUDIT")
+	errorIfFalse(found && level == audit, t, "registered level was not recognized by its label")
+}
+
+func TestCompactFormatter(t *testing.T) {
+	timestamp := time.Date(2018, 10, 3, 7, 51, 14, 0, time.UTC)
+	err := NewOpsError("could not connect to postgres")
+	stdExceptionOf(err).timestamp = &timestamp
+	stdExceptionOf(err).stackTrace = []*StackTraceEntry{{FunctionName: "main.connect", File: "/app/db.go", Line: 87}}
+	WithField(err, "retries", 3)
+	line, _ := NewCompactFormatter().Format(NewEntry(err))
+	errorIfFalse(string(line) == "1003 07:51:14 OE could not connect to postgres {retries=3} @db.go:87", t, "wrong compact line: "+string(line))
+
+	line, _ = (&CompactFormatter{TimeLayout: "15:04"}).Format(NewEntry(errors.New("plain")))
+	errorIfFalse(strings.HasSuffix(string(line), " - plain") && len(line) == len("07:51 - plain"), t, "wrong compact line without a level: "+string(line))
+}
+
+func TestNewFromCapturedStacks(t *testing.T) {
+	pcs := make([]uintptr, 16)
+	pcs = pcs[:runtime.Callers(1, pcs)]
+	err := NewStdExceptionFromPCs(pcs, "from pcs")
+	stackTrace := err.(*StdException).GetStackTrace()
+	errorIfFalse(len(stackTrace) > 0 && strings.HasSuffix(stackTrace[0].FunctionName, "TestNewFromCapturedStacks"), t, "frames were not made from the pcs")
+
+	var stack []byte
+	func() {
+		defer func() {
+			recover()
+			buf := make([]byte, 64*1024)
+			stack = buf[:runtime.Stack(buf, false)]
+		}()
+		var nilMap map[string]int
+		nilMap["boom"] = 1
+	}()
+	err = NewFromRuntimeStack(stack, "from text")
+	stackTrace = err.(*StdException).GetStackTrace()
+	errorIfFalse(len(stackTrace) > 1 && strings.Contains(stackTrace[0].FunctionName, "TestNewFromCapturedStacks.func"), t, "panic site was not at the top: "+stackTraceAsString(stackTrace))
+	errorIfFalse(strings.HasSuffix(stackTrace[0].File, "logging_test.go") && stackTrace[0].Line > 0, t, "file and line were not parsed")
+	errorIfFalse(err.Error() != "" && strings.Contains(err.Error(), "from text"), t, "message was not kept")
+
+	parsed := parseRuntimeStack([]byte("goroutine 7 [running]:\nmain.work(0x1)\n\t/app/work.go:9 +0x1d\ncreated by main.main in goroutine 1\n\t/app/main.go:5 +0x2a\n\ngoroutine 1 [chan receive]:\nmain.main()\n\t/app/main.go:6 +0x3b\n"), defaultStackTraceDepth)
+	errorIfFalse(len(parsed) == 2 && *parsed[0] == StackTraceEntry{FunctionName: "main.work", File: "/app/work.go", Line: 9} && parsed[1].FunctionName == "main.main", t, "runtime.Stack output was not parsed")
+}
+
+func TestCloneAndWithLevel(t *testing.T) {
+	original := WithField(NewOpsError("db down"), "db", "users").(*LeveledException)
+	clone := original.Clone()
+	clone.SetLevel(EnumCritical)
+	WithField(clone, "db", "orders")
+	PrependMsg(clone, "request failed")
+	errorIfFalse(original.GetLevel() == EnumOpsError && original.GetFields()["db"] == "users" && len(original.messageChain) == 0, t, "changing the clone changed the original")
+	errorIfFalse(clone.GetStackTraceAsString() == original.GetStackTraceAsString() && clone.sequence == original.sequence, t, "clone lost the stack trace or sequence number")
+
+	warning := original.WithLevel(EnumWarning)
+	errorIfFalse(warning.GetLevel() == EnumWarning && original.GetLevel() == EnumOpsError, t, "WithLevel changed the original")
+
+	NewMultiWriterLogger(ioutil.Discard).Log(original)
+	changed := PrependMsg(WithCorrelationID(WithField(original, "db", "orders"), "req-1"), "request failed")
+	errorIfFalse(changed != error(original) && FieldsOf(changed)["db"] == "orders" && stdExceptionOf(changed).correlationID == "req-1", t, "changing a logged exception did not return a changed copy")
+	errorIfFalse(original.GetFields()["db"] == "users" && original.correlationID == "" && len(original.messageChain) == 0, t, "changing a logged exception changed it in place")
+	errorIfFalse(NewStdException("plain").(*StdException).WithLevel(EnumInfo).GetLevel() == EnumInfo, t, "StdException.WithLevel did not set the level")
+
+	defer func(policy LevelPolicy) { DefaultLevelPolicy = policy }(DefaultLevelPolicy)
+	DefaultLevelPolicy = Overwrite
+	fresh := NewWarning("fresh")
+	errorIfFalse(AsError(fresh) == fresh && LevelOf(fresh) == EnumError, t, "unshared exception was not graduated in place")
+
+	logger := NewPolyLogger(nil)
+	logger.Log(original)
+	graduated := AsCritical(original)
+	errorIfFalse(graduated != error(original) && LevelOf(graduated) == EnumCritical, t, "logged exception was not copied when graduated")
+	errorIfFalse(original.GetLevel() == EnumOpsError, t, "logged exception was changed when graduated")
+}
+
+func TestConcurrentLogOfSameException(t *testing.T) {
+	// Meant to be run with -race: every logger renders the same exception's stack trace at the same time
+	dir, err := ioutil.TempDir("", "sherlog_same_exception")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	var loggers []Logger
+	for i := 0; i < 4; i++ {
+		logger, err := NewFileLogger(filepath.Join(dir, fmt.Sprintf("%d.log", i)))
+		if err != nil {
+			t.Fatal(err)
+		}
+		loggers = append(loggers, logger)
+	}
+	polyLogger := NewPolyLogger(loggers)
+	defer polyLogger.Close()
+
+	exception := NewError("logged everywhere at once")
+	var waitGroup sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		waitGroup.Add(1)
+		go func() {
+			defer waitGroup.Done()
+			polyLogger.Log(exception)
+			exception.(*LeveledException).GetStackTraceAsString()
+		}()
+	}
+	waitGroup.Wait()
+	for i := range loggers {
+		content, _ := ioutil.ReadFile(filepath.Join(dir, fmt.Sprintf("%d.log", i)))
+		errorIfFalse(strings.Count(string(content), "TestConcurrentLogOfSameException") == 8, t, "stack trace was not written by every log call")
+	}
+}
+
+func testRecurse(depth int, create func() error) error {
+	if depth == 0 {
+		return create()
+	}
+	return testRecurse(depth-1, create)
+}
+
+func TestTruncatedStackTrace(t *testing.T) {
+	defer func(original int) { StackTailFrames = original }(StackTailFrames)
+	create := func() error { return NewStdExceptionWithStackTraceSize("deep", 10) }
+
+	StackTailFrames = 0
+	stackTrace := testRecurse(50, create).(*StdException).GetStackTrace()
+	errorIfFalse(len(stackTrace) == 11, t, "Expected 10 frames and the marker")
+	errorIfFalse(strings.Contains(stackTrace[0].FunctionName, "TestTruncatedStackTrace"), t, "The top frame should be where the exception was created")
+	errorIfFalse(stackTrace[10].FunctionName == "...more frames", t, "The last frame should be the marker")
+
+	StackTailFrames = 3
+	stackTrace = testRecurse(50, create).(*StdException).GetStackTrace()
+	errorIfFalse(len(stackTrace) == 11, t, "Expected 7 top frames, the marker, and 3 tail frames")
+	errorIfFalse(strings.HasSuffix(stackTrace[7].FunctionName, " more frames"), t, "The marker should be between the top and the tail")
+	errorIfFalse(stackTrace[10].FunctionName == "runtime.goexit", t, "The tail should end at the bottom of the stack")
+	errorIfFalse(!strings.Contains(stackTrace[8].FunctionName, "testRecurse"), t, "The tail should be below the recursion")
+
+	stackTrace = create().(*StdException).GetStackTrace()
+	errorIfFalse(!strings.HasSuffix(stackTrace[len(stackTrace)-1].FunctionName, " more frames"), t, "A shallow stack shouldn't be marked")
+
+	for _, size := range []int{0, 1} {
+		size := size
+		done := make(chan []*StackTraceEntry, 1)
+		go func() {
+			done <- testRecurse(50, func() error { return NewStdExceptionWithStackTraceSize("x", size) }).(*StdException).GetStackTrace()
+		}()
+		select {
+		case stackTrace = <-done:
+		case <-time.After(5 * time.Second):
+			t.Fatal("capturing a stack trace with a tiny size limit hung")
+		}
+		errorIfFalse(len(stackTrace) == size*2, t, "Expected no frames for size 0, and a frame and the marker for size 1")
+	}
+}
+
+type testFrame uintptr
+
+type testFrames []testFrame
+
+// testFramesrError carries its stack trace the way github.com/pkg/errors does.
+type testFramesrError struct {
+	stack testFrames
+}
+
+func (tse *testFramesrError) Error() string {
+	return "from a third party"
+}
+
+func (tse *testFramesrError) StackTrace() testFrames {
+	return tse.stack
+}
+
+func newTestStackTracerError() error {
+	pcs := make([]uintptr, 32)
+	pcs = pcs[:runtime.Callers(1, pcs)]
+	stack := make(testFrames, len(pcs))
+	for i, pc := range pcs {
+		stack[i] = testFrame(pc)
+	}
+	return &testFramesrError{stack: stack}
+}
+
+func TestGraduateThirdPartyStackTrace(t *testing.T) {
+	err := newTestStackTracerError()
+	graduated := AsOpsError(err).(*LeveledException)
+	stackTrace := graduated.GetStackTrace()
+	errorIfFalse(len(stackTrace) > 0 && strings.HasSuffix(stackTrace[0].FunctionName, "newTestStackTracerError"), t, "The stack trace should come from where the third party error was created")
+	errorIfFalse(graduated.GetLevel() == EnumOpsError, t, "The level should be OPS_ERROR")
+	errorIfFalse(graduated.Unwrap() == err, t, "The third party error should still be the cause")
+
+	graduated = AsError(errors.New("no stack")).(*LeveledException)
+	errorIfFalse(strings.Contains(graduated.GetStackTrace()[0].FunctionName, "TestGraduateThirdPartyStackTrace"), t, "Errors without a stack trace should get one from where they were graduated")
+}
+
+type testPrinter interface {
+	Print(args ...interface{})
+	Printf(format string, args ...interface{})
+	Detail() bool
+}
+
+// testFormatterError prints its detail the way errors from golang.org/x/xerrors do.
+type testFormatterError struct{}
+
+func (tfe *testFormatterError) Error() string {
+	return "read config"
+}
+
+func (tfe *testFormatterError) FormatError(p testPrinter) error {
+	p.Print("read config")
+	if p.Detail() {
+		p.Printf("\n    main.loadConfig\n        %s:%d", "/app/config.go", 31)
+	}
+	return nil
+}
+
+// testCauserError wraps an error the way older versions of github.com/pkg/errors do, without Unwrap.
+type testCauserError struct {
+	cause error
+}
+
+func (tce *testCauserError) Error() string {
+	return "wrapped: " + tce.cause.Error()
+}
+
+func (tce *testCauserError) Cause() error {
+	return tce.cause
+}
+
+func TestThirdPartyErrorInterop(t *testing.T) {
+	inner := &testFormatterError{}
+	wrapped := &testCauserError{cause: inner}
+	errorIfFalse(RootCause(wrapped) == inner, t, "Cause should be followed like Unwrap")
+	errorIfFalse(ErrorDetail(wrapped) == "read config\n    main.loadConfig\n        /app/config.go:31", t, "ErrorDetail should have what FormatError printed")
+	errorIfFalse(ErrorDetail(errors.New("plain")) == "", t, "Errors without FormatError have no detail")
+
+	stackTracerErr := newTestStackTracerError()
+	stackTrace := StackOf(&testCauserError{cause: stackTracerErr})
+	errorIfFalse(len(stackTrace) > 0 && strings.HasSuffix(stackTrace[0].FunctionName, "newTestStackTracerError"), t, "StackOf should find third party stack traces")
+
+	var buf bytes.Buffer
+	exception := AsError(wrapped).(*LeveledException)
+	exception.Log(&buf)
+	errorIfFalse(strings.Contains(buf.String(), "\nDetail:\n    read config\n        main.loadConfig\n            /app/config.go:31"), t, "Text output should have the detail")
+	jsonMap := exception.ToJsonMap()
+	errorIfFalse(jsonMap["Detail"] == "read config\n    main.loadConfig\n        /app/config.go:31", t, "Json output should have the detail")
+
+	buf.Reset()
+	writeNonSherlogError(&buf, &testCauserError{cause: stackTracerErr})
+	errorIfFalse(strings.Contains(buf.String(), "newTestStackTracerError("), t, "Text output of non-sherlog errors should have third party stack traces")
+	jsonMap = NewEntry(stackTracerErr).ToJsonMap()
+	errorIfFalse(jsonMap["StackTrace"] != nil, t, "Json output of non-sherlog errors should have third party stack traces")
+}
+
+func TestAssertionHelpers(t *testing.T) {
+	logger := NewCounterLogger()
+	errorIfFalse(Check(logger, nil) && Assert(logger, true, "fine"), t, "Passing checks should return true")
+	errorIfFalse(Must(logger, 42, nil) == 42, t, "Must should return the value")
+	errorIfFalse(logger.Counts().Total == 0, t, "Nothing should be logged for passing checks")
+
+	errorIfFalse(!Check(logger, fmt.Errorf("broken")), t, "Check should return false for an error")
+	errorIfFalse(!Assert(logger, false, "batch of ", 3, " is too big"), t, "Assert should return false")
+	errorIfFalse(logger.Counts().ByLevel["CRITICAL"] == 2, t, "Failures should be logged as CRITICAL")
+
+	func() {
+		defer func() {
+			exception, ok := recover().(*LeveledException)
+			errorIfFalse(ok && exception.GetMessage() == "batch is empty", t, "Assert should panic with the exception")
+			errorIfFalse(strings.Contains(exception.GetStackTrace()[0].FunctionName, "TestAssertionHelpers"), t, "The stack trace should start at the caller")
+		}()
+		defer func(original bool) { PanicOnFailedAssertion = original }(PanicOnFailedAssertion)
+		PanicOnFailedAssertion = true
+		Assert(logger, false, "batch is empty")
+	}()
+
+	func() {
+		defer func() {
+			errorIfFalse(recover() != nil, t, "Must should panic")
+		}()
+		Must(logger, nil, fmt.Errorf("no config"))
+	}()
+	errorIfFalse(logger.Counts().ByLevel["CRITICAL"] == 4, t, "Failures that panic should be logged first")
+}
+
+func TestOperation(t *testing.T) {
+	logger := &recordingLogger{}
+	op := Begin(logger, "reindex users")
+	errorIfFalse(len(op.ID) == 32 && op.Name == "reindex users", t, "Wrong operation")
+	op.End(nil)
+	op.End(fmt.Errorf("ignored"))
+	errorIfFalse(len(logger.logged) == 2, t, "Begin and the first End should log one entry each")
+
+	began := logger.logged[0].(*LeveledException)
+	finished := logger.logged[1].(*LeveledException)
+	errorIfFalse(began.GetLevel() == EnumDebug && began.GetMessage() == "began reindex users", t, "Wrong start entry")
+	errorIfFalse(finished.GetLevel() == EnumInfo && finished.GetMessage() == "finished reindex users", t, "Wrong completion entry")
+	errorIfFalse(began.GetFields()[OperationIDField] == op.ID && finished.GetFields()[OperationIDField] == op.ID, t, "Both entries should have the operation ID")
+	errorIfFalse(finished.GetDuration() > 0, t, "The completion entry should have the elapsed time")
+	errorIfFalse(strings.Contains(began.GetStackTrace()[0].FunctionName, "TestOperation"), t, "The stack trace should start at the caller")
+
+	logger.logged = nil
+	Begin(logger, "ship logs").End(NewOpsError("shipper unreachable"))
+	failed := logger.logged[1].(*LeveledException)
+	errorIfFalse(failed.GetLevel() == EnumOpsError && failed.GetFields()[OperationField] == "ship logs", t, "A failure should keep the error's level")
+
+	logger.logged = nil
+	Begin(logger, "parse").End(fmt.Errorf("bad input"))
+	errorIfFalse(logger.logged[1].(*LeveledException).GetLevel() == EnumError, t, "Errors without a level should be logged as ERROR")
+}
+
+func TestHeartbeatLogger(t *testing.T) {
+	logger := &recordingLogger{}
+	defaulted := NewHeartbeatLogger(logger, "no interval", 0)
+	errorIfFalse(defaulted.interval == defaultHeartbeatInterval, t, "an interval of 0 did not fall back to the default")
+	defaulted.Stop()
+	NewHeartbeatLogger(logger, "negative interval", -time.Second).Stop()
+
+	heartbeat := NewHeartbeatLogger(logger, "reindexing users", 5*time.Millisecond)
+	err := heartbeat.Run(func() error {
+		heartbeat.SetStatus("stage", "loading")
+		for i := 0; i < 3; i++ {
+			heartbeat.Add("items_processed", 1)
+			time.Sleep(10 * time.Millisecond)
+		}
+		return fmt.Errorf("job failed")
+	})
+	errorIfFalse(err != nil && err.Error() == "job failed", t, "Run should return what the job returned")
+
+	numLogged := len(logger.logged)
+	errorIfFalse(numLogged >= 2, t, "Heartbeats should be logged every interval")
+	last := logger.logged[numLogged-1].(*LeveledException)
+	errorIfFalse(last.GetLevel() == EnumInfo && last.GetMessage() == "reindexing users", t, "Wrong heartbeat entry")
+	errorIfFalse(last.GetFields()["stage"] == "loading" && last.GetFields()["items_processed"].(int64) >= 1, t, "Heartbeats should have the status fields")
+
+	time.Sleep(20 * time.Millisecond)
+	heartbeat.Stop()
+	errorIfFalse(len(logger.logged) == numLogged, t, "Nothing should be logged after the job is done")
+}
+
+func TestTrimBuildPaths(t *testing.T) {
+	errorIfFalse(trimBuildPath("/home/nick/go/pkg/mod/github.com/lib/pq@v1.0.0/conn.go", "github.com/lib/pq.(*conn).query") == "github.com/lib/pq@v1.0.0/conn.go", t, "Module cache paths should keep module@version")
+	errorIfFalse(trimBuildPath(runtime.GOROOT()+"/src/runtime/proc.go", "runtime.main") == "runtime/proc.go", t, "GOROOT paths should be relative to GOROOT/src")
+	errorIfFalse(trimBuildPath("/home/nick/work/sherlog/stdexception.go", "github.com/Nick-Anderssohn/sherlog.(*StdException).Log") == "github.com/Nick-Anderssohn/sherlog/stdexception.go", t, "Other paths should be under the import path of their package")
+	errorIfFalse(trimBuildPath("/home/nick/work/tool/main.go", "main.main") == "main.go", t, "Files of package main outside of the main module should be trimmed to their base name")
+
+	defer func(original bool) { TrimBuildPaths = original }(TrimBuildPaths)
+	TrimBuildPaths = true
+	frame := &StackTraceEntry{FunctionName: "github.com/Nick-Anderssohn/sherlog.NewError", File: "/home/nick/work/sherlog/default.go", Line: 7}
+	jsonBytes, err := json.Marshal([]*StackTraceEntry{frame})
+	errorIfFalse(err == nil && string(jsonBytes) == `[{"FunctionName":"github.com/Nick-Anderssohn/sherlog.NewError","File":"github.com/Nick-Anderssohn/sherlog/default.go","Line":7}]`, t, "Json should have the trimmed path")
+	errorIfFalse(frame.File == "/home/nick/work/sherlog/default.go", t, "The frame itself shouldn't change")
+
+	exception := NewError("trimmed")
+	errorIfFalse(!strings.Contains(exception.(*LeveledException).GetStackTraceAsString(), runtime.GOROOT()), t, "Text should have trimmed paths")
+	errorIfFalse(strings.HasPrefix(callerOf(exception), "github.com/Nick-Anderssohn/sherlog/logging_test.go:"), t, "Caller should have the trimmed path")
+
+	errorIfFalse(frame.String() == "github.com/Nick-Anderssohn/sherlog.NewError(github.com/Nick-Anderssohn/sherlog/default.go:7)" && frame.Caller() == "github.com/Nick-Anderssohn/sherlog/default.go:7", t, "String and Caller should have the trimmed path")
+	formatter, _ := NewTemplateFormatter("{{range .Stack}}{{.File}}{{end}}")
+	templated, _ := formatter.Format(&Entry{StackTrace: []*StackTraceEntry{frame}})
+	errorIfFalse(string(templated) == "github.com/Nick-Anderssohn/sherlog/default.go", t, "Templates should get the trimmed path: "+string(templated))
+	delimited, _ := NewCSVFormatter().Format(&Entry{StackTrace: []*StackTraceEntry{frame}})
+	errorIfFalse(!strings.Contains(string(delimited), "/home/nick"), t, "Delimited output should have the trimmed path: "+string(delimited))
+
+	errorIfFalse(packagePathOf("gopkg.in/yaml%2ev2.Unmarshal") == "gopkg.in/yaml.v2", t, "Escaped dots should be part of the package path")
+	errorIfFalse(packagePathOf("github.com/a/b.Map[...]") == "github.com/a/b" && packagePathOf("github.com/a/b.F[github.com/c/d.T]") == "github.com/a/b", t, "Type arguments should be ignored")
+}
+
+func TestMultiFileLoggerSetFormatters(t *testing.T) {
+	dir, err := ioutil.TempDir("", "sherlog")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	logger, err := NewMultiFileLogger(map[Level]string{
+		EnumDebug:   filepath.Join(dir, "debug.log"),
+		EnumError:   filepath.Join(dir, "error.log"),
+		EnumWarning: filepath.Join(dir, "error.log"),
+	}, filepath.Join(dir, "default.log"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer logger.Close()
+
+	jsonFormatter := NewJsonFormatter()
+	err = logger.SetFormatters(map[Level]Formatter{EnumError: jsonFormatter, EnumWarning: &ConsoleFormatter{Plain: true}})
+	errorIfFalse(err != nil, t, "Levels sharing a logger can't get different formatters")
+	err = logger.SetFormatters(map[Level]Formatter{EnumInfo: jsonFormatter})
+	errorIfFalse(err != nil, t, "Levels without a logger can't get a formatter")
+
+	err = logger.SetFormatters(map[Level]Formatter{EnumDebug: &ConsoleFormatter{Plain: true}, EnumError: jsonFormatter, EnumWarning: jsonFormatter})
+	errorIfFalse(err == nil, t, "SetFormatters failed")
+	logger.Log(NewDebug("cache miss"))
+	logger.Log(NewError("could not connect"))
+
+	debugBytes, _ := ioutil.ReadFile(filepath.Join(dir, "debug.log"))
+	errorIfFalse(strings.Contains(string(debugBytes), " - DEBUG - cache miss") && !strings.Contains(string(debugBytes), "\t"), t, "The DEBUG file should have text without stack traces")
+	errorBytes, _ := ioutil.ReadFile(filepath.Join(dir, "error.log"))
+	errorIfFalse(strings.HasPrefix(string(errorBytes), `{"entry":`) && strings.Contains(string(errorBytes), `"StackTrace":[`), t, "The ERROR file should have json with the stack trace")
+}
+
+func TestMultiFileLoggerRoutesToFormattedLoggers(t *testing.T) {
+	dir, err := ioutil.TempDir("", "sherlog")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	errorLogger, err := NewFileLogger(filepath.Join(dir, "error.log"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	errorLogger.SetFormatter(NewJsonFormatter())
+	debugLogger := &recordingLogger{}
+	logger, err := NewMultiFileLoggerFromLoggers(map[Level]Logger{EnumError: errorLogger, EnumDebug: debugLogger}, &recordingLogger{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer logger.Close()
+
+	logger.LogNoStack(NewError("no stack"))
+	logger.LogJson(NewError("json"))
+	content, _ := ioutil.ReadFile(filepath.Join(dir, "error.log"))
+	lines := strings.Split(strings.TrimSpace(string(content)), "\n")
+	errorIfFalse(len(lines) == 2 && strings.HasPrefix(lines[0], `{"entry":`) && strings.HasPrefix(lines[1], `{"entry":`), t, "A logger with a formatter should get every entry in its format")
+
+	logger.LogNoStack(NewDebug("plain"))
+	errorIfFalse(len(debugLogger.logged) == 1, t, "Loggers without a formatter should still get LogNoStack")
+}
+
+/*
+uncomparableLogger is a Logger value that can't be compared or used as a map key.
+*/
+type uncomparableLogger struct {
+	*recordingLogger
+	tags []string
+}
+
+func TestPolyLoggerUncomparableLogger(t *testing.T) {
+	inner := &recordingLogger{}
+	other := &recordingLogger{}
+	logger := uncomparableLogger{recordingLogger: inner, tags: []string{"a"}}
+	polyLogger := NewPolyLogger([]Logger{logger, other})
+	polyLogger.SetEncoding(other, EncodingNoStack)
+	polyLogger.Log(NewError("x"))
+	polyLogger.SetEncoding(logger, EncodingJson)
+	polyLogger.LogNoStack(NewError("y"))
+	errorIfFalse(len(inner.logged) == 2 && len(other.logged) == 2, t, "a logger that can't be compared was not written to")
+	errorIfFalse(!polyLogger.RemoveLogger(logger), t, "a logger that can't be compared was removed")
+	errorIfFalse(polyLogger.RemoveLogger(other) && len(polyLogger.Loggers) == 1, t, "removing the other logger failed")
+}
+
+func TestPolyLoggerAddAndRemoveLogger(t *testing.T) {
+	always := NewCounterLogger()
+	polyLogger := NewPolyLogger([]Logger{always})
+	incident := NewCounterLogger()
+
+	stop := make(chan struct{})
+	var waitGroup sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		waitGroup.Add(1)
+		go func() {
+			defer waitGroup.Done()
+			for {
+				select {
+				case <-stop:
+					return
+				default:
+					polyLogger.Info("still going")
+				}
+			}
+		}()
+	}
+	for i := 0; i < 20; i++ {
+		polyLogger.AddLogger(incident)
+		polyLogger.SetEncoding(incident, EncodingNoStack)
+		errorIfFalse(polyLogger.RemoveLogger(incident), t, "RemoveLogger should find the logger")
+	}
+	close(stop)
+	waitGroup.Wait()
+
+	errorIfFalse(!polyLogger.RemoveLogger(incident), t, "RemoveLogger should return false for a logger that isn't there")
+	incident.Reset()
+	polyLogger.AddLogger(incident)
+	polyLogger.Info("during the incident")
+	polyLogger.RemoveLogger(incident)
+	polyLogger.Info("after the incident")
+	errorIfFalse(incident.Counts().Total == 1, t, "Only entries logged while the logger was attached should reach it")
+	errorIfFalse(len(polyLogger.Loggers) == 1 && polyLogger.Loggers[0] == always, t, "The other loggers should stay")
+}
+
+func TestPausableLogger(t *testing.T) {
+	recorder := &recordingLogger{}
+	logger := NewPausableLogger(recorder, BufferWhilePaused, 2)
+	logger.Info("before")
+	logger.Pause()
+	errorIfFalse(logger.Paused(), t, "logger should be paused")
+	logger.Info("during 1")
+	logger.Info("during 2")
+	err := logger.Info("during 3")
+	errorIfFalse(Is(err, ErrQueueFull), t, "entries past maxBuffered should fail with ErrQueueFull")
+	errorIfFalse(len(recorder.logged) == 1 && logger.QueueDepth() == 2, t, "entries should be buffered while paused")
+
+	errorIfFalse(logger.Resume() == nil, t, "Resume should not fail")
+	logger.Info("after")
+	var messages []string
+	for _, logged := range recorder.logged {
+		messages = append(messages, logged.(*LeveledException).GetMessage())
+	}
+	errorIfFalse(strings.Join(messages, ",") == "before,during 1,during 2,after", t, "entries should be written in order")
+
+	dropping := NewPausableLogger(recorder, DropWhilePaused, 0)
+	dropping.Pause()
+	errorIfFalse(dropping.Info("dropped") == nil, t, "dropping should not fail")
+	dropping.Resume()
+	errorIfFalse(len(recorder.logged) == 4, t, "entries should be dropped while paused")
+}
+
+func TestPreallocatedStandbyFile(t *testing.T) {
+	dir, err := ioutil.TempDir("", "sherlog")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	logger, err := NewRollingFileLoggerWithSizeLimit(filepath.Join(dir, "app.log"), 100)
+	if err != nil {
+		t.Fatal(err)
+	}
+	errorIfFalse(logger.SetPreallocate(1024*1024) == nil, t, "could not set up the standby file")
+	standbyPath := logger.standbyFilePath()
+	errorIfFalse(fileExists(standbyPath), t, "the standby file should be created right away")
+
+	errorIfFalse(logger.Roll() == nil, t, "could not roll")
+	logger.Info("written to the standby file")
+	content, _ := ioutil.ReadFile(logger.logFilePath)
+	errorIfFalse(strings.Contains(string(content), "written to the standby file") && !strings.HasPrefix(string(content), "\x00"), t, "the new file should only have the entry")
+	rolledFiles, _ := filepath.Glob(filepath.Join(dir, "app_*.log"))
+	errorIfFalse(len(rolledFiles) == 2, t, "the standby file should not be mistaken for a rolled file")
+
+	for i := 0; i < 100 && !fileExists(standbyPath); i++ {
+		time.Sleep(10 * time.Millisecond)
+	}
+	errorIfFalse(fileExists(standbyPath), t, "the next standby file should be prepared after rolling")
+	logger.Close()
+	errorIfFalse(!fileExists(standbyPath), t, "Close should delete the standby file")
+}
+
+func TestDirectFileWriter(t *testing.T) {
+	dir, err := ioutil.TempDir("", "sherlog")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	filePath := filepath.Join(dir, "direct.log")
+
+	writer, err := OpenDirectFile(filePath, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	logger := NewMultiWriterLogger(writer)
+	var expected bytes.Buffer
+	for i := 0; i < 200; i++ {
+		line := fmt.Sprintf("entry %d %s\n", i, strings.Repeat("x", i))
+		expected.WriteString(line)
+		writer.Write([]byte(line))
+		if i%50 == 0 {
+			errorIfFalse(logger.Flush() == nil, t, "could not flush")
+		}
+	}
+	errorIfFalse(writer.Close() == nil, t, "could not close")
+
+	writer, err = OpenDirectFile(filePath, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	writer.Write([]byte("reopened\n"))
+	expected.WriteString("reopened\n")
+	writer.Close()
+	content, _ := ioutil.ReadFile(filePath)
+	errorIfFalse(string(content) == expected.String(), t, "the file should have exactly what was written, in order")
+}
+
+func TestRingFile(t *testing.T) {
+	dir, err := ioutil.TempDir("", "sherlog")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	filePath := filepath.Join(dir, "app.ring")
+
+	ring, err := OpenRingFile(filePath, RingFileHeaderSize+600)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 100; i++ {
+		ring.Write([]byte(fmt.Sprintf("entry %d%s", i, strings.Repeat(".", i%13))))
+	}
+	ring.Close()
+
+	ring, err = OpenRingFile(filePath, RingFileHeaderSize+600)
+	if err != nil {
+		t.Fatal(err)
+	}
+	logger := NewMultiWriterLogger(ring)
+	logger.LogNoStack(AsError("after reopening"))
+	logger.Close()
+
+	entries, err := ReadRingFile(filePath)
+	errorIfFalse(err == nil && len(entries) > 5, t, "could not read the ring file")
+	errorIfFalse(strings.Contains(string(entries[len(entries)-1]), "after reopening"), t, "the newest entry should be last")
+	first := 100 - (len(entries) - 1)
+	for i, entry := range entries[:len(entries)-1] {
+		expected := fmt.Sprintf("entry %d%s", first+i, strings.Repeat(".", (first+i)%13))
+		errorIfFalse(string(entry) == expected, t, "the ring should have the newest entries, oldest first")
+	}
+
+	content, _ := ioutil.ReadFile(filePath)
+	for i := 16; i < 40; i++ {
+		content[i] = 0xff // Head, tail, and count that don't fit in the file, and turn negative as ints
+	}
+	ioutil.WriteFile(filePath, content, 0644)
+	_, err = ReadRingFile(filePath)
+	errorIfFalse(err != nil, t, "a corrupt header was read")
+	ring, err = OpenRingFile(filePath, RingFileHeaderSize+600)
+	errorIfFalse(err == nil, t, "could not open a ring file with a corrupt header")
+	ring.Write([]byte("fresh"))
+	ring.Close()
+	entries, err = ReadRingFile(filePath)
+	errorIfFalse(err == nil && len(entries) == 1 && string(entries[0]) == "fresh", t, "a corrupt header did not reset the ring")
+}
+
+func TestEscalator(t *testing.T) {
+	defer SetClock(nil)
+	now := time.Date(2018, 10, 3, 7, 51, 14, 0, time.UTC)
+	SetClock(func() time.Time { return now })
+
+	escalator := NewEscalator(EscalationRule{Level: EnumOpsError, Threshold: 3, Window: 5 * time.Minute})
+	var logged []error
+	logFunc := escalator.Escalate(func(values ...interface{}) error {
+		logged = append(logged, values[0].(error))
+		return nil
+	})
+	newOpsError := func() error { return NewOpsError("connection refused") }
+
+	var original error
+	for i := 0; i < 5; i++ {
+		original = newOpsError()
+		logFunc(original, NewError("request failed"))
+		now = now.Add(time.Second)
+	}
+	logFunc(NewWarning("not counted"))
+	for i, err := range logged[:5] {
+		expected := EnumOpsError
+		if i >= 3 {
+			expected = EnumCritical
+		}
+		errorIfFalse(LevelOf(err) == expected, t, "only the entries after the threshold should be escalated")
+	}
+	errorIfFalse(FieldsOf(logged[4])[EscalatedFromField] == "OPS_ERROR", t, "escalated entries should say what they were escalated from")
+	errorIfFalse(LevelOf(original) == EnumOpsError, t, "the caller's exception should keep its level")
+	errorIfFalse(LevelOf(logged[5]) == EnumWarning, t, "entries that no rule matches should be left alone")
+
+	now = now.Add(10 * time.Minute)
+	logFunc(newOpsError())
+	errorIfFalse(LevelOf(logged[6]) == EnumOpsError, t, "entries should stop being escalated once they slow down")
+}
+
+func TestMaintenanceSuppressor(t *testing.T) {
+	defer SetClock(nil)
+	now := time.Date(2018, 10, 7, 3, 10, 0, 0, time.UTC) // A Sunday
+	SetClock(func() time.Time { return now })
+
+	_, err := NewMaintenanceSuppressor(MaintenanceWindow{Schedule: "0 25 * * *"})
+	errorIfFalse(err != nil, t, "an hour of 25 should be rejected")
+
+	suppressor, err := NewMaintenanceSuppressor(MaintenanceWindow{
+		Name:        "postgres restart",
+		Schedule:    "0 3 * * 0",
+		Duration:    30 * time.Minute,
+		Expected:    []FilterRule{{Message: regexp.MustCompile("connection refused")}},
+		DowngradeTo: EnumWarning,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var logged []error
+	logFunc := suppressor.Suppress(func(values ...interface{}) error {
+		logged = append(logged, values[0].(error))
+		return nil
+	})
+
+	original := NewOpsError("connection refused")
+	logFunc(original)
+	logFunc(NewCritical("disk full"))
+	errorIfFalse(LevelOf(logged[0]) == EnumWarning && FieldsOf(logged[0])[MaintenanceWindowField] == "postgres restart", t, "expected errors should be downgraded and tagged during the window")
+	errorIfFalse(LevelOf(original) == EnumOpsError, t, "the caller's exception should keep its level")
+	errorIfFalse(LevelOf(logged[1]) == EnumCritical && FieldsOf(logged[1]) == nil, t, "unexpected errors should be left alone")
+	errorIfFalse(len(suppressor.Active()) == 1, t, "the window should be active")
+
+	now = now.Add(30 * time.Minute)
+	logFunc(NewOpsError("connection refused"))
+	errorIfFalse(LevelOf(logged[2]) == EnumOpsError, t, "errors should be left alone after the window")
+	errorIfFalse(len(suppressor.Active()) == 0, t, "the window should be over")
+}
+
+func TestCloseStopsScheduledRolls(t *testing.T) {
+	dir, err := ioutil.TempDir("", "sherlog")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	before := runtime.NumGoroutine()
+	logger, err := NewCustomRollingFileLogger(filepath.Join(dir, "sched.log"), time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	logger.Close()
+	logger.Close()
+	for i := 0; i < 100 && runtime.NumGoroutine() > before; i++ {
+		time.Sleep(10 * time.Millisecond)
+	}
+	errorIfFalse(runtime.NumGoroutine() <= before, t, "the scheduled roll goroutine was still running after Close")
+}
+
+type testJournalLevel int
+
+func (level testJournalLevel) GetLevelId() int { return int(level) }
+func (testJournalLevel) GetLabel() string      { return "JOURNAL" }
+
+func TestJournalLoggerRejectsUnindexableLevels(t *testing.T) {
+	dir, err := ioutil.TempDir("", "sherlog_journal_levels")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	logger, err := NewJournalLogger(dir, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer logger.Close()
+
+	for _, id := range []int{-1, JournalNoLevel, 300} {
+		err := logger.Log(NewLeveledException("too big", testJournalLevel(id)))
+		errorIfFalse(Is(err, ErrFormat), t, "level id that doesn't fit in the index was not rejected")
+	}
+	errorIfFalse(logger.Log(NewLeveledException("fits", testJournalLevel(254))) == nil, t, "level id 254 was rejected")
+
+	index, err := ioutil.ReadFile(JournalSegmentPath(dir, 1, ".idx"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	errorIfFalse(len(index) == JournalIndexRecordSize && index[8] == 254, t, "rejected entries were indexed")
+}
+
+type closeCountingWriter struct {
+	bytes.Buffer
+	closes int
+}
+
+func (writer *closeCountingWriter) Close() error {
+	writer.closes++
+	return nil
+}
+
+func TestMultiWriterLoggerClose(t *testing.T) {
+	writer := &closeCountingWriter{}
+	logger := NewMultiWriterLogger(writer)
+	logger.Close()
+	logger.Close()
+	errorIfFalse(writer.closes == 1, t, "writer was not closed exactly once")
+	errorIfFalse(Is(logger.Error("too late"), ErrLoggerClosed), t, "logging after Close did not fail with ErrLoggerClosed")
+	errorIfFalse(writer.Len() == 0, t, "entry was written after Close")
+}
+
 // ***************** Benchmarks *******************
 
 func BenchmarkStackTraceAsString(b *testing.B) {
@@ -116,3 +2980,138 @@ func BenchmarkNewLeveledException(b *testing.B) {
 		NewLeveledException("Test Message", EnumError)
 	}
 }
+
+// Creates exceptions from every CPU at once, like a busy service does. Compare allocs/op and B/op between versions
+// to see how much garbage each exception leaves behind.
+func BenchmarkNewStdExceptionParallel(b *testing.B) {
+	b.ReportAllocs()
+	b.RunParallel(func(pb *testing.PB) {
+		for pb.Next() {
+			NewStdException("Test Message")
+		}
+	})
+}
+
+// End to end benchmarks: each iteration creates an exception, formats it, and writes it. They write to /dev/null
+// (to measure sherlog itself) and to tmpfs (to include the cost of the write and fsync without a disk). Compare
+// them against BenchmarkStdlibLog, and against zap and zerolog with the benchmarks module (see
+// benchmarks/doc.go).
+
+func benchmarkDevNullFileLogger(b *testing.B) *FileLogger {
+	logger, err := NewFileLogger(os.DevNull)
+	if err != nil {
+		b.Fatal(err)
+	}
+	logger.skipSync = true // /dev/null can't be synced
+	return logger
+}
+
+/*
+benchmarkTmpfsDir returns a directory on tmpfs if there is one, so that file benchmarks don't measure the disk.
+*/
+func benchmarkTmpfsDir(b *testing.B) string {
+	parent := ""
+	if info, err := os.Stat("/dev/shm"); err == nil && info.IsDir() {
+		parent = "/dev/shm"
+	}
+	dir, err := ioutil.TempDir(parent, "sherlog_bench")
+	if err != nil {
+		b.Fatal(err)
+	}
+	return dir
+}
+
+func benchmarkLogger(b *testing.B, logger Logger) {
+	defer logger.Close()
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if err := logger.Error("benchmark message"); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkStdlibLog(b *testing.B) {
+	devNull, err := os.OpenFile(os.DevNull, os.O_WRONLY, 0)
+	if err != nil {
+		b.Fatal(err)
+	}
+	defer devNull.Close()
+	logger := log.New(devNull, "", log.LstdFlags)
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		logger.Println(NewError("benchmark message"))
+	}
+}
+
+func BenchmarkFileLoggerDevNull(b *testing.B) {
+	benchmarkLogger(b, benchmarkDevNullFileLogger(b))
+}
+
+func BenchmarkFileLoggerJsonDevNull(b *testing.B) {
+	logger := benchmarkDevNullFileLogger(b)
+	defer logger.Close()
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if err := logger.LogJson(NewError("benchmark message")); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkFileLoggerNoStackDevNull(b *testing.B) {
+	logger := benchmarkDevNullFileLogger(b)
+	defer logger.Close()
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if err := logger.LogNoStack(NewError("benchmark message")); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkK8sLoggerDevNull(b *testing.B) {
+	devNull, err := os.OpenFile(os.DevNull, os.O_WRONLY, 0)
+	if err != nil {
+		b.Fatal(err)
+	}
+	benchmarkLogger(b, newK8sLogger(devNull))
+}
+
+func BenchmarkPolyLoggerDevNull(b *testing.B) {
+	benchmarkLogger(b, NewPolyLogger([]Logger{benchmarkDevNullFileLogger(b), benchmarkDevNullFileLogger(b)}))
+}
+
+func BenchmarkFileLoggerTmpfs(b *testing.B) {
+	dir := benchmarkTmpfsDir(b)
+	defer os.RemoveAll(dir)
+	logger, err := NewFileLogger(filepath.Join(dir, "bench.log"))
+	if err != nil {
+		b.Fatal(err)
+	}
+	benchmarkLogger(b, logger)
+}
+
+func BenchmarkRollingFileLoggerTmpfs(b *testing.B) {
+	dir := benchmarkTmpfsDir(b)
+	defer os.RemoveAll(dir)
+	logger, err := NewRollingFileLoggerWithSizeLimit(filepath.Join(dir, "bench.log"), 10000)
+	if err != nil {
+		b.Fatal(err)
+	}
+	benchmarkLogger(b, logger)
+}
+
+func BenchmarkJournalLoggerTmpfs(b *testing.B) {
+	dir := benchmarkTmpfsDir(b)
+	defer os.RemoveAll(dir)
+	logger, err := NewJournalLogger(dir, 0)
+	if err != nil {
+		b.Fatal(err)
+	}
+	benchmarkLogger(b, logger)
+}
@@ -0,0 +1,11 @@
+//go:build !windows
+// +build !windows
+
+package sherlog
+
+/*
+longPath returns path unchanged. Only Windows limits the length of paths.
+*/
+func longPath(path string) string {
+	return path
+}
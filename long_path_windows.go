@@ -0,0 +1,26 @@
+//go:build windows
+// +build windows
+
+package sherlog
+
+import "path/filepath"
+
+/*
+maxShortPathLen is how long a path can get before Windows needs the \\?\ prefix to open it.
+*/
+const maxShortPathLen = 248
+
+/*
+longPath makes long relative paths absolute. Go's os package adds the \\?\ prefix that Windows needs for paths
+longer than MAX_PATH, but only to absolute paths.
+*/
+func longPath(path string) string {
+	if len(path) < maxShortPathLen || filepath.IsAbs(path) {
+		return path
+	}
+	absPath, err := filepath.Abs(path)
+	if err != nil {
+		return path
+	}
+	return absPath
+}
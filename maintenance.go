@@ -0,0 +1,282 @@
+package sherlog
+
+import (
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// MaintenanceWindowField is the field that a MaintenanceSuppressor puts the name of the active window in.
+const MaintenanceWindowField = "maintenance_window"
+
+/*
+MaintenanceWindow is a recurring period during which some errors are expected, such as a nightly database restart.
+*/
+type MaintenanceWindow struct {
+	// Name is put in the maintenance_window field of the entries logged during the window. Defaults to Schedule.
+	Name string
+
+	// Schedule is when the window starts, as a cron expression with five fields: minute, hour, day of the month,
+	// month, and day of the week (0 or 7 is Sunday). Each field is *, a number, a range (1-5), a list (1,15), or
+	// any of those with a step (*/15). "0 3 * * 0" starts at 3:00 every Sunday. Times are in Location.
+	Schedule string
+
+	// Duration is how long the window lasts once it starts.
+	Duration time.Duration
+
+	// Expected limits the window to the entries that match at least one of the rules. If it is empty, every entry
+	// is expected.
+	Expected []FilterRule
+
+	// DowngradeTo is the level that expected entries more severe than it are logged at. If it is nil, entries
+	// keep their level and are only tagged.
+	DowngradeTo Level
+}
+
+/*
+MaintenanceSuppressor is a Middleware that downgrades or tags the errors that are expected during maintenance
+windows, so that on-call isn't paged for planned work while the entries are still recorded:
+
+	suppressor, err := sherlog.NewMaintenanceSuppressor(sherlog.MaintenanceWindow{
+		Name:        "postgres restart",
+		Schedule:    "0 3 * * 0",
+		Duration:    30 * time.Minute,
+		Expected:    []sherlog.FilterRule{{PackagePrefix: "github.com/lib/pq"}},
+		DowngradeTo: sherlog.EnumWarning,
+	})
+	logger.Use(suppressor.Suppress)
+
+Expected entries get the name of the window in the maintenance_window field. The first active window that expects
+an entry decides what happens to it. Entries are copied before they are changed, so the caller's exception is left
+alone. Only sherlog exceptions can be tagged. When Log is given multiple errors, only the first one is looked at.
+Is thread safe :)
+*/
+type MaintenanceSuppressor struct {
+	windows     []MaintenanceWindow
+	schedules   []*cronSchedule
+	checkedAt   time.Time   // The minute that activeUntil was worked out for
+	activeUntil []time.Time // When the current occurrence of each window ends, or the zero time if it isn't active
+	mutex       *sync.Mutex
+}
+
+/*
+NewMaintenanceSuppressor returns a new MaintenanceSuppressor for windows. Returns an error if a Schedule can't be
+parsed.
+*/
+func NewMaintenanceSuppressor(windows ...MaintenanceWindow) (*MaintenanceSuppressor, error) {
+	windows = append([]MaintenanceWindow(nil), windows...)
+	schedules := make([]*cronSchedule, len(windows))
+	for i := range windows {
+		schedule, err := parseCronSchedule(windows[i].Schedule)
+		if err != nil {
+			return nil, err
+		}
+		schedules[i] = schedule
+		if windows[i].Name == "" {
+			windows[i].Name = windows[i].Schedule
+		}
+	}
+	return &MaintenanceSuppressor{
+		windows:     windows,
+		schedules:   schedules,
+		activeUntil: make([]time.Time, len(windows)),
+		mutex:       new(sync.Mutex),
+	}, nil
+}
+
+/*
+Suppress is the Middleware. Pass it to Use.
+*/
+func (ms *MaintenanceSuppressor) Suppress(next LogFunc) LogFunc {
+	return func(values ...interface{}) error {
+		if len(values) > 0 {
+			if err, isErr := values[0].(error); isErr {
+				if suppressed := ms.suppress(err); suppressed != err {
+					values = append([]interface{}{suppressed}, values[1:]...)
+				}
+			}
+		}
+		return next(values...)
+	}
+}
+
+/*
+Active returns the names of the windows that are active right now.
+*/
+func (ms *MaintenanceSuppressor) Active() []string {
+	var names []string
+	for _, i := range ms.activeWindows() {
+		names = append(names, ms.windows[i].Name)
+	}
+	return names
+}
+
+/*
+activeWindows returns the indexes of the windows that are active right now. Which windows are active is only worked
+out again once a minute, since that's as often as a window can start.
+*/
+func (ms *MaintenanceSuppressor) activeWindows() []int {
+	now := Clock()
+	ms.mutex.Lock()
+	defer ms.mutex.Unlock()
+	if minute := now.Truncate(time.Minute); !minute.Equal(ms.checkedAt) {
+		ms.checkedAt = minute
+		for i, window := range ms.windows {
+			ms.activeUntil[i] = time.Time{}
+			if start, found := ms.schedules[i].latestStart(now, window.Duration); found {
+				ms.activeUntil[i] = start.Add(window.Duration)
+			}
+		}
+	}
+	var active []int
+	for i, until := range ms.activeUntil {
+		if now.Before(until) {
+			active = append(active, i)
+		}
+	}
+	return active
+}
+
+/*
+suppress returns a downgraded or tagged copy of err if an active window expects it, or err as is otherwise.
+*/
+func (ms *MaintenanceSuppressor) suppress(err error) error {
+	active := ms.activeWindows()
+	if len(active) == 0 || stdExceptionOf(err) == nil {
+		return err
+	}
+	entry := NewEntry(err)
+	for _, i := range active {
+		window := ms.windows[i]
+		if len(window.Expected) > 0 && !anyRuleMatches(window.Expected, entry) {
+			continue
+		}
+		var suppressed error
+		switch exception := err.(type) {
+		case *LeveledException:
+			level := exception.GetLevel()
+			if window.DowngradeTo != nil && (level == nil || level.GetLevelId() < window.DowngradeTo.GetLevelId()) {
+				level = window.DowngradeTo
+			}
+			suppressed = exception.WithLevel(level)
+		case *StdException:
+			suppressed = exception.Clone()
+		default:
+			return err
+		}
+		return WithField(suppressed, MaintenanceWindowField, window.Name)
+	}
+	return err
+}
+
+/*
+cronSchedule is a parsed cron expression. Each field is a bit set of the values it allows.
+*/
+type cronSchedule struct {
+	minutes, hours, daysOfMonth, months, daysOfWeek uint64
+	anyDayOfMonth, anyDayOfWeek                     bool
+}
+
+/*
+parseCronSchedule parses a cron expression with five fields (see MaintenanceWindow.Schedule).
+*/
+func parseCronSchedule(spec string) (*cronSchedule, error) {
+	fields := strings.Fields(spec)
+	if len(fields) != 5 {
+		return nil, AsError("cron schedule ", strconv.Quote(spec), " must have 5 fields")
+	}
+	bounds := [5][2]int{{0, 59}, {0, 23}, {1, 31}, {1, 12}, {0, 7}}
+	var sets [5]uint64
+	for i, field := range fields {
+		set, valid := parseCronField(field, bounds[i][0], bounds[i][1])
+		if !valid {
+			return nil, AsError("cron schedule ", strconv.Quote(spec), " has an invalid field: ", strconv.Quote(field))
+		}
+		sets[i] = set
+	}
+	if sets[4]&(1<<7) != 0 {
+		sets[4] |= 1 // 7 is Sunday too
+	}
+	return &cronSchedule{
+		minutes:       sets[0],
+		hours:         sets[1],
+		daysOfMonth:   sets[2],
+		months:        sets[3],
+		daysOfWeek:    sets[4],
+		anyDayOfMonth: strings.HasPrefix(fields[2], "*"),
+		anyDayOfWeek:  strings.HasPrefix(fields[4], "*"),
+	}, nil
+}
+
+/*
+parseCronField returns the bit set of the values from min to max that field allows. Returns false if field is
+invalid or out of range.
+*/
+func parseCronField(field string, min, max int) (uint64, bool) {
+	var set uint64
+	for _, part := range strings.Split(field, ",") {
+		step := 1
+		if slash := strings.Index(part, "/"); slash >= 0 {
+			var err error
+			if step, err = strconv.Atoi(part[slash+1:]); err != nil || step < 1 {
+				return 0, false
+			}
+			part = part[:slash]
+		}
+		low, high := min, max
+		if part != "*" {
+			bounds := strings.SplitN(part, "-", 2)
+			var err error
+			if low, err = strconv.Atoi(bounds[0]); err != nil {
+				return 0, false
+			}
+			high = low
+			if len(bounds) == 2 {
+				if high, err = strconv.Atoi(bounds[1]); err != nil {
+					return 0, false
+				}
+			} else if step > 1 {
+				high = max // Like cron, "5/15" means every 15 starting at 5
+			}
+		}
+		if low < min || high > max || low > high {
+			return 0, false
+		}
+		for value := low; value <= high; value += step {
+			set |= 1 << uint(value)
+		}
+	}
+	return set, true
+}
+
+/*
+matches returns true if the schedule fires at the minute of t. Like cron, when both the day of the month and the
+day of the week are restricted, either one matching is enough.
+*/
+func (cs *cronSchedule) matches(t time.Time) bool {
+	if cs.minutes&(1<<uint(t.Minute())) == 0 || cs.hours&(1<<uint(t.Hour())) == 0 || cs.months&(1<<uint(t.Month())) == 0 {
+		return false
+	}
+	dayOfMonth := cs.daysOfMonth&(1<<uint(t.Day())) != 0
+	dayOfWeek := cs.daysOfWeek&(1<<uint(t.Weekday())) != 0
+	if cs.anyDayOfMonth || cs.anyDayOfWeek {
+		return dayOfMonth && dayOfWeek
+	}
+	return dayOfMonth || dayOfWeek
+}
+
+/*
+latestStart returns the latest time at or before now, and less than within before it, that the schedule fired.
+*/
+func (cs *cronSchedule) latestStart(now time.Time, within time.Duration) (time.Time, bool) {
+	now = now.In(Location)
+	earliest := now.Add(-within)
+	start := time.Date(now.Year(), now.Month(), now.Day(), now.Hour(), now.Minute(), 0, 0, now.Location())
+	for ; start.After(earliest); start = start.Add(-time.Minute) {
+		if cs.matches(start) {
+			return start, true
+		}
+	}
+	return time.Time{}, false
+}
@@ -0,0 +1,154 @@
+package sherlog
+
+import "fmt"
+
+/*
+LogFunc logs values. It is what a Middleware wraps.
+*/
+type LogFunc func(values ...interface{}) error
+
+/*
+Middleware wraps the LogFunc of a logger so that cross-cutting concerns (redaction, enrichment, metrics, sampling)
+can be composed as a pipeline. A Middleware can change values before passing them on to next, do something after
+next returns, or drop the entry by returning without calling next:
+
+	logger.Use(func(next sherlog.LogFunc) sherlog.LogFunc {
+		return func(values ...interface{}) error {
+			stamped := make([]interface{}, len(values))
+			for i, value := range values {
+				if err, isErr := value.(error); isErr {
+					value = sherlog.WithCorrelationID(err, requestID) // A copy, since the caller's exception is shared
+				}
+				stamped[i] = value
+			}
+			return next(stamped...)
+		}
+	})
+
+Middleware runs for Log, LogNoStack, and LogJson (and the leveled functions, since they call Log). LogNoStack
+and LogJson pass a single error and only log the first value that comes out of the pipeline.
+*/
+type Middleware func(next LogFunc) LogFunc
+
+/*
+middlewareChain is embedded in loggers to give them a Use function.
+*/
+type middlewareChain struct {
+	middlewares  []Middleware
+	onWriteError func(entry error, writeErr error) error
+}
+
+/*
+Use adds middlewares to the end of the logger's pipeline. The first Middleware added is the first one to see
+each entry. Not thread safe, so call it while setting up the logger.
+*/
+func (mc *middlewareChain) Use(middlewares ...Middleware) {
+	mc.middlewares = append(mc.middlewares, middlewares...)
+}
+
+/*
+SetOnWriteError sets a handler that is called whenever the logger fails to write an entry, with the entry (the
+first value that was being logged, as an error) and the error that writing it returned. Whatever the handler
+returns is returned by the log function instead, so it can recover and return nil, or add context to the error:
+
+	fileLogger.SetOnWriteError(func(entry error, writeErr error) error {
+		if sherlog.Is(writeErr, sherlog.ErrLoggerClosed) {
+			return backupLogger.Log(entry)
+		}
+		return writeErr
+	})
+
+Pass nil to remove the handler, which is the default. Not thread safe, so call it while setting up the logger.
+*/
+func (mc *middlewareChain) SetOnWriteError(handler func(entry error, writeErr error) error) {
+	mc.onWriteError = handler
+}
+
+/*
+handleWriteError gives writeErr to the OnWriteError handler if there is one.
+*/
+func (mc *middlewareChain) handleWriteError(values []interface{}, writeErr error) error {
+	if writeErr == nil || mc.onWriteError == nil {
+		return writeErr
+	}
+	return mc.onWriteError(firstError(values), writeErr)
+}
+
+/*
+through runs values through the middleware and then final. nil values are dropped first, and if that leaves
+nothing to log, nothing is logged and nil is returned.
+*/
+func (mc *middlewareChain) through(final LogFunc, values []interface{}) error {
+	if len(values) > 0 {
+		values = withoutNils(values)
+		if len(values) == 0 {
+			return nil
+		}
+	}
+	stampSequenceNumbers(values)
+	markShared(values)
+	logFunc := final
+	for i := len(mc.middlewares) - 1; i >= 0; i-- {
+		logFunc = mc.middlewares[i](logFunc)
+	}
+	return mc.handleWriteError(values, logFunc(values...))
+}
+
+/*
+throughWithError runs errToLog through the middleware and then gives the first value that comes out to final.
+Nothing is logged if errToLog is nil.
+*/
+func (mc *middlewareChain) throughWithError(final func(errToLog error) error, errToLog error) error {
+	if isNil(errToLog) {
+		return nil
+	}
+	if len(mc.middlewares) == 0 {
+		stampSequenceNumbers([]interface{}{errToLog})
+		markShared([]interface{}{errToLog})
+		return mc.handleWriteError([]interface{}{errToLog}, final(errToLog))
+	}
+	return mc.through(func(values ...interface{}) error {
+		if len(values) == 0 {
+			return nil
+		}
+		if err, isErr := values[0].(error); isErr || values[0] == nil {
+			return final(err)
+		}
+		return final(fmt.Errorf("%v", values[0]))
+	}, []interface{}{errToLog})
+}
+
+/*
+isNil returns true if value is nil or a nil sherlog exception. Logging nil is a no-op, since the pattern of
+logging whatever a function returned makes it easy to do by accident.
+*/
+func isNil(value interface{}) bool {
+	switch impl := value.(type) {
+	case nil:
+		return true
+	case *LeveledException:
+		return impl == nil
+	case *StdException:
+		return impl == nil
+	}
+	return false
+}
+
+/*
+withoutNils returns values without the ones that are nil (see isNil).
+*/
+func withoutNils(values []interface{}) []interface{} {
+	for i, value := range values {
+		if !isNil(value) {
+			continue
+		}
+		withoutNils := append([]interface{}{}, values[:i]...)
+		for _, value := range values[i+1:] {
+			if !isNil(value) {
+				withoutNils = append(withoutNils, value)
+			}
+		}
+		return withoutNils
+	}
+	return values
+}
@@ -0,0 +1,140 @@
+package sherlog
+
+import (
+	"io"
+	"net"
+	"sync"
+	"time"
+)
+
+const (
+	mqttConnect    = 0x10
+	mqttConnack    = 0x20
+	mqttPublish    = 0x30
+	mqttDisconnect = 0xe0
+)
+
+/*
+MQTTPublisher is a minimal MQTT 3.1.1 client that can only publish with QoS 0. It speaks the MQTT protocol
+directly so that sherlog doesn't depend on an MQTT client library. Keep alive is turned off, so the broker never
+disconnects an idle publisher. Reconnects once if a publish fails. Is thread safe :)
+*/
+type MQTTPublisher struct {
+	networkTimeouts
+	address  string
+	clientID string
+	conn     net.Conn
+	mutex    *sync.Mutex
+}
+
+/*
+NewMQTTPublisher connects to the MQTT broker at address (host:port) as clientID.
+*/
+func NewMQTTPublisher(address, clientID string) (*MQTTPublisher, error) {
+	mp := &MQTTPublisher{
+		address:  address,
+		clientID: clientID,
+		mutex:    new(sync.Mutex),
+	}
+	if err := mp.connect(); err != nil {
+		return nil, err
+	}
+	return mp, nil
+}
+
+/*
+connect dials the broker, sends CONNECT, and waits for CONNACK. The mutex must be held (or the publisher not
+shared yet).
+*/
+func (mp *MQTTPublisher) connect() error {
+	conn, err := net.DialTimeout("tcp", mp.address, brokerDialTimeout)
+	if err != nil {
+		return AsError(err)
+	}
+
+	var body []byte
+	body = appendMQTTString(body, "MQTT")
+	body = append(body, 4)    // Protocol level 3.1.1
+	body = append(body, 0x02) // Clean session
+	body = append(body, 0, 0) // Keep alive off
+	body = appendMQTTString(body, mp.clientID)
+	if _, err = conn.Write(mqttPacket(mqttConnect, body)); err != nil {
+		conn.Close()
+		return AsError(err)
+	}
+
+	connack := make([]byte, 4)
+	conn.SetReadDeadline(time.Now().Add(brokerDialTimeout))
+	if _, err = io.ReadFull(conn, connack); err != nil {
+		conn.Close()
+		return AsError(err)
+	}
+	conn.SetReadDeadline(time.Time{})
+	if connack[0] != mqttConnack || connack[3] != 0 {
+		conn.Close()
+		return AsError("MQTT broker refused the connection with return code ", connack[3])
+	}
+	mp.conn = conn
+	return nil
+}
+
+/*
+Publish publishes payload to topic with QoS 0.
+*/
+func (mp *MQTTPublisher) Publish(topic string, payload []byte) error {
+	body := appendMQTTString(make([]byte, 0, len(topic)+len(payload)+2), topic)
+	body = append(body, payload...)
+	packet := mqttPacket(mqttPublish, body)
+	return mp.withRetries(func() error {
+		deadline, err := mp.sendDeadline()
+		if err != nil {
+			return err
+		}
+		mp.mutex.Lock()
+		defer mp.mutex.Unlock()
+		return writeWithReconnect(mp.ctx, &mp.conn, mp.connect, packet, deadline)
+	})
+}
+
+/*
+Close sends DISCONNECT and closes the connection.
+*/
+func (mp *MQTTPublisher) Close() error {
+	mp.mutex.Lock()
+	defer mp.mutex.Unlock()
+	if mp.conn == nil {
+		return nil
+	}
+	mp.conn.Write([]byte{mqttDisconnect, 0})
+	err := mp.conn.Close()
+	mp.conn = nil
+	return err
+}
+
+/*
+mqttPacket returns a packet of packetType with body, prefixed with the remaining length.
+*/
+func mqttPacket(packetType byte, body []byte) []byte {
+	packet := []byte{packetType}
+	remaining := len(body)
+	for {
+		encoded := byte(remaining % 128)
+		remaining /= 128
+		if remaining > 0 {
+			encoded |= 0x80
+		}
+		packet = append(packet, encoded)
+		if remaining == 0 {
+			break
+		}
+	}
+	return append(packet, body...)
+}
+
+/*
+appendMQTTString appends str prefixed with its 2 byte length.
+*/
+func appendMQTTString(buf []byte, str string) []byte {
+	buf = append(buf, byte(len(str)>>8), byte(len(str)))
+	return append(buf, str...)
+}
@@ -0,0 +1,129 @@
+package sherlog
+
+import "math"
+
+/*
+MsgpackFormatter is a Formatter that writes entries as MessagePack. The entries hold the same keys as the
+json written by JsonFormatter, but are about 40% smaller. Entries are self-delimiting, so nothing is written
+between them. Use parser.MsgpackDecoder to read them back.
+*/
+type MsgpackFormatter struct {
+	IncludeStackString bool
+	Transformers       []JsonTransformer
+}
+
+/*
+NewMsgpackFormatter returns a new MsgpackFormatter.
+*/
+func NewMsgpackFormatter() *MsgpackFormatter {
+	return &MsgpackFormatter{}
+}
+
+/*
+Format turns entry into MessagePack.
+*/
+func (mf *MsgpackFormatter) Format(entry *Entry) ([]byte, error) {
+	return formatBinary(msgpackEncoder{}, entry, mf.IncludeStackString, mf.Transformers), nil
+}
+
+/*
+Separator returns nil since MessagePack values are self-delimiting.
+*/
+func (mf *MsgpackFormatter) Separator() []byte {
+	return nil
+}
+
+type msgpackEncoder struct{}
+
+func (msgpackEncoder) appendNil(buf []byte) []byte {
+	return append(buf, 0xc0)
+}
+
+func (msgpackEncoder) appendBool(buf []byte, val bool) []byte {
+	if val {
+		return append(buf, 0xc3)
+	}
+	return append(buf, 0xc2)
+}
+
+func (me msgpackEncoder) appendInt(buf []byte, val int64) []byte {
+	switch {
+	case val >= 0:
+		return me.appendUint(buf, uint64(val))
+	case val >= -32:
+		return append(buf, byte(val))
+	case val >= math.MinInt8:
+		return append(buf, 0xd0, byte(val))
+	case val >= math.MinInt16:
+		return appendUint16BE(append(buf, 0xd1), uint16(val))
+	case val >= math.MinInt32:
+		return appendUint32BE(append(buf, 0xd2), uint32(val))
+	}
+	return appendUint64BE(append(buf, 0xd3), uint64(val))
+}
+
+func (msgpackEncoder) appendUint(buf []byte, val uint64) []byte {
+	switch {
+	case val <= 0x7f:
+		return append(buf, byte(val))
+	case val <= math.MaxUint8:
+		return append(buf, 0xcc, byte(val))
+	case val <= math.MaxUint16:
+		return appendUint16BE(append(buf, 0xcd), uint16(val))
+	case val <= math.MaxUint32:
+		return appendUint32BE(append(buf, 0xce), uint32(val))
+	}
+	return appendUint64BE(append(buf, 0xcf), val)
+}
+
+func (msgpackEncoder) appendFloat(buf []byte, val float64) []byte {
+	return appendUint64BE(append(buf, 0xcb), math.Float64bits(val))
+}
+
+func (msgpackEncoder) appendString(buf []byte, val string) []byte {
+	length := len(val)
+	switch {
+	case length < 32:
+		buf = append(buf, 0xa0|byte(length))
+	case length <= math.MaxUint8:
+		buf = append(buf, 0xd9, byte(length))
+	case length <= math.MaxUint16:
+		buf = appendUint16BE(append(buf, 0xda), uint16(length))
+	default:
+		buf = appendUint32BE(append(buf, 0xdb), uint32(length))
+	}
+	return append(buf, val...)
+}
+
+func (msgpackEncoder) appendBytes(buf []byte, val []byte) []byte {
+	length := len(val)
+	switch {
+	case length <= math.MaxUint8:
+		buf = append(buf, 0xc4, byte(length))
+	case length <= math.MaxUint16:
+		buf = appendUint16BE(append(buf, 0xc5), uint16(length))
+	default:
+		buf = appendUint32BE(append(buf, 0xc6), uint32(length))
+	}
+	return append(buf, val...)
+}
+
+func (msgpackEncoder) appendArrayHeader(buf []byte, length int) []byte {
+	switch {
+	case length < 16:
+		return append(buf, 0x90|byte(length))
+	case length <= math.MaxUint16:
+		return appendUint16BE(append(buf, 0xdc), uint16(length))
+	}
+	return appendUint32BE(append(buf, 0xdd), uint32(length))
+}
+
+func (msgpackEncoder) appendMapHeader(buf []byte, length int) []byte {
+	switch {
+	case length < 16:
+		return append(buf, 0x80|byte(length))
+	case length <= math.MaxUint16:
+		return appendUint16BE(append(buf, 0xde), uint16(length))
+	}
+	return appendUint32BE(append(buf, 0xdf), uint32(length))
+}
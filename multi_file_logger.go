@@ -1,6 +1,10 @@
 package sherlog
 
-import "time"
+import (
+	"fmt"
+	"reflect"
+	"time"
+)
 
 /*
 LeveledLoggable is a Loggable that also has a log level attached to it.
@@ -17,8 +21,10 @@ log levels, then they will be logged to that same file with no problems.
 Is thread safe :)
 */
 type MultiFileLogger struct {
+	callerSkipper
+	middlewareChain
 	loggers       map[Level]Logger
-	defaultLogger *FileLogger // If a Loggable without a log level is provided, this is the logger that will be used
+	defaultLogger Logger // If a Loggable without a log level is provided, this is the logger that will be used
 }
 
 /*
@@ -95,6 +101,38 @@ func NewMultiFileLogger(paths map[Level]string, defaultLogPath string) (*MultiFi
 	}, nil
 }
 
+/*
+NewMultiFileLoggerFromLoggers returns a new MultiFileLogger that uses loggers that you have already created, so each
+level can use a different kind of logger. For example, a size based rolling file for ERROR, a ConsoleLogger for
+DEBUG, and a plain FileLogger for everything else:
+
+	errorLogger, _ := sherlog.NewRollingFileLoggerWithSizeLimit("errors.log", 10000)
+	defaultLogger, _ := sherlog.NewFileLogger("default.log")
+	logger, err := sherlog.NewMultiFileLoggerFromLoggers(map[sherlog.Level]sherlog.Logger{
+		sherlog.EnumError: errorLogger,
+		sherlog.EnumDebug: sherlog.NewConsoleLogger(),
+	}, defaultLogger)
+
+defaultLogger is used for levels that are not in loggers and for errors without a level. Giving several levels the
+same logger is fine. Close closes every logger. Returns an error if any of the loggers are nil.
+*/
+func NewMultiFileLoggerFromLoggers(loggers map[Level]Logger, defaultLogger Logger) (*MultiFileLogger, error) {
+	if defaultLogger == nil {
+		return nil, NewLeveledException("defaultLogger must not be nil", EnumError)
+	}
+	loggersCopy := make(map[Level]Logger, len(loggers))
+	for level, logger := range loggers {
+		if logger == nil {
+			return nil, NewLeveledException("logger for "+level.GetLabel()+" must not be nil", EnumError)
+		}
+		loggersCopy[level] = logger
+	}
+	return &MultiFileLogger{
+		loggers:       loggersCopy,
+		defaultLogger: defaultLogger,
+	}, nil
+}
+
 // Creates loggers for the various levels. Any levels that share the same path will use the same logger.
 func createRobustLoggers(paths map[Level]string, loggerConstructor func(path string) (Logger, error)) (loggers map[Level]Logger, err error) {
 	loggers = map[Level]Logger{}
@@ -149,6 +187,37 @@ func createFileLoggers(paths map[Level]string) (map[Level]Logger, error) {
 
 // *************************************************************************************************************************
 
+/*
+FormatterGetter is implemented by loggers that can report the formatter they were given with SetFormatter, such
+as FileLogger and MultiWriterLogger.
+*/
+type FormatterGetter interface {
+	GetFormatter() Formatter
+}
+
+/*
+destinationFor returns the logger for the level of errToLog, or the default logger if it doesn't have a level or
+there is no logger for its level.
+*/
+func (mfl *MultiFileLogger) destinationFor(errToLog error) Logger {
+	if leveledLoggable, isLeveled := errToLog.(LeveledLoggable); isLeveled {
+		if logger := mfl.loggers[leveledLoggable.GetLevel()]; logger != nil {
+			return logger
+		}
+	}
+	return mfl.defaultLogger
+}
+
+/*
+hasFormatter returns whether logger writes every entry with a formatter (see SetFormatters). LogNoStack and
+LogJson bypass the formatter of such loggers, so they are given entries with Log instead, which keeps everything
+in their file in the same format.
+*/
+func hasFormatter(logger Logger) bool {
+	formatterGetter, ok := logger.(FormatterGetter)
+	return ok && formatterGetter.GetFormatter() != nil
+}
+
 /*
 Log logs the error.
 If not a sherlog error, will just be logged with a timestamp and message.
@@ -156,63 +225,184 @@ If not a sherlog error, will just be logged with a timestamp and message.
 Is thread safe :)
 */
 func (mfl *MultiFileLogger) Log(errToLog error) error {
+	return mfl.throughWithError(mfl.logError, errToLog)
+}
+
+func (mfl *MultiFileLogger) logError(errToLog error) error {
 	if errToLog == nil {
 		return AsError("tried to log nil error")
 	}
-	if leveledLoggable, isLeveled := errToLog.(LeveledLoggable); isLeveled {
-		logger := mfl.loggers[leveledLoggable.GetLevel()]
-		if logger != nil {
-			return logger.Log(errToLog)
-		}
-	}
-	return mfl.defaultLogger.Log(errToLog)
+	return mfl.destinationFor(errToLog).Log(errToLog)
 }
 
 /*
-LogNoStack logs the error without the stack trace.
+LogNoStack logs the error without the stack trace. Loggers that were given a formatter (see SetFormatters) get it
+with Log instead, since their formatter decides whether stack traces are written.
 
 Is thread safe :)
 */
 func (mfl *MultiFileLogger) LogNoStack(errToLog error) error {
+	return mfl.throughWithError(mfl.logNoStack, errToLog)
+}
+
+func (mfl *MultiFileLogger) logNoStack(errToLog error) error {
 	if errToLog == nil {
 		return AsError("tried to log nil error")
 	}
-	if leveledLoggable, isLeveled := errToLog.(LeveledLoggable); isLeveled {
-		logger := mfl.loggers[leveledLoggable.GetLevel()]
-		if logger != nil {
-			return logger.LogNoStack(errToLog)
-		}
+	logger := mfl.destinationFor(errToLog)
+	if hasFormatter(logger) {
+		return logger.Log(errToLog)
 	}
-	return mfl.defaultLogger.LogNoStack(errToLog)
+	return logger.LogNoStack(errToLog)
 }
 
 /*
 LogJson logs the error as a json blob.
-If not a sherlog error, will just include message.
+If not a sherlog error, will just include message. Loggers that were given a formatter (see SetFormatters) get it
+with Log instead, since their formatter decides the format.
 
 Is thread safe :)
 */
 func (mfl *MultiFileLogger) LogJson(errToLog error) error {
+	return mfl.throughWithError(mfl.logJson, errToLog)
+}
+
+func (mfl *MultiFileLogger) logJson(errToLog error) error {
 	if errToLog == nil {
 		return AsError("tried to log nil error")
 	}
-	if leveledLoggable, isLeveled := errToLog.(LeveledLoggable); isLeveled {
-		logger := mfl.loggers[leveledLoggable.GetLevel()]
-		if logger != nil {
-			return logger.LogJson(errToLog)
-		}
+	logger := mfl.destinationFor(errToLog)
+	if hasFormatter(logger) {
+		return logger.Log(errToLog)
 	}
-	return mfl.defaultLogger.LogJson(errToLog)
+	return logger.LogJson(errToLog)
 }
 
 /*
-Close closes all loggers.
+Close closes all loggers. Loggers shared by several levels are only closed once.
 */
 func (mfl *MultiFileLogger) Close() {
-	for _, logger := range mfl.loggers {
+	for _, logger := range mfl.levelLoggers(mfl.defaultLogger) {
 		logger.Close()
 	}
-	mfl.defaultLogger.Close()
+}
+
+/*
+levelLoggers returns first followed by the loggers of the levels, with every logger only once. Loggers that can't
+be compared (see sameLogger) can't be told apart, so they are in it once per level.
+*/
+func (mfl *MultiFileLogger) levelLoggers(first ...Logger) []Logger {
+	distinct := first
+	for _, logger := range mfl.loggers {
+		if indexOfLogger(distinct, logger) < 0 {
+			distinct = append(distinct, logger)
+		}
+	}
+	return distinct
+}
+
+/*
+indexOfLogger returns the index of logger in loggers, or -1 if it isn't there.
+*/
+func indexOfLogger(loggers []Logger, logger Logger) int {
+	for i, existing := range loggers {
+		if sameLogger(existing, logger) {
+			return i
+		}
+	}
+	return -1
+}
+
+/*
+RollAll rolls every logger that is a Roller, so that all of them start new files at the same time. Loggers
+shared by several levels are only rolled once. Every logger is rolled even if one of them fails. Returns the
+first error.
+*/
+func (mfl *MultiFileLogger) RollAll() error {
+	var firstErr error
+	for _, logger := range mfl.levelLoggers() {
+		roller, isRoller := logger.(Roller)
+		if !isRoller {
+			continue
+		}
+		if err := roller.Roll(); err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+	return firstErr
+}
+
+/*
+FormatterSetter is implemented by loggers whose output format can be changed with SetFormatter, such as
+FileLogger and the rolling file loggers.
+*/
+type FormatterSetter interface {
+	SetFormatter(formatter Formatter)
+}
+
+/*
+SetFormatters sets the formatter of the logger of each level in formatters (see FileLogger.SetFormatter), so that
+every destination's format is configured in one place instead of by calling Log, LogNoStack, or LogJson. For
+example, DEBUG without stack traces and ERROR as json:
+
+	err := logger.SetFormatters(map[sherlog.Level]sherlog.Formatter{
+		sherlog.EnumDebug: &sherlog.ConsoleFormatter{Plain: true},
+		sherlog.EnumError: sherlog.NewJsonFormatter(),
+	})
+
+Levels that aren't in formatters keep their format. A logger shared by several levels gets the formatter for all
+of them, so giving such levels different formatters is an error. Nothing is changed if an error is returned,
+which also happens if a level has no logger of its own or its logger isn't a FormatterSetter. Call it before
+logging.
+*/
+func (mfl *MultiFileLogger) SetFormatters(formatters map[Level]Formatter) error {
+	var setters []Logger
+	var setterFormatters []Formatter
+	for level, formatter := range formatters {
+		logger := mfl.loggers[level]
+		if logger == nil {
+			return NewLeveledException("there is no logger for "+level.GetLabel(), EnumError)
+		}
+		if _, ok := logger.(FormatterSetter); !ok {
+			return NewLeveledException(fmt.Sprintf("the logger for %s (%T) can't be given a formatter", level.GetLabel(), logger), EnumError)
+		}
+		if i := indexOfLogger(setters, logger); i >= 0 {
+			if !sameFormatter(setterFormatters[i], formatter) {
+				return NewLeveledException("levels that share the logger of "+level.GetLabel()+" were given different formatters", EnumError)
+			}
+			continue
+		}
+		setters = append(setters, logger)
+		setterFormatters = append(setterFormatters, formatter)
+	}
+	for i, setter := range setters {
+		setter.(FormatterSetter).SetFormatter(setterFormatters[i])
+	}
+	return nil
+}
+
+/*
+sameFormatter returns whether a and b are the same formatter. Formatters that can't be compared, such as
+FormatterFuncs, are never the same.
+*/
+func sameFormatter(a, b Formatter) bool {
+	if a == nil || b == nil {
+		return a == b
+	}
+	return reflect.TypeOf(a) == reflect.TypeOf(b) && reflect.TypeOf(a).Comparable() && a == b
+}
+
+/*
+SetDefaultFormatter sets the formatter of the logger used for errors without a level and for levels without a
+logger of their own. Returns an error if that logger isn't a FormatterSetter. Call it before logging.
+*/
+func (mfl *MultiFileLogger) SetDefaultFormatter(formatter Formatter) error {
+	setter, ok := mfl.defaultLogger.(FormatterSetter)
+	if !ok {
+		return NewLeveledException(fmt.Sprintf("the default logger (%T) can't be given a formatter", mfl.defaultLogger), EnumError)
+	}
+	setter.SetFormatter(formatter)
+	return nil
 }
 
 /*
@@ -228,7 +418,7 @@ Critical turns values into a *LeveledException with level CRITICAL and then call
 Log function.
 */
 func (mfl *MultiFileLogger) Critical(values ...interface{}) error {
-	return mfl.Log(graduateOrConcatAndCreate(EnumCritical, values...))
+	return mfl.Log(mfl.graduate(EnumCritical, values...))
 }
 
 /*
@@ -236,7 +426,7 @@ Error turns values into a *LeveledException with level ERROR and then calls the
 Log function.
 */
 func (mfl *MultiFileLogger) Error(values ...interface{}) error {
-	return mfl.Log(graduateOrConcatAndCreate(EnumError, values...))
+	return mfl.Log(mfl.graduate(EnumError, values...))
 }
 
 /*
@@ -244,7 +434,7 @@ OpsError turns values into a *LeveledException with level OPS_ERROR and then cal
 Log function.
 */
 func (mfl *MultiFileLogger) OpsError(values ...interface{}) error {
-	return mfl.Log(graduateOrConcatAndCreate(EnumOpsError, values...))
+	return mfl.Log(mfl.graduate(EnumOpsError, values...))
 }
 
 /*
@@ -252,7 +442,7 @@ Warn turns values into a *LeveledException with level WARNING and then calls the
 Log function.
 */
 func (mfl *MultiFileLogger) Warn(values ...interface{}) error {
-	return mfl.Log(graduateOrConcatAndCreate(EnumWarning, values...))
+	return mfl.Log(mfl.graduate(EnumWarning, values...))
 }
 
 /*
@@ -260,7 +450,7 @@ Info turns values into a *LeveledException with level INFO and then calls the lo
 Log function.
 */
 func (mfl *MultiFileLogger) Info(values ...interface{}) error {
-	return mfl.Log(graduateOrConcatAndCreate(EnumInfo, values...))
+	return mfl.Log(mfl.graduate(EnumInfo, values...))
 }
 
 /*
@@ -268,5 +458,5 @@ Debug turns values into a *LeveledException with level DEBUG and then calls the
 Log function.
 */
 func (mfl *MultiFileLogger) Debug(values ...interface{}) error {
-	return mfl.Log(graduateOrConcatAndCreate(EnumDebug, values...))
+	return mfl.Log(mfl.graduate(EnumDebug, values...))
 }
@@ -0,0 +1,269 @@
+package sherlog
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"sync"
+)
+
+/*
+MultiWriterLogger formats each entry exactly once and then writes the bytes to several io.Writers. Use it instead of
+a PolyLogger when every destination uses the same format (such as a file plus stdout), since a PolyLogger makes
+every one of its loggers format the entry again:
+
+	file, _ := os.OpenFile("app.log", os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	logger := sherlog.NewMultiWriterLogger(file, os.Stdout)
+
+Every writer is written to even if one of them fails. Is thread safe :)
+*/
+type MultiWriterLogger struct {
+	callerSkipper
+	middlewareChain
+	writers   []io.Writer
+	formatter Formatter
+	closed    bool
+	mutex     *sync.Mutex
+}
+
+/*
+NewMultiWriterLogger returns a new MultiWriterLogger that writes to writers using the default format.
+*/
+func NewMultiWriterLogger(writers ...io.Writer) *MultiWriterLogger {
+	return &MultiWriterLogger{
+		writers: writers,
+		mutex:   new(sync.Mutex),
+	}
+}
+
+/*
+SetFormatter makes Log use formatter instead of the Loggable's Log function, like FileLogger.SetFormatter.
+Pass nil to go back to the default format.
+*/
+func (mwl *MultiWriterLogger) SetFormatter(formatter Formatter) {
+	mwl.formatter = formatter
+}
+
+/*
+GetFormatter returns the formatter set with SetFormatter, or nil if the default format is used.
+*/
+func (mwl *MultiWriterLogger) GetFormatter() Formatter {
+	return mwl.formatter
+}
+
+/*
+Log formats errorsToLog once and writes the result to every writer. Is thread safe :)
+Non-sherlog errors get logged with only timestamp and message
+*/
+func (mwl *MultiWriterLogger) Log(errorsToLog ...interface{}) error {
+	return mwl.through(mwl.logValues, errorsToLog)
+}
+
+func (mwl *MultiWriterLogger) logValues(errorsToLog ...interface{}) error {
+	if len(errorsToLog) < 1 {
+		return AsError("no parameters provided to Log")
+	}
+	var buf bytes.Buffer
+	if mwl.formatter == nil {
+		if err := writeValues(&buf, errorsToLog); err != nil {
+			return err
+		}
+		buf.WriteString("\n\n")
+		return mwl.write(buf.Bytes())
+	}
+	for _, errToLog := range errorsToLog {
+		if errToLog == nil {
+			return AsError("tried to log nil error")
+		}
+		entryBytes, err := mwl.formatter.Format(NewEntry(errToLog))
+		if err != nil {
+			return AsError(err)
+		}
+		buf.Write(entryBytes)
+		buf.Write(separatorFor(mwl.formatter))
+	}
+	return mwl.write(buf.Bytes())
+}
+
+/*
+writeValues writes errorsToLog to buf in the default text format, separated by "Caused by:" lines.
+*/
+func writeValues(buf *bytes.Buffer, errorsToLog []interface{}) error {
+	for i, errToLog := range errorsToLog {
+		if errToLog == nil {
+			return AsError("tried to log nil error")
+		}
+
+		var err error
+		switch impl := errToLog.(type) {
+		case Loggable:
+			err = impl.Log(buf)
+		case error:
+			err = writeNonSherlogError(buf, impl)
+		default:
+			buf.WriteString(sanitizeText(fmt.Sprintf("%v", impl), true))
+		}
+		if err != nil {
+			return AsError(err)
+		}
+		if i < len(errorsToLog)-1 {
+			buf.WriteString("\nCaused by:\n")
+		}
+	}
+	return nil
+}
+
+/*
+LogNoStack formats errToLog without the stack trace once and writes the result to every writer. Is thread safe :)
+Non-sherlog errors get logged with only timestamp and message
+*/
+func (mwl *MultiWriterLogger) LogNoStack(errToLog error) error {
+	return mwl.throughWithError(mwl.logNoStack, errToLog)
+}
+
+func (mwl *MultiWriterLogger) logNoStack(errToLog error) error {
+	if errToLog == nil {
+		return AsError("tried to log nil error")
+	}
+	var buf bytes.Buffer
+	var err error
+	if loggable, isLoggable := errToLog.(LoggableWithNoStackOption); isLoggable {
+		err = loggable.LogNoStack(&buf)
+	} else {
+		err = writeNonSherlogError(&buf, errToLog)
+	}
+	if err != nil {
+		return AsError(err)
+	}
+	buf.WriteString("\n\n")
+	return mwl.write(buf.Bytes())
+}
+
+/*
+LogJson formats errToLog as json once and writes the result to every writer. Is thread safe :)
+*/
+func (mwl *MultiWriterLogger) LogJson(errToLog error) error {
+	return mwl.throughWithError(mwl.logJson, errToLog)
+}
+
+func (mwl *MultiWriterLogger) logJson(errToLog error) error {
+	if errToLog == nil {
+		return AsError("tried to log nil error")
+	}
+	jsonMap := NewEntry(errToLog).ToJsonMap()
+	removeStackRepresentations(jsonMap, false, true)
+	jsonBytes, err := marshalJsonEntry(jsonMap, false)
+	if err != nil {
+		return AsError(err)
+	}
+	return mwl.write(append(jsonBytes, '\n'))
+}
+
+/*
+write writes entryBytes to every writer. Returns the first error.
+*/
+func (mwl *MultiWriterLogger) write(entryBytes []byte) error {
+	mwl.mutex.Lock()
+	defer mwl.mutex.Unlock()
+	if mwl.closed {
+		return loggerFailure(ErrLoggerClosed)
+	}
+	var firstErr error
+	for _, writer := range mwl.writers {
+		if _, err := writer.Write(entryBytes); err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+	return firstErr
+}
+
+/*
+Flush flushes every writer that buffers what is written to it (has a Flush() error function), such as a
+DirectFileWriter. Returns the first error.
+*/
+func (mwl *MultiWriterLogger) Flush() error {
+	mwl.mutex.Lock()
+	defer mwl.mutex.Unlock()
+	if mwl.closed {
+		return loggerFailure(ErrLoggerClosed)
+	}
+	var firstErr error
+	for _, writer := range mwl.writers {
+		if flusher, isFlusher := writer.(Flusher); isFlusher {
+			if err := flusher.Flush(); err != nil && firstErr == nil {
+				firstErr = err
+			}
+		}
+	}
+	return firstErr
+}
+
+/*
+Close closes every writer that is an io.Closer, except for stdout and stderr. Anything logged afterwards fails
+with ErrLoggerClosed. Calling Close again does nothing.
+*/
+func (mwl *MultiWriterLogger) Close() {
+	mwl.mutex.Lock()
+	defer mwl.mutex.Unlock()
+	if mwl.closed {
+		return
+	}
+	mwl.closed = true
+	for _, writer := range mwl.writers {
+		if writer == os.Stdout || writer == os.Stderr {
+			continue
+		}
+		if closer, isCloser := writer.(io.Closer); isCloser {
+			closer.Close()
+		}
+	}
+}
+
+/*
+Critical turns values into a *LeveledException with level CRITICAL and then calls the logger's
+Log function.
+*/
+func (mwl *MultiWriterLogger) Critical(values ...interface{}) error {
+	return mwl.Log(mwl.graduate(EnumCritical, values...))
+}
+
+/*
+Error turns values into a *LeveledException with level ERROR and then calls the logger's
+Log function.
+*/
+func (mwl *MultiWriterLogger) Error(values ...interface{}) error {
+	return mwl.Log(mwl.graduate(EnumError, values...))
+}
+
+/*
+OpsError turns values into a *LeveledException with level OPS_ERROR and then calls the logger's
+Log function.
+*/
+func (mwl *MultiWriterLogger) OpsError(values ...interface{}) error {
+	return mwl.Log(mwl.graduate(EnumOpsError, values...))
+}
+
+/*
+Warn turns values into a *LeveledException with level WARNING and then calls the logger's
+Log function.
+*/
+func (mwl *MultiWriterLogger) Warn(values ...interface{}) error {
+	return mwl.Log(mwl.graduate(EnumWarning, values...))
+}
+
+/*
+Info turns values into a *LeveledException with level INFO and then calls the logger's
+Log function.
+*/
+func (mwl *MultiWriterLogger) Info(values ...interface{}) error {
+	return mwl.Log(mwl.graduate(EnumInfo, values...))
+}
+
+/*
+Debug turns values into a *LeveledException with level DEBUG and then calls the logger's
+Log function.
+*/
+func (mwl *MultiWriterLogger) Debug(values ...interface{}) error {
+	return mwl.Log(mwl.graduate(EnumDebug, values...))
+}
@@ -0,0 +1,151 @@
+package sherlog
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const brokerDialTimeout = 5 * time.Second
+
+/*
+NATSPublisher is a minimal NATS client that can only publish. It speaks the NATS text protocol directly so that
+sherlog doesn't depend on the NATS client library, answers the server's pings, and reconnects once if a publish
+fails. Is thread safe :)
+*/
+type NATSPublisher struct {
+	networkTimeouts
+	address string
+	conn    net.Conn
+	mutex   *sync.Mutex
+}
+
+/*
+NewNATSPublisher connects to the NATS server at address (host:port).
+*/
+func NewNATSPublisher(address string) (*NATSPublisher, error) {
+	np := &NATSPublisher{
+		address: address,
+		mutex:   new(sync.Mutex),
+	}
+	if err := np.connect(); err != nil {
+		return nil, err
+	}
+	return np, nil
+}
+
+/*
+connect dials the server and sends CONNECT. The mutex must be held (or the publisher not shared yet).
+*/
+func (np *NATSPublisher) connect() error {
+	conn, err := net.DialTimeout("tcp", np.address, brokerDialTimeout)
+	if err != nil {
+		return AsError(err)
+	}
+	reader := bufio.NewReader(conn)
+	conn.SetReadDeadline(time.Now().Add(brokerDialTimeout))
+	info, err := reader.ReadString('\n')
+	if err != nil {
+		conn.Close()
+		return AsError(err)
+	}
+	if !strings.HasPrefix(info, "INFO ") {
+		conn.Close()
+		return AsError("expected INFO from NATS server, got: ", strings.TrimSpace(info))
+	}
+	conn.SetReadDeadline(time.Time{})
+	if _, err = conn.Write([]byte("CONNECT {\"verbose\":false,\"pedantic\":false,\"name\":\"sherlog\"}\r\n")); err != nil {
+		conn.Close()
+		return AsError(err)
+	}
+	np.conn = conn
+	go np.answerPings(conn, reader)
+	return nil
+}
+
+/*
+answerPings answers the PINGs the server sends to check that the client is alive. Returns when conn is closed.
+*/
+func (np *NATSPublisher) answerPings(conn net.Conn, reader *bufio.Reader) {
+	for {
+		line, err := reader.ReadString('\n')
+		if err != nil {
+			return
+		}
+		if strings.HasPrefix(line, "PING") {
+			np.mutex.Lock()
+			conn.Write([]byte("PONG\r\n"))
+			np.mutex.Unlock()
+		}
+	}
+}
+
+/*
+Publish publishes payload to subject.
+*/
+func (np *NATSPublisher) Publish(subject string, payload []byte) error {
+	message := make([]byte, 0, len(subject)+len(payload)+32)
+	message = append(message, "PUB "+subject+" "+strconv.Itoa(len(payload))+"\r\n"...)
+	message = append(message, payload...)
+	message = append(message, "\r\n"...)
+	return np.withRetries(func() error {
+		deadline, err := np.sendDeadline()
+		if err != nil {
+			return err
+		}
+		np.mutex.Lock()
+		defer np.mutex.Unlock()
+		return writeWithReconnect(np.ctx, &np.conn, np.connect, message, deadline)
+	})
+}
+
+/*
+Close closes the connection.
+*/
+func (np *NATSPublisher) Close() error {
+	np.mutex.Lock()
+	defer np.mutex.Unlock()
+	if np.conn == nil {
+		return nil
+	}
+	err := np.conn.Close()
+	np.conn = nil
+	return err
+}
+
+/*
+writeWithReconnect writes message to *conn. If that fails, it reconnects and tries once more. Both writes must
+finish by deadline, unless it is the zero time, and are interrupted if ctx (which may be nil) is done first.
+*/
+func writeWithReconnect(ctx context.Context, conn *net.Conn, connect func() error, message []byte, deadline time.Time) error {
+	if *conn != nil {
+		(*conn).SetWriteDeadline(deadline)
+		stop := interruptWhenDone(ctx, *conn)
+		_, err := (*conn).Write(message)
+		stop()
+		if err == nil {
+			return nil
+		}
+		if ctx != nil && ctx.Err() != nil {
+			return loggerFailure(ErrDestinationUnavailable, ctx.Err())
+		}
+		diagnose(NewInfo(fmt.Sprintf("reconnecting to %v after: %v", (*conn).RemoteAddr(), err)))
+		(*conn).Close()
+		*conn = nil
+	}
+	if err := connect(); err != nil {
+		return loggerFailure(ErrDestinationUnavailable, err)
+	}
+	(*conn).SetWriteDeadline(deadline)
+	stop := interruptWhenDone(ctx, *conn)
+	defer stop()
+	if _, err := (*conn).Write(message); err != nil {
+		return loggerFailure(ErrDestinationUnavailable, err)
+	}
+	return nil
+}
@@ -0,0 +1,111 @@
+package sherlog
+
+import (
+	"context"
+	"net"
+	"time"
+)
+
+/*
+networkTimeouts is embedded in loggers and publishers that write to a TCP connection, to give them SetContext,
+SetWriteTimeout, and SetRetryPolicy.
+*/
+type networkTimeouts struct {
+	ctx          context.Context
+	writeTimeout time.Duration
+	retry        RetryPolicy
+	retries      RetryCounts
+}
+
+/*
+SetContext sets the base context of the connection. Once ctx is done, sends fail right away with
+ErrDestinationUnavailable instead of waiting on the network, a send that is blocked on the network when ctx is done
+is interrupted, and ctx's deadline (if it has one) bounds every send. Cancel it at shutdown so that a hung collector
+can't block the process from exiting. Not thread safe, so call it
+while setting up.
+*/
+func (nt *networkTimeouts) SetContext(ctx context.Context) {
+	nt.ctx = ctx
+}
+
+/*
+SetWriteTimeout limits how long each send (and the wait for its acknowledgement, if there is one) may take. 0 means
+no limit, which is the default. Not thread safe, so call it while setting up.
+*/
+func (nt *networkTimeouts) SetWriteTimeout(timeout time.Duration) {
+	nt.writeTimeout = timeout
+}
+
+/*
+SetRetryPolicy sets how failed sends are retried. Each attempt already reconnects once if the connection was
+broken, so the default of no retries only gives up when the destination can't be reached at all. Not thread
+safe, so call it while setting up.
+*/
+func (nt *networkTimeouts) SetRetryPolicy(policy RetryPolicy) {
+	nt.retry = policy
+}
+
+/*
+Retries returns how many times sends were retried, and how many still failed after that.
+*/
+func (nt *networkTimeouts) Retries() RetryCounts {
+	return nt.retries.load()
+}
+
+/*
+withRetries runs send with the retry policy, stopping early if the base context is done. send has to take the
+mutex of the connection itself, so that it isn't held while waiting between attempts.
+*/
+func (nt *networkTimeouts) withRetries(send func() error) error {
+	return nt.retry.do(nt.ctx, &nt.retries, send)
+}
+
+/*
+sendDeadline returns the deadline for a send that is starting now, or the zero time if there isn't one. Returns an
+error if the base context is already done.
+*/
+func (nt *networkTimeouts) sendDeadline() (time.Time, error) {
+	var deadline time.Time
+	if nt.writeTimeout > 0 {
+		deadline = time.Now().Add(nt.writeTimeout)
+	}
+	if nt.ctx == nil {
+		return deadline, nil
+	}
+	if err := nt.ctx.Err(); err != nil {
+		return deadline, loggerFailure(ErrDestinationUnavailable, err)
+	}
+	if ctxDeadline, hasDeadline := nt.ctx.Deadline(); hasDeadline && (deadline.IsZero() || ctxDeadline.Before(deadline)) {
+		deadline = ctxDeadline
+	}
+	return deadline, nil
+}
+
+/*
+interruptWhenDone makes the reads and writes that are blocked on conn fail right away if ctx (which may be nil) is
+done before stop is called.
+*/
+func interruptWhenDone(ctx context.Context, conn net.Conn) (stop func()) {
+	if ctx == nil || ctx.Done() == nil {
+		return func() {}
+	}
+	stopped := make(chan struct{})
+	go func() {
+		select {
+		case <-ctx.Done():
+			conn.SetDeadline(time.Now())
+		case <-stopped:
+		}
+	}()
+	return func() { close(stopped) }
+}
+
+/*
+earliest returns the earlier of two deadlines, where the zero time means no deadline.
+*/
+func earliest(deadline, other time.Time) time.Time {
+	if deadline.IsZero() || (!other.IsZero() && other.Before(deadline)) {
+		return other
+	}
+	return deadline
+}
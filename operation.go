@@ -0,0 +1,81 @@
+package sherlog
+
+import "sync/atomic"
+
+const (
+	// OperationField is the field that Begin and End put the name of the operation in.
+	OperationField = "operation"
+
+	// OperationIDField is the field that Begin and End put the ID of the operation in.
+	OperationIDField = "operation_id"
+)
+
+/*
+Operation is something that is being done, from Begin until End. Both entries share the operation's ID, so they
+(and anything else logged with the ID) can be found together. It is a lightweight alternative to tracing.
+*/
+type Operation struct {
+	// ID is a random 32 character hex ID that is unique to this operation.
+	ID string
+
+	// Name is what was passed to Begin.
+	Name string
+
+	logger Logger
+	timer  *Timer
+	ended  int32
+}
+
+/*
+Begin logs a DEBUG entry saying that the operation called name began and returns the Operation. Call End on it
+when the operation is done:
+
+	op := sherlog.Begin(logger, "reindex users")
+	err := reindexUsers()
+	op.End(err)
+
+Both entries have the name of the operation in the "operation" field and its ID in the "operation_id" field.
+*/
+func Begin(logger Logger, name string) *Operation {
+	op := &Operation{
+		ID:     NewCorrelationID(),
+		Name:   name,
+		logger: logger,
+		timer:  StartTimer(),
+	}
+	logger.Log(op.withFields(GraduateWithSkip(EnumDebug, 0, "began ", name)))
+	return op
+}
+
+/*
+End logs how long the operation took. If err is nil, it logs an INFO entry saying that the operation finished.
+Otherwise, it logs err with its own level if it has one (see LevelOf) and with level ERROR if it doesn't. Only the
+first call does anything, so it is safe to defer End as a fallback and call it early as well. Returns the error
+logger.Log returned, if any.
+*/
+func (op *Operation) End(err error) error {
+	if !atomic.CompareAndSwapInt32(&op.ended, 0, 1) {
+		return nil
+	}
+	var exception error
+	if err == nil {
+		exception = GraduateWithSkip(EnumInfo, 0, "finished ", op.Name)
+	} else {
+		level := LevelOf(err)
+		if level == nil {
+			level = EnumError
+		}
+		exception = GraduateWithSkip(level, 0, err) // withFields copies it if it was already logged
+	}
+	return op.logger.Log(WithDuration(op.withFields(exception), op.timer.Elapsed()))
+}
+
+/*
+withFields attaches the name and ID of the operation to exception. Returns exception.
+*/
+func (op *Operation) withFields(exception error) error {
+	return WithFields(exception, map[string]interface{}{
+		OperationField:   op.Name,
+		OperationIDField: op.ID,
+	})
+}
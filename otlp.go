@@ -0,0 +1,147 @@
+package sherlog
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"strconv"
+)
+
+/*
+OTelSeverityByLevel maps levels to OpenTelemetry SeverityNumbers. Levels that are not in the map get
+SeverityNumber 0 (UNSPECIFIED). Custom levels can be added:
+
+	sherlog.OTelSeverityByLevel[MyCustomLevel] = 10
+*/
+var OTelSeverityByLevel = map[Level]int{
+	EnumCritical: 21, // FATAL
+	EnumError:    17, // ERROR
+	EnumOpsError: 18, // ERROR2
+	EnumWarning:  13, // WARN
+	EnumInfo:     9,  // INFO
+	EnumDebug:    5,  // DEBUG
+}
+
+/*
+OTLPFormatter is a Formatter that writes each entry as an OTLP json ExportLogsServiceRequest holding a single
+LogRecord, which is what the OpenTelemetry collector's otlpjsonfile receiver reads (one request per line):
+
+	{
+	   "resourceLogs":[{
+		  "resource":{"attributes":[{"key":"service.name","value":{"stringValue":"user-service"}}]},
+		  "scopeLogs":[{
+			 "scope":{"name":"sherlog"},
+			 "logRecords":[{
+				"timeUnixNano":"1538553074000000000",
+				"observedTimeUnixNano":"1538553074000000000",
+				"severityNumber":17,
+				"severityText":"ERROR",
+				"body":{"stringValue":"could not connect to postgres"},
+				"attributes":[
+				   {"key":"exception.type","value":{"stringValue":"*errors.errorString"}},
+				   {"key":"exception.stacktrace","value":{"stringValue":"\tmain.main(/app/main.go:12)"}}
+				],
+				"traceId":"5b8efff798038103d269b633813fc60c",
+				"spanId":"eee19b7ec3c1b174"
+			 }]
+		  }]
+	   }]
+	}
+
+The trace ID comes from the entry's correlation ID and the span ID from the entry's span ID (see WithContext).
+They are only included if they are valid OpenTelemetry IDs (32 and 16 hex characters).
+*/
+type OTLPFormatter struct {
+	ServiceName string
+}
+
+/*
+NewOTLPFormatter returns a new OTLPFormatter. serviceName is used for the service.name resource attribute.
+If it is empty, the name set with SetServiceInfo is used instead. The service.version resource attribute
+always comes from SetServiceInfo.
+*/
+func NewOTLPFormatter(serviceName string) *OTLPFormatter {
+	return &OTLPFormatter{ServiceName: serviceName}
+}
+
+/*
+Format turns entry into an OTLP json ExportLogsServiceRequest.
+*/
+func (of *OTLPFormatter) Format(entry *Entry) ([]byte, error) {
+	var resourceAttributes []map[string]interface{}
+	serviceName := of.ServiceName
+	if serviceName == "" {
+		serviceName = serviceInfo.Name
+	}
+	if serviceName != "" {
+		resourceAttributes = append(resourceAttributes, otlpAttribute("service.name", serviceName))
+	}
+	if serviceInfo.Version != "" {
+		resourceAttributes = append(resourceAttributes, otlpAttribute("service.version", serviceInfo.Version))
+	}
+	return json.Marshal(map[string]interface{}{
+		"resourceLogs": []map[string]interface{}{{
+			"resource": map[string]interface{}{"attributes": resourceAttributes},
+			"scopeLogs": []map[string]interface{}{{
+				"scope":      map[string]interface{}{"name": "sherlog"},
+				"logRecords": []map[string]interface{}{of.ToLogRecord(entry)},
+			}},
+		}},
+	})
+}
+
+/*
+ToLogRecord creates the map[string]interface{} for a single OTLP LogRecord.
+*/
+func (of *OTLPFormatter) ToLogRecord(entry *Entry) map[string]interface{} {
+	timeUnixNano := strconv.FormatInt(entry.Time.UnixNano(), 10)
+	logRecord := map[string]interface{}{
+		"timeUnixNano":         timeUnixNano,
+		"observedTimeUnixNano": strconv.FormatInt(Clock().UnixNano(), 10),
+		"body":                 map[string]interface{}{"stringValue": entry.Message},
+	}
+	if entry.Level != nil {
+		logRecord["severityNumber"] = OTelSeverityByLevel[entry.Level]
+		logRecord["severityText"] = entry.Level.GetLabel()
+	}
+
+	var attributes []map[string]interface{}
+	if entry.Err != nil {
+		attributes = append(attributes, otlpAttribute("exception.type", fmt.Sprintf("%T", RootCause(entry.Err))))
+	}
+	if len(entry.StackTrace) > 0 {
+		attributes = append(attributes, otlpAttribute("exception.stacktrace", entry.StackTraceAsString()))
+	}
+	if entry.Sequence != 0 {
+		attributes = append(attributes, otlpAttribute("sherlog.sequence", strconv.FormatUint(entry.Sequence, 10)))
+	}
+	if attributes != nil {
+		logRecord["attributes"] = attributes
+	}
+
+	if isHexID(entry.CorrelationID, 16) {
+		logRecord["traceId"] = entry.CorrelationID
+	}
+	if isHexID(entry.SpanID, 8) {
+		logRecord["spanId"] = entry.SpanID
+	}
+	return logRecord
+}
+
+func otlpAttribute(key, value string) map[string]interface{} {
+	return map[string]interface{}{
+		"key":   key,
+		"value": map[string]interface{}{"stringValue": value},
+	}
+}
+
+/*
+isHexID returns true if id is numBytes bytes encoded as hex.
+*/
+func isHexID(id string, numBytes int) bool {
+	if len(id) != numBytes*2 {
+		return false
+	}
+	_, err := hex.DecodeString(id)
+	return err == nil
+}
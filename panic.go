@@ -0,0 +1,72 @@
+package sherlog
+
+import (
+	"fmt"
+	"strings"
+)
+
+/*
+FromPanic converts a value returned by recover() into a LeveledException with level CRITICAL.
+Errors keep their message and are kept as the cause. Strings are used as the message. Anything else
+is converted to a string with fmt.Sprint. Returns nil if recovered is nil.
+
+FromPanic must be called from the deferred function that called recover(). The stack trace starts at
+the place where the panic happened instead of inside of the deferred function:
+
+	defer func() {
+		if exception := sherlog.FromPanic(recover()); exception != nil {
+			logger.Log(exception)
+		}
+	}()
+*/
+func FromPanic(recovered interface{}) *LeveledException {
+	if recovered == nil {
+		return nil
+	}
+
+	// Skip runtime.Callers, getStackTrace, and FromPanic so that the deferred function is at the top
+	stackTrace := trimToPanicSite(getStackTrace(3, defaultStackTraceDepth))
+
+	var message string
+	var cause error
+	switch impl := recovered.(type) {
+	case error:
+		message = impl.Error()
+		cause = impl
+	case string:
+		message = impl
+	default:
+		message = fmt.Sprint(impl)
+	}
+
+	timestamp := Clock().In(Location)
+	return &LeveledException{
+		StdException: StdException{
+			stackTrace:        stackTrace,
+			maxStackTraceSize: defaultStackTraceDepth,
+			message:           message,
+			timestamp:         &timestamp,
+			cause:             cause,
+		},
+		level: EnumCritical,
+	}
+}
+
+/*
+trimToPanicSite removes everything up to and including runtime.gopanic (and any runtime frames that
+called it, such as runtime.sigpanic for nil pointer dereferences) so that the panic site is at the top.
+If runtime.gopanic is not in the stack trace, then it is returned untouched.
+*/
+func trimToPanicSite(stackTrace []*StackTraceEntry) []*StackTraceEntry {
+	for i, entry := range stackTrace {
+		if entry.FunctionName != "runtime.gopanic" {
+			continue
+		}
+		i++
+		for i < len(stackTrace)-1 && strings.HasPrefix(stackTrace[i].FunctionName, "runtime.") {
+			i++
+		}
+		return stackTrace[i:]
+	}
+	return stackTrace
+}
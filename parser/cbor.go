@@ -0,0 +1,102 @@
+package parser
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"math"
+)
+
+/*
+CBORDecoder reads CBOR entries, such as the ones written by sherlog.CBORFormatter, one at a time.
+Indefinite length items and tags are not supported since sherlog never writes them.
+*/
+type CBORDecoder struct {
+	reader *bufio.Reader
+}
+
+/*
+NewCBORDecoder returns a new CBORDecoder that reads from reader.
+*/
+func NewCBORDecoder(reader io.Reader) *CBORDecoder {
+	return &CBORDecoder{reader: bufio.NewReader(reader)}
+}
+
+/*
+Decode reads the next entry. Returns io.EOF when there are no more entries.
+*/
+func (cd *CBORDecoder) Decode() (interface{}, error) {
+	if _, err := cd.reader.Peek(1); err != nil {
+		return nil, err
+	}
+	return cd.decodeValue()
+}
+
+func (cd *CBORDecoder) decodeValue() (interface{}, error) {
+	initialByte, err := cd.reader.ReadByte()
+	if err != nil {
+		return nil, noEOF(err)
+	}
+	majorType := initialByte >> 5
+	info := initialByte & 0x1f
+
+	if majorType == 7 {
+		return cd.decodeSimple(info)
+	}
+
+	val, err := cd.readArgument(info)
+	if err != nil {
+		return nil, err
+	}
+
+	switch majorType {
+	case 0:
+		return toInt(val), nil
+	case 1:
+		if val > math.MaxInt64 {
+			return nil, fmt.Errorf("cbor negative integer out of range")
+		}
+		return -1 - int64(val), nil
+	case 2:
+		return readBytes(cd.reader, val)
+	case 3:
+		strBytes, err := readBytes(cd.reader, val)
+		return string(strBytes), err
+	case 4:
+		return readArray(val, cd.decodeValue)
+	case 5:
+		return readMap(val, cd.decodeValue)
+	}
+	return nil, fmt.Errorf("unsupported cbor major type %d", majorType)
+}
+
+/*
+readArgument reads the value/length that follows the initial byte.
+*/
+func (cd *CBORDecoder) readArgument(info byte) (uint64, error) {
+	switch {
+	case info < 24:
+		return uint64(info), nil
+	case info <= 27:
+		return readBigEndian(cd.reader, 1<<(info-24))
+	}
+	return 0, fmt.Errorf("unsupported cbor additional info %d", info)
+}
+
+func (cd *CBORDecoder) decodeSimple(info byte) (interface{}, error) {
+	switch info {
+	case 20:
+		return false, nil
+	case 21:
+		return true, nil
+	case 22, 23:
+		return nil, nil
+	case 26:
+		val, err := readBigEndian(cd.reader, 4)
+		return float64(math.Float32frombits(uint32(val))), err
+	case 27:
+		val, err := readBigEndian(cd.reader, 8)
+		return math.Float64frombits(val), err
+	}
+	return nil, fmt.Errorf("unsupported cbor simple value %d", info)
+}
@@ -0,0 +1,7 @@
+/*
+Package parser reads entries written by sherlog's formatters back into Go values.
+
+Maps are decoded into map[string]interface{} (map[interface{}]interface{} if a key is not a string), arrays into
+[]interface{}, integers into int64 (uint64 if they don't fit), and floats into float64.
+*/
+package parser
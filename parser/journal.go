@@ -0,0 +1,86 @@
+package parser
+
+import (
+	"encoding/binary"
+	"io"
+	"io/ioutil"
+	"os"
+	"time"
+
+	"github.com/Nick-Anderssohn/sherlog"
+)
+
+/*
+JournalQuery selects entries from a journal written by sherlog.JournalLogger. A zero From or To leaves that end of
+the time range open, and an empty Levels matches every level (including entries without one).
+*/
+type JournalQuery struct {
+	From   time.Time
+	To     time.Time
+	Levels []sherlog.Level
+}
+
+/*
+QueryJournal returns the entries in the journal in dir that match query, oldest segment first. Only the small
+.idx files are scanned, the entries themselves are read straight from their offsets.
+*/
+func QueryJournal(dir string, query JournalQuery) ([]interface{}, error) {
+	segments, err := sherlog.JournalSegments(dir)
+	if err != nil {
+		return nil, err
+	}
+	var entries []interface{}
+	for _, segment := range segments {
+		segmentEntries, err := querySegment(dir, segment, query)
+		if err != nil {
+			return nil, err
+		}
+		entries = append(entries, segmentEntries...)
+	}
+	return entries, nil
+}
+
+func querySegment(dir string, segment int, query JournalQuery) ([]interface{}, error) {
+	index, err := ioutil.ReadFile(sherlog.JournalSegmentPath(dir, segment, ".idx"))
+	if err != nil {
+		return nil, sherlog.AsError(err)
+	}
+	logFile, err := os.Open(sherlog.JournalSegmentPath(dir, segment, ".log"))
+	if err != nil {
+		return nil, sherlog.AsError(err)
+	}
+	defer logFile.Close()
+
+	var entries []interface{}
+	for start := 0; start+sherlog.JournalIndexRecordSize <= len(index); start += sherlog.JournalIndexRecordSize {
+		record := index[start : start+sherlog.JournalIndexRecordSize]
+		if !query.matches(int64(binary.BigEndian.Uint64(record[:8])), record[8]) {
+			continue
+		}
+		offset := int64(binary.BigEndian.Uint64(record[9:]))
+		entry, err := NewMsgpackDecoder(io.NewSectionReader(logFile, offset, 1<<62)).Decode()
+		if err != nil {
+			return nil, sherlog.AsError(err)
+		}
+		entries = append(entries, entry)
+	}
+	return entries, nil
+}
+
+func (jq JournalQuery) matches(unixNanos int64, levelId byte) bool {
+	if !jq.From.IsZero() && unixNanos < jq.From.UnixNano() {
+		return false
+	}
+	if !jq.To.IsZero() && unixNanos > jq.To.UnixNano() {
+		return false
+	}
+	if len(jq.Levels) == 0 {
+		return true
+	}
+	for _, level := range jq.Levels {
+		if levelId != sherlog.JournalNoLevel && int(levelId) == level.GetLevelId() {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,254 @@
+package parser
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"math"
+)
+
+/*
+MsgpackDecoder reads MessagePack entries, such as the ones written by sherlog.MsgpackFormatter, one at a time.
+*/
+type MsgpackDecoder struct {
+	reader *bufio.Reader
+}
+
+/*
+NewMsgpackDecoder returns a new MsgpackDecoder that reads from reader.
+*/
+func NewMsgpackDecoder(reader io.Reader) *MsgpackDecoder {
+	return &MsgpackDecoder{reader: bufio.NewReader(reader)}
+}
+
+/*
+Decode reads the next entry. Returns io.EOF when there are no more entries.
+*/
+func (md *MsgpackDecoder) Decode() (interface{}, error) {
+	if _, err := md.reader.Peek(1); err != nil {
+		return nil, err
+	}
+	return md.decodeValue()
+}
+
+func (md *MsgpackDecoder) decodeValue() (interface{}, error) {
+	typeByte, err := md.reader.ReadByte()
+	if err != nil {
+		return nil, noEOF(err)
+	}
+
+	switch {
+	case typeByte <= 0x7f:
+		return int64(typeByte), nil
+	case typeByte >= 0xe0:
+		return int64(int8(typeByte)), nil
+	case typeByte&0xe0 == 0xa0:
+		return md.readString(uint64(typeByte & 0x1f))
+	case typeByte&0xf0 == 0x90:
+		return md.readArray(uint64(typeByte & 0x0f))
+	case typeByte&0xf0 == 0x80:
+		return md.readMap(uint64(typeByte & 0x0f))
+	}
+
+	switch typeByte {
+	case 0xc0:
+		return nil, nil
+	case 0xc2:
+		return false, nil
+	case 0xc3:
+		return true, nil
+	case 0xcc, 0xcd, 0xce, 0xcf:
+		val, err := readBigEndian(md.reader, 1<<(typeByte-0xcc))
+		return toInt(val), err
+	case 0xd0, 0xd1, 0xd2, 0xd3:
+		numBytes := 1 << (typeByte - 0xd0)
+		val, err := readBigEndian(md.reader, numBytes)
+		return signExtend(val, numBytes), err
+	case 0xca:
+		val, err := readBigEndian(md.reader, 4)
+		return float64(math.Float32frombits(uint32(val))), err
+	case 0xcb:
+		val, err := readBigEndian(md.reader, 8)
+		return math.Float64frombits(val), err
+	case 0xd9, 0xda, 0xdb:
+		length, err := readBigEndian(md.reader, 1<<(typeByte-0xd9))
+		if err != nil {
+			return nil, err
+		}
+		return md.readString(length)
+	case 0xc4, 0xc5, 0xc6:
+		length, err := readBigEndian(md.reader, 1<<(typeByte-0xc4))
+		if err != nil {
+			return nil, err
+		}
+		return readBytes(md.reader, length)
+	case 0xdc, 0xdd:
+		length, err := readBigEndian(md.reader, 2<<(typeByte-0xdc))
+		if err != nil {
+			return nil, err
+		}
+		return md.readArray(length)
+	case 0xde, 0xdf:
+		length, err := readBigEndian(md.reader, 2<<(typeByte-0xde))
+		if err != nil {
+			return nil, err
+		}
+		return md.readMap(length)
+	}
+	return nil, fmt.Errorf("unsupported msgpack type 0x%x", typeByte)
+}
+
+func (md *MsgpackDecoder) readString(length uint64) (interface{}, error) {
+	strBytes, err := readBytes(md.reader, length)
+	return string(strBytes), err
+}
+
+func (md *MsgpackDecoder) readArray(length uint64) (interface{}, error) {
+	return readArray(length, md.decodeValue)
+}
+
+func (md *MsgpackDecoder) readMap(length uint64) (interface{}, error) {
+	return readMap(length, md.decodeValue)
+}
+
+/*
+readBigEndian reads a numBytes long big endian unsigned integer.
+*/
+func readBigEndian(reader io.Reader, numBytes int) (uint64, error) {
+	var buf [8]byte
+	if _, err := io.ReadFull(reader, buf[8-numBytes:]); err != nil {
+		return 0, noEOF(err)
+	}
+	return binary.BigEndian.Uint64(buf[:]), nil
+}
+
+/*
+maxPreallocated is the most bytes or elements that are allocated up front for an item. Bigger items grow as they
+are read, so that a corrupt length can't make the decoder allocate far more memory than the input holds.
+*/
+const maxPreallocated = 4096
+
+/*
+maxLength is the longest length that an item can have. Entries are never anywhere near this long, so longer lengths
+mean the input is corrupt. It also keeps lengths from turning negative when they are converted to an int.
+*/
+const maxLength = math.MaxInt32
+
+/*
+checkLength returns an error if length is longer than maxLength.
+*/
+func checkLength(length uint64) error {
+	if length > maxLength {
+		return fmt.Errorf("length %d is too long, the input is corrupt", length)
+	}
+	return nil
+}
+
+/*
+preallocated returns how much to allocate up front for an item with length elements.
+*/
+func preallocated(length uint64) int {
+	if length > maxPreallocated {
+		return maxPreallocated
+	}
+	return int(length)
+}
+
+func readBytes(reader io.Reader, length uint64) ([]byte, error) {
+	if err := checkLength(length); err != nil {
+		return nil, err
+	}
+	if length <= maxPreallocated {
+		buf := make([]byte, length)
+		_, err := io.ReadFull(reader, buf)
+		return buf, noEOF(err)
+	}
+	var buf bytes.Buffer
+	buf.Grow(maxPreallocated)
+	numRead, err := buf.ReadFrom(io.LimitReader(reader, int64(length)))
+	if err != nil {
+		return nil, err
+	}
+	if uint64(numRead) < length {
+		return nil, io.ErrUnexpectedEOF
+	}
+	return buf.Bytes(), nil
+}
+
+func readArray(length uint64, decodeValue func() (interface{}, error)) (interface{}, error) {
+	if err := checkLength(length); err != nil {
+		return nil, err
+	}
+	array := make([]interface{}, 0, preallocated(length))
+	for i := uint64(0); i < length; i++ {
+		elem, err := decodeValue()
+		if err != nil {
+			return nil, err
+		}
+		array = append(array, elem)
+	}
+	return array, nil
+}
+
+/*
+readMap reads length key value pairs. Returns a map[string]interface{} if all keys are strings, otherwise a
+map[interface{}]interface{}.
+*/
+func readMap(length uint64, decodeValue func() (interface{}, error)) (interface{}, error) {
+	if err := checkLength(length); err != nil {
+		return nil, err
+	}
+	stringMap := make(map[string]interface{}, preallocated(length))
+	var anyMap map[interface{}]interface{}
+	for i := uint64(0); i < length; i++ {
+		key, err := decodeValue()
+		if err != nil {
+			return nil, err
+		}
+		val, err := decodeValue()
+		if err != nil {
+			return nil, err
+		}
+		strKey, isStr := key.(string)
+		if isStr && anyMap == nil {
+			stringMap[strKey] = val
+			continue
+		}
+		if anyMap == nil {
+			anyMap = make(map[interface{}]interface{}, preallocated(length))
+			for k, v := range stringMap {
+				anyMap[k] = v
+			}
+		}
+		anyMap[key] = val
+	}
+	if anyMap != nil {
+		return anyMap, nil
+	}
+	return stringMap, nil
+}
+
+func toInt(val uint64) interface{} {
+	if val > math.MaxInt64 {
+		return val
+	}
+	return int64(val)
+}
+
+func signExtend(val uint64, numBytes int) int64 {
+	shift := uint(64 - numBytes*8)
+	return int64(val<<shift) >> shift
+}
+
+/*
+noEOF turns io.EOF into io.ErrUnexpectedEOF since running out of bytes in the middle of an entry means it
+was truncated.
+*/
+func noEOF(err error) error {
+	if err == io.EOF {
+		return io.ErrUnexpectedEOF
+	}
+	return err
+}
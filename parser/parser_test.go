@@ -0,0 +1,155 @@
+package parser
+
+import (
+	"bytes"
+	"io"
+	"io/ioutil"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Nick-Anderssohn/sherlog"
+)
+
+func TestRoundTrip(t *testing.T) {
+	entry := sherlog.NewEntry(sherlog.NewOpsError("could not connect to postgres"))
+
+	formatters := map[string]sherlog.Formatter{
+		"msgpack": sherlog.NewMsgpackFormatter(),
+		"cbor":    sherlog.NewCBORFormatter(),
+	}
+	newDecoders := map[string]func(io.Reader) func() (interface{}, error){
+		"msgpack": func(r io.Reader) func() (interface{}, error) { return NewMsgpackDecoder(r).Decode },
+		"cbor":    func(r io.Reader) func() (interface{}, error) { return NewCBORDecoder(r).Decode },
+	}
+
+	for name, formatter := range formatters {
+		var buf bytes.Buffer
+		for i := 0; i < 2; i++ {
+			entryBytes, err := formatter.Format(entry)
+			if err != nil {
+				t.Fatal(name, err)
+			}
+			buf.Write(entryBytes)
+		}
+
+		decode := newDecoders[name](&buf)
+		for i := 0; i < 2; i++ {
+			decoded, err := decode()
+			if err != nil {
+				t.Fatal(name, err)
+			}
+			envelope := decoded.(map[string]interface{})
+			decodedEntry := envelope["entry"].(map[string]interface{})
+			if decodedEntry["Level"] != "OPS_ERROR" || decodedEntry["Message"] != "could not connect to postgres" {
+				t.Error(name, "wrong entry", decodedEntry)
+			}
+			frames := decodedEntry["StackTrace"].([]interface{})
+			if len(frames) == 0 || frames[0].(map[string]interface{})["Line"].(int64) <= 0 {
+				t.Error(name, "stack trace was not decoded")
+			}
+		}
+		if _, err := decode(); err != io.EOF {
+			t.Error(name, "expected io.EOF after the last entry, got", err)
+		}
+	}
+}
+
+func TestNumbersAndLongValues(t *testing.T) {
+	longStr := string(bytes.Repeat([]byte("a"), 300))
+	addValues := func(jsonMap map[string]interface{}) map[string]interface{} {
+		return map[string]interface{}{"neg": -200, "small": -1, "big": 70000, "float": 1.5, "long": longStr, "ok": true, "nothing": nil}
+	}
+	entry := sherlog.NewEntry(sherlog.NewInfo("x"))
+
+	msgpackBytes, _ := (&sherlog.MsgpackFormatter{Transformers: []sherlog.JsonTransformer{addValues}}).Format(entry)
+	cborBytes, _ := (&sherlog.CBORFormatter{Transformers: []sherlog.JsonTransformer{addValues}}).Format(entry)
+	msgpackVal, err := NewMsgpackDecoder(bytes.NewReader(msgpackBytes)).Decode()
+	if err != nil {
+		t.Fatal(err)
+	}
+	cborVal, err := NewCBORDecoder(bytes.NewReader(cborBytes)).Decode()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for name, decoded := range map[string]interface{}{"msgpack": msgpackVal, "cbor": cborVal} {
+		values := decoded.(map[string]interface{})["entry"].(map[string]interface{})
+		if values["neg"] != int64(-200) || values["small"] != int64(-1) || values["big"] != int64(70000) ||
+			values["float"] != 1.5 || values["long"] != longStr || values["ok"] != true || values["nothing"] != nil {
+			t.Error(name, "values did not survive the round trip", values)
+		}
+	}
+}
+
+func TestCorruptLengths(t *testing.T) {
+	corrupt := map[string][]byte{
+		"msgpack bin32":       {0xc6, 0xff, 0xff, 0xff, 0xff},
+		"msgpack array32":     {0xdd, 0xff, 0xff, 0xff, 0xfe, 0xc0},
+		"msgpack map32":       {0xdf, 0x7f, 0xff, 0xff, 0xff},
+		"cbor huge bytes":     {0x5b, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff},
+		"cbor negative array": {0x9b, 0x80, 0, 0, 0, 0, 0, 0, 0},
+	}
+	for name, input := range corrupt {
+		var err error
+		if strings.HasPrefix(name, "cbor") {
+			_, err = NewCBORDecoder(bytes.NewReader(input)).Decode()
+		} else {
+			_, err = NewMsgpackDecoder(bytes.NewReader(input)).Decode()
+		}
+		if err == nil {
+			t.Error(name, "was decoded")
+		}
+	}
+
+	long := append([]byte{0xc5, 0x13, 0x88}, bytes.Repeat([]byte("a"), 5000)...)
+	decoded, err := NewMsgpackDecoder(bytes.NewReader(long)).Decode()
+	if err != nil || len(decoded.([]byte)) != 5000 {
+		t.Error("bytes longer than what is allocated up front did not decode", err)
+	}
+}
+
+func TestQueryJournal(t *testing.T) {
+	dir, err := ioutil.TempDir("", "journal")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	logger, err := sherlog.NewJournalLogger(dir, 1024)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 10; i++ {
+		logger.Info("just saying hi")
+		logger.Error("something broke")
+	}
+	logger.Close()
+
+	segments, _ := sherlog.JournalSegments(dir)
+	if len(segments) < 2 {
+		t.Error("expected the journal to roll into multiple segments, got", segments)
+	}
+
+	errs, err := QueryJournal(dir, JournalQuery{Levels: []sherlog.Level{sherlog.EnumError}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(errs) != 10 {
+		t.Fatal("expected 10 errors, got", len(errs))
+	}
+	for _, decoded := range errs {
+		values := decoded.(map[string]interface{})["entry"].(map[string]interface{})
+		if values["Level"] != "ERROR" || values["Message"] != "something broke" {
+			t.Error("query returned the wrong entry", values)
+		}
+	}
+
+	if all, _ := QueryJournal(dir, JournalQuery{}); len(all) != 20 {
+		t.Error("expected 20 entries, got", len(all))
+	}
+	if future, _ := QueryJournal(dir, JournalQuery{From: time.Now().Add(time.Hour)}); len(future) != 0 {
+		t.Error("expected no entries in the future, got", len(future))
+	}
+}
@@ -0,0 +1,221 @@
+package sherlog
+
+import "sync"
+
+const defaultMaxPausedEntries = 10000
+
+/*
+PausePolicy decides what a PausableLogger does with the entries that are logged while it is paused.
+*/
+type PausePolicy int
+
+const (
+	/*
+		BufferWhilePaused keeps the entries in memory and writes them in the order they were logged once the
+		logger is resumed.
+	*/
+	BufferWhilePaused PausePolicy = iota
+
+	/*
+		DropWhilePaused throws the entries away.
+	*/
+	DropWhilePaused
+)
+
+/*
+PausableLogger wraps any Logger so that it can be paused for maintenance, such as moving the log volume or
+rotating the credentials of a remote destination:
+
+	logger := sherlog.NewPausableLogger(shipper, sherlog.BufferWhilePaused, 0)
+	...
+	logger.Pause()
+	rotateCredentials()
+	logger.Resume() // Writes everything that was logged in between, in order
+
+Pause waits for the entries that are being written to finish, so nothing touches the wrapped logger until Resume
+is called. Resume writes the buffered entries before any new entry gets through, so entries are always written in
+the order they were logged. Is thread safe :)
+*/
+type PausableLogger struct {
+	callerSkipper
+	logger      Logger
+	policy      PausePolicy
+	maxBuffered int
+	paused      bool
+	buffered    []func() error
+	pauseMutex  *sync.RWMutex // Held for reading while writing to logger, and for writing while pausing or resuming
+	bufferMutex *sync.Mutex
+}
+
+/*
+NewPausableLogger returns a new PausableLogger that passes everything on to logger and follows policy while paused.
+With BufferWhilePaused, at most maxBuffered entries (10000 if maxBuffered is 0 or less) are kept. Log functions
+return an error caused by ErrQueueFull for the entries after that.
+*/
+func NewPausableLogger(logger Logger, policy PausePolicy, maxBuffered int) *PausableLogger {
+	if maxBuffered <= 0 {
+		maxBuffered = defaultMaxPausedEntries
+	}
+	return &PausableLogger{
+		logger:      logger,
+		policy:      policy,
+		maxBuffered: maxBuffered,
+		pauseMutex:  new(sync.RWMutex),
+		bufferMutex: new(sync.Mutex),
+	}
+}
+
+/*
+Pause stops entries from being passed on to the wrapped logger. It returns once the entries that were already
+being written are done.
+*/
+func (pl *PausableLogger) Pause() {
+	pl.pauseMutex.Lock()
+	defer pl.pauseMutex.Unlock()
+	pl.paused = true
+}
+
+/*
+Resume writes the buffered entries to the wrapped logger in the order they were logged and then starts passing
+entries on again. Every buffered entry is written even if some fail, and the first error is returned.
+*/
+func (pl *PausableLogger) Resume() error {
+	pl.pauseMutex.Lock()
+	defer pl.pauseMutex.Unlock()
+	pl.bufferMutex.Lock()
+	buffered := pl.buffered
+	pl.buffered = nil
+	pl.bufferMutex.Unlock()
+
+	var firstErr error
+	for _, logFunc := range buffered {
+		if err := logFunc(); err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+	pl.paused = false
+	return firstErr
+}
+
+/*
+Paused returns true if the logger is paused.
+*/
+func (pl *PausableLogger) Paused() bool {
+	pl.pauseMutex.RLock()
+	defer pl.pauseMutex.RUnlock()
+	return pl.paused
+}
+
+/*
+QueueDepth returns the number of entries that are buffered until the logger is resumed.
+*/
+func (pl *PausableLogger) QueueDepth() int {
+	pl.bufferMutex.Lock()
+	defer pl.bufferMutex.Unlock()
+	return len(pl.buffered)
+}
+
+/*
+pass runs logFunc right away if the logger isn't paused, and otherwise buffers or drops it according to the policy.
+*/
+func (pl *PausableLogger) pass(logFunc func() error) error {
+	pl.pauseMutex.RLock()
+	defer pl.pauseMutex.RUnlock()
+	if !pl.paused {
+		return logFunc()
+	}
+	if pl.policy == DropWhilePaused {
+		return nil
+	}
+	pl.bufferMutex.Lock()
+	defer pl.bufferMutex.Unlock()
+	if len(pl.buffered) >= pl.maxBuffered {
+		return loggerFailure(ErrQueueFull, "the logger is paused and already has ", pl.maxBuffered, " buffered entries")
+	}
+	pl.buffered = append(pl.buffered, logFunc)
+	return nil
+}
+
+/*
+Log calls the wrapped logger's Log function, or buffers or drops errorsToLog if the logger is paused.
+*/
+func (pl *PausableLogger) Log(errorsToLog ...interface{}) error {
+	values := append([]interface{}(nil), errorsToLog...)
+	return pl.pass(func() error {
+		return pl.logger.Log(values...)
+	})
+}
+
+/*
+LogNoStack calls the wrapped logger's LogNoStack function, or buffers or drops errToLog if the logger is paused.
+*/
+func (pl *PausableLogger) LogNoStack(errToLog error) error {
+	return pl.pass(func() error {
+		return pl.logger.LogNoStack(errToLog)
+	})
+}
+
+/*
+LogJson calls the wrapped logger's LogJson function, or buffers or drops errToLog if the logger is paused.
+*/
+func (pl *PausableLogger) LogJson(errToLog error) error {
+	return pl.pass(func() error {
+		return pl.logger.LogJson(errToLog)
+	})
+}
+
+/*
+Close writes the buffered entries and then closes the wrapped logger.
+*/
+func (pl *PausableLogger) Close() {
+	pl.Resume()
+	pl.logger.Close()
+}
+
+/*
+Critical turns values into a *LeveledException with level CRITICAL and then calls the logger's
+Log function.
+*/
+func (pl *PausableLogger) Critical(values ...interface{}) error {
+	return pl.Log(pl.graduate(EnumCritical, values...))
+}
+
+/*
+Error turns values into a *LeveledException with level ERROR and then calls the logger's
+Log function.
+*/
+func (pl *PausableLogger) Error(values ...interface{}) error {
+	return pl.Log(pl.graduate(EnumError, values...))
+}
+
+/*
+OpsError turns values into a *LeveledException with level OPS_ERROR and then calls the logger's
+Log function.
+*/
+func (pl *PausableLogger) OpsError(values ...interface{}) error {
+	return pl.Log(pl.graduate(EnumOpsError, values...))
+}
+
+/*
+Warn turns values into a *LeveledException with level WARNING and then calls the logger's
+Log function.
+*/
+func (pl *PausableLogger) Warn(values ...interface{}) error {
+	return pl.Log(pl.graduate(EnumWarning, values...))
+}
+
+/*
+Info turns values into a *LeveledException with level INFO and then calls the logger's
+Log function.
+*/
+func (pl *PausableLogger) Info(values ...interface{}) error {
+	return pl.Log(pl.graduate(EnumInfo, values...))
+}
+
+/*
+Debug turns values into a *LeveledException with level DEBUG and then calls the logger's
+Log function.
+*/
+func (pl *PausableLogger) Debug(values ...interface{}) error {
+	return pl.Log(pl.graduate(EnumDebug, values...))
+}
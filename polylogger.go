@@ -1,24 +1,46 @@
 package sherlog
 
 import (
-	"log"
+	"fmt"
+	"reflect"
 	"sync"
 )
 
+/*
+Encoding is how a PolyLogger writes to one of its loggers.
+*/
+type Encoding int
+
+const (
+	// EncodingAsCalled uses whichever function was called on the PolyLogger. It is the default.
+	EncodingAsCalled Encoding = iota
+	// EncodingText always uses the logger's Log function.
+	EncodingText
+	// EncodingNoStack always uses the logger's LogNoStack function.
+	EncodingNoStack
+	// EncodingJson always uses the logger's LogJson function.
+	EncodingJson
+)
+
 /*
 PolyLogger is a simple container for multiple loggers.
 Will call all of the loggers' log functions every time something
-needs to be logged.
+needs to be logged. Once the PolyLogger is in use, only change Loggers with AddLogger and RemoveLogger.
 */
 type PolyLogger struct {
+	callerSkipper
+	middlewareChain
 	Loggers          []Logger
+	loggersMutex     sync.RWMutex // Guards Loggers and encodings. Loggers is replaced, never changed in place
+	encodings        []Encoding   // encodings[i] is the encoding of Loggers[i]. Loggers past its end use EncodingAsCalled
 	handleLoggerFail func(error)
-	waitGroup        sync.WaitGroup
+	handleFailure    func(destination Logger, entry error, writeErr error)
 }
 
 /*
 NewPolyLogger creates a new PolyLogger. loggers are all the loggers that will be used during logging. If a logger fails when
-logging something, log.Println will be used to log the error that the logger returned.
+logging something, the error that the logger returned is reported to the diagnostics logger (see
+SetDiagnosticsLogger), which prints it with log.Println by default.
 Returns a new PolyLogger.
 */
 func NewPolyLogger(loggers []Logger) *PolyLogger {
@@ -37,93 +59,256 @@ func NewPolyLoggerWithHandleLoggerFail(loggers []Logger, handleLoggerFail func(e
 	}
 }
 
+/*
+NewPolyLoggerWithFailureHandler creates a new PolyLogger like NewPolyLoggerWithHandleLoggerFail, but handleFailure
+is also told which logger failed and what it failed to log, so lost entries can be sent somewhere else:
+
+	polyLogger := sherlog.NewPolyLoggerWithFailureHandler(loggers, func(destination sherlog.Logger, entry error, writeErr error) {
+		fallbackLogger.Log(entry)
+		fallbackLogger.Log(writeErr)
+	})
+
+entry is the first value that was being logged as an error (the values after it were the errors it was caused by).
+*/
+func NewPolyLoggerWithFailureHandler(loggers []Logger, handleFailure func(destination Logger, entry error, writeErr error)) *PolyLogger {
+	return &PolyLogger{
+		Loggers:       loggers,
+		handleFailure: handleFailure,
+	}
+}
+
+/*
+SetEncoding makes the PolyLogger always write to logger with encoding, no matter which of Log, LogNoStack, or
+LogJson is called. For example, to send human readable text to the console, json to a shipper, and entries
+without stack traces to an audit file:
+
+	polyLogger := sherlog.NewPolyLogger([]sherlog.Logger{consoleLogger, shipper, auditLogger})
+	polyLogger.SetEncoding(consoleLogger, sherlog.EncodingText)
+	polyLogger.SetEncoding(shipper, sherlog.EncodingJson)
+	polyLogger.SetEncoding(auditLogger, sherlog.EncodingNoStack)
+
+When Log is called with multiple values, loggers that use EncodingNoStack or EncodingJson only get the first one.
+Pass EncodingAsCalled to go back to the default. logger must already be one of the loggers.
+*/
+func (p *PolyLogger) SetEncoding(logger Logger, encoding Encoding) {
+	p.loggersMutex.Lock()
+	defer p.loggersMutex.Unlock()
+	encodings := make([]Encoding, len(p.Loggers))
+	copy(encodings, p.encodings)
+	for i, existing := range p.Loggers {
+		if sameLogger(existing, logger) {
+			encodings[i] = encoding
+		}
+	}
+	p.encodings = encodings
+}
+
+/*
+AddLogger starts writing to logger, such as a console logger that is only attached during an incident. It is
+safe to call while other goroutines are logging. Calls to Log that already started don't write to logger.
+*/
+func (p *PolyLogger) AddLogger(logger Logger) {
+	p.loggersMutex.Lock()
+	defer p.loggersMutex.Unlock()
+	loggers := make([]Logger, len(p.Loggers), len(p.Loggers)+1)
+	copy(loggers, p.Loggers)
+	p.Loggers = append(loggers, logger)
+}
+
+/*
+RemoveLogger stops writing to logger and forgets its encoding (see SetEncoding). It is safe to call while other
+goroutines are logging. Calls to Log that already started may still write to logger, so wait for them before
+closing it. logger is not closed. Returns false if logger wasn't one of the loggers.
+*/
+func (p *PolyLogger) RemoveLogger(logger Logger) bool {
+	p.loggersMutex.Lock()
+	defer p.loggersMutex.Unlock()
+	loggers := make([]Logger, 0, len(p.Loggers))
+	encodings := make([]Encoding, 0, len(p.Loggers))
+	for i, existing := range p.Loggers {
+		if !sameLogger(existing, logger) {
+			loggers = append(loggers, existing)
+			encodings = append(encodings, p.encodingFor(i, EncodingAsCalled))
+		}
+	}
+	if len(loggers) == len(p.Loggers) {
+		return false
+	}
+	p.Loggers = loggers
+	p.encodings = encodings
+	return true
+}
+
+/*
+sameLogger returns true if a and b are the same logger. Loggers whose type can't be compared (a struct value
+holding a slice or map) are never the same as anything, since comparing them would panic.
+*/
+func sameLogger(a, b Logger) bool {
+	typeOfA := reflect.TypeOf(a)
+	if typeOfA != reflect.TypeOf(b) {
+		return false
+	}
+	return typeOfA == nil || (typeOfA.Comparable() && a == b)
+}
+
+/*
+currentLoggers returns the loggers at the moment. The slice must not be changed.
+*/
+func (p *PolyLogger) currentLoggers() []Logger {
+	p.loggersMutex.RLock()
+	defer p.loggersMutex.RUnlock()
+	return p.Loggers
+}
+
 /*
 Close asynchronously runs all loggers' Close functions.
 */
 func (p *PolyLogger) Close() {
-	for _, logger := range p.Loggers {
+	for _, logger := range p.currentLoggers() {
 		go logger.Close()
 	}
 }
 
 /*
-Log asynchronously runs all logger's Log functions.
+QueueDepth returns the sum of the queue depths of the loggers (see QueueDepthOf).
+*/
+func (p *PolyLogger) QueueDepth() int {
+	var depth int
+	for _, logger := range p.currentLoggers() {
+		depth += QueueDepthOf(logger)
+	}
+	return depth
+}
+
+/*
+Pressure returns the highest pressure of the loggers (see PressureOf), since every logger is written to on every
+call.
+*/
+func (p *PolyLogger) Pressure() float64 {
+	var pressure float64
+	for _, logger := range p.currentLoggers() {
+		if loggerPressure := PressureOf(logger); loggerPressure > pressure {
+			pressure = loggerPressure
+		}
+	}
+	return pressure
+}
+
+/*
+Log asynchronously runs all logger's Log functions (or the function picked with SetEncoding).
 Handles any errors in the logging process with handleLoggerFail.
 Will always return nil.
 */
 func (p *PolyLogger) Log(errorsToLog ...interface{}) error {
-	for _, logger := range p.Loggers {
-		p.waitGroup.Add(1)
-		go p.runLogWithFail(logger, errorsToLog)
-	}
-	p.waitGroup.Wait()
+	return p.through(p.logValues, errorsToLog)
+}
+
+func (p *PolyLogger) logValues(errorsToLog ...interface{}) error {
+	p.runLoggers(EncodingText, errorsToLog)
 	return nil
 }
 
 /*
-LogNoStack asynchronously runs all logger's LogNoStack functions.
-Will ignore any Loggers that are not RobustLoggers.
+LogNoStack asynchronously runs all logger's LogNoStack functions (or the function picked with SetEncoding).
 Handles any errors in the logging process with handleLoggerFail.
 Will always return nil.
 */
 func (p *PolyLogger) LogNoStack(errToLog error) error {
+	return p.throughWithError(p.logNoStack, errToLog)
+}
+
+func (p *PolyLogger) logNoStack(errToLog error) error {
 	if errToLog == nil {
 		return AsError("tried to log nil error")
 	}
-	for _, logger := range p.Loggers {
-		if robustLogger, isRobust := logger.(Logger); isRobust {
-			p.waitGroup.Add(1)
-			go p.runLoggerWithFail(robustLogger.LogNoStack, errToLog)
-		}
-	}
-	p.waitGroup.Wait()
+	p.runLoggers(EncodingNoStack, []interface{}{errToLog})
 	return nil
 }
 
 /*
-LogJson asynchronously runs all logger's LogJson functions.
-Will ignore any Loggers that are not RobustLoggers.
+LogJson asynchronously runs all logger's LogJson functions (or the function picked with SetEncoding).
 Handles any errors in the logging process with handleLoggerFail.
 Will always return nil.
 */
 func (p *PolyLogger) LogJson(errToLog error) error {
+	return p.throughWithError(p.logJson, errToLog)
+}
+
+func (p *PolyLogger) logJson(errToLog error) error {
 	if errToLog == nil {
 		return AsError("tried to log nil error")
 	}
-	for _, logger := range p.Loggers {
-		if robustLogger, isRobust := logger.(Logger); isRobust {
-			p.waitGroup.Add(1)
-			go p.runLoggerWithFail(robustLogger.LogJson, errToLog)
-		}
-	}
-	p.waitGroup.Wait()
+	p.runLoggers(EncodingJson, []interface{}{errToLog})
 	return nil
 }
 
-// Call in a go routine! Will automatically decrement wait group
-func (p *PolyLogger) runLoggerWithFail(logFunc func(error) error, loggable error) {
-	defer p.waitGroup.Add(-1)
-	err := logFunc(loggable)
-	if err != nil && p.handleLoggerFail != nil {
-		p.handleLoggerFail(err)
+/*
+encodingFor returns the encoding set for the logger at index i of Loggers, or called if there isn't one.
+loggersMutex must be held.
+*/
+func (p *PolyLogger) encodingFor(i int, called Encoding) Encoding {
+	if i < len(p.encodings) && p.encodings[i] != EncodingAsCalled {
+		return p.encodings[i]
+	}
+	return called
+}
+
+/*
+runLoggers runs every logger in its own goroutine and waits for all of them. Each call gets its own WaitGroup so
+that concurrent calls don't wait on each other's loggers.
+*/
+func (p *PolyLogger) runLoggers(called Encoding, errorsToLog []interface{}) {
+	var waitGroup sync.WaitGroup
+	p.loggersMutex.RLock()
+	for i, logger := range p.Loggers {
+		waitGroup.Add(1)
+		go p.runLoggerWithFail(&waitGroup, logger, p.encodingFor(i, called), errorsToLog)
 	}
+	p.loggersMutex.RUnlock()
+	waitGroup.Wait()
 }
 
 // Call in a go routine! Will automatically decrement wait group
-func (p *PolyLogger) runLogWithFail(logger Logger, errorsToLog []interface{}) {
-	defer p.waitGroup.Add(-1)
-	err := logger.Log(errorsToLog...)
-	if err != nil && p.handleLoggerFail != nil {
+func (p *PolyLogger) runLoggerWithFail(waitGroup *sync.WaitGroup, logger Logger, encoding Encoding, errorsToLog []interface{}) {
+	defer waitGroup.Done()
+	var err error
+	switch encoding {
+	case EncodingNoStack:
+		err = logger.LogNoStack(firstError(errorsToLog))
+	case EncodingJson:
+		err = logger.LogJson(firstError(errorsToLog))
+	default:
+		err = logger.Log(errorsToLog...)
+	}
+	if err == nil {
+		return
+	}
+	if p.handleFailure != nil {
+		p.handleFailure(logger, firstError(errorsToLog), err)
+	} else if p.handleLoggerFail != nil {
 		p.handleLoggerFail(err)
 	}
 }
 
+/*
+firstError returns the first value as an error so that it can be passed to LogNoStack or LogJson.
+*/
+func firstError(values []interface{}) error {
+	if len(values) == 0 || values[0] == nil {
+		return nil
+	}
+	if err, isErr := values[0].(error); isErr {
+		return err
+	}
+	return fmt.Errorf("%v", values[0])
+}
+
 /*
 Critical turns values into a *LeveledException with level CRITICAL and then calls the logger's
 Log function.
 */
 func (p *PolyLogger) Critical(values ...interface{}) error {
-	return p.Log(graduateOrConcatAndCreate(EnumCritical, values...))
+	return p.Log(p.graduate(EnumCritical, values...))
 }
 
 /*
@@ -131,7 +316,7 @@ Error turns values into a *LeveledException with level ERROR and then calls the
 Log function.
 */
 func (p *PolyLogger) Error(values ...interface{}) error {
-	return p.Log(graduateOrConcatAndCreate(EnumError, values...))
+	return p.Log(p.graduate(EnumError, values...))
 }
 
 /*
@@ -139,7 +324,7 @@ OpsError turns values into a *LeveledException with level OPS_ERROR and then cal
 Log function.
 */
 func (p *PolyLogger) OpsError(values ...interface{}) error {
-	return p.Log(graduateOrConcatAndCreate(EnumOpsError, values...))
+	return p.Log(p.graduate(EnumOpsError, values...))
 }
 
 /*
@@ -147,7 +332,7 @@ Warn turns values into a *LeveledException with level WARNING and then calls the
 Log function.
 */
 func (p *PolyLogger) Warn(values ...interface{}) error {
-	return p.Log(graduateOrConcatAndCreate(EnumWarning, values...))
+	return p.Log(p.graduate(EnumWarning, values...))
 }
 
 /*
@@ -155,7 +340,7 @@ Info turns values into a *LeveledException with level INFO and then calls the lo
 Log function.
 */
 func (p *PolyLogger) Info(values ...interface{}) error {
-	return p.Log(graduateOrConcatAndCreate(EnumInfo, values...))
+	return p.Log(p.graduate(EnumInfo, values...))
 }
 
 /*
@@ -163,9 +348,9 @@ Debug turns values into a *LeveledException with level DEBUG and then calls the
 Log function.
 */
 func (p *PolyLogger) Debug(values ...interface{}) error {
-	return p.Log(graduateOrConcatAndCreate(EnumDebug, values...))
+	return p.Log(p.graduate(EnumDebug, values...))
 }
 
 func defaultHandleLoggerFail(err error) {
-	log.Println(err)
+	diagnose(err)
 }
@@ -0,0 +1,25 @@
+//go:build linux
+// +build linux
+
+package sherlog
+
+import (
+	"os"
+	"syscall"
+)
+
+// fallocKeepSize is FALLOC_FL_KEEP_SIZE, which reserves the blocks without changing the size of the file.
+const fallocKeepSize = 0x01
+
+/*
+preallocate reserves size bytes of disk for file with fallocate, leaving its size at 0 so appends start at the
+beginning. File systems that don't support fallocate (EOPNOTSUPP), such as some network ones, just get the file
+created ahead of time, like other systems do.
+*/
+func preallocate(file *os.File, size int64) error {
+	err := syscall.Fallocate(int(file.Fd()), fallocKeepSize, 0, size)
+	if err == syscall.EOPNOTSUPP {
+		return nil
+	}
+	return err
+}
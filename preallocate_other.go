@@ -0,0 +1,13 @@
+//go:build !linux
+// +build !linux
+
+package sherlog
+
+import "os"
+
+/*
+preallocate does nothing. Only Linux can reserve disk for a file without changing its size.
+*/
+func preallocate(file *os.File, size int64) error {
+	return nil
+}
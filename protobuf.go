@@ -0,0 +1,154 @@
+package sherlog
+
+import "fmt"
+
+// Protobuf wire types
+const (
+	protoVarint          = 0
+	protoLengthDelimited = 2
+)
+
+/*
+ProtobufFormatter is a Formatter that writes entries as sherlog.v1.LogEntry protobuf messages.
+The schema lives in proto/sherlog.proto, so consumers (gRPC services, Kafka consumers, etc.) can generate their
+own code for it. The encoder is hand written so that sherlog does not depend on a protobuf library.
+
+If Delimited is true (the default from NewProtobufFormatter), each message is prefixed with its length as a varint,
+which is how multiple messages are stored in one file or stream. Turn it off when each entry is published on its own,
+such as one Kafka message per entry.
+*/
+type ProtobufFormatter struct {
+	Delimited bool
+}
+
+/*
+NewProtobufFormatter returns a new ProtobufFormatter that writes length delimited messages.
+*/
+func NewProtobufFormatter() *ProtobufFormatter {
+	return &ProtobufFormatter{Delimited: true}
+}
+
+/*
+Format turns entry into a LogEntry protobuf message.
+*/
+func (pf *ProtobufFormatter) Format(entry *Entry) ([]byte, error) {
+	message := MarshalProtobuf(entry)
+	if !pf.Delimited {
+		return message, nil
+	}
+	return append(appendProtoVarint(nil, uint64(len(message))), message...), nil
+}
+
+/*
+Separator returns nil since the messages are either length delimited or published on their own.
+*/
+func (pf *ProtobufFormatter) Separator() []byte {
+	return nil
+}
+
+/*
+MarshalProtobuf encodes entry as a sherlog.v1.LogEntry protobuf message (see proto/sherlog.proto).
+*/
+func MarshalProtobuf(entry *Entry) []byte {
+	var buf []byte
+	if !entry.Time.IsZero() {
+		buf = appendProtoVarintField(buf, 1, uint64(entry.Time.UnixNano()))
+	}
+	if entry.Level != nil {
+		buf = appendProtoStringField(buf, 2, entry.Level.GetLabel())
+		buf = appendProtoVarintField(buf, 3, uint64(int64(entry.Level.GetLevelId())))
+	}
+	buf = appendProtoStringField(buf, 4, entry.Message)
+	for _, frame := range entry.StackTrace {
+		buf = appendProtoBytesField(buf, 5, marshalProtoStackFrame(frame))
+	}
+	for _, key := range sortedFieldKeys(entry.Fields) {
+		fieldEntry := appendProtoStringField(nil, 1, key)
+		fieldEntry = appendProtoStringField(fieldEntry, 2, fmt.Sprint(entry.Fields[key]))
+		buf = appendProtoBytesField(buf, 6, fieldEntry)
+	}
+	causes, cutOff := causesOf(entry.Err)
+	for _, cause := range causes {
+		buf = appendProtoBytesField(buf, 7, marshalProtoCause(cause))
+	}
+	if cutOff != "" {
+		buf = appendProtoBytesField(buf, 7, appendProtoStringField(nil, 1, cutOff))
+	}
+	for _, msg := range entry.MessageChain {
+		buf = appendProtoBytesField(buf, 8, []byte(msg))
+	}
+	if entry.Sequence != 0 {
+		buf = appendProtoVarintField(buf, 9, entry.Sequence)
+	}
+	buf = appendProtoStringField(buf, 10, entry.CorrelationID)
+	buf = appendProtoStringField(buf, 11, entry.SpanID)
+	return buf
+}
+
+/*
+causesOf returns the errors that err wraps, outermost first, and a marker if the chain was cut off (see
+walkChain). err itself is not included.
+*/
+func causesOf(err error) (causes []error, cutOff string) {
+	isErr := true
+	cutOff = walkChain(err, func(cur error) bool {
+		if !isErr {
+			causes = append(causes, cur)
+		}
+		isErr = false
+		return true
+	})
+	return
+}
+
+func marshalProtoCause(cause error) []byte {
+	var buf []byte
+	buf = appendProtoStringField(buf, 1, cause.Error())
+	buf = appendProtoStringField(buf, 2, fmt.Sprintf("%T", cause))
+	for _, frame := range stackTraceOf(cause) {
+		buf = appendProtoBytesField(buf, 3, marshalProtoStackFrame(frame))
+	}
+	return buf
+}
+
+func marshalProtoStackFrame(frame *StackTraceEntry) []byte {
+	var buf []byte
+	buf = appendProtoStringField(buf, 1, frame.FunctionName)
+	buf = appendProtoStringField(buf, 2, frame.renderedFile())
+	if frame.Line != 0 {
+		buf = appendProtoVarintField(buf, 3, uint64(int64(frame.Line)))
+	}
+	return buf
+}
+
+func appendProtoVarint(buf []byte, val uint64) []byte {
+	for val >= 0x80 {
+		buf = append(buf, byte(val)|0x80)
+		val >>= 7
+	}
+	return append(buf, byte(val))
+}
+
+func appendProtoTag(buf []byte, fieldNum int, wireType int) []byte {
+	return appendProtoVarint(buf, uint64(fieldNum<<3|wireType))
+}
+
+func appendProtoVarintField(buf []byte, fieldNum int, val uint64) []byte {
+	return appendProtoVarint(appendProtoTag(buf, fieldNum, protoVarint), val)
+}
+
+/*
+appendProtoStringField skips empty strings since they are the default value in proto3.
+*/
+func appendProtoStringField(buf []byte, fieldNum int, val string) []byte {
+	if val == "" {
+		return buf
+	}
+	return appendProtoBytesField(buf, fieldNum, []byte(val))
+}
+
+func appendProtoBytesField(buf []byte, fieldNum int, val []byte) []byte {
+	buf = appendProtoTag(buf, fieldNum, protoLengthDelimited)
+	buf = appendProtoVarint(buf, uint64(len(val)))
+	return append(buf, val...)
+}
@@ -0,0 +1,190 @@
+package sherlog
+
+import "strings"
+
+/*
+Publisher publishes a payload to a topic (called a subject in NATS) of a message broker. The Publish function of
+the official NATS client (*nats.Conn) already satisfies it, so it can be used instead of NewNATSPublisher.
+*/
+type Publisher interface {
+	Publish(topic string, payload []byte) error
+}
+
+/*
+PublisherLogger publishes json entries to a message broker, for deployments that already have a broker but no log
+infrastructure. Each entry is published to the logger's topic with the lowercase level label as a suffix, such as
+"logs.myapp.error" for NATS or "logs/myapp/error" for MQTT. Entries without a level are published to the topic
+itself.
+
+Log and LogJson include the stack trace, LogNoStack does not. When Log is given multiple errors, only the first
+one is published. Is thread safe as long as the Publisher is :)
+*/
+type PublisherLogger struct {
+	callerSkipper
+	middlewareChain
+	publisher      Publisher
+	topic          string
+	topicSeparator string
+}
+
+/*
+NewPublisherLogger returns a new PublisherLogger that publishes to topic using publisher. separator goes between
+the topic and the level suffix, such as "." for NATS or "/" for MQTT.
+*/
+func NewPublisherLogger(publisher Publisher, topic, separator string) *PublisherLogger {
+	return &PublisherLogger{
+		publisher:      publisher,
+		topic:          topic,
+		topicSeparator: separator,
+	}
+}
+
+/*
+NewNATSLogger connects to the NATS server at address (host:port) and returns a PublisherLogger that publishes to
+subject, with level suffixes separated by ".".
+*/
+func NewNATSLogger(address, subject string) (*PublisherLogger, error) {
+	publisher, err := NewNATSPublisher(address)
+	if err != nil {
+		return nil, err
+	}
+	return NewPublisherLogger(publisher, subject, "."), nil
+}
+
+/*
+NewMQTTLogger connects to the MQTT broker at address (host:port) as clientID and returns a PublisherLogger that
+publishes to topic, with level suffixes separated by "/".
+*/
+func NewMQTTLogger(address, clientID, topic string) (*PublisherLogger, error) {
+	publisher, err := NewMQTTPublisher(address, clientID)
+	if err != nil {
+		return nil, err
+	}
+	return NewPublisherLogger(publisher, topic, "/"), nil
+}
+
+/*
+topicFor returns the topic entry should be published to.
+*/
+func (pl *PublisherLogger) topicFor(entry *Entry) string {
+	if entry.Level == nil {
+		return pl.topic
+	}
+	return pl.topic + pl.topicSeparator + strings.ToLower(entry.Level.GetLabel())
+}
+
+/*
+publish publishes toLog as json.
+*/
+func (pl *PublisherLogger) publish(toLog interface{}, includeStack bool) error {
+	if toLog == nil {
+		return AsError("tried to log nil error")
+	}
+	entry := NewEntry(toLog)
+	jsonMap := entry.ToJsonMap()
+	removeStackRepresentations(jsonMap, false, includeStack)
+	payload, err := marshalJsonEntry(jsonMap, false)
+	if err != nil {
+		return loggerFailure(ErrFormat, err)
+	}
+	if err = pl.publisher.Publish(pl.topicFor(entry), payload); err != nil {
+		return AsError(err)
+	}
+	return nil
+}
+
+/*
+Log publishes the first value of errorsToLog with its stack trace.
+*/
+func (pl *PublisherLogger) Log(errorsToLog ...interface{}) error {
+	return pl.through(pl.logValues, errorsToLog)
+}
+
+func (pl *PublisherLogger) logValues(errorsToLog ...interface{}) error {
+	if len(errorsToLog) < 1 {
+		return AsError("no parameters provided to Log")
+	}
+	return pl.publish(errorsToLog[0], true)
+}
+
+/*
+LogNoStack publishes errToLog without its stack trace.
+*/
+func (pl *PublisherLogger) LogNoStack(errToLog error) error {
+	return pl.throughWithError(pl.logNoStack, errToLog)
+}
+
+func (pl *PublisherLogger) logNoStack(errToLog error) error {
+	return pl.publish(errToLog, false)
+}
+
+/*
+LogJson publishes errToLog with its stack trace. Entries are always json, so it is the same as Log.
+*/
+func (pl *PublisherLogger) LogJson(errToLog error) error {
+	return pl.throughWithError(pl.logJson, errToLog)
+}
+
+func (pl *PublisherLogger) logJson(errToLog error) error {
+	return pl.publish(errToLog, true)
+}
+
+/*
+Close closes the publisher if it has a Close function.
+*/
+func (pl *PublisherLogger) Close() {
+	switch closer := pl.publisher.(type) {
+	case interface{ Close() error }:
+		closer.Close()
+	case interface{ Close() }:
+		closer.Close()
+	}
+}
+
+/*
+Critical turns values into a *LeveledException with level CRITICAL and then calls the logger's
+Log function.
+*/
+func (pl *PublisherLogger) Critical(values ...interface{}) error {
+	return pl.Log(pl.graduate(EnumCritical, values...))
+}
+
+/*
+Error turns values into a *LeveledException with level ERROR and then calls the logger's
+Log function.
+*/
+func (pl *PublisherLogger) Error(values ...interface{}) error {
+	return pl.Log(pl.graduate(EnumError, values...))
+}
+
+/*
+OpsError turns values into a *LeveledException with level OPS_ERROR and then calls the logger's
+Log function.
+*/
+func (pl *PublisherLogger) OpsError(values ...interface{}) error {
+	return pl.Log(pl.graduate(EnumOpsError, values...))
+}
+
+/*
+Warn turns values into a *LeveledException with level WARNING and then calls the logger's
+Log function.
+*/
+func (pl *PublisherLogger) Warn(values ...interface{}) error {
+	return pl.Log(pl.graduate(EnumWarning, values...))
+}
+
+/*
+Info turns values into a *LeveledException with level INFO and then calls the logger's
+Log function.
+*/
+func (pl *PublisherLogger) Info(values ...interface{}) error {
+	return pl.Log(pl.graduate(EnumInfo, values...))
+}
+
+/*
+Debug turns values into a *LeveledException with level DEBUG and then calls the logger's
+Log function.
+*/
+func (pl *PublisherLogger) Debug(values ...interface{}) error {
+	return pl.Log(pl.graduate(EnumDebug, values...))
+}
@@ -0,0 +1,99 @@
+package sherlog
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+/*
+tmpSuffix is added to the end of a file (a checksum sidecar, a compaction summary, or the link to the current file)
+until it has been completely written and is renamed to drop the suffix.
+*/
+const tmpSuffix = ".tmp"
+
+/*
+RecoverOrphanedFiles cleans up after a process that crashed in the middle of rolling, writing a checksum, or
+compacting. Call it once at startup, right after creating the logger. It:
+
+  - deletes empty rolled files (other than the current one), including the "(N)" ones, that were opened by a roll
+    that never got used
+  - deletes the .tmp files of checksum sidecars (see SetWriteChecksums), compaction summaries (see Compact), and
+    the link to the current file (see SetCurrentLink) that were never renamed. Nothing is lost, since the files
+    they were made from are only deleted once they are renamed.
+
+Only files named like the logger names them are touched. If anything was found, an INFO entry saying what was done
+is logged. Returns the first error.
+*/
+func (rfl *RollingFileLogger) RecoverOrphanedFiles() error {
+	var firstErr error
+	keepFirstErr := func(err error) {
+		if err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+
+	rfl.mutex.Lock()
+	currentFilePath := rfl.logFilePath
+	rfl.mutex.Unlock()
+
+	var numEmpty, numTmp int
+	filePaths, err := rfl.rolledFilePaths()
+	keepFirstErr(err)
+	for _, filePath := range filePaths {
+		if info, err := os.Stat(filePath); err != nil || info.Size() > 0 || filePath == currentFilePath {
+			continue
+		}
+		if err := os.Remove(filePath); err != nil {
+			keepFirstErr(err)
+			continue
+		}
+		numEmpty++
+	}
+
+	tmpFilePaths, err := rfl.orphanedTmpFilePaths()
+	keepFirstErr(err)
+	for _, tmpFilePath := range tmpFilePaths {
+		if err := os.Remove(tmpFilePath); err != nil {
+			keepFirstErr(err)
+			continue
+		}
+		numTmp++
+	}
+
+	if numEmpty+numTmp == 0 {
+		return firstErr
+	}
+	message := fmt.Sprintf("recovered orphaned log files: deleted %d empty files, deleted %d unfinished .tmp files", numEmpty, numTmp)
+	keepFirstErr(rfl.Log(NewInfo(message)))
+	return firstErr
+}
+
+/*
+orphanedTmpFilePaths returns the paths of the .tmp files that the logger writes and renames, and that are still
+there.
+*/
+func (rfl *RollingFileLogger) orphanedTmpFilePaths() ([]string, error) {
+	tmpFilePaths, err := rfl.rolledFilePathsWithSuffix(ChecksumSuffix + tmpSuffix)
+	if err != nil {
+		return nil, err
+	}
+	summaryPattern := rfl.summaryFilePath("*") + tmpSuffix
+	summaryTmpFilePaths, err := filepath.Glob(summaryPattern)
+	if err != nil {
+		return nil, err
+	}
+	tmpFilePaths = append(tmpFilePaths, summaryTmpFilePaths...)
+	if linkTmpPath := rfl.baseFilePath + tmpSuffix; isPresent(linkTmpPath) {
+		tmpFilePaths = append(tmpFilePaths, linkTmpPath)
+	}
+	return tmpFilePaths, nil
+}
+
+/*
+isPresent returns true if something is at filePath, even a symlink whose target is gone.
+*/
+func isPresent(filePath string) bool {
+	_, err := os.Lstat(filePath)
+	return err == nil
+}
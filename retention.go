@@ -0,0 +1,143 @@
+package sherlog
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+/*
+SetMaxFileAge makes the logger delete its rolled files once they are older than maxAge (by modification time).
+Files are checked right away and every time the logger rolls. Both flat files and files in time bucketed
+subdirectories (see SetTimeBucketedDirs) are checked, and time bucket directories that end up empty are removed.
+The file currently being logged to is never deleted. onDelete is called with the paths of the files that were
+deleted each time at least one was. It may be nil. Pass a maxAge of 0 to turn it off, which is the default.
+
+	logger.SetMaxFileAge(30*24*time.Hour, func(deletedFilePaths []string) {
+		fmt.Println("deleted old logs:", deletedFilePaths)
+	})
+*/
+func (rfl *RollingFileLogger) SetMaxFileAge(maxAge time.Duration, onDelete func(deletedFilePaths []string)) error {
+	rfl.maxFileAge = maxAge
+	rfl.onDelete = onDelete
+	return rfl.deleteExpiredFiles()
+}
+
+/*
+rolledFilePaths returns every file this logger has rolled out, including the current one.
+*/
+func (rfl *RollingFileLogger) rolledFilePaths() ([]string, error) {
+	return rfl.rolledFilePathsWithSuffix("")
+}
+
+/*
+rolledFilePathsWithSuffix returns the paths of the rolled files with suffix added to the end (such as ".gz"). Only
+files named like the logger names them (the base name, a timestamp in FileNameTimeLayout, and maybe a "(N)" that
+makes the name unique) are returned, so that other files that happen to start with the base name, such as
+app_audit.log next to app.log, are never touched.
+*/
+func (rfl *RollingFileLogger) rolledFilePathsWithSuffix(suffix string) ([]string, error) {
+	dir := filepath.Dir(rfl.baseFilePath)
+	ext := filepath.Ext(rfl.baseFilePath)
+	stem := filepath.Base(rfl.baseFilePath[:len(rfl.baseFilePath)-len(ext)])
+	pattern := stem + "*" + ext + suffix
+
+	filePaths, err := filepath.Glob(filepath.Join(dir, pattern))
+	if err != nil {
+		return nil, err
+	}
+	bucketedFilePaths, err := filepath.Glob(filepath.Join(dir, "[0-9][0-9][0-9][0-9]", "[0-9][0-9]", "[0-9][0-9]", pattern))
+	if err != nil {
+		return nil, err
+	}
+
+	var rolledFilePaths []string
+	for _, filePath := range append(filePaths, bucketedFilePaths...) {
+		if isRolledFileName(filepath.Base(filePath), stem, ext+suffix) {
+			rolledFilePaths = append(rolledFilePaths, filePath)
+		}
+	}
+	return rolledFilePaths, nil
+}
+
+/*
+isRolledFileName returns true if name is stem, a timestamp in FileNameTimeLayout (as getTimestampedFileName writes
+it), an optional "(N)", and ext.
+*/
+func isRolledFileName(name, stem, ext string) bool {
+	if len(name) < len(stem)+len(ext) || !strings.HasPrefix(name, stem) || !strings.HasSuffix(name, ext) {
+		return false
+	}
+	timestamp := name[len(stem) : len(name)-len(ext)]
+	if strings.HasSuffix(timestamp, ")") {
+		if openParen := strings.LastIndex(timestamp, "("); openParen >= 0 {
+			if _, err := strconv.Atoi(timestamp[openParen+1 : len(timestamp)-1]); err == nil {
+				timestamp = timestamp[:openParen]
+			}
+		}
+	}
+	_, err := time.Parse(fileNameSafe(FileNameTimeLayout), timestamp)
+	return err == nil
+}
+
+/*
+deleteExpiredFiles deletes the rolled files that are older than maxFileAge. Returns the first error.
+*/
+func (rfl *RollingFileLogger) deleteExpiredFiles() error {
+	if rfl.maxFileAge <= 0 {
+		return nil
+	}
+	filePaths, err := rfl.rolledFilePaths()
+	if err != nil {
+		return err
+	}
+
+	rfl.mutex.Lock()
+	currentFilePath := rfl.logFilePath
+	rfl.mutex.Unlock()
+
+	var deleted []string
+	var firstErr error
+	cutoff := Clock().Add(-rfl.maxFileAge)
+	for _, filePath := range filePaths {
+		if filePath == currentFilePath {
+			continue
+		}
+		info, err := os.Stat(filePath)
+		if err != nil || !info.ModTime().Before(cutoff) {
+			continue
+		}
+		if err = os.Remove(filePath); err != nil {
+			if firstErr == nil {
+				firstErr = err
+			}
+			continue
+		}
+		os.Remove(filePath + ChecksumSuffix)
+		deleted = append(deleted, filePath)
+		removeEmptyTimeBuckets(filepath.Dir(filePath), filepath.Dir(rfl.baseFilePath))
+	}
+
+	if len(deleted) > 0 {
+		diagnose(NewInfo(fmt.Sprintf("deleted expired log files: %v", deleted)))
+		if rfl.onDelete != nil {
+			rfl.onDelete(deleted)
+		}
+	}
+	return firstErr
+}
+
+/*
+removeEmptyTimeBuckets removes dir and its parents, stopping at baseDir or at the first one that isn't empty.
+*/
+func removeEmptyTimeBuckets(dir, baseDir string) {
+	for dir != baseDir && len(dir) > len(baseDir) {
+		if os.Remove(dir) != nil {
+			return
+		}
+		dir = filepath.Dir(dir)
+	}
+}
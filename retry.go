@@ -0,0 +1,172 @@
+package sherlog
+
+import (
+	"context"
+	"math/rand"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	defaultInitialBackoff = 100 * time.Millisecond
+	defaultMaxBackoff     = 10 * time.Second
+	defaultBackoffFactor  = 2
+)
+
+/*
+DefaultRetryPolicy makes 3 attempts, waiting about 100ms and then about 200ms between them.
+*/
+var DefaultRetryPolicy = RetryPolicy{
+	MaxAttempts:    3,
+	InitialBackoff: defaultInitialBackoff,
+	MaxBackoff:     defaultMaxBackoff,
+	Multiplier:     defaultBackoffFactor,
+	Jitter:         0.2,
+}
+
+/*
+RetryPolicy decides how remote sinks retry failed sends: how many times, how long to wait in between (growing
+exponentially, with random jitter so that many processes don't retry in lockstep), and which errors are worth
+retrying. The zero value makes a single attempt.
+*/
+type RetryPolicy struct {
+	// MaxAttempts is the most attempts made, counting the first one. 0 or 1 means no retries.
+	MaxAttempts int
+
+	// InitialBackoff is how long to wait before the first retry. Defaults to 100ms.
+	InitialBackoff time.Duration
+
+	// MaxBackoff caps the wait between retries. Defaults to 10 seconds.
+	MaxBackoff time.Duration
+
+	// Multiplier is what the wait is multiplied by after each retry. Defaults to 2.
+	Multiplier float64
+
+	// Jitter randomizes each wait by up to this fraction of it in either direction, such as 0.2 for ±20%.
+	Jitter float64
+
+	// Retryable decides whether err is worth retrying. Defaults to IsRetryable.
+	Retryable func(err error) bool
+}
+
+/*
+RetryCounts counts retries, either of one sink (see HTTPShipper.Retries and FluentLogger.Retries) or of every
+RetryPolicy in the process (see Retries).
+*/
+type RetryCounts struct {
+	// Retries is how many times a failed send was retried.
+	Retries uint64
+
+	// Exhausted is how many sends still failed after being retried as many times as their policy allowed.
+	Exhausted uint64
+}
+
+var retryCounts RetryCounts
+
+/*
+Retries returns the retry counts of every RetryPolicy in the process so far. They are also published with expvar under "sherlog_retries" once
+TrackStats has been called.
+*/
+func Retries() RetryCounts {
+	return retryCounts.load()
+}
+
+/*
+load returns a copy of the counts that is safe to read while they are being counted.
+*/
+func (rc *RetryCounts) load() RetryCounts {
+	return RetryCounts{
+		Retries:   atomic.LoadUint64(&rc.Retries),
+		Exhausted: atomic.LoadUint64(&rc.Exhausted),
+	}
+}
+
+/*
+IsRetryable is the default RetryPolicy.Retryable. Only failures to reach a destination are retried (see
+ErrDestinationUnavailable). Entries that a destination rejected (see ErrRejected) or couldn't be formatted would
+just fail again.
+*/
+func IsRetryable(err error) bool {
+	return Is(err, ErrDestinationUnavailable)
+}
+
+/*
+Do calls attempt until it succeeds, returns an error that isn't retryable, or runs out of attempts, waiting between
+attempts as the policy says. Gives up early if ctx is done while waiting. Returns the last error.
+*/
+func (rp RetryPolicy) Do(ctx context.Context, attempt func() error) error {
+	return rp.do(ctx, nil, attempt)
+}
+
+/*
+do is Do, also counting the retries in counts unless it is nil. Nothing is held while waiting between attempts, so
+an attempt that needs a lock has to take it itself.
+*/
+func (rp RetryPolicy) do(ctx context.Context, counts *RetryCounts, attempt func() error) error {
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	retryable := rp.Retryable
+	if retryable == nil {
+		retryable = IsRetryable
+	}
+	backoff := rp.InitialBackoff
+	if backoff <= 0 {
+		backoff = defaultInitialBackoff
+	}
+	for attempts := 1; ; attempts++ {
+		err := attempt()
+		if err == nil || !retryable(err) {
+			return err
+		}
+		if attempts >= rp.MaxAttempts {
+			if attempts > 1 {
+				atomic.AddUint64(&retryCounts.Exhausted, 1)
+				if counts != nil {
+					atomic.AddUint64(&counts.Exhausted, 1)
+				}
+			}
+			return err
+		}
+		timer := time.NewTimer(rp.jittered(backoff))
+		select {
+		case <-timer.C:
+		case <-ctx.Done():
+			timer.Stop()
+			return err
+		}
+		atomic.AddUint64(&retryCounts.Retries, 1)
+		if counts != nil {
+			atomic.AddUint64(&counts.Retries, 1)
+		}
+		backoff = rp.next(backoff)
+	}
+}
+
+/*
+jittered randomizes backoff by up to Jitter in either direction.
+*/
+func (rp RetryPolicy) jittered(backoff time.Duration) time.Duration {
+	if rp.Jitter <= 0 {
+		return backoff
+	}
+	return time.Duration(float64(backoff) * (1 + rp.Jitter*(rand.Float64()*2-1)))
+}
+
+/*
+next returns the wait after backoff.
+*/
+func (rp RetryPolicy) next(backoff time.Duration) time.Duration {
+	multiplier := rp.Multiplier
+	if multiplier <= 0 {
+		multiplier = defaultBackoffFactor
+	}
+	maxBackoff := rp.MaxBackoff
+	if maxBackoff <= 0 {
+		maxBackoff = defaultMaxBackoff
+	}
+	if next := time.Duration(float64(backoff) * multiplier); next < maxBackoff {
+		return next
+	}
+	return maxBackoff
+}
@@ -0,0 +1,288 @@
+package sherlog
+
+import (
+	"encoding/binary"
+	"io/ioutil"
+	"os"
+	"sync"
+)
+
+const (
+	// RingFileHeaderSize is the size of the header at the start of every ring file.
+	RingFileHeaderSize = 64
+
+	ringFileMagic      = "SHRLRING"
+	ringWrapMarker     = 0xffffffff
+	ringRecordOverhead = 4
+)
+
+/*
+RingFile is a fixed-size file that holds the most recent entries like a flight recorder: once it is full, every
+new entry overwrites the oldest ones. It is memory-mapped where the system supports it (Linux, macOS, and the BSDs),
+so entries are in the file as soon as they are written and survive the process crashing, without any syscalls on
+the hot path. Elsewhere, every entry is also written to the file with WriteAt. Use it on devices with tiny disks
+where rolling files is overkill:
+
+	ring, _ := sherlog.OpenRingFile("/var/log/app.ring", 4*1024*1024)
+	logger := sherlog.NewMultiWriterLogger(ring)
+
+Every Write is one entry. Read the entries back, oldest first, with ReadRingFile (or the sherlog-ringdump command).
+The file starts with a RingFileHeaderSize byte header:
+
+	magic      8 bytes, "SHRLRING"
+	data size  8 bytes, big endian, the size of the area after the header that holds the entries
+	head       8 bytes, big endian, where in the data area the next entry goes
+	tail       8 bytes, big endian, where in the data area the oldest entry is
+	count      8 bytes, big endian, the number of entries
+
+Each entry is its length (4 bytes, big endian) followed by its bytes. A length of 0xffffffff (or fewer than 4 bytes
+left) means that the next entry is at the start of the data area. The header is updated so that it only ever
+describes entries that were completely written. Is thread safe :)
+*/
+type RingFile struct {
+	file   *os.File
+	region []byte
+	mapped bool
+	data   []byte
+	closed bool
+	mutex  *sync.Mutex
+}
+
+/*
+OpenRingFile opens the ring file at filePath, creating it with room for size bytes (including the header) if it
+doesn't exist. A ring file that already exists with the same size keeps its entries, anything else at filePath is
+replaced by an empty ring.
+*/
+func OpenRingFile(filePath string, size int) (*RingFile, error) {
+	if size <= RingFileHeaderSize+ringRecordOverhead {
+		return nil, AsError("ring files must be bigger than ", RingFileHeaderSize+ringRecordOverhead, " bytes")
+	}
+	file, err := os.OpenFile(longPath(filePath), os.O_RDWR|os.O_CREATE, 0644)
+	if err != nil {
+		return nil, AsError(err)
+	}
+	info, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return nil, AsError(err)
+	}
+	reuse := info.Size() == int64(size)
+	if !reuse {
+		if err = file.Truncate(int64(size)); err != nil {
+			file.Close()
+			return nil, AsError(err)
+		}
+	}
+	region, mapped, err := mapRing(file, size)
+	if err != nil {
+		file.Close()
+		return nil, AsError(err)
+	}
+
+	rf := &RingFile{
+		file:   file,
+		region: region,
+		mapped: mapped,
+		data:   region[RingFileHeaderSize:],
+		mutex:  new(sync.Mutex),
+	}
+	if reuse && rf.validHeader() {
+		return rf, nil
+	}
+	for i := range rf.region[:RingFileHeaderSize] {
+		rf.region[i] = 0
+	}
+	copy(rf.region, ringFileMagic)
+	binary.BigEndian.PutUint64(rf.region[8:], uint64(len(rf.data)))
+	if err = rf.persist(0, RingFileHeaderSize); err != nil {
+		rf.Close()
+		return nil, AsError(err)
+	}
+	return rf, nil
+}
+
+/*
+validHeader returns true if the header is one that a RingFile of this size wrote.
+*/
+func (rf *RingFile) validHeader() bool {
+	return string(rf.region[:8]) == ringFileMagic &&
+		binary.BigEndian.Uint64(rf.region[8:]) == uint64(len(rf.data)) &&
+		validRingState(rf.region, len(rf.data))
+}
+
+/*
+validRingState returns true if the head, tail, and count in header fit in a data area of dataSize bytes. They are
+checked before they are converted to ints, so that huge values from a corrupt file can't turn negative.
+*/
+func validRingState(header []byte, dataSize int) bool {
+	size := uint64(dataSize)
+	return binary.BigEndian.Uint64(header[16:]) <= size &&
+		binary.BigEndian.Uint64(header[24:]) <= size &&
+		binary.BigEndian.Uint64(header[32:]) <= size/ringRecordOverhead
+}
+
+/*
+state returns the head, tail, and count from the header. Only call it once the header is known to be valid.
+*/
+func (rf *RingFile) state() (head, tail, count int) {
+	return int(binary.BigEndian.Uint64(rf.region[16:])),
+		int(binary.BigEndian.Uint64(rf.region[24:])),
+		int(binary.BigEndian.Uint64(rf.region[32:]))
+}
+
+/*
+setState writes head, tail, and count to the header.
+*/
+func (rf *RingFile) setState(head, tail, count int) error {
+	binary.BigEndian.PutUint64(rf.region[16:], uint64(head))
+	binary.BigEndian.PutUint64(rf.region[24:], uint64(tail))
+	binary.BigEndian.PutUint64(rf.region[32:], uint64(count))
+	return rf.persist(16, 40)
+}
+
+/*
+persist makes sure the bytes of the file from start to end are written. Only needed where the file isn't mapped.
+*/
+func (rf *RingFile) persist(start, end int) error {
+	if rf.mapped {
+		return nil
+	}
+	_, err := rf.file.WriteAt(rf.region[start:end], int64(start))
+	return err
+}
+
+/*
+Write adds p to the ring as one entry, overwriting the oldest entries if there isn't enough room. Entries that are
+bigger than the ring are cut short. Is thread safe :)
+*/
+func (rf *RingFile) Write(p []byte) (int, error) {
+	entry := p
+	if maxLength := len(rf.data) - ringRecordOverhead; len(entry) > maxLength {
+		entry = entry[:maxLength]
+	}
+	need := ringRecordOverhead + len(entry)
+
+	rf.mutex.Lock()
+	defer rf.mutex.Unlock()
+	if rf.closed {
+		return 0, loggerFailure(ErrLoggerClosed)
+	}
+	head, tail, count := rf.state()
+	if head+need > len(rf.data) {
+		tail, count = rf.evict(head, len(rf.data), tail, count)
+		if err := rf.setState(head, tail, count); err != nil {
+			return 0, err
+		}
+		if head+ringRecordOverhead <= len(rf.data) {
+			binary.BigEndian.PutUint32(rf.data[head:], ringWrapMarker)
+			if err := rf.persist(RingFileHeaderSize+head, RingFileHeaderSize+head+ringRecordOverhead); err != nil {
+				return 0, err
+			}
+		}
+		head = 0
+	}
+	tail, count = rf.evict(head, head+need, tail, count)
+	if count == 0 {
+		tail = head
+	}
+	// Forget the overwritten entries before overwriting them, and only count the new one once it is all there
+	if err := rf.setState(head, tail, count); err != nil {
+		return 0, err
+	}
+
+	binary.BigEndian.PutUint32(rf.data[head:], uint32(len(entry)))
+	copy(rf.data[head+ringRecordOverhead:], entry)
+	if err := rf.persist(RingFileHeaderSize+head, RingFileHeaderSize+head+need); err != nil {
+		return 0, err
+	}
+	if err := rf.setState(head+need, tail, count+1); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
+
+/*
+evict moves tail past the entries that are in the data area from start to end, so that they can be overwritten.
+Returns the new tail and count.
+*/
+func (rf *RingFile) evict(start, end, tail, count int) (int, int) {
+	for count > 0 && tail >= start && tail < end {
+		tail += ringRecordOverhead + int(binary.BigEndian.Uint32(rf.data[tail:]))
+		count--
+		if count > 0 {
+			tail, _ = ringRecordAt(rf.data, tail)
+		}
+	}
+	return tail, count
+}
+
+/*
+ringRecordAt returns where the entry at position really starts (at the start of the data area if there is a wrap
+marker at position) and its length.
+*/
+func ringRecordAt(data []byte, position int) (int, int) {
+	if position+ringRecordOverhead > len(data) || binary.BigEndian.Uint32(data[position:]) == ringWrapMarker {
+		position = 0
+	}
+	return position, int(binary.BigEndian.Uint32(data[position:]))
+}
+
+/*
+Close unmaps and closes the file.
+*/
+func (rf *RingFile) Close() error {
+	rf.mutex.Lock()
+	defer rf.mutex.Unlock()
+	if rf.closed {
+		return nil
+	}
+	rf.closed = true
+	var err error
+	if rf.mapped {
+		err = unmapRing(rf.region)
+		rf.mapped = false
+	}
+	if closeErr := rf.file.Close(); err == nil {
+		err = closeErr
+	}
+	return err
+}
+
+/*
+ReadRingFile returns the entries in the ring file at filePath, oldest first. It only reads the file, so it can be
+used on the file of a process that crashed, or while a process is still writing to it.
+*/
+func ReadRingFile(filePath string) ([][]byte, error) {
+	content, err := ioutil.ReadFile(longPath(filePath))
+	if err != nil {
+		return nil, AsError(err)
+	}
+	if len(content) < RingFileHeaderSize || string(content[:8]) != ringFileMagic {
+		return nil, AsError(filePath, " is not a ring file")
+	}
+	data := content[RingFileHeaderSize:]
+	if binary.BigEndian.Uint64(content[8:]) != uint64(len(data)) {
+		return nil, AsError(filePath, " is not a complete ring file")
+	}
+	if !validRingState(content, len(data)) {
+		return nil, AsError(filePath, " is corrupt")
+	}
+
+	position := int(binary.BigEndian.Uint64(content[24:]))
+	count := int(binary.BigEndian.Uint64(content[32:]))
+	entries := make([][]byte, 0, count)
+	for i := 0; i < count; i++ {
+		if position > len(data) {
+			return entries, AsError(filePath, " is corrupt")
+		}
+		var length int
+		position, length = ringRecordAt(data, position)
+		start := position + ringRecordOverhead
+		if length < 0 || uint64(start)+uint64(length) > uint64(len(data)) {
+			return entries, AsError(filePath, " is corrupt")
+		}
+		entries = append(entries, data[start:start+length])
+		position = start + length
+	}
+	return entries, nil
+}
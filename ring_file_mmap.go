@@ -0,0 +1,27 @@
+//go:build linux || darwin || freebsd || netbsd || openbsd || dragonfly
+// +build linux darwin freebsd netbsd openbsd dragonfly
+
+package sherlog
+
+import (
+	"os"
+	"syscall"
+)
+
+/*
+mapRing maps the first size bytes of file into memory, shared so that writes to it go to the file.
+*/
+func mapRing(file *os.File, size int) ([]byte, bool, error) {
+	region, err := syscall.Mmap(int(file.Fd()), 0, size, syscall.PROT_READ|syscall.PROT_WRITE, syscall.MAP_SHARED)
+	if err != nil {
+		return nil, false, err
+	}
+	return region, true, nil
+}
+
+/*
+unmapRing unmaps a region returned by mapRing.
+*/
+func unmapRing(region []byte) error {
+	return syscall.Munmap(region)
+}
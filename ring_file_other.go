@@ -0,0 +1,28 @@
+//go:build !linux && !darwin && !freebsd && !netbsd && !openbsd && !dragonfly
+// +build !linux,!darwin,!freebsd,!netbsd,!openbsd,!dragonfly
+
+package sherlog
+
+import (
+	"io"
+	"os"
+)
+
+/*
+mapRing reads the first size bytes of file into memory, since the file can't be mapped. RingFile writes what it
+changes back with WriteAt.
+*/
+func mapRing(file *os.File, size int) ([]byte, bool, error) {
+	region := make([]byte, size)
+	if _, err := file.ReadAt(region, 0); err != nil && err != io.EOF {
+		return nil, false, err
+	}
+	return region, false, nil
+}
+
+/*
+unmapRing does nothing, since mapRing never maps anything here.
+*/
+func unmapRing(region []byte) error {
+	return nil
+}
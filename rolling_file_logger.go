@@ -1,10 +1,11 @@
 package sherlog
 
 import (
-	"fmt"
 	"os"
 	"path/filepath"
+	"strconv"
 	"strings"
+	"sync/atomic"
 	"time"
 )
 
@@ -13,8 +14,27 @@ RollingFileLogger is a logger that will automatically start a new log file after
 */
 type RollingFileLogger struct {
 	FileLogger
-	baseFilePath string
-	running      bool
+	baseFilePath   string
+	running        int32         // 1 until Close is called. Accessed atomically
+	stop           chan struct{} // Closed by Close to stop the scheduled rolls
+	timeBucketed   bool
+	onRoll         func(rolledFilePath string)
+	maxFileAge     time.Duration
+	onDelete       func(deletedFilePaths []string)
+	writeChecksums bool
+	currentLink    bool
+	lastRoll       time.Time
+
+	preallocateSize  int64
+	standbyFile      *os.File
+	preparingStandby bool
+}
+
+/*
+Roller is implemented by loggers that can be told to start a new file.
+*/
+type Roller interface {
+	Roll() error
 }
 
 /*
@@ -28,6 +48,8 @@ func NewNightlyRollingFileLogger(logFilePath string) (*RollingFileLogger, error)
 	rollingFileLogger := &RollingFileLogger{
 		FileLogger:   *fileLogger,
 		baseFilePath: logFilePath,
+		running:      1,
+		stop:         make(chan struct{}),
 	}
 	go rollingFileLogger.rollNightly()
 	return rollingFileLogger, nil
@@ -44,55 +66,186 @@ func NewCustomRollingFileLogger(logFilePath string, duration time.Duration) (*Ro
 	rollingFileLogger := &RollingFileLogger{
 		FileLogger:   *fileLogger,
 		baseFilePath: logFilePath,
+		running:      1,
+		stop:         make(chan struct{}),
 	}
 	go rollingFileLogger.rollEvery(duration)
 	return rollingFileLogger, nil
 }
 
 /*
-Close closes the file writer.
+Close closes the file writer and stops the scheduled rolls.
 */
 func (rfl *RollingFileLogger) Close() {
-	rfl.running = false
+	if atomic.CompareAndSwapInt32(&rfl.running, 1, 0) {
+		close(rfl.stop)
+	}
 	rfl.FileLogger.Close()
+	rfl.mutex.Lock()
+	defer rfl.mutex.Unlock()
+	rfl.discardStandby()
 }
 
 func (rfl *RollingFileLogger) rollEvery(duration time.Duration) {
-	rfl.running = true
-	for rfl.running {
+	for atomic.LoadInt32(&rfl.running) == 1 {
 		rfl.rollIn(duration)
 	}
 }
 
 func (rfl *RollingFileLogger) rollNightly() {
-	rfl.running = true
-	for rfl.running {
+	for atomic.LoadInt32(&rfl.running) == 1 {
 		rfl.rollIn(getDurationUntilTomorrowAtMidnight())
 	}
 }
 
+/*
+rollIn rolls once duration has passed, unless the logger is closed first.
+*/
 func (rfl *RollingFileLogger) rollIn(duration time.Duration) {
-	time.Sleep(duration)
-	rfl.roll()
+	timer := time.NewTimer(duration)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+	case <-rfl.stop:
+		return
+	}
+	if err := rfl.roll(); err != nil && !Is(err, ErrLoggerClosed) {
+		diagnose(AsOpsError("scheduled roll of ", rfl.baseFilePath, " failed: ", err))
+	}
+}
+
+/*
+SetTimeBucketedDirs turns on/off placing new log files under YYYY/MM/DD subdirectories of the directory that
+logFilePath is in, so that a long running service doesn't end up with thousands of files in one directory.
+The subdirectories are created automatically. Changing it starts a new file right away. The previous file is
+deleted if nothing was logged to it yet. Off by default.
+*/
+func (rfl *RollingFileLogger) SetTimeBucketedDirs(bucketed bool) error {
+	// openNextFile takes the mutex itself, so it is only held while setting the flag
+	rfl.mutex.Lock()
+	rfl.timeBucketed = bucketed
+	rfl.mutex.Unlock()
+	oldFilePath, err := rfl.openNextFile()
+	if info, statErr := os.Stat(oldFilePath); statErr == nil && info.Size() == 0 && oldFilePath != rfl.logFilePath {
+		os.Remove(oldFilePath)
+	}
+	return err
+}
+
+/*
+SetOnRoll registers a function that is called with the path of the file that was just closed every time the
+logger rolls, whether it was on schedule or forced with Roll. Use it to hand finished files to a log shipper.
+*/
+func (rfl *RollingFileLogger) SetOnRoll(onRoll func(rolledFilePath string)) {
+	rfl.mutex.Lock()
+	defer rfl.mutex.Unlock()
+	rfl.onRoll = onRoll
+}
+
+/*
+Roll starts a new file right away instead of waiting for the next scheduled roll. Use it at release boundaries
+or from an admin endpoint so the old file can be shipped. Is thread safe :)
+*/
+func (rfl *RollingFileLogger) Roll() error {
+	return rfl.roll()
 }
 
 func (rfl *RollingFileLogger) roll() error {
+	rolledFilePath, err := rfl.openNextFile()
+	if err != nil {
+		return err
+	}
+	rfl.mutex.Lock()
+	rfl.lastRoll = Clock()
+	writeChecksums, onRoll := rfl.writeChecksums, rfl.onRoll
+	rfl.mutex.Unlock()
+	if writeChecksums {
+		if _, err = WriteChecksumFile(rolledFilePath); err != nil {
+			return err
+		}
+	}
+	if onRoll != nil {
+		onRoll(rolledFilePath)
+	}
+	return rfl.deleteExpiredFiles()
+}
+
+/*
+LastRollTime returns when the logger last rolled to a new file, or the zero time if it hasn't rolled yet.
+*/
+func (rfl *RollingFileLogger) LastRollTime() time.Time {
+	rfl.mutex.Lock()
+	defer rfl.mutex.Unlock()
+	return rfl.lastRoll
+}
+
+/*
+openNextFile closes the current file and opens the next one. Returns the path of the file that was closed.
+*/
+func (rfl *RollingFileLogger) openNextFile() (string, error) {
 	rfl.mutex.Lock()
 	defer rfl.mutex.Unlock()
+	previousFilePath := rfl.logFilePath
+	if rfl.closed {
+		return previousFilePath, loggerFailure(ErrLoggerClosed)
+	}
+	if rfl.preallocateSize > 0 {
+		releaseUnusedSpace(rfl.file)
+	}
 	rfl.file.Close()
-	rfl.logFilePath = getTimestampedFileName(rfl.baseFilePath)
-	newFile, err := openFile(rfl.logFilePath)
+	logFilePath, err := rfl.nextFilePath()
+	if err != nil {
+		return previousFilePath, err
+	}
+	rfl.logFilePath = logFilePath
+	newFile := rfl.takeStandby(logFilePath)
+	if newFile == nil {
+		newFile, err = openFile(rfl.logFilePath)
+	}
 	rfl.file = newFile
-	return err
+	if rfl.preallocateSize > 0 {
+		rfl.prepareStandbyInBackground()
+	}
+	if err == nil && rfl.currentLink {
+		err = rfl.updateCurrentLink()
+	}
+	return previousFilePath, err
+}
+
+/*
+nextFilePath returns the path of the next file to log to, creating the time bucket directories if necessary.
+*/
+func (rfl *RollingFileLogger) nextFilePath() (string, error) {
+	if !rfl.timeBucketed {
+		return getTimestampedFileName(rfl.baseFilePath), nil
+	}
+	now := Clock().In(Location)
+	dir := filepath.Join(filepath.Dir(rfl.baseFilePath), now.Format("2006"), now.Format("01"), now.Format("02"))
+	if err := os.MkdirAll(longPath(dir), 0755); err != nil {
+		return "", err
+	}
+	return getTimestampedFileName(filepath.Join(dir, filepath.Base(rfl.baseFilePath))), nil
 }
 
 func getTimestampedFileName(fileName string) string {
-	now := time.Now().In(Location)
+	now := Clock().In(Location)
 	ext := filepath.Ext(fileName)
-	fileName = fileName[:len(fileName)-len(ext)] + now.Format(timeFileNameFmt) + ext
+	fileName = fileName[:len(fileName)-len(ext)] + fileNameSafe(now.Format(FileNameTimeLayout)) + ext
 	return incFileNameUntilNotExists(fileName)
 }
 
+/*
+fileNameSafe replaces the characters that Windows does not allow in file names with dashes.
+*/
+func fileNameSafe(name string) string {
+	return strings.Map(func(r rune) rune {
+		if strings.ContainsRune(`<>:"/\|?*`, r) || r < ' ' {
+			return '-'
+		}
+		return r
+	}, name)
+}
+
 func incFileNameUntilNotExists(fileName string) string {
 	for fileExists(fileName) {
 		fileName = incFileName(fileName)
@@ -105,23 +258,25 @@ func fileExists(fileName string) bool {
 	return !os.IsNotExist(err)
 }
 
-// Assumes that a file that has ")" right before the extension needs the number inside incremented
+// Assumes that a file that has "(N)" right before the extension needs N incremented. Only the file name is looked
+// at, so parentheses in the directory (such as C:\Program Files (x86)) are left alone.
 func incFileName(fileName string) string {
 	ext := filepath.Ext(fileName)
 	fileName = fileName[:len(fileName)-len(ext)]
 	var fileVersion int
-	if fileName[len(fileName)-1] == ')' {
-		firstParenIndex := strings.Index(fileName, "(")
-		fmt.Fscanf(strings.NewReader(fileName), fileName[:firstParenIndex]+"(%d)", &fileVersion)
-		fileName = fileName[:firstParenIndex]
+	if openParenIndex := strings.LastIndex(fileName, "("); strings.HasSuffix(fileName, ")") && openParenIndex >= len(fileName)-len(filepath.Base(fileName)) {
+		if version, err := strconv.Atoi(fileName[openParenIndex+1 : len(fileName)-1]); err == nil {
+			fileVersion = version
+			fileName = fileName[:openParenIndex]
+		}
 	}
 	fileVersion++
 
-	return fmt.Sprintf(fileName+"(%d)"+ext, fileVersion)
+	return fileName + "(" + strconv.Itoa(fileVersion) + ")" + ext
 }
 
 func getDurationUntilTomorrowAtMidnight() time.Duration {
-	now := time.Now().In(Location)
+	now := Clock().In(Location)
 	tomorrow := now.AddDate(0, 0, 1)
 	tomorrow = time.Date(tomorrow.Year(), tomorrow.Month(), tomorrow.Day(), 0, 0, 0, 1, Location) // Tomorrow at midnight
 	return tomorrow.Sub(now)
@@ -132,7 +287,7 @@ Critical turns values into a *LeveledException with level CRITICAL and then call
 Log function.
 */
 func (rfl *RollingFileLogger) Critical(values ...interface{}) error {
-	return rfl.Log(graduateOrConcatAndCreate(EnumCritical, values...))
+	return rfl.Log(rfl.graduate(EnumCritical, values...))
 }
 
 /*
@@ -140,7 +295,7 @@ Error turns values into a *LeveledException with level ERROR and then calls the
 Log function.
 */
 func (rfl *RollingFileLogger) Error(values ...interface{}) error {
-	return rfl.Log(graduateOrConcatAndCreate(EnumError, values...))
+	return rfl.Log(rfl.graduate(EnumError, values...))
 }
 
 /*
@@ -148,7 +303,7 @@ OpsError turns values into a *LeveledException with level OPS_ERROR and then cal
 Log function.
 */
 func (rfl *RollingFileLogger) OpsError(values ...interface{}) error {
-	return rfl.Log(graduateOrConcatAndCreate(EnumOpsError, values...))
+	return rfl.Log(rfl.graduate(EnumOpsError, values...))
 }
 
 /*
@@ -156,7 +311,7 @@ Warn turns values into a *LeveledException with level WARNING and then calls the
 Log function.
 */
 func (rfl *RollingFileLogger) Warn(values ...interface{}) error {
-	return rfl.Log(graduateOrConcatAndCreate(EnumWarning, values...))
+	return rfl.Log(rfl.graduate(EnumWarning, values...))
 }
 
 /*
@@ -164,7 +319,7 @@ Info turns values into a *LeveledException with level INFO and then calls the lo
 Log function.
 */
 func (rfl *RollingFileLogger) Info(values ...interface{}) error {
-	return rfl.Log(graduateOrConcatAndCreate(EnumInfo, values...))
+	return rfl.Log(rfl.graduate(EnumInfo, values...))
 }
 
 /*
@@ -172,5 +327,5 @@ Debug turns values into a *LeveledException with level DEBUG and then calls the
 Log function.
 */
 func (rfl *RollingFileLogger) Debug(values ...interface{}) error {
-	return rfl.Log(graduateOrConcatAndCreate(EnumDebug, values...))
+	return rfl.Log(rfl.graduate(EnumDebug, values...))
 }
@@ -0,0 +1,64 @@
+package sherlog
+
+import "math/rand"
+
+/*
+SamplingPolicy decides what fraction of entries to keep for each level.
+*/
+type SamplingPolicy struct {
+	// Rates maps a level to the fraction (0 to 1) of its entries that are kept. Levels that aren't in Rates,
+	// and entries without a level, are always kept.
+	Rates map[Level]float64
+
+	// AlwaysKeep is the least severe level that bypasses sampling. Entries at this level or more severe are
+	// always kept, no matter what Rates says. Defaults to EnumCritical.
+	AlwaysKeep Level
+}
+
+/*
+NewSampler returns a Middleware that randomly drops entries according to policy. Since it is a Middleware, the
+same sampler can be configured once and then used by every destination:
+
+	sampler := sherlog.NewSampler(sherlog.SamplingPolicy{
+		Rates: map[sherlog.Level]float64{
+			sherlog.EnumInfo:  0.01,
+			sherlog.EnumDebug: 0,
+		},
+	})
+	fileLogger.Use(sampler)
+	shipper.Use(sampler)
+
+When Log is given multiple errors, the first one decides whether they get kept.
+*/
+func NewSampler(policy SamplingPolicy) Middleware {
+	if policy.AlwaysKeep == nil {
+		policy.AlwaysKeep = EnumCritical
+	}
+	return func(next LogFunc) LogFunc {
+		return func(values ...interface{}) error {
+			if len(values) > 0 && !policy.keeps(values[0]) {
+				return nil
+			}
+			return next(values...)
+		}
+	}
+}
+
+/*
+keeps randomly decides whether toLog should be kept.
+*/
+func (sp *SamplingPolicy) keeps(toLog interface{}) bool {
+	err, isErr := toLog.(error)
+	if !isErr {
+		return true
+	}
+	level := LevelOf(err)
+	if level == nil || level.GetLevelId() <= sp.AlwaysKeep.GetLevelId() {
+		return true
+	}
+	rate, hasRate := sp.Rates[level]
+	if !hasRate || rate >= 1 {
+		return true
+	}
+	return rate > 0 && rand.Float64() < rate
+}
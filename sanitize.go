@@ -0,0 +1,112 @@
+package sherlog
+
+import (
+	"strings"
+	"unicode/utf8"
+)
+
+const escapeChar = 0x1b
+
+/*
+lineBreakEscapes maps the characters that start a new line to how sanitizeText escapes them.
+*/
+var lineBreakEscapes = map[rune]string{'\n': `\n`, '\r': `\r`, '\u2028': `\u2028`, '\u2029': `\u2029`}
+
+/*
+sanitizeText cleans up text (a message or field value) before it is written in a text format, so that a message
+can't forge fake entries or mess with the terminal of whoever reads the file: invalid UTF-8 is replaced with
+U+FFFD, ANSI escape sequences and control characters (except tabs) are removed, and line breaks are escaped as
+\n, \r, \u2028, and \u2029 if escapeNewlines is true. Returns text unchanged if SanitizeText is off.
+*/
+func sanitizeText(text string, escapeNewlines bool) string {
+	if !SanitizeText || isCleanText(text) {
+		return text
+	}
+	var buf strings.Builder
+	buf.Grow(len(text))
+	for i := 0; i < len(text); {
+		r, size := utf8.DecodeRuneInString(text[i:])
+		switch {
+		case r == utf8.RuneError && size == 1:
+			buf.WriteRune(utf8.RuneError)
+		case r == escapeChar:
+			size = ansiSequenceLen(text[i:])
+		case lineBreakEscapes[r] != "":
+			if escapeNewlines {
+				buf.WriteString(lineBreakEscapes[r])
+			} else {
+				buf.WriteRune(r)
+			}
+		case r == '\t' || !isControl(r):
+			buf.WriteString(text[i : i+size])
+		}
+		i += size
+	}
+	return buf.String()
+}
+
+/*
+isCleanText returns true if text is printable ASCII (or tabs), which is almost always the case and is cheap to
+check.
+*/
+func isCleanText(text string) bool {
+	for i := 0; i < len(text); i++ {
+		if c := text[i]; (c < 0x20 && c != '\t') || c >= 0x7f {
+			return false
+		}
+	}
+	return true
+}
+
+/*
+isControl returns true for C0 and C1 control characters and DEL.
+*/
+func isControl(r rune) bool {
+	return r < 0x20 || (r >= 0x7f && r <= 0x9f)
+}
+
+/*
+ansiSequenceLen returns the length of the ANSI escape sequence at the start of text, which starts with ESC. CSI
+sequences (ESC [ ... final byte) and OSC sequences (ESC ] ... BEL or ESC \) are recognized. Anything else is
+treated as ESC followed by one character.
+*/
+func ansiSequenceLen(text string) int {
+	if len(text) < 2 {
+		return len(text)
+	}
+	switch text[1] {
+	case '[':
+		for i := 2; i < len(text); i++ {
+			if text[i] >= 0x40 && text[i] <= 0x7e {
+				return i + 1
+			}
+		}
+		return len(text)
+	case ']':
+		for i := 2; i < len(text); i++ {
+			if text[i] == 0x07 {
+				return i + 1
+			}
+			if text[i] == escapeChar && i+1 < len(text) && text[i+1] == '\\' {
+				return i + 2
+			}
+		}
+		return len(text)
+	}
+	_, size := utf8.DecodeRuneInString(text[1:])
+	return 1 + size
+}
+
+/*
+capText cuts text down to at most maxBytes, without splitting a UTF-8 character.
+*/
+func capText(text string, maxBytes int) string {
+	if len(text) <= maxBytes {
+		return text
+	}
+	cut := maxBytes
+	for cut > 0 && !utf8.RuneStart(text[cut]) {
+		cut--
+	}
+	return text[:cut]
+}
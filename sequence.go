@@ -0,0 +1,84 @@
+package sherlog
+
+import (
+	"io"
+	"strconv"
+	"sync"
+	"sync/atomic"
+)
+
+var sequenceNumbers = struct {
+	counter uint64
+	on      uint32
+	mutex   sync.Mutex // Held while stamping, so that an exception logged by several goroutines at once gets one number
+}{}
+
+/*
+SetStampSequenceNumbers turns stamping every entry with a sequence number on or off. The number is atomically
+incremented once per entry when it is first handed to a logger (or once per destination for non-sherlog errors,
+since there is nowhere to keep the number on them), so exceptions that are created but never logged don't leave
+gaps, and the same exception carries the same number to every destination. This lets consumers detect lost or
+reordered entries. The number shows up as "#42" after the timestamp in text output and as "Sequence" in json.
+Off by default. Is thread safe :)
+*/
+func SetStampSequenceNumbers(on bool) {
+	var value uint32
+	if on {
+		value = 1
+	}
+	atomic.StoreUint32(&sequenceNumbers.on, value)
+}
+
+/*
+StampingSequenceNumbers returns true if sequence numbers are being stamped (see SetStampSequenceNumbers).
+*/
+func StampingSequenceNumbers() bool {
+	return atomic.LoadUint32(&sequenceNumbers.on) == 1
+}
+
+/*
+nextSequenceNumber returns the next sequence number if sequence numbers are being stamped. Returns 0 otherwise.
+*/
+func nextSequenceNumber() uint64 {
+	if !StampingSequenceNumbers() {
+		return 0
+	}
+	return atomic.AddUint64(&sequenceNumbers.counter, 1)
+}
+
+/*
+stampSequenceNumbers stamps the next sequence number on the sherlog exceptions in values that don't have one yet.
+Loggers call it when they are handed values, before any middleware runs.
+*/
+func stampSequenceNumbers(values []interface{}) {
+	if !StampingSequenceNumbers() {
+		return
+	}
+	sequenceNumbers.mutex.Lock()
+	defer sequenceNumbers.mutex.Unlock()
+	for _, value := range values {
+		if err, isErr := value.(error); isErr {
+			if stdException := stdExceptionOf(err); stdException != nil && stdException.sequenceNumber() == 0 {
+				atomic.StoreUint64(&stdException.sequence, nextSequenceNumber())
+			}
+		}
+	}
+}
+
+/*
+sequenceNumber returns the sequence number stamped on se, or 0 if it hasn't been stamped.
+*/
+func (se *StdException) sequenceNumber() uint64 {
+	return atomic.LoadUint64(&se.sequence)
+}
+
+/*
+writeSequenceNumber writes " - #seq" to writer if seq was stamped.
+*/
+func writeSequenceNumber(writer io.Writer, seq uint64) error {
+	if seq == 0 {
+		return nil
+	}
+	_, err := writer.Write([]byte(" - #" + strconv.FormatUint(seq, 10)))
+	return err
+}
@@ -0,0 +1,119 @@
+package sherlog
+
+import (
+	"io"
+	"runtime/debug"
+	"strings"
+)
+
+/*
+ServiceInfo identifies the service that wrote a log entry. Log aggregators need it to tell services apart when
+several of them write to the same file or stream.
+*/
+type ServiceInfo struct {
+	Name    string
+	Version string
+	Commit  string
+}
+
+var serviceInfo ServiceInfo
+
+/*
+SetServiceInfo stamps name, version, and commit onto every entry. They show up in text output right after the
+timestamp (name@version (commit)) and in json output under the "Service" key. Empty values are left out.
+Call it once at startup, before anything is logged.
+*/
+func SetServiceInfo(name, version, commit string) {
+	serviceInfo = ServiceInfo{
+		Name:    name,
+		Version: version,
+		Commit:  commit,
+	}
+}
+
+/*
+SetServiceInfoFromBuildInfo calls SetServiceInfo with what debug.ReadBuildInfo knows about the main module:
+the last segment of the module path as the name, the module version, and the vcs revision.
+Returns false (and leaves the service info untouched) if the binary has no build info.
+*/
+func SetServiceInfoFromBuildInfo() bool {
+	info, ok := debug.ReadBuildInfo()
+	if !ok {
+		return false
+	}
+	var commit string
+	for _, setting := range info.Settings {
+		if setting.Key == "vcs.revision" {
+			commit = setting.Value
+		}
+	}
+	name := info.Main.Path[strings.LastIndex(info.Main.Path, "/")+1:]
+	SetServiceInfo(name, info.Main.Version, commit)
+	return true
+}
+
+/*
+GetServiceInfo returns the service info set with SetServiceInfo or SetServiceInfoFromBuildInfo.
+*/
+func GetServiceInfo() ServiceInfo {
+	return serviceInfo
+}
+
+func (si ServiceInfo) isEmpty() bool {
+	return si.Name == "" && si.Version == "" && si.Commit == ""
+}
+
+/*
+String returns the service info formatted as name@version (commit), leaving out empty values.
+*/
+func (si ServiceInfo) String() string {
+	var buf strings.Builder
+	buf.WriteString(si.Name)
+	if si.Version != "" {
+		buf.WriteString("@")
+		buf.WriteString(si.Version)
+	}
+	if si.Commit != "" {
+		if buf.Len() > 0 {
+			buf.WriteString(" ")
+		}
+		buf.WriteString("(")
+		buf.WriteString(si.Commit)
+		buf.WriteString(")")
+	}
+	return buf.String()
+}
+
+/*
+toJsonMap returns the map that gets logged under the "Service" json key.
+*/
+func (si ServiceInfo) toJsonMap() map[string]interface{} {
+	jsonMap := map[string]interface{}{}
+	if si.Name != "" {
+		jsonMap["Name"] = si.Name
+	}
+	if si.Version != "" {
+		jsonMap["Version"] = si.Version
+	}
+	if si.Commit != "" {
+		jsonMap["Commit"] = si.Commit
+	}
+	return jsonMap
+}
+
+/*
+maxServiceInfoBytes is how long the service info can get in text output before it is cut short.
+*/
+const maxServiceInfoBytes = 256
+
+/*
+writeServiceInfo writes " - name@version (commit)" to writer if service info has been set. It is sanitized like a
+message and cut short at maxServiceInfoBytes, since the version and commit can come from anywhere at build time.
+*/
+func writeServiceInfo(writer io.Writer) error {
+	if serviceInfo.isEmpty() {
+		return nil
+	}
+	_, err := writer.Write([]byte(" - " + capText(sanitizeText(serviceInfo.String(), true), maxServiceInfoBytes)))
+	return err
+}
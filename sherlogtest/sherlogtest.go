@@ -0,0 +1,234 @@
+/*
+Package sherlogtest provides a Harness for deterministic end to end tests of logger configurations. A Harness runs
+loggers against a temporary directory and a fake clock, so rolls, retention, and compaction can be driven step by
+step and the resulting files asserted exactly:
+
+	func TestRetention(t *testing.T) {
+		h := sherlogtest.New(t)
+		defer h.Close()
+		logger := h.NewRollingFileLogger("app.log")
+		logger.SetMaxFileAge(48*time.Hour, nil)
+
+		h.Log(logger, sherlog.NewError("day one"))
+		h.Advance(24 * time.Hour)
+		h.Roll(logger)
+		h.Log(logger, sherlog.NewError("day two"))
+		h.Advance(36 * time.Hour)
+		h.Roll(logger)
+
+		h.AssertFiles("app_2018-10-04.log", "app_2018-10-05.log")
+	}
+
+The fake clock is installed with sherlog.SetClock, which is global, so tests that use a Harness must not run in
+parallel. sherlog doesn't compress rolled files itself, so there is no compression for a Harness to drive, but
+Compact reads rolled files that something else gzipped, so write those with a .gz extension to test it.
+*/
+package sherlogtest
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/Nick-Anderssohn/sherlog"
+)
+
+/*
+Start is the time the fake clock of every Harness starts at: 2018-10-03 00:00:00 UTC.
+*/
+var Start = time.Date(2018, 10, 3, 0, 0, 0, 0, time.UTC)
+
+/*
+neverRoll is used as the roll duration of the loggers made by NewRollingFileLogger, so that they only roll when told to.
+*/
+const neverRoll = time.Duration(1<<63 - 1)
+
+/*
+Harness owns a temporary directory and a fake clock. Create one with New and Close it when the test is done.
+*/
+type Harness struct {
+	// Dir is the temporary directory that the test's files go in.
+	Dir string
+
+	t           testing.TB
+	now         time.Time
+	mutex       sync.Mutex
+	previousLoc *time.Location
+	loggers     []sherlog.Logger
+}
+
+/*
+New creates a temporary directory and installs a fake clock set to Start with sherlog.SetClock. sherlog.Location is
+set to UTC until Close so that file names don't depend on the machine's time zone.
+*/
+func New(t testing.TB) *Harness {
+	dir, err := ioutil.TempDir("", "sherlogtest")
+	if err != nil {
+		t.Fatal(err)
+	}
+	h := &Harness{
+		Dir:         dir,
+		t:           t,
+		now:         Start,
+		previousLoc: sherlog.Location,
+	}
+	sherlog.SetClock(h.Now)
+	sherlog.Location = time.UTC
+	return h
+}
+
+/*
+Close closes the loggers made by the Harness, puts back the real clock, and deletes Dir.
+*/
+func (h *Harness) Close() {
+	for _, logger := range h.loggers {
+		logger.Close()
+	}
+	sherlog.SetClock(nil)
+	sherlog.Location = h.previousLoc
+	os.RemoveAll(h.Dir)
+}
+
+/*
+Now returns the time of the fake clock.
+*/
+func (h *Harness) Now() time.Time {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+	return h.now
+}
+
+/*
+Advance moves the fake clock forward by duration.
+*/
+func (h *Harness) Advance(duration time.Duration) {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+	h.now = h.now.Add(duration)
+}
+
+/*
+Path returns the path of name in Dir. Use forward slashes for subdirectories.
+*/
+func (h *Harness) Path(name string) string {
+	return filepath.Join(h.Dir, filepath.FromSlash(name))
+}
+
+/*
+NewRollingFileLogger returns a RollingFileLogger for name in Dir that only rolls when Roll is called. It is
+closed by Close.
+*/
+func (h *Harness) NewRollingFileLogger(name string) *sherlog.RollingFileLogger {
+	if dir := filepath.Dir(h.Path(name)); dir != h.Dir {
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			h.t.Fatal(err)
+		}
+	}
+	logger, err := sherlog.NewCustomRollingFileLogger(h.Path(name), neverRoll)
+	if err != nil {
+		h.t.Fatal(err)
+	}
+	h.loggers = append(h.loggers, logger)
+	return logger
+}
+
+/*
+Log logs values with logger and fails the test if it returns an error. Afterwards the modification time of the
+file the logger is writing to (if it writes to a file) is set to the fake clock, so that SetMaxFileAge and Compact
+see the file as written at the fake time.
+*/
+func (h *Harness) Log(logger sherlog.Logger, values ...interface{}) {
+	if err := logger.Log(values...); err != nil {
+		h.t.Fatal("logging failed: ", err)
+	}
+	filer, isFiler := logger.(interface{ CurrentFilePath() string })
+	if !isFiler || filer.CurrentFilePath() == "" {
+		return
+	}
+	now := h.Now()
+	if err := os.Chtimes(filer.CurrentFilePath(), now, now); err != nil {
+		h.t.Fatal(err)
+	}
+}
+
+/*
+Roll rolls roller and fails the test if it returns an error.
+*/
+func (h *Harness) Roll(roller sherlog.Roller) {
+	if err := roller.Roll(); err != nil {
+		h.t.Fatal("rolling failed: ", err)
+	}
+}
+
+/*
+Files returns the paths of every file under Dir relative to Dir, with forward slashes, sorted.
+*/
+func (h *Harness) Files() []string {
+	var files []string
+	err := filepath.Walk(h.Dir, func(path string, info os.FileInfo, err error) error {
+		if err != nil || info.IsDir() {
+			return err
+		}
+		relativePath, err := filepath.Rel(h.Dir, path)
+		files = append(files, filepath.ToSlash(relativePath))
+		return err
+	})
+	if err != nil {
+		h.t.Fatal(err)
+	}
+	sort.Strings(files)
+	return files
+}
+
+/*
+AssertFiles fails the test unless the files under Dir are exactly expected (see Files). The order of expected
+doesn't matter.
+*/
+func (h *Harness) AssertFiles(expected ...string) {
+	sorted := append([]string(nil), expected...)
+	sort.Strings(sorted)
+	actual := h.Files()
+	if strings.Join(actual, "\n") != strings.Join(sorted, "\n") {
+		h.t.Errorf("expected files:\n\t%s\nbut found:\n\t%s", strings.Join(sorted, "\n\t"), strings.Join(actual, "\n\t"))
+	}
+}
+
+/*
+ReadFile returns the content of name in Dir and fails the test if it can't be read.
+*/
+func (h *Harness) ReadFile(name string) string {
+	content, err := ioutil.ReadFile(h.Path(name))
+	if err != nil {
+		h.t.Fatal(err)
+	}
+	return string(content)
+}
+
+/*
+AssertFileContains fails the test unless name in Dir contains every one of substrings.
+*/
+func (h *Harness) AssertFileContains(name string, substrings ...string) {
+	content := h.ReadFile(name)
+	for _, substring := range substrings {
+		if !strings.Contains(content, substring) {
+			h.t.Errorf("expected %s to contain %q but it was:\n%s", name, substring, content)
+		}
+	}
+}
+
+/*
+AssertFileNotContains fails the test if name in Dir contains any of substrings.
+*/
+func (h *Harness) AssertFileNotContains(name string, substrings ...string) {
+	content := h.ReadFile(name)
+	for _, substring := range substrings {
+		if strings.Contains(content, substring) {
+			h.t.Errorf("expected %s not to contain %q but it was:\n%s", name, substring, content)
+		}
+	}
+}
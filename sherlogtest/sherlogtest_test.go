@@ -0,0 +1,50 @@
+package sherlogtest
+
+import (
+	"testing"
+	"time"
+
+	"github.com/Nick-Anderssohn/sherlog"
+)
+
+func TestRollAndRetention(t *testing.T) {
+	h := New(t)
+	defer h.Close()
+	logger := h.NewRollingFileLogger("app.log")
+	if err := logger.SetMaxFileAge(48*time.Hour, nil); err != nil {
+		t.Fatal(err)
+	}
+
+	h.Log(logger, sherlog.NewError("day one"))
+	h.Advance(24 * time.Hour)
+	h.Roll(logger)
+	h.Log(logger, sherlog.NewError("day two"))
+	h.AssertFiles("app_2018-10-03.log", "app_2018-10-04.log")
+	h.AssertFileContains("app_2018-10-03.log", "2018-10-03 00:00:00 - ERROR - day one")
+
+	h.Advance(36 * time.Hour) // The first file is now 60 hours old and the second one 36
+	h.Roll(logger)
+	h.AssertFiles("app_2018-10-04.log", "app_2018-10-05.log")
+}
+
+func TestCompactWithFakeClock(t *testing.T) {
+	h := New(t)
+	defer h.Close()
+	logger := h.NewRollingFileLogger("app.log")
+
+	h.Log(logger, sherlog.NewError("disk full"))
+	h.Log(logger, sherlog.NewError("disk full"))
+	h.Advance(24 * time.Hour)
+	h.Roll(logger)
+	h.Advance(time.Hour)
+
+	written, err := logger.Compact(time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(written) != 1 {
+		t.Fatalf("expected 1 summary but got %v", written)
+	}
+	h.AssertFiles("app_2018-10-04.log", "app_summary_2018-10-03.json")
+	h.AssertFileContains("app_summary_2018-10-03.json", `"Count": 2`, `"Message": "disk full"`)
+}
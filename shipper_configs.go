@@ -0,0 +1,208 @@
+package sherlog
+
+import (
+	"bytes"
+	"encoding/json"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+/*
+datadogStatuses maps levels to Datadog's log statuses.
+*/
+var datadogStatuses = map[Level]string{
+	EnumCritical: "critical",
+	EnumError:    "error",
+	EnumOpsError: "error",
+	EnumWarning:  "warning",
+	EnumInfo:     "info",
+	EnumDebug:    "debug",
+}
+
+/*
+DatadogShipperConfig returns an HTTPShipperConfig that sends entries to the Datadog Logs intake of site (such as
+"datadoghq.com" or "datadoghq.eu", defaults to "datadoghq.com") using apiKey. Entries are mapped to Datadog's
+reserved attributes (message, status, service, date, error.stack) and the whole entry is kept under "sherlog".
+service defaults to the name set with SetServiceInfo.
+
+	shipper := sherlog.NewHTTPShipper(sherlog.DatadogShipperConfig(os.Getenv("DD_API_KEY"), "datadoghq.eu", "user-service"))
+*/
+func DatadogShipperConfig(apiKey, site, service string) HTTPShipperConfig {
+	if site == "" {
+		site = "datadoghq.com"
+	}
+	return HTTPShipperConfig{
+		URL:         "https://http-intake.logs." + site + "/api/v2/logs",
+		Headers:     map[string]string{"DD-API-KEY": apiKey},
+		ContentType: "application/json",
+		Encode: func(entries []*Entry) ([]byte, error) {
+			records := make([]map[string]interface{}, len(entries))
+			for i, entry := range entries {
+				records[i] = datadogRecord(entry, service)
+			}
+			return json.Marshal(records)
+		},
+	}
+}
+
+/*
+datadogRecord maps entry to the attributes Datadog understands.
+*/
+func datadogRecord(entry *Entry, service string) map[string]interface{} {
+	if service == "" {
+		service = serviceInfo.Name
+	}
+	record := map[string]interface{}{
+		"message":  entry.Message,
+		"date":     entry.Time.UnixNano() / 1e6,
+		"ddsource": "go",
+		"sherlog":  ShipperJsonMap(entry),
+	}
+	if service != "" {
+		record["service"] = service
+	}
+	if status, ok := datadogStatuses[entry.Level]; ok {
+		record["status"] = status
+	}
+	if len(entry.StackTrace) > 0 {
+		record["error.stack"] = strings.TrimRight(entry.StackTraceAsString(), "\n")
+		record["error.message"] = entry.Message
+	}
+	return record
+}
+
+/*
+SplunkHECShipperConfig returns an HTTPShipperConfig that sends entries to the Splunk HTTP Event Collector at
+baseURL (such as "https://splunk.example.com:8088") using token. Each entry becomes an event with the entry's
+json as the event data, the entry's time, and the level as an indexed field. sourcetype defaults to "sherlog".
+index is left up to the token's default if it is empty.
+
+	shipper := sherlog.NewHTTPShipper(sherlog.SplunkHECShipperConfig("https://splunk:8088", token, "", "main"))
+*/
+func SplunkHECShipperConfig(baseURL, token, sourcetype, index string) HTTPShipperConfig {
+	if sourcetype == "" {
+		sourcetype = "sherlog"
+	}
+	return HTTPShipperConfig{
+		URL:         strings.TrimRight(baseURL, "/") + "/services/collector/event",
+		Headers:     map[string]string{"Authorization": "Splunk " + token},
+		ContentType: "application/json",
+		Encode: func(entries []*Entry) ([]byte, error) {
+			var buf bytes.Buffer
+			for _, entry := range entries {
+				eventBytes, err := json.Marshal(splunkEvent(entry, sourcetype, index))
+				if err != nil {
+					return nil, err
+				}
+				buf.Write(eventBytes)
+				buf.WriteByte('\n')
+			}
+			return buf.Bytes(), nil
+		},
+	}
+}
+
+/*
+splunkEvent wraps entry in the HEC event format.
+*/
+func splunkEvent(entry *Entry, sourcetype, index string) map[string]interface{} {
+	event := map[string]interface{}{
+		"time":       float64(entry.Time.UnixNano()) / 1e9,
+		"sourcetype": sourcetype,
+		"event":      ShipperJsonMap(entry),
+	}
+	if index != "" {
+		event["index"] = index
+	}
+	if serviceInfo.Name != "" {
+		event["source"] = serviceInfo.Name
+	}
+	if entry.Level != nil {
+		event["fields"] = map[string]string{"level": entry.Level.GetLabel()}
+	}
+	return event
+}
+
+/*
+LokiShipperConfig returns an HTTPShipperConfig that sends entries to the push API of the Grafana Loki server at
+baseURL (such as "http://loki:3100"). Every entry is labeled with staticLabels (such as service and env) plus its
+lowercase level label under "level". If staticLabels has no "service", the name set with SetServiceInfo is used.
+
+Nothing else becomes a label since every distinct set of labels is a separate stream in Loki, and labels with
+lots of values (such as user IDs or correlation IDs) would explode the number of streams. Fields and everything
+else stay in the line, which is the json LogJson would write, so they can still be queried with "| json".
+*/
+func LokiShipperConfig(baseURL string, staticLabels map[string]string) HTTPShipperConfig {
+	labels := map[string]string{}
+	if serviceInfo.Name != "" {
+		labels["service"] = serviceInfo.Name
+	}
+	for name, value := range staticLabels {
+		labels[name] = value
+	}
+	return HTTPShipperConfig{
+		URL:         strings.TrimRight(baseURL, "/") + "/loki/api/v1/push",
+		ContentType: "application/json",
+		Encode: func(entries []*Entry) ([]byte, error) {
+			return encodeLokiPush(entries, labels)
+		},
+	}
+}
+
+/*
+NewLokiLogger returns an HTTPShipper configured with LokiShipperConfig.
+*/
+func NewLokiLogger(baseURL string, staticLabels map[string]string) *HTTPShipper {
+	return NewHTTPShipper(LokiShipperConfig(baseURL, staticLabels))
+}
+
+type lokiStream struct {
+	Stream map[string]string `json:"stream"`
+	Values [][2]string       `json:"values"`
+}
+
+type lokiValue struct {
+	nanos int64
+	line  string
+}
+
+/*
+encodeLokiPush groups entries into one stream per level and encodes them as a push request. Values are sorted by
+time within each stream.
+*/
+func encodeLokiPush(entries []*Entry, labels map[string]string) ([]byte, error) {
+	valuesByLevel := map[string][]lokiValue{}
+	for _, entry := range entries {
+		line, err := marshalJsonEntry(ShipperJsonMap(entry), false)
+		if err != nil {
+			return nil, err
+		}
+		level := strings.ToLower(entry.LevelLabel())
+		valuesByLevel[level] = append(valuesByLevel[level], lokiValue{nanos: entry.Time.UnixNano(), line: string(line)})
+	}
+
+	levels := make([]string, 0, len(valuesByLevel))
+	for level := range valuesByLevel {
+		levels = append(levels, level)
+	}
+	sort.Strings(levels)
+
+	streams := make([]lokiStream, 0, len(levels))
+	for _, level := range levels {
+		stream := lokiStream{Stream: make(map[string]string, len(labels)+1)}
+		for name, value := range labels {
+			stream.Stream[name] = value
+		}
+		if level != "" {
+			stream.Stream["level"] = level
+		}
+		values := valuesByLevel[level]
+		sort.SliceStable(values, func(i, j int) bool { return values[i].nanos < values[j].nanos })
+		for _, value := range values {
+			stream.Values = append(stream.Values, [2]string{strconv.FormatInt(value.nanos, 10), value.line})
+		}
+		streams = append(streams, stream)
+	}
+	return json.Marshal(map[string]interface{}{"streams": streams})
+}
@@ -1,5 +1,7 @@
 package sherlog
 
+import "sync"
+
 /*
 SizeBasedRollingFileLogger is a logger that rolls files when they hit a certain number of log messages.
 */
@@ -7,6 +9,7 @@ type SizeBasedRollingFileLogger struct {
 	RollingFileLogger
 	countToRollOn int
 	curCount      int
+	countMutex    *sync.Mutex
 }
 
 /*
@@ -26,6 +29,7 @@ func NewRollingFileLoggerWithSizeLimit(logFilePath string, numMessagesPerFile in
 			baseFilePath: logFilePath,
 		},
 		countToRollOn: numMessagesPerFile,
+		countMutex:    new(sync.Mutex),
 	}, nil
 }
 
@@ -33,6 +37,9 @@ func NewRollingFileLoggerWithSizeLimit(logFilePath string, numMessagesPerFile in
 Log calls loggable's Log function. Is thread safe :)
 */
 func (rfl *SizeBasedRollingFileLogger) Log(errorsToLog ...interface{}) error {
+	if len(errorsToLog) > 0 && len(withoutNils(errorsToLog)) == 0 {
+		return nil // Nothing was logged, so don't count it
+	}
 	err := rfl.RollingFileLogger.Log(errorsToLog...)
 	if err != nil {
 		return err
@@ -45,6 +52,9 @@ func (rfl *SizeBasedRollingFileLogger) Log(errorsToLog ...interface{}) error {
 LogNoStack calls loggable's LogNoStack function. Is thread safe :)
 */
 func (rfl *SizeBasedRollingFileLogger) LogNoStack(errToLog error) error {
+	if isNil(errToLog) {
+		return nil
+	}
 	err := rfl.RollingFileLogger.LogNoStack(errToLog)
 	if err != nil {
 		return err
@@ -57,6 +67,9 @@ func (rfl *SizeBasedRollingFileLogger) LogNoStack(errToLog error) error {
 LogJson calls loggable's LogJson function. Is thread safe :)
 */
 func (rfl *SizeBasedRollingFileLogger) LogJson(errToLog error) error {
+	if isNil(errToLog) {
+		return nil
+	}
 	err := rfl.RollingFileLogger.LogJson(errToLog)
 	if err != nil {
 		return err
@@ -66,6 +79,8 @@ func (rfl *SizeBasedRollingFileLogger) LogJson(errToLog error) error {
 }
 
 func (rfl *SizeBasedRollingFileLogger) incAndRollIfNecessary() error {
+	rfl.countMutex.Lock()
+	defer rfl.countMutex.Unlock()
 	rfl.curCount++
 	if rfl.curCount >= rfl.countToRollOn {
 		return rfl.roll()
@@ -73,6 +88,18 @@ func (rfl *SizeBasedRollingFileLogger) incAndRollIfNecessary() error {
 	return nil
 }
 
+/*
+Roll starts a new file right away instead of waiting for the current one to fill up. Is thread safe :)
+*/
+func (rfl *SizeBasedRollingFileLogger) Roll() error {
+	rfl.countMutex.Lock()
+	defer rfl.countMutex.Unlock()
+	return rfl.roll()
+}
+
+/*
+roll rolls and resets the count. The countMutex must be held.
+*/
 func (rfl *SizeBasedRollingFileLogger) roll() error {
 	err := rfl.RollingFileLogger.roll()
 	rfl.curCount = 0
@@ -84,7 +111,7 @@ Critical turns values into a *LeveledException with level CRITICAL and then call
 Log function.
 */
 func (rfl *SizeBasedRollingFileLogger) Critical(values ...interface{}) error {
-	return rfl.Log(graduateOrConcatAndCreate(EnumCritical, values...))
+	return rfl.Log(rfl.graduate(EnumCritical, values...))
 }
 
 /*
@@ -92,7 +119,7 @@ Error turns values into a *LeveledException with level ERROR and then calls the
 Log function.
 */
 func (rfl *SizeBasedRollingFileLogger) Error(values ...interface{}) error {
-	return rfl.Log(graduateOrConcatAndCreate(EnumError, values...))
+	return rfl.Log(rfl.graduate(EnumError, values...))
 }
 
 /*
@@ -100,7 +127,7 @@ OpsError turns values into a *LeveledException with level OPS_ERROR and then cal
 Log function.
 */
 func (rfl *SizeBasedRollingFileLogger) OpsError(values ...interface{}) error {
-	return rfl.Log(graduateOrConcatAndCreate(EnumOpsError, values...))
+	return rfl.Log(rfl.graduate(EnumOpsError, values...))
 }
 
 /*
@@ -108,7 +135,7 @@ Warn turns values into a *LeveledException with level WARNING and then calls the
 Log function.
 */
 func (rfl *SizeBasedRollingFileLogger) Warn(values ...interface{}) error {
-	return rfl.Log(graduateOrConcatAndCreate(EnumWarning, values...))
+	return rfl.Log(rfl.graduate(EnumWarning, values...))
 }
 
 /*
@@ -116,7 +143,7 @@ Info turns values into a *LeveledException with level INFO and then calls the lo
 Log function.
 */
 func (rfl *SizeBasedRollingFileLogger) Info(values ...interface{}) error {
-	return rfl.Log(graduateOrConcatAndCreate(EnumInfo, values...))
+	return rfl.Log(rfl.graduate(EnumInfo, values...))
 }
 
 /*
@@ -124,5 +151,5 @@ Debug turns values into a *LeveledException with level DEBUG and then calls the
 Log function.
 */
 func (rfl *SizeBasedRollingFileLogger) Debug(values ...interface{}) error {
-	return rfl.Log(graduateOrConcatAndCreate(EnumDebug, values...))
+	return rfl.Log(rfl.graduate(EnumDebug, values...))
 }
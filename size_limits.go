@@ -0,0 +1,183 @@
+package sherlog
+
+import (
+	"bytes"
+	"strconv"
+	"unicode/utf8"
+)
+
+/*
+SizeLimits is a Middleware that caps the size of entries, so that a pathological megabyte-sized message (or an
+endless recursion's stack trace) can't flood a file or overflow what a network sink accepts in one message:
+
+	logger.Use(sherlog.SizeLimits{MaxMessageBytes: 4096, MaxFrames: 64, MaxEntryBytes: 32 * 1024}.Enforce)
+
+Whatever is cut is replaced with a marker saying how much was left out. The errors passed to Log are never
+modified, entries that go over a limit are logged as copies. A limit of 0 means no limit.
+*/
+type SizeLimits struct {
+	// MaxMessageBytes caps the length of the message.
+	MaxMessageBytes int
+
+	// MaxFrames caps the number of stack frames.
+	MaxFrames int
+
+	// MaxEntryBytes caps the size of the whole entry, as written in the default text format. Stack frames are cut
+	// first and then the message. Fields and messages added with PrependMsg are never cut, so an entry can still
+	// go over if they alone are too big.
+	MaxEntryBytes int
+}
+
+/*
+Enforce is the Middleware that applies the limits to every error that is logged.
+*/
+func (sl SizeLimits) Enforce(next LogFunc) LogFunc {
+	return func(values ...interface{}) error {
+		var limited []interface{}
+		for i, value := range values {
+			err, isErr := value.(error)
+			if !isErr || err == nil {
+				continue
+			}
+			if limitedErr := sl.limit(err); limitedErr != err {
+				if limited == nil {
+					limited = append([]interface{}(nil), values...)
+				}
+				limited[i] = limitedErr
+			}
+		}
+		if limited == nil {
+			return next(values...)
+		}
+		return next(limited...)
+	}
+}
+
+/*
+limit returns err if it is within the limits, or else a copy of it that is.
+*/
+func (sl SizeLimits) limit(err error) error {
+	if stdException := stdExceptionOf(err); stdException != nil {
+		return sl.limitException(err, stdException)
+	}
+	message := err.Error()
+	maxBytes := sl.MaxMessageBytes
+	if sl.MaxEntryBytes > 0 && (maxBytes <= 0 || sl.MaxEntryBytes < maxBytes) {
+		maxBytes = sl.MaxEntryBytes
+	}
+	if maxBytes <= 0 || len(message) <= maxBytes {
+		return err
+	}
+	return &truncatedError{message: truncateMessage(message, maxBytes), cause: err}
+}
+
+/*
+limitException returns err if it is within the limits, or else a copy of it that is. stdException is the
+StdException of err.
+*/
+func (sl SizeLimits) limitException(err error, stdException *StdException) error {
+	message, stackTrace := stdException.message, stdException.stackTrace
+	if sl.MaxMessageBytes > 0 && len(message) > sl.MaxMessageBytes {
+		message = truncateMessage(stdException.message, sl.MaxMessageBytes)
+	}
+	numFrames := len(stackTrace)
+	if sl.MaxFrames > 0 && numFrames > sl.MaxFrames {
+		numFrames = sl.MaxFrames
+		stackTrace = truncateFrames(stdException.stackTrace, numFrames)
+	}
+	limitedErr := err
+	if message != stdException.message || numFrames < len(stdException.stackTrace) {
+		limitedErr = copyException(err, message, stackTrace)
+	}
+	if sl.MaxEntryBytes <= 0 {
+		return limitedErr
+	}
+
+	size := renderedSize(limitedErr)
+	for size > sl.MaxEntryBytes && numFrames > 0 {
+		numFrames /= 2
+		stackTrace = truncateFrames(stdException.stackTrace, numFrames)
+		limitedErr = copyException(err, message, stackTrace)
+		size = renderedSize(limitedErr)
+	}
+	if excess := size - sl.MaxEntryBytes; excess > 0 {
+		message = truncateMessage(stdException.message, len(message)-excess)
+		limitedErr = copyException(err, message, stackTrace)
+	}
+	return limitedErr
+}
+
+/*
+copyException returns a copy of err (a sherlog exception) with message and stackTrace.
+*/
+func copyException(err error, message string, stackTrace []*StackTraceEntry) error {
+	var limitedErr error
+	var limited *StdException
+	switch impl := err.(type) {
+	case *LeveledException:
+		clone := impl.Clone()
+		limitedErr, limited = clone, &clone.StdException
+	case *StdException:
+		clone := impl.Clone()
+		limitedErr, limited = clone, clone
+	}
+	limited.message = message
+	limited.stackTrace = stackTrace
+	return limitedErr
+}
+
+/*
+renderedSize returns the size of err in the default text format.
+*/
+func renderedSize(err error) int {
+	var buf bytes.Buffer
+	if loggable, isLoggable := err.(Loggable); isLoggable {
+		loggable.Log(&buf)
+		return buf.Len()
+	}
+	return len(err.Error())
+}
+
+/*
+truncateMessage cuts message down to about maxBytes, without splitting a UTF-8 character, and marks how much was
+cut.
+*/
+func truncateMessage(message string, maxBytes int) string {
+	marker := "...[" + strconv.Itoa(len(message)) + " bytes, truncated]"
+	cut := maxBytes - len(marker)
+	if cut < 0 {
+		cut = 0
+	}
+	for cut > 0 && !utf8.RuneStart(message[cut]) {
+		cut--
+	}
+	return message[:cut] + marker
+}
+
+/*
+truncateFrames returns the top numFrames frames of stackTrace followed by a frame saying how many were left out.
+*/
+func truncateFrames(stackTrace []*StackTraceEntry, numFrames int) []*StackTraceEntry {
+	truncated := make([]*StackTraceEntry, numFrames, numFrames+1)
+	copy(truncated, stackTrace)
+	return append(truncated, omittedFramesEntry(len(stackTrace)-numFrames))
+}
+
+/*
+truncatedError is what SizeLimits logs in place of a non-sherlog error whose message is too long.
+*/
+type truncatedError struct {
+	message string
+	cause   error
+}
+
+func (te *truncatedError) Error() string {
+	return te.message
+}
+
+/*
+Unwrap returns the error whose message was truncated.
+*/
+func (te *truncatedError) Unwrap() error {
+	return te.cause
+}
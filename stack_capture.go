@@ -0,0 +1,169 @@
+package sherlog
+
+import (
+	"bufio"
+	"bytes"
+	"reflect"
+	"runtime"
+	"strconv"
+	"strings"
+)
+
+/*
+NewStdExceptionFromPCs creates an exception whose stack trace is made from program counters that were already
+captured, such as by runtime.Callers in a profiler callback or in custom recovery code. If the panic machinery is
+in the stack trace, it is trimmed off like FromPanic does.
+*/
+func NewStdExceptionFromPCs(pcs []uintptr, message string) error {
+	return newStdExceptionWithStackTrace(message, trimToPanicSite(stackTraceFromPCs(pcs, defaultStackTraceDepth)))
+}
+
+/*
+NewFromRuntimeStack creates an exception whose stack trace is parsed from the output of runtime.Stack (or
+debug.Stack), for when a stack was captured as text before sherlog got involved, such as from another goroutine.
+Only the first goroutine in buf is used. If the panic machinery is in the stack trace, it is trimmed off like
+FromPanic does.
+
+	buf := make([]byte, 64*1024)
+	exception := sherlog.NewFromRuntimeStack(buf[:runtime.Stack(buf, false)], "worker panicked")
+*/
+func NewFromRuntimeStack(buf []byte, message string) error {
+	return newStdExceptionWithStackTrace(message, trimToPanicSite(parseRuntimeStack(buf, defaultStackTraceDepth)))
+}
+
+func newStdExceptionWithStackTrace(message string, stackTrace []*StackTraceEntry) *StdException {
+	se := &StdException{}
+	se.initWithStackTrace(message, stackTrace, defaultStackTraceDepth)
+	return se
+}
+
+/*
+thirdPartyStackTrace returns the stack trace of the innermost error in err's Unwrap chain that carries one the way
+github.com/pkg/errors does, or nil if there isn't one. Those errors have a StackTrace method that returns a slice
+of program counters (errors.StackTrace, a []errors.Frame), which is found with reflection so that sherlog doesn't
+have to depend on them.
+*/
+func thirdPartyStackTrace(err error) (stackTrace []*StackTraceEntry) {
+	walkChain(err, func(cur error) bool {
+		if curStackTrace := stackTraceFromPCs(stackTracerPCs(cur), defaultStackTraceDepth); curStackTrace != nil {
+			stackTrace = curStackTrace
+		}
+		return true
+	})
+	return
+}
+
+/*
+stackTracerPCs returns the program counters from err's StackTrace method, or nil if it doesn't have one that
+returns a slice of program counters.
+*/
+func stackTracerPCs(err error) []uintptr {
+	method := reflect.ValueOf(err).MethodByName("StackTrace")
+	if !method.IsValid() {
+		return nil
+	}
+	methodType := method.Type()
+	if methodType.NumIn() != 0 || methodType.NumOut() != 1 ||
+		methodType.Out(0).Kind() != reflect.Slice || methodType.Out(0).Elem().Kind() != reflect.Uintptr {
+		return nil
+	}
+	frames := method.Call(nil)[0]
+	pcs := make([]uintptr, frames.Len())
+	for i := range pcs {
+		pcs[i] = uintptr(frames.Index(i).Uint())
+	}
+	return pcs
+}
+
+/*
+stackTraceFromPCs turns up to maxStackTraceSize frames of pcs into a stack trace.
+*/
+func stackTraceFromPCs(pcs []uintptr, maxStackTraceSize int) []*StackTraceEntry {
+	if len(pcs) == 0 || maxStackTraceSize <= 0 {
+		return nil
+	}
+	// The entries share one backing array, so a stack trace costs two allocations instead of one per frame.
+	capacity := len(pcs)
+	if capacity > maxStackTraceSize {
+		capacity = maxStackTraceSize
+	}
+	frames := make([]StackTraceEntry, 0, capacity)
+	framePtr := runtime.CallersFrames(pcs)
+	for more := true; more && len(frames) < maxStackTraceSize; {
+		var frame runtime.Frame
+		frame, more = framePtr.Next()
+		if frame.Function == "" {
+			break
+		}
+		frames = append(frames, createStackTraceEntryFromRuntimeFrame(&frame))
+	}
+	if len(frames) == 0 {
+		return nil
+	}
+	stackTrace := make([]*StackTraceEntry, len(frames))
+	for i := range frames {
+		stackTrace[i] = &frames[i]
+	}
+	return stackTrace
+}
+
+/*
+parseRuntimeStack parses up to maxStackTraceSize frames of the first goroutine in buf, which is formatted like
+runtime.Stack's output:
+
+	goroutine 1 [running]:
+	main.main()
+		/app/main.go:12 +0x1d
+*/
+func parseRuntimeStack(buf []byte, maxStackTraceSize int) (stackTrace []*StackTraceEntry) {
+	scanner := bufio.NewScanner(bytes.NewReader(buf))
+	var current *StackTraceEntry
+	for scanner.Scan() && len(stackTrace) < maxStackTraceSize {
+		line := scanner.Text()
+		switch {
+		case line == "":
+			if len(stackTrace) > 0 {
+				return
+			}
+		case strings.HasPrefix(line, "\t") && current != nil:
+			location := strings.TrimPrefix(line, "\t")
+			if offset := strings.LastIndex(location, " +0x"); offset >= 0 {
+				location = location[:offset]
+			}
+			if colon := strings.LastIndex(location, ":"); colon >= 0 {
+				current.File = location[:colon]
+				current.Line, _ = strconv.Atoi(location[colon+1:])
+			}
+			if current.FunctionName == "panic" && strings.HasSuffix(current.File, "runtime/panic.go") {
+				current.FunctionName = "runtime.gopanic"
+			}
+			stackTrace = append(stackTrace, current)
+			current = nil
+		case strings.HasPrefix(line, "goroutine "), strings.HasPrefix(line, "..."), strings.HasPrefix(line, "["):
+			// Goroutine headers, elided frames, and other notes aren't frames
+		default:
+			current = &StackTraceEntry{FunctionName: runtimeStackFunctionName(line)}
+		}
+	}
+	return
+}
+
+/*
+runtimeStackFunctionName returns the function name in a function line of runtime.Stack's output, which ends with
+the arguments, such as "main.handle(0xc000010000, 0x2)", or is a "created by" line.
+*/
+func runtimeStackFunctionName(line string) string {
+	if strings.HasPrefix(line, "created by ") {
+		line = strings.TrimPrefix(line, "created by ")
+		if inGoroutine := strings.Index(line, " in goroutine "); inGoroutine >= 0 {
+			line = line[:inGoroutine]
+		}
+		return line
+	}
+	if strings.HasSuffix(line, ")") {
+		if openParen := strings.LastIndex(line, "("); openParen > 0 {
+			return line[:openParen]
+		}
+	}
+	return line
+}
@@ -0,0 +1,197 @@
+package sherlog
+
+import (
+	"encoding/json"
+	"runtime"
+	"runtime/debug"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+/*
+StackRenderOptions controls how stack traces are rendered as text (in Log, GetStackTraceAsString, and the
+"StackTraceStr" json key). The structured "StackTrace" json key always holds every frame with full paths and
+function names. See StackRender.
+*/
+type StackRenderOptions struct {
+	// RelativePaths trims file paths so that they are relative to the root of ModulePath.
+	RelativePaths bool
+
+	// ModulePath is the module whose root RelativePaths trims to. Defaults to the main module
+	// read from debug.ReadBuildInfo.
+	ModulePath string
+
+	// ShortFunctionNames leaves out everything but the last package segment of function names, so
+	// github.com/Nick-Anderssohn/sherlog.NewError becomes sherlog.NewError.
+	ShortFunctionNames bool
+
+	// MaxFrames caps the number of frames written. The rest are replaced by "...N more frames". 0 means no cap.
+	MaxFrames int
+}
+
+var (
+	mainModuleOnce sync.Once
+	mainModule     string
+)
+
+/*
+mainModulePath returns the path of the main module, or an empty string if the binary has no build info.
+*/
+func mainModulePath() string {
+	mainModuleOnce.Do(func() {
+		if info, ok := debug.ReadBuildInfo(); ok {
+			mainModule = info.Main.Path
+		}
+	})
+	return mainModule
+}
+
+/*
+writeFrame writes a single frame to buf formatted like StackTraceEntry.String, with sro applied.
+*/
+func (sro *StackRenderOptions) writeFrame(buf *strings.Builder, frame *StackTraceEntry) {
+	if frame.File == "" && frame.Line == 0 {
+		buf.WriteString(frame.FunctionName) // A marker such as "...3 more frames" rather than a real frame
+		return
+	}
+	if !sro.RelativePaths && !sro.ShortFunctionNames && !TrimBuildPaths {
+		buf.WriteString(frame.String())
+		return
+	}
+	functionName, file := frame.FunctionName, frame.renderedFile()
+	if sro.ShortFunctionNames {
+		functionName = shortFunctionName(functionName)
+	}
+	if sro.RelativePaths {
+		modulePath := sro.ModulePath
+		if modulePath == "" {
+			modulePath = mainModulePath()
+		}
+		file = relativeToModule(file, modulePath)
+	}
+	buf.WriteString(functionName)
+	buf.WriteString("(")
+	buf.WriteString(file)
+	buf.WriteString(":")
+	buf.WriteString(strconv.Itoa(frame.Line))
+	buf.WriteString(")")
+}
+
+/*
+shortFunctionName removes everything up to the last slash of functionName.
+*/
+func shortFunctionName(functionName string) string {
+	return functionName[strings.LastIndex(functionName, "/")+1:]
+}
+
+/*
+relativeToModule returns the part of file that comes after modulePath. file is returned untouched if it is
+not inside of modulePath.
+*/
+func relativeToModule(file, modulePath string) string {
+	if modulePath == "" {
+		return file
+	}
+	for searchFrom := 0; ; {
+		i := strings.Index(file[searchFrom:], modulePath+"/")
+		if i < 0 {
+			return file
+		}
+		i += searchFrom
+		if i == 0 || file[i-1] == '/' {
+			return file[i+len(modulePath)+1:]
+		}
+		searchFrom = i + 1
+	}
+}
+
+/*
+MarshalJSON writes the frame as {"FunctionName":...,"File":...,"Line":...}, with the file path trimmed if
+TrimBuildPaths is on.
+*/
+func (ste *StackTraceEntry) MarshalJSON() ([]byte, error) {
+	type plainStackTraceEntry StackTraceEntry // Doesn't have MarshalJSON, so json.Marshal doesn't come back here
+	frame := plainStackTraceEntry(*ste)
+	frame.File = ste.renderedFile()
+	return json.Marshal(frame)
+}
+
+/*
+renderedFile returns the file path of the frame the way it should be written, which is trimmed by trimBuildPath if
+TrimBuildPaths is on.
+*/
+func (ste *StackTraceEntry) renderedFile() string {
+	if !TrimBuildPaths || ste.File == "" {
+		return ste.File
+	}
+	return trimBuildPath(ste.File, ste.FunctionName)
+}
+
+/*
+trimBuildPath rewrites file, an absolute path on the machine the binary was built on, in the form that
+go build -trimpath uses. functionName is the function of the frame that file belongs to:
+
+	/home/nick/go/pkg/mod/github.com/lib/pq@v1.0.0/conn.go    github.com/lib/pq@v1.0.0/conn.go
+	/usr/local/go/src/runtime/proc.go                         runtime/proc.go
+	/home/nick/work/sherlog/stdexception.go                   github.com/Nick-Anderssohn/sherlog/stdexception.go
+
+Files that are neither in the module cache nor in GOROOT are placed under the import path of the function's
+package, since the directory they were built in is exactly what shouldn't be leaked. Files of package main are
+placed under the main module (see StackRenderOptions.ModulePath) when they are inside of it, and are trimmed to
+their base name otherwise.
+*/
+func trimBuildPath(file, functionName string) string {
+	if i := strings.Index(file, "/pkg/mod/"); i >= 0 {
+		return file[i+len("/pkg/mod/"):]
+	}
+	if goRoot := runtime.GOROOT(); goRoot != "" && strings.HasPrefix(file, goRoot+"/src/") {
+		return file[len(goRoot+"/src/"):]
+	}
+	baseName := file[strings.LastIndex(file, "/")+1:]
+	if packagePath := packagePathOf(functionName); packagePath != "" && packagePath != "main" {
+		return packagePath + "/" + baseName
+	}
+	modulePath := StackRender.ModulePath
+	if modulePath == "" {
+		modulePath = mainModulePath()
+	}
+	if relativeFile := relativeToModule(file, modulePath); relativeFile != file {
+		return modulePath + "/" + relativeFile
+	}
+	return baseName
+}
+
+/*
+packagePathOf returns the import path of the package that functionName, such as
+github.com/Nick-Anderssohn/sherlog.(*StdException).Log, belongs to. The runtime escapes the dots in the last
+segment of an import path as %2e (gopkg.in/yaml%2ev2.Unmarshal), so the first dot after the last slash is where the
+package path ends. The escaped dots are turned back into dots, and type arguments (which can have slashes of their
+own) are ignored.
+*/
+func packagePathOf(functionName string) string {
+	if bracket := strings.Index(functionName, "["); bracket >= 0 {
+		functionName = functionName[:bracket]
+	}
+	lastSlash := strings.LastIndex(functionName, "/")
+	dot := strings.Index(functionName[lastSlash+1:], ".")
+	if dot < 0 {
+		return ""
+	}
+	return strings.Replace(functionName[:lastSlash+1+dot], "%2e", ".", -1)
+}
+
+/*
+renderedStackTrace returns stackTrace with every file path the way it should be written (see renderedFile). Returns
+stackTrace itself if TrimBuildPaths is off.
+*/
+func renderedStackTrace(stackTrace []*StackTraceEntry) []*StackTraceEntry {
+	if !TrimBuildPaths || len(stackTrace) == 0 {
+		return stackTrace
+	}
+	rendered := make([]*StackTraceEntry, len(stackTrace))
+	for i, frame := range stackTrace {
+		rendered[i] = &StackTraceEntry{FunctionName: frame.FunctionName, File: frame.renderedFile(), Line: frame.Line}
+	}
+	return rendered
+}
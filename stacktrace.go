@@ -4,6 +4,7 @@ import (
 	"runtime"
 	"strconv"
 	"strings"
+	"sync"
 )
 
 /*
@@ -16,65 +17,196 @@ type StackTraceEntry struct {
 }
 
 /*
-String converts a StackTraceEntry to its string representation
+String converts a StackTraceEntry to its string representation, with the file path trimmed if TrimBuildPaths is on
 */
 func (ste *StackTraceEntry) String() string {
 	var buf strings.Builder
 	buf.Grow(defaultStackTraceLineLen)
 	buf.WriteString(ste.FunctionName)
 	buf.WriteString("(")
-	buf.WriteString(ste.File)
+	buf.WriteString(ste.renderedFile())
 	buf.WriteString(":")
 	buf.WriteString(strconv.Itoa(ste.Line))
 	buf.WriteString(")")
 	return buf.String()
 }
 
-func createStackTraceEntryFromRuntimeFrame(frame *runtime.Frame) *StackTraceEntry {
-	return &StackTraceEntry{
+/*
+Caller returns the file and line of a StackTraceEntry formatted as file:line, with the file path trimmed if
+TrimBuildPaths is on
+*/
+func (ste *StackTraceEntry) Caller() string {
+	return ste.renderedFile() + ":" + strconv.Itoa(ste.Line)
+}
+
+func createStackTraceEntryFromRuntimeFrame(frame *runtime.Frame) StackTraceEntry {
+	return StackTraceEntry{
 		FunctionName: frame.Function,
 		File:         frame.File,
 		Line:         frame.Line,
 	}
 }
 
+/*
+programCounterPool holds the buffers that getStackTrace passes to runtime.Callers. They are only needed until the
+frames are resolved, so they are reused instead of allocating one for every exception.
+*/
+var programCounterPool = sync.Pool{
+	New: func() interface{} {
+		programCounters := make([]uintptr, defaultStackTraceDepth+1)
+		return &programCounters
+	},
+}
+
 /*
 skip is the number of calls to skip recording at the top of our stack trace
 maxStackSize limits the number of callers to record in the stack trace
 */
 func getStackTrace(skip, maxStackTraceSize int) (stackTrace []*StackTraceEntry) {
-	programCounters := make([]uintptr, maxStackTraceSize)
-	runtime.Callers(skip, programCounters)
-	framePtr := runtime.CallersFrames(programCounters)
+	if maxStackTraceSize <= 0 {
+		return nil
+	}
+	// One extra program counter tells whether the stack is deeper than maxStackTraceSize.
+	pooled := programCounterPool.Get().(*[]uintptr)
+	if cap(*pooled) < maxStackTraceSize+1 {
+		*pooled = make([]uintptr, maxStackTraceSize+1)
+	}
+	programCounters := (*pooled)[:maxStackTraceSize+1]
+	numCallers := runtime.Callers(skip, programCounters)
+	if numCallers > maxStackTraceSize && stackTailFrames(maxStackTraceSize) == 0 {
+		// Without a tail there's no need to walk the rest of the stack, only to say that there is more
+		stackTrace = append(stackTraceFromPCs(programCounters[:maxStackTraceSize], maxStackTraceSize), omittedFramesEntry(-1))
+	} else if numCallers > maxStackTraceSize {
+		stackTrace = truncatedStackTrace(skip+1, maxStackTraceSize)
+	} else {
+		stackTrace = stackTraceFromPCs(programCounters[:numCallers], maxStackTraceSize)
+	}
+	programCounterPool.Put(pooled)
+	return
+}
 
-	for i, more := 0, true; i < maxStackTraceSize && more; i++ {
-		var frame runtime.Frame
-		frame, more = framePtr.Next()
+/*
+truncatedStackTrace captures the whole stack, which is deeper than maxStackTraceSize, and returns its top frames,
+a frame saying how many were left out, and the bottom StackTailFrames frames. Only maxStackTraceSize frames are
+kept in total.
+*/
+func truncatedStackTrace(skip, maxStackTraceSize int) []*StackTraceEntry {
+	if maxStackTraceSize <= 0 {
+		return nil
+	}
+	bufferSize := 2 * maxStackTraceSize
+	if bufferSize < 64 {
+		bufferSize = 64
+	}
+	programCounters := make([]uintptr, bufferSize)
+	numCallers := runtime.Callers(skip, programCounters)
+	for numCallers == len(programCounters) {
+		programCounters = make([]uintptr, 2*len(programCounters))
+		numCallers = runtime.Callers(skip, programCounters)
+	}
 
-		if frame.Function == "" {
-			return
-		}
+	numTail := stackTailFrames(maxStackTraceSize)
+	numTop := maxStackTraceSize - numTail
+	top := stackTraceFromPCs(programCounters[:numTop], numTop)
+	tail := stackTraceFromPCs(programCounters[numCallers-numTail:numCallers], numTail)
 
-		stackTrace = append(stackTrace, createStackTraceEntryFromRuntimeFrame(&frame))
+	stackTrace := make([]*StackTraceEntry, 0, len(top)+1+len(tail))
+	stackTrace = append(stackTrace, top...)
+	stackTrace = append(stackTrace, omittedFramesEntry(numCallers-numTop-numTail))
+	return append(stackTrace, tail...)
+}
+
+/*
+stackTailFrames returns how many of maxStackTraceSize frames go to the bottom of the stack (see StackTailFrames).
+At least one frame is always left for the top.
+*/
+func stackTailFrames(maxStackTraceSize int) int {
+	numTail := StackTailFrames
+	if numTail > maxStackTraceSize-1 {
+		numTail = maxStackTraceSize - 1
 	}
-	return
+	if numTail < 0 {
+		numTail = 0
+	}
+	return numTail
 }
 
 /*
-Returns the stack trace in the following format:
+omittedFramesEntry returns the frame that stands in for numOmitted frames that were left out of a stack trace.
+Text output writes it as "...N more frames", or "...more frames" if numOmitted is negative because the frames
+weren't counted.
+*/
+func omittedFramesEntry(numOmitted int) *StackTraceEntry {
+	if numOmitted < 0 {
+		return &StackTraceEntry{FunctionName: "...more frames"}
+	}
+	return &StackTraceEntry{FunctionName: "..." + strconv.Itoa(numOmitted) + " more frames"}
+}
+
+/*
+Returns the stack trace in the following format (with StackRender applied):
 		sherlog.exampleFunc(exampleFile.go:18)
 		sherlog.exampleFunc2(exampleFile2.go:46)
 		sherlog.exampleFunc3(exampleFile2.go:177)
 */
 func stackTraceAsString(stackTrace []*StackTraceEntry) string {
+	var numMore int
+	if StackRender.MaxFrames > 0 && len(stackTrace) > StackRender.MaxFrames {
+		numMore = len(stackTrace) - StackRender.MaxFrames
+		stackTrace = stackTrace[:StackRender.MaxFrames]
+	}
 	var buf strings.Builder
 	buf.Grow(defaultStackTraceNumBytes)
 	for i, call := range stackTrace {
 		buf.WriteString("\t")
-		buf.WriteString(call.String())
+		StackRender.writeFrame(&buf, call)
 		if i < len(stackTrace)-1 {
 			buf.WriteString("\n")
 		}
 	}
+	if numMore > 0 {
+		buf.WriteString("\n\t...")
+		buf.WriteString(strconv.Itoa(numMore))
+		buf.WriteString(" more frames")
+	}
+	return buf.String()
+}
+
+/*
+countCommonFrames returns the number of frames at the bottom of stackTrace that are also at the bottom of other.
+*/
+func countCommonFrames(stackTrace, other []*StackTraceEntry) (numCommon int) {
+	for i, j := len(stackTrace)-1, len(other)-1; i >= 0 && j >= 0; i, j = i-1, j-1 {
+		if *stackTrace[i] != *other[j] {
+			return
+		}
+		numCommon++
+	}
+	return
+}
+
+/*
+Returns the stack trace in the same format as stackTraceAsString, but replaces the bottom numCommon frames with
+a single line:
+		sherlog.exampleFunc(exampleFile.go:18)
+		...2 common frames omitted
+*/
+func stackTraceAsStringOmittingCommon(stackTrace []*StackTraceEntry, numCommon int) string {
+	if numCommon <= 0 {
+		return stackTraceAsString(stackTrace)
+	}
+	if numCommon > len(stackTrace) {
+		numCommon = len(stackTrace)
+	}
+	var buf strings.Builder
+	buf.Grow(defaultStackTraceNumBytes)
+	for _, call := range stackTrace[:len(stackTrace)-numCommon] {
+		buf.WriteString("\t")
+		StackRender.writeFrame(&buf, call)
+		buf.WriteString("\n")
+	}
+	buf.WriteString("\t...")
+	buf.WriteString(strconv.Itoa(numCommon))
+	buf.WriteString(" common frames omitted")
 	return buf.String()
 }
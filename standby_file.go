@@ -0,0 +1,126 @@
+package sherlog
+
+import (
+	"os"
+	"path/filepath"
+)
+
+/*
+SetPreallocate turns on keeping a warm standby file next to the log files, so that rolling is a cheap rename
+instead of creating a file while entries wait. The standby file is a hidden file in the directory of the base file
+path (such as .app.log.standby for app.log). On Linux, size bytes of disk are reserved for it with fallocate so
+that writes to a fresh file don't have to allocate blocks. Elsewhere, and on file systems that don't support
+fallocate, only the creation is done ahead of time.
+
+After every roll, the next standby file is prepared in the background. The space that a rolled file didn't use is
+released when the logger rolls away from it, and the standby file is deleted by Close. If the standby file can't
+be used (it isn't ready yet, or it can't be renamed, like on Windows where open files can't be renamed), the next
+file is created the normal way.
+
+Pass 0 to turn it off, which is the default. Call it while setting up the logger. Returns an error if the standby
+file could not be created or preallocated.
+*/
+func (rfl *RollingFileLogger) SetPreallocate(size int64) error {
+	rfl.mutex.Lock()
+	rfl.preallocateSize = size
+	rfl.discardStandby()
+	rfl.mutex.Unlock()
+	if size <= 0 {
+		return nil
+	}
+	return rfl.prepareStandby()
+}
+
+/*
+standbyFilePath returns the path of the standby file.
+*/
+func (rfl *RollingFileLogger) standbyFilePath() string {
+	return filepath.Join(filepath.Dir(rfl.baseFilePath), "."+filepath.Base(rfl.baseFilePath)+".standby")
+}
+
+/*
+prepareStandby creates and preallocates the standby file unless it is already ready or being prepared.
+*/
+func (rfl *RollingFileLogger) prepareStandby() error {
+	rfl.mutex.Lock()
+	size := rfl.preallocateSize
+	if size <= 0 || rfl.closed || rfl.standbyFile != nil || rfl.preparingStandby {
+		rfl.mutex.Unlock()
+		return nil
+	}
+	rfl.preparingStandby = true
+	rfl.mutex.Unlock()
+
+	standbyPath := longPath(rfl.standbyFilePath())
+	file, err := os.OpenFile(standbyPath, os.O_APPEND|os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0644)
+	if err == nil {
+		if err = preallocate(file, size); err != nil {
+			file.Close()
+			os.Remove(standbyPath)
+		}
+	}
+
+	rfl.mutex.Lock()
+	defer rfl.mutex.Unlock()
+	rfl.preparingStandby = false
+	if err != nil {
+		return AsError(err)
+	}
+	if rfl.closed || rfl.preallocateSize != size {
+		file.Close()
+		os.Remove(standbyPath)
+		return nil
+	}
+	rfl.standbyFile = file
+	return nil
+}
+
+/*
+prepareStandbyInBackground prepares the next standby file without holding up the roll that used the last one.
+*/
+func (rfl *RollingFileLogger) prepareStandbyInBackground() {
+	go func() {
+		if err := rfl.prepareStandby(); err != nil {
+			diagnose(AsOpsError("could not prepare the standby file for ", rfl.baseFilePath, ": ", err))
+		}
+	}()
+}
+
+/*
+takeStandby renames the standby file to logFilePath and returns it, or returns nil if there is no standby file or
+it couldn't be renamed. The mutex must be held.
+*/
+func (rfl *RollingFileLogger) takeStandby(logFilePath string) *os.File {
+	file := rfl.standbyFile
+	if file == nil {
+		return nil
+	}
+	rfl.standbyFile = nil
+	if err := os.Rename(longPath(rfl.standbyFilePath()), longPath(logFilePath)); err != nil {
+		file.Close()
+		os.Remove(longPath(rfl.standbyFilePath()))
+		return nil
+	}
+	return file
+}
+
+/*
+discardStandby closes and deletes the standby file if there is one. The mutex must be held.
+*/
+func (rfl *RollingFileLogger) discardStandby() {
+	if rfl.standbyFile == nil {
+		return
+	}
+	rfl.standbyFile.Close()
+	rfl.standbyFile = nil
+	os.Remove(longPath(rfl.standbyFilePath()))
+}
+
+/*
+releaseUnusedSpace truncates file to its size, which frees the blocks that were preallocated but not written to.
+*/
+func releaseUnusedSpace(file *os.File) {
+	if info, err := file.Stat(); err == nil {
+		file.Truncate(info.Size())
+	}
+}
@@ -0,0 +1,168 @@
+package sherlog
+
+import (
+	"encoding/json"
+	"expvar"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+/*
+LoggerStats is a snapshot of the stats of a logger registered with TrackStats.
+*/
+type LoggerStats struct {
+	// Written is how many calls to the logger succeeded.
+	Written uint64
+
+	// Dropped is how many entries the logger dropped because its queue was full (see ErrQueueFull).
+	Dropped uint64
+
+	// Errors is how many calls to the logger failed for any other reason.
+	Errors uint64
+
+	// LastRoll is when the logger last rolled to a new file. Only set for rolling loggers that have rolled.
+	LastRoll *time.Time `json:",omitempty"`
+
+	// CurrentFile is the file the logger is writing to. Only set for file loggers.
+	CurrentFile string `json:",omitempty"`
+
+	// QueueDepth is how many entries are waiting to be written. Only set for loggers that implement QueueDepther.
+	QueueDepth *int `json:",omitempty"`
+
+	// Pressure is how close the logger is to making callers wait. Only set for loggers that implement Pressurer.
+	Pressure *float64 `json:",omitempty"`
+
+	// Counts are the counts of a CounterLogger. Only set for loggers that have a Counts function like
+	// CounterLogger's.
+	Counts *CounterSnapshot `json:",omitempty"`
+
+	// Latency is how long writes took, including the ones that failed. Use it to spot a slow disk or network
+	// destination that is holding up the code that logs.
+	Latency LatencyHistogram
+}
+
+/*
+middlewareUser is implemented by every sherlog logger.
+*/
+type middlewareUser interface {
+	Use(middlewares ...Middleware)
+}
+
+type statsTracker struct {
+	written uint64
+	dropped uint64
+	errors  uint64
+	latency *latencyRecorder
+	logger  Logger
+}
+
+var trackedStats = struct {
+	trackers map[string]*statsTracker
+	mutex    sync.Mutex
+	publish  sync.Once
+}{trackers: map[string]*statsTracker{}}
+
+/*
+TrackStats starts counting what logger writes under name, which must be unique. The stats of every tracked logger
+are published with expvar under "sherlog" (so they show up at /debug/vars when the expvar handler is served) and
+by StatsHandler. The counts returned by Retries are published under "sherlog_retries" too.
+
+	sherlog.TrackStats("errors", errorLogger)
+	http.Handle("/debug/sherlog", sherlog.StatsHandler())
+
+Counting is done with a Middleware that is added to the end of logger's pipeline, so entries dropped by earlier
+middleware (such as a sampler) are not counted at all. Like Use, call it while setting up the logger. Returns an
+error if name is already taken or if logger doesn't support middleware.
+*/
+func TrackStats(name string, logger Logger) error {
+	user, canUse := logger.(middlewareUser)
+	if !canUse {
+		return AsError("cannot track the stats of ", logger, " since it does not support middleware")
+	}
+	trackedStats.mutex.Lock()
+	defer trackedStats.mutex.Unlock()
+	if _, taken := trackedStats.trackers[name]; taken {
+		return AsError("stats are already being tracked under ", name)
+	}
+	tracker := &statsTracker{logger: logger, latency: newLatencyRecorder()}
+	trackedStats.trackers[name] = tracker
+	user.Use(tracker.count)
+	trackedStats.publish.Do(func() {
+		expvar.Publish("sherlog", expvar.Func(func() interface{} { return Stats() }))
+		expvar.Publish("sherlog_retries", expvar.Func(func() interface{} { return Retries() }))
+	})
+	return nil
+}
+
+func (st *statsTracker) count(next LogFunc) LogFunc {
+	return func(values ...interface{}) error {
+		start := time.Now()
+		err := next(values...)
+		st.latency.record(time.Since(start))
+		switch {
+		case err == nil:
+			atomic.AddUint64(&st.written, 1)
+		case Is(err, ErrQueueFull):
+			atomic.AddUint64(&st.dropped, 1)
+		default:
+			atomic.AddUint64(&st.errors, 1)
+		}
+		return err
+	}
+}
+
+func (st *statsTracker) snapshot() LoggerStats {
+	stats := LoggerStats{
+		Written: atomic.LoadUint64(&st.written),
+		Dropped: atomic.LoadUint64(&st.dropped),
+		Errors:  atomic.LoadUint64(&st.errors),
+		Latency: st.latency.snapshot(),
+	}
+	if roller, isRoller := st.logger.(interface{ LastRollTime() time.Time }); isRoller {
+		if lastRoll := roller.LastRollTime(); !lastRoll.IsZero() {
+			stats.LastRoll = &lastRoll
+		}
+	}
+	if filer, isFiler := st.logger.(interface{ CurrentFilePath() string }); isFiler {
+		stats.CurrentFile = filer.CurrentFilePath()
+	}
+	if depther, isDepther := st.logger.(QueueDepther); isDepther {
+		queueDepth := depther.QueueDepth()
+		stats.QueueDepth = &queueDepth
+	}
+	if pressurer, isPressurer := st.logger.(Pressurer); isPressurer {
+		pressure := pressurer.Pressure()
+		stats.Pressure = &pressure
+	}
+	if counter, isCounter := st.logger.(interface{ Counts() CounterSnapshot }); isCounter {
+		counts := counter.Counts()
+		stats.Counts = &counts
+	}
+	return stats
+}
+
+/*
+Stats returns the stats of every logger registered with TrackStats, by name.
+*/
+func Stats() map[string]LoggerStats {
+	trackedStats.mutex.Lock()
+	defer trackedStats.mutex.Unlock()
+	stats := make(map[string]LoggerStats, len(trackedStats.trackers))
+	for name, tracker := range trackedStats.trackers {
+		stats[name] = tracker.snapshot()
+	}
+	return stats
+}
+
+/*
+StatsHandler returns an http.Handler that responds with the json of Stats. Mount it somewhere private, since it
+reveals file paths.
+*/
+func StatsHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(Stats())
+	})
+}
@@ -5,6 +5,7 @@ import (
 	"fmt"
 	"io"
 	"strings"
+	"sync"
 	"time"
 )
 
@@ -15,10 +16,19 @@ Implements error, Loggable, and StackTraceWrapper.
 type StdException struct {
 	stackTrace        []*StackTraceEntry
 	stackTraceStr     string
+	stackTraceStrOnce sync.Once
 	maxStackTraceSize int
 	message           string
 	timestamp         *time.Time
 	messageChain      []string
+	cause             error
+	httpStatus        int
+	sequence          uint64
+	correlationID     string
+	spanID            string
+	fields            map[string]interface{}
+	duration          time.Duration
+	shared            int32 // 1 once the exception was logged, see markShared
 
 	// NonLoggedMsg can be optionally used to attach a secondary message that won't be logged.
 	NonLoggedMsg string
@@ -56,13 +66,29 @@ func NewStdExceptionWithStackTraceSize(message string, stackTraceNumLines int) e
 }
 
 func newStdException(message string, stackTraceNumLines, skip int) *StdException {
-	timestamp := time.Now().In(Location)
-	return &StdException{
-		stackTrace:        getStackTrace(skip, stackTraceNumLines),
-		maxStackTraceSize: stackTraceNumLines,
-		message:           message,
-		timestamp:         &timestamp,
-	}
+	se := new(StdException)
+	// init adds a function call in between, so skip one more frame.
+	se.init(message, stackTraceNumLines, skip+1)
+	return se
+}
+
+/*
+init fills in a new exception in place, so that LeveledException doesn't have to copy one (StdException must not
+be copied once it is in use, since it holds a sync.Once).
+*/
+func (se *StdException) init(message string, stackTraceNumLines, skip int) {
+	se.initWithStackTrace(message, getStackTrace(skip, stackTraceNumLines), stackTraceNumLines)
+}
+
+/*
+initWithStackTrace is init for a stack trace that was already captured.
+*/
+func (se *StdException) initWithStackTrace(message string, stackTrace []*StackTraceEntry, stackTraceNumLines int) {
+	timestamp := Clock().In(Location)
+	se.stackTrace = stackTrace
+	se.maxStackTraceSize = stackTraceNumLines
+	se.message = message
+	se.timestamp = &timestamp
 }
 
 /*
@@ -86,10 +112,11 @@ func PrependMsg(err error, msg string) error {
 		return nil
 	}
 	var buf strings.Builder
-	buf.WriteString(time.Now().Format(timeFmt))
+	buf.WriteString(Clock().Format(timeFmt))
 	buf.WriteString(" - ")
 	buf.WriteString(msg)
 	msg = buf.String()
+	err = unshared(err) // Copies err if it was already logged, since loggers may still be writing it
 	if val, hasPrependFunc := err.(prependable); hasPrependFunc {
 		val.prependMsg(msg)
 	} else {
@@ -99,6 +126,27 @@ func PrependMsg(err error, msg string) error {
 	return err
 }
 
+/*
+Unwrap returns the error that this exception was graduated from, or nil if it was created from scratch.
+*/
+func (se *StdException) Unwrap() error {
+	return se.cause
+}
+
+/*
+GetHTTPStatus returns the http status code set with SetHTTPStatus or WithHTTPStatus. Returns 0 if none was set.
+*/
+func (se *StdException) GetHTTPStatus() int {
+	return se.httpStatus
+}
+
+/*
+SetHTTPStatus sets the http status code that HTTPStatusOf will return for this exception.
+*/
+func (se *StdException) SetHTTPStatus(status int) {
+	se.httpStatus = status
+}
+
 /*
 GetStackTrace returns the stack trace as slice of *StackTraceEntry.
 */
@@ -117,10 +165,10 @@ Uses the cached stack trace string if one is available.
 If it has to convert the stack trace to a string, it will cache it for later.
 */
 func (se *StdException) GetStackTraceAsString() string {
-	if se.stackTraceStr == "" {
+	// Several loggers (such as the ones in a PolyLogger) may log the same exception at the same time
+	se.stackTraceStrOnce.Do(func() {
 		se.stackTraceStr = stackTraceAsString(se.stackTrace)
-	}
-
+	})
 	return se.stackTraceStr
 }
 
@@ -144,6 +192,32 @@ func (se *StdException) Log(writer io.Writer) error {
 		return err
 	}
 	_, err = writer.Write([]byte(se.GetStackTraceAsString()))
+	if err != nil {
+		return err
+	}
+	return writeErrorDetail(writer, se.cause)
+}
+
+/*
+LogOmittingCommonFrames works like Log, but the frames at the bottom of the stack trace that are also at the
+bottom of innerStackTrace are replaced with a single line:
+
+	yyyy-mm-dd hh:mm:ss - message:
+		sherlog.exampleFunc(exampleFile.go:18)
+		...2 common frames omitted
+
+Returns an error if there was one.
+*/
+func (se *StdException) LogOmittingCommonFrames(writer io.Writer, innerStackTrace []*StackTraceEntry) error {
+	err := se.LogNoStack(writer)
+	if err != nil {
+		return err
+	}
+	_, err = writer.Write([]byte(":\n"))
+	if err != nil {
+		return err
+	}
+	_, err = writer.Write([]byte(stackTraceAsStringOmittingCommon(se.stackTrace, countCommonFrames(se.stackTrace, innerStackTrace))))
 	return err
 }
 
@@ -156,11 +230,23 @@ Note that it does not have the stack trace.
 Returns the string that was logged or an error if there was one.
 */
 func (se *StdException) LogNoStack(writer io.Writer) error {
-	for _, msg := range se.messageChain {
-		writer.Write([]byte(msg))
+	for _, msg := range limitMessageChain(se.messageChain) {
+		writer.Write([]byte(sanitizeText(msg, true)))
 		writer.Write([]byte("\nCaused by:\n"))
 	}
-	_, err := writer.Write([]byte(se.timestamp.Format(timeFmt)))
+	_, err := writer.Write([]byte(se.timestamp.Format(timeLayoutOf(writer))))
+	if err != nil {
+		return err
+	}
+	err = writeServiceInfo(writer)
+	if err != nil {
+		return err
+	}
+	err = writeSequenceNumber(writer, se.sequenceNumber())
+	if err != nil {
+		return err
+	}
+	err = writeCorrelationID(writer, se.correlationID)
 	if err != nil {
 		return err
 	}
@@ -168,41 +254,46 @@ func (se *StdException) LogNoStack(writer io.Writer) error {
 	if err != nil {
 		return err
 	}
-	_, err = writer.Write([]byte(se.message))
-	return err
+	_, err = writer.Write([]byte(sanitizeText(se.message, true)))
+	if err != nil {
+		return err
+	}
+	err = writeDuration(writer, se.duration)
+	if err != nil {
+		return err
+	}
+	return writeFields(writer, se.fields)
 }
 
 /*
 LogAsJson packages up the exception's info into json and writes it to writer.
 
-The json is formatted like this
+The json is wrapped in the envelope of CurrentJsonSchema (see JsonSchema). With JsonSchemaV7 it is formatted like this
 	{
-	   "Message":"I'm informative!",
-	   "StackTrace":[
-		  {
-			 "FunctionName":"github.com/Nick-Anderssohn/sherlog.TestLogJson",
-			 "File":"/home/nick/go/src/github.com/Nick-Anderssohn/sherlog/scratch_test.go",
-			 "Line":68
-		  },
-		  {
-			 "FunctionName":"testing.tRunner",
-			 "File":"/usr/local/go/src/testing/testing.go",
-			 "Line":777
-		  },
-		  {
-			 "FunctionName":"runtime.goexit",
-			 "File":"/usr/local/go/src/runtime/asm_amd64.s",
-			 "Line":2361
-		  }
-	   ],
-	   "StackTraceStr":"\tgithub.com/Nick-Anderssohn/sherlog.TestLogJson(/home/nick/go/src/github.com/Nick-Anderssohn/sherlog/scratch_test.go:68)\n\ttesting.tRunner(/usr/local/go/src/testing/testing.go:777)\n\truntime.goexit(/usr/local/go/src/runtime/asm_amd64.s:2361)\n",
-	   "Time":"2018-10-03 07:51:14"
+	   "sherlog":"7",
+	   "entry":{
+		  "Message":"I'm informative!",
+		  "StackTrace":[
+			 {
+				"FunctionName":"github.com/Nick-Anderssohn/sherlog.TestLogJson",
+				"File":"/home/nick/go/src/github.com/Nick-Anderssohn/sherlog/scratch_test.go",
+				"Line":68
+			 },
+			 {
+				"FunctionName":"testing.tRunner",
+				"File":"/usr/local/go/src/testing/testing.go",
+				"Line":777
+			 }
+		  ],
+		  "StackTraceStr":"\tgithub.com/Nick-Anderssohn/sherlog.TestLogJson(/home/nick/go/src/github.com/Nick-Anderssohn/sherlog/scratch_test.go:68)\n\ttesting.tRunner(/usr/local/go/src/testing/testing.go:777)",
+		  "Time":"2018-10-03 07:51:14"
+	   }
 	}
 
 Returns an error if there was one.
 */
 func (se *StdException) LogAsJson(writer io.Writer) error {
-	jsonBytes, err := se.ToJsonBytes()
+	jsonBytes, err := marshalJsonEntry(se.ToJsonMap(), false)
 	if err != nil {
 		return err
 	}
@@ -288,12 +379,88 @@ ToJsonMap creates a map[string]interface{} that, when compiled to json, looks li
 	}
 */
 func (se *StdException) ToJsonMap() map[string]interface{} {
-	return map[string]interface{}{
+	jsonMap := map[string]interface{}{
 		"Time":          se.timestamp.Format(timeFmt),
 		"Message":       se.message,
 		"StackTrace":    se.stackTrace,
 		"StackTraceStr": se.GetStackTraceAsString(),
 	}
+	if sequence := se.sequenceNumber(); sequence != 0 {
+		jsonMap["Sequence"] = sequence
+	}
+	if se.correlationID != "" {
+		jsonMap["CorrelationID"] = se.correlationID
+	}
+	if len(se.fields) > 0 {
+		jsonMap["Fields"] = sanitizeFields(se.fields)
+	}
+	if se.duration != 0 {
+		jsonMap["DurationMs"] = durationMillis(se.duration)
+	}
+	if len(se.messageChain) > 0 {
+		jsonMap["MessageChain"] = append([]string(nil), limitMessageChain(se.messageChain)...)
+	}
+	if IncludeInternalMessage && se.NonLoggedMsg != "" {
+		jsonMap["InternalMessage"] = se.NonLoggedMsg
+	}
+	if detail := ErrorDetail(se.cause); detail != "" {
+		jsonMap["Detail"] = detail
+	}
+	return jsonMap
+}
+
+/*
+GetCorrelationID returns the correlation ID set with SetCorrelationID, WithCorrelationID, or WithContext.
+*/
+func (se *StdException) GetCorrelationID() string {
+	return se.correlationID
+}
+
+/*
+SetCorrelationID sets the correlation ID that gets logged with the exception.
+*/
+func (se *StdException) SetCorrelationID(id string) {
+	se.correlationID = id
+}
+
+/*
+GetFields returns a copy of the fields attached with SetField, WithField, or WithFields.
+Returns nil if there are none.
+*/
+func (se *StdException) GetFields() map[string]interface{} {
+	return copyFields(se.fields)
+}
+
+/*
+SetField attaches key and value to the exception. Setting a key that already exists replaces its value.
+*/
+func (se *StdException) SetField(key string, value interface{}) {
+	if se.fields == nil {
+		se.fields = map[string]interface{}{}
+	}
+	se.fields[key] = value
+}
+
+/*
+GetDuration returns the duration set with SetDuration or WithDuration. Returns 0 if there is none.
+*/
+func (se *StdException) GetDuration() time.Duration {
+	return se.duration
+}
+
+/*
+SetDuration sets how long the operation the exception is about took.
+*/
+func (se *StdException) SetDuration(duration time.Duration) {
+	se.duration = duration
+}
+
+/*
+GetSequenceNumber returns the sequence number stamped on the exception when it was first logged.
+Returns 0 if it hasn't been logged yet or if sequence numbers weren't being stamped (see SetStampSequenceNumbers).
+*/
+func (se *StdException) GetSequenceNumber() uint64 {
+	return se.sequenceNumber()
 }
 
 func (se *StdException) GetMessage() string {
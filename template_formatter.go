@@ -0,0 +1,76 @@
+package sherlog
+
+import (
+	"bytes"
+	"text/template"
+	"time"
+)
+
+/*
+DefaultTextTemplate reproduces the layout that LeveledException.Log writes.
+*/
+const DefaultTextTemplate = "{{.Time}} - {{.Level}} - {{.Message}}:\n{{.StackStr}}"
+
+/*
+TemplateData is what a TemplateFormatter's template gets executed with.
+*/
+type TemplateData struct {
+	Time          string    // Formatted as yyyy-mm-dd hh:mm:ss
+	Timestamp     time.Time // Use this to format the time yourself: {{.Timestamp.Format "15:04:05"}}
+	Level         string    // The level's label. Empty if the entry does not have a level.
+	Message       string
+	Stack         []*StackTraceEntry // File paths are trimmed if TrimBuildPaths is on
+	StackStr      string             // The stack trace formatted like GetStackTraceAsString
+	MessageChain  []string
+	CorrelationID string
+	Sequence      uint64
+	Entry         *Entry
+}
+
+/*
+TemplateFormatter is a Formatter driven by a text/template, so that you can match an existing log layout
+without writing Go code. For example:
+
+	formatter, err := sherlog.NewTemplateFormatter(
+		"{{.Time}} [{{.Level}}] {{.Message}}{{range .Stack}}\n    at {{.FunctionName}} ({{.File}}:{{.Line}}){{end}}")
+
+See TemplateData for everything that is available to the template.
+*/
+type TemplateFormatter struct {
+	template *template.Template
+}
+
+/*
+NewTemplateFormatter parses text and returns a TemplateFormatter that uses it. Returns an error if text
+is not a valid template.
+*/
+func NewTemplateFormatter(text string) (*TemplateFormatter, error) {
+	tmpl, err := template.New("sherlog").Parse(text)
+	if err != nil {
+		return nil, AsError(err)
+	}
+	return &TemplateFormatter{template: tmpl}, nil
+}
+
+/*
+Format executes the template with the entry's TemplateData.
+*/
+func (tf *TemplateFormatter) Format(entry *Entry) ([]byte, error) {
+	var buf bytes.Buffer
+	err := tf.template.Execute(&buf, &TemplateData{
+		Time:          entry.FormattedTime(),
+		Timestamp:     entry.Time,
+		Level:         entry.LevelLabel(),
+		Message:       sanitizeText(entry.Message, true),
+		Stack:         renderedStackTrace(entry.StackTrace),
+		StackStr:      entry.StackTraceAsString(),
+		MessageChain:  entry.MessageChain,
+		CorrelationID: entry.CorrelationID,
+		Sequence:      entry.Sequence,
+		Entry:         entry,
+	})
+	if err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
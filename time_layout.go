@@ -0,0 +1,64 @@
+package sherlog
+
+import (
+	"io"
+	"time"
+)
+
+const (
+	// TimeLayoutDefault is the layout timestamps are written in unless a logger is told otherwise. It has no zone,
+	// so the timestamp is in Location.
+	TimeLayoutDefault = timeFmt
+
+	// TimeLayoutWithOffset is TimeLayoutDefault followed by the zone offset, such as 2018-10-03 07:51:14 -0700.
+	TimeLayoutWithOffset = "2006-01-02 15:04:05 -0700"
+
+	// TimeLayoutRFC3339 writes timestamps as RFC3339, such as 2018-10-03T07:51:14-07:00.
+	TimeLayoutRFC3339 = time.RFC3339
+)
+
+/*
+timeLayoutWriter lets a logger tell the Log functions of exceptions which layout to write timestamps in.
+*/
+type timeLayoutWriter struct {
+	io.Writer
+	layout string
+}
+
+/*
+timeLayoutOf returns the layout timestamps written to writer should use.
+*/
+func timeLayoutOf(writer io.Writer) string {
+	if layoutWriter, ok := writer.(*timeLayoutWriter); ok {
+		return layoutWriter.layout
+	}
+	return timeFmt
+}
+
+func layoutOrDefault(layout string) string {
+	if layout == "" {
+		return timeFmt
+	}
+	return layout
+}
+
+/*
+SetTimeLayout sets the layout (see time.Time.Format) that the logger writes timestamps in, in both text and json
+output. Use TimeLayoutWithOffset or TimeLayoutRFC3339 so that entries from services that are configured with
+different Locations can't be mistaken for one another. Formatters get the layout as Entry.TimeLayout.
+Pass an empty string to go back to TimeLayoutDefault. Messages added with PrependMsg keep the layout they were
+created with.
+*/
+func (l *FileLogger) SetTimeLayout(layout string) {
+	l.timeLayout = layout
+}
+
+/*
+writer returns what Log functions should write to.
+*/
+func (l *FileLogger) writer() io.Writer {
+	if l.timeLayout == "" {
+		return l.file
+	}
+	return &timeLayoutWriter{Writer: l.file, layout: l.timeLayout}
+}